@@ -0,0 +1,5 @@
+// Package monitorpb contains the gRPC service definition for attaching to a
+// running mqtt-monitor. Regenerate with protoc, protoc-gen-go and protoc-gen-go-grpc.
+package monitorpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative monitor.proto
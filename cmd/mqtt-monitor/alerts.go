@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/alerts"
+)
+
+// startAlerts runs the alert rules when any are configured. The returned function
+// waits for pending notifications after ctx is cancelled.
+func startAlerts(config *Config, state *monitor.State, notify func(error), ctx context.Context) func() {
+	if len(config.Alert.Rules) == 0 {
+		return func() {}
+	}
+
+	logger := log.With().Str("component", "alerts").Logger()
+	manager, err := alerts.NewManager(config.Alert, notify, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to start alerting")
+		return func() {}
+	}
+
+	messages, unsubscribe := state.Subscribe(sinkQueueSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer unsubscribe()
+		manager.Run(ctx, messages)
+	}()
+	return func() { <-done }
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+const (
+	defaultAPIMessageLimit = 100
+	defaultAPITopTopics    = 20
+)
+
+// APIConfig configures the embedded HTTP API
+type APIConfig struct {
+	Listen         string   `toml:"listen"`          // Address to serve the API on, e.g. "127.0.0.1:8080" (disabled when empty)
+	AllowedOrigins []string `toml:"allowed_origins"` // Browser origins allowed to open /stream besides the API's own, "*" for any
+	GRPCListen     string   `toml:"grpc_listen"`     // Address to serve the gRPC Monitor service on, e.g. "127.0.0.1:9090"
+	WebUI          bool     `toml:"web_ui"`          // Serve a browser view of the message stream at / on the API address
+}
+
+// APIServer exposes a running monitor's status, recent messages and statistics over HTTP
+type APIServer struct {
+	server   *http.Server
+	mux      *http.ServeMux
+	listener net.Listener
+	state    *monitor.State
+	logger   zerolog.Logger
+
+	allowedOrigins []string
+}
+
+func NewAPIServer(config APIConfig, state *monitor.State, logger zerolog.Logger) (*APIServer, error) {
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", config.Listen, err)
+	}
+
+	s := &APIServer{
+		mux:            http.NewServeMux(),
+		listener:       listener,
+		state:          state,
+		logger:         logger,
+		allowedOrigins: config.AllowedOrigins,
+	}
+
+	s.mux.HandleFunc("GET /api/status", s.handleStatus)
+	s.mux.HandleFunc("GET /api/messages", s.handleMessages)
+	s.mux.HandleFunc("GET /api/stats", s.handleStats)
+	s.mux.HandleFunc("GET /api/last", s.handleLast)
+	s.mux.HandleFunc("GET /api/coverage", s.handleCoverage)
+	s.mux.HandleFunc("GET /api/sequences", s.handleSequences)
+	s.mux.HandleFunc("GET /stream", s.handleStream)
+	s.server = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Mux returns the router so other endpoints can be mounted next to the API
+func (s *APIServer) Mux() *http.ServeMux {
+	return s.mux
+}
+
+// Addr returns the address the API is listening on
+func (s *APIServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Start serves requests until ctx is cancelled
+func (s *APIServer) Start(ctx context.Context) {
+	go func() {
+		if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error().Err(err).Msg("API server stopped")
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		s.server.Shutdown(shutdownCtx)
+	}()
+}
+
+type statusResponse struct {
+	StartTime   time.Time                  `json:"start_time"`
+	Uptime      string                     `json:"uptime"`
+	Messages    uint64                     `json:"messages"`
+	Errors      uint64                     `json:"errors"`
+	Drops       map[string]uint64          `json:"drops"` // Messages and events lost by drop point, summed over the connections
+	Connections []monitor.ConnectionStatus `json:"connections"`
+}
+
+func (s *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	stats := s.state.Stats(0)
+	writeJSON(w, http.StatusOK, statusResponse{
+		StartTime:   stats.StartTime,
+		Uptime:      stats.Uptime,
+		Messages:    stats.Messages,
+		Errors:      stats.Errors,
+		Drops:       s.state.Drops(),
+		Connections: s.state.Connections(),
+	})
+}
+
+// handleMessages returns buffered messages, filtered by the topic, source, q,
+// since and limit query parameters
+func (s *APIServer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	query, err := parseMessageQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	messages := s.state.Messages(query)
+	records := make([]sessionlog.Record, 0, len(messages))
+	for _, msg := range messages {
+		records = append(records, sessionlogger.NewMessageRecord(msg))
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// handleLast returns the last message of every topic matching the topic query
+// parameter, a topic filter, or of every kept topic without it
+func (s *APIServer) handleLast(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("topic")
+	if filter != "" {
+		if err := mqtt.ValidateTopicFilter(filter); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	messages := s.state.LastValues(filter)
+	records := make([]sessionlog.Record, 0, len(messages))
+	for _, msg := range messages {
+		records = append(records, sessionlogger.NewMessageRecord(msg))
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (s *APIServer) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.state.Coverage())
+}
+
+func (s *APIServer) handleSequences(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.state.Sequences())
+}
+
+func (s *APIServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	top := defaultAPITopTopics
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid top %q", v)})
+			return
+		}
+		top = n
+	}
+	writeJSON(w, http.StatusOK, s.state.Stats(top))
+}
+
+// parseMessageQuery reads message filters from the request's query string.
+// since accepts an RFC 3339 timestamp or a duration relative to now, e.g. "5m".
+func parseMessageQuery(r *http.Request) (monitor.MessageQuery, error) {
+	values := r.URL.Query()
+	query := monitor.MessageQuery{
+		Topic:  values.Get("topic"),
+		Source: values.Get("source"),
+		Text:   values.Get("q"),
+		Limit:  defaultAPIMessageLimit,
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return query, fmt.Errorf("invalid limit %q", v)
+		}
+		query.Limit = limit
+	}
+
+	if v := values.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			query.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			query.Since = t
+		} else {
+			return query, fmt.Errorf("invalid since %q (expected RFC 3339 time or duration)", v)
+		}
+	}
+
+	return query, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
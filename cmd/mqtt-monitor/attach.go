@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	AttachBacklog        = 1000 // Buffered messages fetched from the collector when (re)attaching
+	AttachRetryMin       = time.Second
+	AttachRetryMax       = 30 * time.Second
+	AttachStatusInterval = 5 * time.Second
+
+	// attachReadTimeout declares the stream dead when neither a message nor a
+	// ping arrived for two ping intervals of the collector
+	attachReadTimeout = 2 * streamPingInterval
+)
+
+// Attacher feeds the TUI from the HTTP API of a collector, a monitor running with
+// -no-tui and [api] listen, instead of connecting to brokers. Each viewer gets the
+// collector's buffered messages followed by the live /stream, and reconnects when
+// the collector goes away, so the capture outlives any terminal.
+type Attacher struct {
+	baseURL    *url.URL
+	client     *http.Client
+	messagesCh chan<- monitor.Message
+	errorsCh   chan<- error
+	*recordConverter
+
+	last     time.Time // Timestamp of the newest message passed on, to skip duplicates on reconnect
+	statuses map[string]string
+
+	mu       sync.Mutex
+	state    AttachState
+	onChange func(AttachState)
+}
+
+// AttachState describes the collector for display
+type AttachState struct {
+	Address     string
+	Attached    bool
+	Connections []monitor.ConnectionStatus
+}
+
+// NewAttacher accepts the collector's API address as "host:port" or an http(s) URL
+func NewAttacher(address string, messagesCh chan<- monitor.Message, errorsCh chan<- error, topicDepth int) (*Attacher, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	baseURL, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attach address: %w", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid attach address: unsupported scheme %q", baseURL.Scheme)
+	}
+	if baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid attach address %q: missing host", address)
+	}
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
+
+	return &Attacher{
+		baseURL:         baseURL,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		messagesCh:      messagesCh,
+		errorsCh:        errorsCh,
+		recordConverter: newRecordConverter(topicDepth),
+		statuses:        make(map[string]string),
+		state:           AttachState{Address: baseURL.Host},
+	}, nil
+}
+
+// SetStateHandler registers a callback invoked whenever the collector state changes
+func (a *Attacher) SetStateHandler(fn func(AttachState)) {
+	a.onChange = fn
+}
+
+// State returns a snapshot of the collector state
+func (a *Attacher) State() AttachState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
+}
+
+// Address returns the collector's API address
+func (a *Attacher) Address() string {
+	return a.baseURL.Host
+}
+
+// Run follows the collector until ctx is cancelled
+func (a *Attacher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.pollStatus(ctx)
+	}()
+	defer wg.Wait()
+
+	retry := AttachRetryMin
+	for {
+		attached, err := a.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		a.update(func(state *AttachState) { state.Attached = false })
+		if attached {
+			retry = AttachRetryMin
+		}
+		a.event(ctx, fmt.Errorf("attach: lost %s: %v, retrying in %s", a.Address(), err, retry))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, AttachRetryMax)
+	}
+}
+
+// follow opens the stream, catches up on the buffered messages and then passes on
+// live messages until the stream fails. It reports whether the stream was opened.
+func (a *Attacher) follow(ctx context.Context) (bool, error) {
+	streamURL := *a.baseURL
+	streamURL.Scheme = strings.Replace(streamURL.Scheme, "http", "ws", 1)
+	streamURL.Path += "/stream"
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, streamURL.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetReadDeadline(time.Now().Add(attachReadTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(attachReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(streamWriteTimeout))
+	})
+
+	// The stream is already open, so nothing received in between is lost. The
+	// overlap, and on reconnect the messages shown before, are skipped by timestamp.
+	backlog, err := a.fetchBacklog(ctx)
+	if err != nil {
+		return true, err
+	}
+	for _, record := range backlog {
+		if record.Timestamp.After(a.last) {
+			a.emit(ctx, record)
+		}
+	}
+	caughtUp := a.last
+	a.event(ctx, fmt.Errorf("attach: following %s", a.Address()))
+	a.update(func(state *AttachState) { state.Attached = true })
+
+	for {
+		var record sessionlog.Record
+		if err := conn.ReadJSON(&record); err != nil {
+			return true, err
+		}
+		conn.SetReadDeadline(time.Now().Add(attachReadTimeout))
+		if record.Timestamp.After(caughtUp) {
+			a.emit(ctx, record)
+		}
+	}
+}
+
+// fetchBacklog returns the collector's buffered messages newer than the last one
+// passed on
+func (a *Attacher) fetchBacklog(ctx context.Context) ([]sessionlog.Record, error) {
+	query := url.Values{"limit": {strconv.Itoa(AttachBacklog)}}
+	if !a.last.IsZero() {
+		query.Set("since", a.last.Format(time.RFC3339Nano))
+	}
+	var records []sessionlog.Record
+	if err := a.get(ctx, "/api/messages?"+query.Encode(), &records); err != nil {
+		return nil, fmt.Errorf("failed to fetch buffered messages: %w", err)
+	}
+	return records, nil
+}
+
+// pollStatus mirrors the collector's connection state into the title and reports
+// connection changes as events
+func (a *Attacher) pollStatus(ctx context.Context) {
+	ticker := time.NewTicker(AttachStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		var status statusResponse
+		if err := a.get(ctx, "/api/status", &status); err == nil {
+			for _, c := range status.Connections {
+				if previous, ok := a.statuses[c.Name]; ok && previous != c.LastEvent {
+					a.event(ctx, fmt.Errorf("collector: %s: %s", c.Name, c.LastEvent))
+				}
+				a.statuses[c.Name] = c.LastEvent
+			}
+			a.update(func(state *AttachState) { state.Connections = status.Connections })
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Attacher) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL.String()+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// emit passes a message record on to the pipeline
+func (a *Attacher) emit(ctx context.Context, record sessionlog.Record) {
+	if record.Type != sessionlog.TypeMessage {
+		return
+	}
+	if record.Timestamp.After(a.last) {
+		a.last = record.Timestamp
+	}
+
+	select {
+	case a.messagesCh <- a.toMessage(record):
+	case <-ctx.Done():
+	}
+}
+
+func (a *Attacher) event(ctx context.Context, err error) {
+	select {
+	case a.errorsCh <- err:
+	case <-ctx.Done():
+	default:
+	}
+}
+
+func (a *Attacher) update(fn func(*AttachState)) {
+	a.mu.Lock()
+	fn(&a.state)
+	state := a.state
+	a.mu.Unlock()
+
+	if a.onChange != nil {
+		a.onChange(state)
+	}
+}
+
+// FormatAttachTitle renders the collector state for the messages view title
+func FormatAttachTitle(state AttachState) string {
+	if !state.Attached {
+		return fmt.Sprintf(" Messages - Attaching to %s ", state.Address)
+	}
+	if state.Connections == nil {
+		return fmt.Sprintf(" Messages - Attached to %s ", state.Address)
+	}
+	up := 0
+	for _, c := range state.Connections {
+		if c.Connected {
+			up++
+		}
+	}
+	return fmt.Sprintf(" Messages - Attached to %s [%d/%d connections up] ", state.Address, up, len(state.Connections))
+}
+
+// runAttach shows the messages captured by a collector in the TUI
+func runAttach(config *Config, address string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ui := newUI(config)
+	m := monitor.New(monitor.Options{BufferSize: MaxDisplayedMessages})
+	messagesCh, errorsCh := m.Feed()
+
+	attacher, err := NewAttacher(address, messagesCh, errorsCh, config.Display.TopicDepth)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to attach")
+	}
+	attacher.SetStateHandler(func(state AttachState) {
+		ui.SetMessagesTitle(FormatAttachTitle(state))
+	})
+	ui.SetMessagesTitle(FormatAttachTitle(attacher.State()))
+
+	sigCh := setupSignalHandler()
+	uiDone := startUI(ui, ctx)
+
+	attachDone := make(chan struct{})
+	go func() {
+		defer close(attachDone)
+		attacher.Run(ctx)
+	}()
+	m.AddHandler(newViewHandler(ui, m.State(), nil, nil))
+	monitorDone := runPipeline(m, ctx)
+
+	reason := waitForShutdownSignal(sigCh, uiDone)
+
+	cancel()
+	<-attachDone
+	performGracefulShutdown(cancel, ui, monitorDone, reason)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	benchDrainTimeout = 5 * time.Second // Wait for queued messages after the generator stops
+	benchBatch        = 64              // Messages sent at once without a rate
+)
+
+// Bench outputs: the TUI's formatting, or a headless output format
+const benchOutputUI = "ui"
+
+// BenchOptions configures a run of the bench command
+type BenchOptions struct {
+	Rate             float64       // Messages per second, 0 for as fast as possible
+	Duration         time.Duration // How long to generate messages
+	Connections      int           // Simulated connections the messages are spread over
+	Topics           int           // Distinct topics
+	PayloadSize      int           // Payload bytes per message
+	DistinctPayloads int           // Distinct payloads cycled through, 0 for a unique payload per message
+	Output           string        // "ui", OutputJSON or OutputPlain
+}
+
+// benchView is the view the bench pipeline ends in: the TUI's message store and
+// formatting without a terminal, or a headless output writing to io.Discard
+type benchView struct {
+	ui       *UI
+	headless *HeadlessOutput
+	alerts   atomic.Uint64 // Alert notifications and other events
+}
+
+func (v *benchView) AddMessage(msg monitor.Message) {
+	if v.headless != nil {
+		v.headless.AddMessage(msg)
+		return
+	}
+	v.ui.AddMessage(msg)
+	v.ui.formatMessageForDisplay(msg) // What the flush does on the UI goroutine
+}
+
+func (v *benchView) AddConnectionEvent(monitor.ConnectionEvent) {
+	v.alerts.Add(1)
+}
+
+func (v *benchView) AddError(err error) {
+	if err != nil {
+		v.alerts.Add(1)
+	}
+}
+
+// UpdateStatus is a no-op; the TUI's status bar is drawn on its own goroutine
+func (v *benchView) UpdateStatus(string) {}
+
+// benchResult is what a bench run measured
+type benchResult struct {
+	Elapsed    time.Duration
+	Sent       uint64
+	Processed  uint64
+	Dropped    uint64 // Messages the connections dropped because decoding or the handler fell behind
+	Missed     uint64 // Messages and events that alert rules missed
+	Events     uint64
+	Mallocs    uint64
+	AllocBytes uint64
+	GCCycles   uint32
+	GCPause    time.Duration
+	HeapInUse  uint64
+}
+
+// runBench implements the "bench" subcommand: synthetic messages through the
+// decode workers, the message handler, alert rules and the TUI formatting or a
+// headless output, without a broker
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var opts BenchOptions
+	fs.Float64Var(&opts.Rate, "rate", 0, "Messages per second; messages the pipeline cannot keep up with are dropped (default: as fast as it takes them)")
+	fs.DurationVar(&opts.Duration, "duration", 10*time.Second, "How long to generate messages")
+	fs.IntVar(&opts.Connections, "connections", 1, "Simulated connections the messages are spread over")
+	fs.IntVar(&opts.Topics, "topics", 100, "Number of distinct topics")
+	fs.IntVar(&opts.PayloadSize, "payload-size", 128, "Payload size in bytes")
+	fs.IntVar(&opts.DistinctPayloads, "distinct-payloads", 0, "Cycle through this many payloads, e.g. to measure repeated heartbeats (default: every payload unique)")
+	fs.StringVar(&opts.Output, "output", benchOutputUI, "Where messages end: ui (the TUI's formatting without a terminal), json or plain (headless output to nowhere)")
+	configFile := fs.String("config", "", "Config file whose [display] settings and [alert] rules are used; notification targets are ignored")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s bench [flags]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Drives the message pipeline with synthetic messages and reports throughput, drops and allocations")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if opts.Rate < 0 || opts.Duration <= 0 || opts.Connections < 1 || opts.Topics < 1 || opts.PayloadSize < 1 || opts.DistinctPayloads < 0 {
+		return fmt.Errorf("-rate must not be negative, and -duration, -connections, -topics and -payload-size must be positive")
+	}
+
+	config := DefaultConfig()
+	if *configFile != "" {
+		var err error
+		if config, err = LoadConfig(*configFile); err != nil {
+			return err
+		}
+	}
+	// Rules are evaluated, but a bench must not page anyone
+	config.Alert.Slack, config.Alert.Matrix, config.Alert.Telegram, config.Alert.Email = nil, nil, nil, nil
+
+	view := &benchView{}
+	switch opts.Output {
+	case benchOutputUI:
+		view.ui = NewUI(config.Display.Truncate)
+		view.ui.SetMemoryLimit(config.Display.memoryLimit)
+	case OutputJSON, OutputPlain:
+		view.headless, _ = NewHeadlessOutput(opts.Output, io.Discard, io.Discard)
+	default:
+		return fmt.Errorf("invalid -output %q (expected %q, %q or %q)", opts.Output, benchOutputUI, OutputJSON, OutputPlain)
+	}
+
+	fmt.Printf("Benchmarking %s for %s: %s, %d connections, %d topics, %d byte payloads, output %s\n",
+		os.Args[0], opts.Duration, benchRate(opts.Rate), opts.Connections, opts.Topics, opts.PayloadSize, opts.Output)
+	result := benchPipeline(config, opts, view)
+	printBenchResult(os.Stdout, result)
+	return nil
+}
+
+// benchPipeline generates messages for opts.Duration, waits for the pipeline to
+// drain and returns the measurements
+func benchPipeline(config *Config, opts BenchOptions, view *benchView) benchResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var connections []monitor.ConnectionConfig
+	for i := range opts.Connections {
+		connections = append(connections, monitor.ConnectionConfig{Name: "bench-" + strconv.Itoa(i+1), Server: "tcp://bench.invalid:1883"})
+	}
+	m := monitor.New(monitor.Options{
+		Connections: connections,
+		TopicDepth:  config.Display.TopicDepth,
+		BufferSize:  MaxDisplayedMessages,
+		Colors:      connectionColors,
+		Offline:     true,
+	})
+	clients, state := m.Clients(), m.State()
+	state.SetMemoryLimit(config.Display.memoryLimit)
+	waitAlerts := startAlerts(config, state, func(err error) { view.AddError(err) }, ctx)
+	m.AddHandler(newViewHandler(view, state, nil, nil))
+	monitorDone := runPipeline(m, ctx)
+	m.Alive(ctx) // The clients are set up for Run once it answers
+
+	topics := make([]string, opts.Topics)
+	for i := range topics {
+		topics[i] = fmt.Sprintf("bench/device%d/value", i)
+	}
+	payloads := make([][]byte, opts.DistinctPayloads)
+	for i := range payloads {
+		payloads[i] = benchPayload(uint64(i), opts.PayloadSize)
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	var sent uint64
+	deadline := start.Add(opts.Duration)
+	for now := start; now.Before(deadline); now = time.Now() {
+		// Without a rate, a batch is sent whenever the pipeline has room for it, so
+		// nothing is dropped; with one, the count due by now
+		due := sent + benchBatch
+		if queues := m.Queues(); opts.Rate == 0 && (queues.Decode > monitor.DefaultDecodeQueue/2 || queues.Messages > queues.MessagesSize/2) {
+			runtime.Gosched()
+			continue
+		}
+		if opts.Rate > 0 {
+			due = uint64(now.Sub(start).Seconds() * opts.Rate)
+			if due <= sent {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+		}
+		for ; sent < due; sent++ {
+			// A new payload per message stands in for the buffer the MQTT client allocates
+			var payload []byte
+			if len(payloads) > 0 {
+				payload = payloads[sent%uint64(len(payloads))]
+			} else {
+				payload = benchPayload(sent, opts.PayloadSize)
+			}
+			clients[sent%uint64(len(clients))].Receive(mqtt.Message{
+				Topic:     topics[sent%uint64(len(topics))],
+				Payload:   payload,
+				Timestamp: time.Now(),
+			})
+		}
+	}
+
+	// Let the queued messages through before measuring
+	var dropped uint64
+	for drain := time.Now(); time.Since(drain) < benchDrainTimeout; time.Sleep(time.Millisecond) {
+		dropped = 0
+		for _, client := range clients {
+			dropped += client.Status().Dropped
+		}
+		if state.Stats(0).Messages+dropped >= sent && m.Queues().Messages == 0 {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	cancel()
+	<-monitorDone
+	waitAlerts()
+
+	return benchResult{
+		Elapsed:    elapsed,
+		Sent:       sent,
+		Processed:  state.Stats(0).Messages,
+		Dropped:    dropped,
+		Missed:     state.Dropped(),
+		Events:     view.alerts.Load(),
+		Mallocs:    after.Mallocs - before.Mallocs,
+		AllocBytes: after.TotalAlloc - before.TotalAlloc,
+		GCCycles:   after.NumGC - before.NumGC,
+		GCPause:    time.Duration(after.PauseTotalNs - before.PauseTotalNs),
+		HeapInUse:  after.HeapInuse,
+	}
+}
+
+// benchPayload returns a JSON payload of size bytes numbered n
+func benchPayload(n uint64, size int) []byte {
+	payload := fmt.Appendf(make([]byte, 0, size), `{"seq":%d,"value":%d.5,"pad":"`, n, n%100)
+	for len(payload) < size-2 {
+		payload = append(payload, 'x')
+	}
+	return append(payload, `"}`...)
+}
+
+func benchRate(rate float64) string {
+	if rate == 0 {
+		return "unlimited rate"
+	}
+	return fmt.Sprintf("%.0f msg/s", rate)
+}
+
+func printBenchResult(w io.Writer, r benchResult) {
+	perMessage := func(total uint64) float64 {
+		if r.Processed == 0 {
+			return 0
+		}
+		return float64(total) / float64(r.Processed)
+	}
+	percent := func(part uint64) float64 {
+		if r.Sent == 0 {
+			return 0
+		}
+		return 100 * float64(part) / float64(r.Sent)
+	}
+
+	fmt.Fprintf(w, "Sent:        %d in %s\n", r.Sent, r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Processed:   %d (%.0f msg/s)\n", r.Processed, float64(r.Processed)/r.Elapsed.Seconds())
+	fmt.Fprintf(w, "Dropped:     %d (%.2f%%) by the connections, %d missed by alert rules\n", r.Dropped, percent(r.Dropped), r.Missed)
+	fmt.Fprintf(w, "Events:      %d\n", r.Events)
+	fmt.Fprintf(w, "Allocations: %.1f per message, %.0f bytes per message\n", perMessage(r.Mallocs), perMessage(r.AllocBytes))
+	fmt.Fprintf(w, "GC:          %d cycles, %s total pause, %.1f MB heap in use\n", r.GCCycles, r.GCPause, float64(r.HeapInUse)/1e6)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// brokerSchemes are the URL schemes the MQTT client can connect with
+var brokerSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "tcps", "ws", "wss"}
+
+// configCheck collects the results of checking a config file
+type configCheck struct {
+	failed, warned int
+}
+
+func (c *configCheck) report(subject string, err error) {
+	if err != nil {
+		fmt.Printf("FAIL %s: %v\n", subject, err)
+		c.failed++
+		return
+	}
+	fmt.Printf("OK   %s\n", subject)
+}
+
+func (c *configCheck) warn(subject, message string) {
+	fmt.Printf("WARN %s: %s\n", subject, message)
+	c.warned++
+}
+
+// runCheck validates a config file in depth without connecting to any broker:
+// everything LoadConfig checks, plus broker URLs, topic filters and loading the
+// TLS certificates and keyring passwords of every connection, including those of profiles
+func runCheck(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s check [config.toml]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one config file")
+	}
+	path := findConfigFile()
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		fmt.Printf("FAIL %s: %v\n", path, err)
+		return fmt.Errorf("%s is invalid", path)
+	}
+	fmt.Printf("OK   %s\n", path)
+
+	var check configCheck
+	files, _ := includedFiles(path, config.Include) // Already loaded by LoadConfig
+	for _, file := range files {
+		check.report("include "+file, nil)
+	}
+	// Theme and keymap files were loaded by LoadConfig too
+	for _, name := range slices.Sorted(maps.Keys(config.Display.Themes)) {
+		check.report("theme "+name+" "+config.Display.Themes[name], nil)
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.Display.Keymaps)) {
+		check.report("keymap "+name+" "+config.Display.Keymaps[name], nil)
+	}
+
+	checkConnections(&check, "", config.Connections)
+	for _, name := range config.ProfileNames() {
+		checkConnections(&check, "profile "+name+": ", config.Profiles[name].Connections)
+	}
+	if len(config.Connections) == 0 && len(config.Profiles) == 0 {
+		check.warn("connections", "none configured, only -broker, -replay and -attach can run")
+	}
+
+	checkLogging(&check, config.Logging)
+
+	check.report(fmt.Sprintf("%d alert rules", len(config.Alert.Rules)), nil)
+	check.report(fmt.Sprintf("%d sequence rules", len(config.Sequences)), nil)
+	check.report(fmt.Sprintf("%d sinks", len(config.Sink)), nil)
+
+	fmt.Printf("\n%d failed, %d warnings\n", check.failed, check.warned)
+	if check.failed > 0 {
+		return fmt.Errorf("%s has %d problems", path, check.failed)
+	}
+	return nil
+}
+
+func checkConnections(check *configCheck, prefix string, connections []monitor.ConnectionConfig) {
+	for _, conn := range connections {
+		subject := prefix + "connection " + conn.Name
+		check.report(subject+": server "+conn.Server, checkBrokerURL(conn.Server))
+		for _, topic := range conn.Topics {
+			check.report(subject+": topic "+topic, mqtt.ValidateTopicFilter(topic))
+		}
+
+		if conn.PasswordKeyring != "" && conn.Password == "" {
+			_, err := lookupKeyringPassword(conn.PasswordKeyring)
+			check.report(subject+": keyring "+conn.PasswordKeyring, err)
+		}
+		if conn.PasswordEncrypted != "" && conn.Password == "" {
+			if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+				_, err := decryptPassword(conn.PasswordEncrypted, passphrase)
+				check.report(subject+": encrypted password", err)
+			} else {
+				check.warn(subject+": encrypted password", "not decrypted, "+passphraseEnv+" is not set")
+			}
+		}
+
+		mqttConfig := conn.ToMQTTConfig()
+		if mqttConfig.DisableResubscribe && mqttConfig.CleanSession {
+			check.warn(subject+": resubscribe_on_reconnect", "with a clean session the subscriptions are lost on reconnect (set clean_session = false)")
+		}
+		if mqttConfig.PasswordFunc != nil {
+			_, err := mqttConfig.PasswordFunc()
+			check.report(subject+": fetch password", err)
+		}
+		tlsConfig, err := mqtt.NewTLSConfig(mqttConfig)
+		switch {
+		case err != nil:
+			check.report(subject+": TLS", err)
+		case tlsConfig == nil:
+		case tlsConfig.InsecureSkipVerify:
+			check.warn(subject+": TLS", "certificate verification is disabled")
+		default:
+			check.report(subject+": TLS certificates", nil)
+		}
+	}
+}
+
+// checkBrokerURL checks that a server setting is a URL the client can connect to
+func checkBrokerURL(server string) error {
+	u, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(brokerSchemes, u.Scheme) {
+		return fmt.Errorf("unsupported scheme %q (expected one of %v)", u.Scheme, brokerSchemes)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host")
+	}
+	if u.Port() == "" && u.Scheme != "ws" && u.Scheme != "wss" {
+		port := 1883
+		if slices.Contains([]string{"ssl", "tls", "mqtts", "tcps"}, u.Scheme) {
+			port = 8883
+		}
+		return fmt.Errorf("missing port, e.g. %s://%s:%d", u.Scheme, u.Hostname(), port)
+	}
+	return nil
+}
+
+func checkLogging(check *configCheck, logging Logging) {
+	for _, filter := range slices.Concat(logging.LogTopics, logging.LogExcludeTopics) {
+		check.report("logging: topic filter "+filter, mqtt.ValidateTopicFilter(filter))
+	}
+	if !logging.EnableSessionLog {
+		return
+	}
+
+	_, err := newSessionLoggerConfig(logging, "")
+	check.report("logging: session log settings", err)
+	if info, err := os.Stat(logging.OutputDir); errors.Is(err, fs.ErrNotExist) {
+		check.warn("logging: output_dir "+logging.OutputDir, "does not exist yet and will be created")
+	} else if err != nil {
+		check.report("logging: output_dir "+logging.OutputDir, err)
+	} else if !info.IsDir() {
+		check.report("logging: output_dir "+logging.OutputDir, fmt.Errorf("not a directory"))
+	} else {
+		check.report("logging: output_dir "+logging.OutputDir, nil)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/cli"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// connectionFlags describe a connection given on the command line, for quick
+// monitoring without writing a config file
+type connectionFlags struct {
+	cli.ConnectionFlags
+	topics repeatedFlag
+	qos    uint
+}
+
+// repeatedFlag collects the values of a flag given several times
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// register adds the shared connection flags to flags. With subscribe, the flags
+// of a monitored connection (-topic, -name, -client-id, -qos) are added too.
+func (f *connectionFlags) register(flags *flag.FlagSet, brokerUsage string, subscribe bool) {
+	f.Register(flags, brokerUsage)
+	if !subscribe {
+		return
+	}
+	flags.Var(&f.topics, "topic", "Topic filter to subscribe to with -broker, may be repeated (default: #)")
+	flags.StringVar(&f.Conn.Name, "name", "", "Connection name shown for -broker (default: the broker host)")
+	flags.StringVar(&f.Conn.ClientIDBase, "client-id", "", "Client ID base for -broker (default: mqtt-monitor-<name>)")
+	flags.UintVar(&f.qos, "qos", 1, "Subscription QoS level for -broker (0, 1 or 2)")
+}
+
+// apply replaces the connections of config with the one given on the command line
+func (f *connectionFlags) apply(config *Config) error {
+	if f.qos > 2 {
+		return fmt.Errorf("invalid -qos %d (expected 0, 1 or 2)", f.qos)
+	}
+
+	conn, err := f.Connection()
+	if err != nil {
+		return err
+	}
+	conn.QoS = byte(f.qos)
+	conn.Topics = f.topics
+	if len(conn.Topics) == 0 {
+		conn.Topics = []string{"#"}
+	}
+	if conn.Name == "" {
+		u, err := url.Parse(conn.Server)
+		if err != nil || u.Hostname() == "" {
+			return fmt.Errorf("invalid -broker %q (expected e.g. tcp://localhost:1883)", conn.Server)
+		}
+		conn.Name = u.Hostname()
+	}
+	config.Connections = []monitor.ConnectionConfig{conn}
+	return validateConnections(config.Connections)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+// commandHelp lists the commands of the command prompt
+const commandHelp = "last <topic filter>: the last message of the matching topics\n" +
+	"coverage [topic]: the topics the subscription filters matched, and which filters match topic\n" +
+	"sequences: the messages lost by the topics with a sequence rule\n" +
+	"snapshot [file]: save the messages, filter, search, events and layout, by default to the state directory\n" +
+	"restore [file]: bring back a snapshot"
+
+// promptCommand asks for a command, e.g. "last devices/abc/state", and runs it
+func promptCommand(ui *UI, state *monitor.State) {
+	ui.Prompt(":", "", func(input string) {
+		name, args, _ := strings.Cut(strings.TrimSpace(input), " ")
+		args = strings.TrimSpace(args)
+		switch name {
+		case "":
+		case "last":
+			showLastValues(ui, state, args)
+		case "coverage":
+			showCoverage(ui, state, args)
+		case "sequences":
+			showSequences(ui, state)
+		case "snapshot":
+			ui.AddError(saveSnapshot(ui, args))
+		case "restore":
+			ui.AddError(restoreSnapshot(ui, args))
+		default:
+			ui.ShowPanel("Command", tview.Escape(fmt.Sprintf("unknown command %q\n\n%s", name, commandHelp)))
+		}
+	})
+}
+
+// showLastValues shows the last message of every topic matching filter, also of
+// topics whose messages scrolled out of the buffers
+func showLastValues(ui *UI, state *monitor.State, filter string) {
+	if filter == "" {
+		ui.ShowPanel("Last values", tview.Escape("usage: "+strings.Split(commandHelp, "\n")[0]))
+		return
+	}
+	if err := mqtt.ValidateTopicFilter(filter); err != nil {
+		ui.ShowPanel("Last values", tview.Escape(err.Error()))
+		return
+	}
+
+	messages := state.LastValues(filter)
+	records := make([]sessionlog.Record, 0, len(messages))
+	for _, msg := range messages {
+		records = append(records, sessionlogger.NewMessageRecord(msg))
+	}
+	ui.ShowPanel(fmt.Sprintf("Last values: %s (%d topics)", tview.Escape(filter), len(records)),
+		FormatHistoryResults(records, false))
+}
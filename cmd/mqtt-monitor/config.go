@@ -1,65 +1,262 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
-
-	"github.com/BurntSushi/toml"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/alerts"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
 )
 
 type Config struct {
-	Logging     Logging            `toml:"logging"`
-	Connections []ConnectionConfig `toml:"connection"`
-	Display     DisplayConfig      `toml:"display"`
+	Include     []string                   `toml:"include"` // Files with more connections, sinks, alert rules, sequences and mappings, e.g. ["conf.d/*.toml"]
+	Logging     Logging                    `toml:"logging"`
+	Connections []monitor.ConnectionConfig `toml:"connection"`
+	Display     DisplayConfig              `toml:"display"`
+	Influx      InfluxConfig               `toml:"influx"`
+	API         APIConfig                  `toml:"api"`
+	Sink        SinkConfig                 `toml:"sink"`
+	Status      StatusConfig               `toml:"status"`
+	Control     ControlConfig              `toml:"control"`
+	Telemetry   TelemetryConfig            `toml:"telemetry"`
+	Alert       alerts.Config              `toml:"alert"`
+	Sequences   []monitor.SequenceRule     `toml:"sequence"` // Payload counters checked for lost messages
+	Metrics     MetricsConfig              `toml:"metrics"`
+	Reload      ReloadConfig               `toml:"reload"`
+	Debug       DebugConfig                `toml:"debug"`
+	Profiles    map[string]ProfileConfig   `toml:"profile"`
 }
 
 type Logging struct {
-	Level                 string `toml:"level"`
-	Pretty                bool   `toml:"pretty"`
-	OutputDir             string `toml:"output_dir"`
-	EnableSessionLog      bool   `toml:"enable_session_log"`
-	SessionLogMaxDuration string `toml:"session_log_max_duration"`
+	Level                  string   `toml:"level"`
+	Pretty                 bool     `toml:"pretty"`
+	OutputDir              string   `toml:"output_dir"`
+	EnableSessionLog       bool     `toml:"enable_session_log"`
+	SessionLogMaxDuration  string   `toml:"session_log_max_duration"`
+	LogFormat              string   `toml:"log_format"`                 // Session log format: "text", "jsonl" or "binary"
+	SessionLogMaxSize      string   `toml:"session_log_max_size"`       // Rotate when a file exceeds this size, e.g. "100MB"
+	MaxLogAge              string   `toml:"max_log_age"`                // Delete session logs older than this, e.g. "168h"
+	MaxLogFiles            int      `toml:"max_log_files"`              // Keep at most this many session logs
+	MaxTotalLogSize        string   `toml:"max_total_log_size"`         // Keep session logs below this total size, e.g. "1GB"
+	LogTopics              []string `toml:"log_topics"`                 // Only log messages matching these topic filters (default: all)
+	LogExcludeTopics       []string `toml:"log_exclude_topics"`         // Never log messages matching these topic filters
+	SessionLogFilename     string   `toml:"session_log_filename"`       // Filename template, e.g. "{hostname}_{connection}_{date}_{time}_{seq}"
+	SessionLogAppend       bool     `toml:"session_log_append"`         // Resume the most recent log on restart if it is still within limits
+	SessionLogChecksums    bool     `toml:"session_log_checksums"`      // Write a SHA-256 manifest next to each finished log
+	SessionLogShardByTopic bool     `toml:"session_log_shard_by_topic"` // Write one log per first topic level
+	TailListen             string   `toml:"tail_listen"`                // Stream the session log on "unix:/path.sock" or "tcp:127.0.0.1:7070"
+	SessionLogRotation     string   `toml:"session_log_rotation"`       // "duration" (default), "daily" or "daily_utc"
+	SessionLogSummary      bool     `toml:"session_log_summary"`        // Write per-file statistics next to each finished log
 }
 
 type DisplayConfig struct {
-	TopicDepth int  `toml:"topic_depth"` // Number of topic levels to show from the end
-	Truncate   bool `toml:"truncate"`    // Whether to truncate long messages to fit terminal width
+	TopicDepth     int               `toml:"topic_depth"`     // Number of topic levels to show from the end
+	Truncate       bool              `toml:"truncate"`        // Whether to truncate long messages to fit terminal width
+	PrettyJSON     bool              `toml:"pretty_json"`     // Indent JSON payloads over several lines in the messages view
+	Theme          string            `toml:"theme"`           // Theme at startup: "default", a name of themes or a theme file
+	Keymap         string            `toml:"keymap"`          // Keymap at startup: "default", a name of keymaps or a keymap file
+	Themes         map[string]string `toml:"themes"`          // Theme files by name, relative to the config file
+	Keymaps        map[string]string `toml:"keymaps"`         // Keymap files by name, relative to the config file
+	MemoryLimit    string            `toml:"memory_limit"`    // Cap on the size of the kept messages, e.g. "16MB"; the oldest are dropped beyond it
+	SpoolThreshold string            `toml:"spool_threshold"` // Keep payloads above this size, e.g. "256KB", in a temporary file with a preview in memory
+	SpoolDir       string            `toml:"spool_dir"`       // Directory of the spool files (default: the system's temporary directory)
+	EventLevel     string            `toml:"event_level"`     // Least severity shown in the status view: "info" (default), "warning" or "error"
+
+	themes         map[string]*Theme  // Loaded from Themes
+	keymaps        map[string]*Keymap // Loaded from Keymaps
+	memoryLimit    int64              // Parsed MemoryLimit, 0 for no limit
+	spoolThreshold int64              // Parsed SpoolThreshold, 0 for no spooling
+	eventLevel     monitor.Severity   // Parsed EventLevel
 }
 
-type ConnectionConfig struct {
-	Name                  string   `toml:"name"`
-	Server                string   `toml:"server"`
-	User                  string   `toml:"user,omitempty"`
-	Password              string   `toml:"password,omitempty"`
-	TLSCertFile           string   `toml:"tls_cert_file,omitempty"`
-	TLSKeyFile            string   `toml:"tls_key_file,omitempty"`
-	TLSCAFile             string   `toml:"tls_ca_file,omitempty"`
-	TLSInsecureSkipVerify bool     `toml:"tls_insecure_skip_verify,omitempty"`
-	Topics                []string `toml:"topics"` // Array of topics
-	ClientIDBase          string   `toml:"client_id_base"`
-	QoS                   byte     `toml:"qos,omitempty"` // QoS level (0, 1, or 2)
+// ReloadConfig controls applying changes of the config file at runtime
+type ReloadConfig struct {
+	Watch bool `toml:"watch"` // Reload when the config file changes, in addition to SIGUSR1
 }
 
-func LoadConfig(filename string) (*Config, error) {
+// DefaultConfig returns a configuration with defaults applied and no connections
+func DefaultConfig() *Config {
 	var config Config
-
-	// Set defaults
 	config.Display.TopicDepth = 3 // Default to showing last 3 levels
+	config.Logging.LogFormat = sessionlogger.FormatText
+	config.Logging.SessionLogRotation = sessionlogger.RotationDuration
+	return &config
+}
 
-	_, err := toml.DecodeFile(filename, &config)
-	if err != nil {
+func LoadConfig(filename string) (*Config, error) {
+	config := DefaultConfig()
+
+	if _, err := decodeConfigFile(filename, config); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := mergeIncludes(filename, config); err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	config.Sink.setDefaultNames()
+
+	applyCredentialEnv(config.Connections)
+	if err := validateConnections(config.Connections); err != nil {
+		return nil, err
+	}
+	if err := validateProfiles(config.Profiles); err != nil {
+		return nil, err
+	}
+
+	if err := validateSessionLogSettings(&config.Logging); err != nil {
+		return nil, err
+	}
+
+	if config.Logging.TailListen != "" {
+		if _, _, err := parseListenSpec(config.Logging.TailListen); err != nil {
+			return nil, fmt.Errorf("invalid tail_listen: %w", err)
+		}
+	}
+
+	if err := validateInfluxConfig(config.Influx); err != nil {
+		return nil, err
+	}
+
+	if config.API.Listen != "" {
+		if _, _, err := net.SplitHostPort(config.API.Listen); err != nil {
+			return nil, fmt.Errorf("invalid api listen address: %w", err)
+		}
+	} else if config.API.WebUI {
+		return nil, fmt.Errorf("api web_ui requires api listen")
+	}
+	if config.API.GRPCListen != "" {
+		if _, _, err := net.SplitHostPort(config.API.GRPCListen); err != nil {
+			return nil, fmt.Errorf("invalid api grpc_listen address: %w", err)
+		}
+	}
+
+	if err := validateSinkConfig(config); err != nil {
+		return nil, err
+	}
+	if err := validateStatusConfig(config.Status, config.Connections); err != nil {
+		return nil, err
+	}
+	if err := validateControlConfig(config.Control, config.Connections); err != nil {
+		return nil, err
+	}
+	if err := validateTelemetryConfig(config.Telemetry); err != nil {
+		return nil, err
+	}
+	if err := alerts.Validate(config.Alert); err != nil {
+		return nil, err
+	}
+	for _, rule := range config.Sequences {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateMetricsConfig(config.Metrics); err != nil {
+		return nil, err
+	}
+	if err := validateDebugConfig(config.Debug); err != nil {
+		return nil, err
+	}
+
+	// Validate display configuration
+	if config.Display.TopicDepth < 1 {
+		config.Display.TopicDepth = 3 // Default fallback
+	}
+	if config.Display.MemoryLimit != "" {
+		limit, err := ParseByteSize(config.Display.MemoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory_limit: %w", err)
+		}
+		config.Display.memoryLimit = limit
+	}
+	if config.Display.SpoolThreshold != "" {
+		threshold, err := ParseByteSize(config.Display.SpoolThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spool_threshold: %w", err)
+		}
+		config.Display.spoolThreshold = threshold
+	}
+	if config.Display.EventLevel != "" {
+		level, err := monitor.ParseSeverity(config.Display.EventLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event_level: %w", err)
+		}
+		config.Display.eventLevel = level
+	}
+	if err := loadDisplayFiles(filename, &config.Display); err != nil {
+		return nil, err
+	}
+	if err := validateProfileStyles(config.Profiles, &config.Display); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// validateSessionLogSettings checks the session log settings of logging and applies
+// their defaults
+func validateSessionLogSettings(logging *Logging) error {
+	if err := validateTopicFilters("log_topics", logging.LogTopics); err != nil {
+		return err
+	}
+	if err := validateTopicFilters("log_exclude_topics", logging.LogExcludeTopics); err != nil {
+		return err
+	}
+
+	switch logging.LogFormat {
+	case "":
+		logging.LogFormat = sessionlogger.FormatText
+	case sessionlogger.FormatText, sessionlogger.FormatJSONL, sessionlogger.FormatBinary:
+	default:
+		return fmt.Errorf("invalid log_format %q (expected %q, %q or %q)", logging.LogFormat, sessionlogger.FormatText, sessionlogger.FormatJSONL, sessionlogger.FormatBinary)
+	}
+
+	switch logging.SessionLogRotation {
+	case "":
+		logging.SessionLogRotation = sessionlogger.RotationDuration
+	case sessionlogger.RotationDuration, sessionlogger.RotationDaily, sessionlogger.RotationDailyUTC:
+	default:
+		return fmt.Errorf("invalid session_log_rotation %q (expected %q, %q or %q)",
+			logging.SessionLogRotation, sessionlogger.RotationDuration, sessionlogger.RotationDaily, sessionlogger.RotationDailyUTC)
+	}
+
+	if logging.SessionLogMaxSize != "" {
+		if _, err := ParseByteSize(logging.SessionLogMaxSize); err != nil {
+			return fmt.Errorf("invalid session_log_max_size: %w", err)
+		}
+	}
 
-	// Override with environment variables if available
-	for i := range config.Connections {
-		conn := &config.Connections[i]
+	if logging.MaxLogAge != "" {
+		if _, err := time.ParseDuration(logging.MaxLogAge); err != nil {
+			return fmt.Errorf("invalid max_log_age: %w", err)
+		}
+	}
+	if logging.MaxLogFiles < 0 {
+		return fmt.Errorf("max_log_files must not be negative")
+	}
+	if logging.MaxTotalLogSize != "" {
+		if _, err := ParseByteSize(logging.MaxTotalLogSize); err != nil {
+			return fmt.Errorf("invalid max_total_log_size: %w", err)
+		}
+	}
+
+	if logging.SessionLogFilename != "" {
+		if err := sessionlogger.ValidateFilenameTemplate(logging.SessionLogFilename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyCredentialEnv overrides the credentials of connections with MQTT_USER_<n>
+// and MQTT_PASSWORD_<n>, or MQTT_USER and MQTT_PASSWORD for a single connection
+func applyCredentialEnv(connections []monitor.ConnectionConfig) {
+	for i := range connections {
+		conn := &connections[i]
 
 		// Override credentials from environment variables
 		if envUser := os.Getenv(fmt.Sprintf("MQTT_USER_%d", i)); envUser != "" {
@@ -70,7 +267,7 @@ func LoadConfig(filename string) (*Config, error) {
 		}
 
 		// Global environment variables (for single connection setups)
-		if len(config.Connections) == 1 {
+		if len(connections) == 1 {
 			if envUser := os.Getenv("MQTT_USER"); envUser != "" {
 				conn.User = envUser
 			}
@@ -79,42 +276,100 @@ func LoadConfig(filename string) (*Config, error) {
 			}
 		}
 	}
+}
+
+// validateTopicFilters checks configured topic filters against the MQTT rules,
+// so a bad filter is reported at load instead of as a failed subscription
+func validateTopicFilters(setting string, filters []string) error {
+	for _, filter := range filters {
+		if err := mqtt.ValidateTopicFilter(filter); err != nil {
+			return fmt.Errorf("%s: %w", setting, err)
+		}
+	}
+	return nil
+}
 
-	// Validate required fields
-	for i, conn := range config.Connections {
+// validateSecretSources checks that the password and the TLS key passphrase each
+// come from at most one external source
+func validateSecretSources(conn monitor.ConnectionConfig) error {
+	sources := 0
+	for _, source := range []string{conn.PasswordKeyring, conn.PasswordCommand, conn.PasswordVault, conn.PasswordEncrypted} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("set only one of password_keyring, password_command, password_vault and password_encrypted")
+	}
+	if conn.PasswordEncrypted != "" {
+		if _, _, _, err := splitEncryptedPassword(conn.PasswordEncrypted); err != nil {
+			return err
+		}
+	}
+	if conn.PasswordVault != "" {
+		if _, _, err := monitor.ParseVaultRef(conn.PasswordVault, "password"); err != nil {
+			return err
+		}
+	}
+
+	if conn.TLSKeyPassphraseCommand == "" && conn.TLSKeyPassphraseVault == "" {
+		return nil
+	}
+	if conn.TLSKeyPassphraseCommand != "" && conn.TLSKeyPassphraseVault != "" {
+		return fmt.Errorf("set only one of tls_key_passphrase_command and tls_key_passphrase_vault")
+	}
+	if conn.TLSKeyFile == "" {
+		return fmt.Errorf("a TLS key passphrase requires tls_key_file")
+	}
+	if conn.TLSKeyPassphraseVault != "" {
+		if _, _, err := monitor.ParseVaultRef(conn.TLSKeyPassphraseVault, "passphrase"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateConnections checks the connections and fills in default names and client IDs
+func validateConnections(connections []monitor.ConnectionConfig) error {
+	for i, conn := range connections {
 		if conn.Name == "" {
-			config.Connections[i].Name = fmt.Sprintf("Connection-%d", i+1)
+			connections[i].Name = fmt.Sprintf("Connection-%d", i+1)
 		}
 		if conn.Server == "" {
-			return nil, fmt.Errorf("server is required for connection %s", conn.Name)
+			return fmt.Errorf("server is required for connection %s", conn.Name)
 		}
 		if len(conn.Topics) == 0 {
-			return nil, fmt.Errorf("at least one topic is required for connection %s", conn.Name)
+			return fmt.Errorf("at least one topic is required for connection %s", conn.Name)
+		}
+		if err := validateTopicFilters("connection "+conn.Name, conn.Topics); err != nil {
+			return err
+		}
+		if conn.PasswordKeyring != "" {
+			if _, _, err := splitKeyringEntry(conn.PasswordKeyring); err != nil {
+				return fmt.Errorf("connection %s: %w", conn.Name, err)
+			}
+		}
+		if err := validateSecretSources(conn); err != nil {
+			return fmt.Errorf("connection %s: %w", conn.Name, err)
 		}
 		if conn.ClientIDBase == "" {
-			config.Connections[i].ClientIDBase = fmt.Sprintf("mqtt-monitor-%s", conn.Name)
+			connections[i].ClientIDBase = fmt.Sprintf("mqtt-monitor-%s", conn.Name)
 		}
 
 		// Set default QoS if not specified
 		if conn.QoS > 2 {
-			config.Connections[i].QoS = 1 // Default to QoS 1
+			connections[i].QoS = 1 // Default to QoS 1
 		}
 
 		// Validate TLS configuration
-		if err := validateTLSConfig(&config.Connections[i]); err != nil {
-			return nil, fmt.Errorf("TLS validation failed for connection %s: %w", conn.Name, err)
+		if err := validateTLSConfig(&connections[i]); err != nil {
+			return fmt.Errorf("TLS validation failed for connection %s: %w", conn.Name, err)
 		}
 	}
-
-	// Validate display configuration
-	if config.Display.TopicDepth < 1 {
-		config.Display.TopicDepth = 3 // Default fallback
-	}
-
-	return &config, nil
+	return nil
 }
 
-func validateTLSConfig(conn *ConnectionConfig) error {
+func validateTLSConfig(conn *monitor.ConnectionConfig) error {
 	// Check if TLS is required based on server URL
 	isTLS := strings.HasPrefix(conn.Server, "ssl://") ||
 		strings.HasPrefix(conn.Server, "tls://") ||
@@ -153,69 +408,39 @@ func validateTLSConfig(conn *ConnectionConfig) error {
 	return nil
 }
 
-// ToMQTTConfig converts ConnectionConfig to mqtt.Config
-func (c *ConnectionConfig) ToMQTTConfig() mqtt.Config {
-	return mqtt.Config{
-		BrokerURL:             c.Server,
-		ClientID:              c.GetUniqueClientID(),
-		Username:              c.User,
-		Password:              c.Password,
-		CleanSession:          true,
-		ConnectRetryInterval:  5 * time.Second,
-		MaxReconnectInterval:  60 * time.Second,
-		TLSCertFile:           c.TLSCertFile,
-		TLSKeyFile:            c.TLSKeyFile,
-		TLSCAFile:             c.TLSCAFile,
-		TLSInsecureSkipVerify: c.TLSInsecureSkipVerify,
+// ParseByteSize parses a human readable size such as "512KB", "100MB" or "1GiB" into bytes.
+// Decimal and binary suffixes are both treated as powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	value := strings.TrimSpace(strings.ToUpper(s))
+	if value == "" {
+		return 0, fmt.Errorf("empty size")
 	}
-}
-
-func (c *ConnectionConfig) GetUniqueClientID() string {
-	return fmt.Sprintf("%s-%d", c.ClientIDBase, time.Now().Unix())
-}
 
-func (c *ConnectionConfig) GetTLSConfig() (*tls.Config, error) {
-	if !c.needsTLS() {
-		return nil, nil
+	multipliers := []struct {
+		suffix string
+		factor int64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
 	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: c.TLSInsecureSkipVerify,
-	}
-
-	// Load client certificate if provided
-	if c.TLSCertFile != "" && c.TLSKeyFile != "" {
-		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	factor := int64(1)
+	for _, m := range multipliers {
+		if strings.HasSuffix(value, m.suffix) {
+			factor = m.factor
+			value = strings.TrimSpace(strings.TrimSuffix(value, m.suffix))
+			break
 		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
-	// Load CA certificate if provided
-	if c.TLSCAFile != "" {
-		caCert, err := os.ReadFile(c.TLSCAFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-		}
-
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM(caCert) {
-			return nil, fmt.Errorf("failed to parse CA certificate")
-		}
-		tlsConfig.RootCAs = caCertPool
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
 	}
 
-	return tlsConfig, nil
-}
-
-func (c *ConnectionConfig) needsTLS() bool {
-	return strings.HasPrefix(c.Server, "ssl://") ||
-		strings.HasPrefix(c.Server, "tls://") ||
-		strings.HasPrefix(c.Server, "mqtts://") ||
-		c.TLSCertFile != "" ||
-		c.TLSCAFile != "" ||
-		c.TLSInsecureSkipVerify
+	return int64(n * float64(factor)), nil
 }
 
 // FormatTopicForDisplay formats topic according to configured depth
@@ -231,4 +456,4 @@ func FormatTopicForDisplay(topic string, depth int) string {
 
 	// Take the last 'depth' parts
 	return strings.Join(parts[len(parts)-depth:], "/")
-}
\ No newline at end of file
+}
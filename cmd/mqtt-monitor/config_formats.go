@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeConfigFile decodes a TOML, YAML (.yaml, .yml) or JSON (.json) config file,
+// chosen by extension, into v. YAML and JSON use the same keys as TOML; they are
+// converted to TOML and decoded like a TOML file, so all formats map to v the same way.
+func decodeConfigFile(filename string, v any) (toml.MetaData, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+		return toml.DecodeFile(filename, v)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return toml.MetaData{}, err
+	}
+
+	var document any
+	if ext == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // Keep integers apart from floats
+		if err := decoder.Decode(&document); err != nil {
+			return toml.MetaData{}, fmt.Errorf("json: %w", err)
+		}
+	} else if err := yaml.Unmarshal(data, &document); err != nil {
+		return toml.MetaData{}, err
+	}
+
+	tables, ok := normalizeConfigValue(document).(map[string]any)
+	if document != nil && !ok {
+		return toml.MetaData{}, fmt.Errorf("%s: the top level must be a mapping of sections", filename)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tables); err != nil {
+		return toml.MetaData{}, err
+	}
+	md, err := toml.Decode(buf.String(), v)
+	if err != nil {
+		// Line numbers would refer to the converted document; the key names the setting
+		return md, errors.New(tomlErrorLine.ReplaceAllString(err.Error(), "toml: "))
+	}
+	return md, nil
+}
+
+// tomlErrorLine matches the line number in errors of the TOML decoder
+var tomlErrorLine = regexp.MustCompile(`^toml: line \d+ `)
+
+// normalizeConfigValue converts a decoded YAML or JSON value into values the TOML
+// encoder accepts: JSON numbers become int64 or float64 and nulls are dropped
+func normalizeConfigValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = normalizeConfigValue(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeConfigValue(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// includableKeys are the lists an included file may extend
+var includableKeys = []string{"connection", "sink", "alert.rule", "sequence", "influx.mapping"}
+
+// includedFiles returns the files matching the include patterns of the config
+// file filename, in merge order. Relative patterns are resolved against the
+// directory of filename, and a pattern without wildcards must name an existing file.
+func includedFiles(filename string, patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %q: %w", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[`) {
+			return nil, fmt.Errorf("include %s: %w", pattern, os.ErrNotExist)
+		}
+		for _, match := range matches {
+			if !slices.Contains(files, match) {
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// mergeIncludes appends the connections, sinks, alert rules, sequence rules and
+// InfluxDB mappings of the files included by config, so per-site snippets can be
+// kept apart
+func mergeIncludes(filename string, config *Config) error {
+	files, err := includedFiles(filename, config.Include)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		var part Config
+		md, err := decodeConfigFile(file, &part)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, key := range md.Keys() {
+			if !slices.ContainsFunc(includableKeys, func(allowed string) bool {
+				return key.String() == allowed || strings.HasPrefix(key.String(), allowed+".") ||
+					strings.HasPrefix(allowed, key.String()+".")
+			}) {
+				return fmt.Errorf("%s: %s cannot be set in an included file (only %s)",
+					file, key, strings.Join(includableKeys, ", "))
+			}
+		}
+
+		config.Connections = append(config.Connections, part.Connections...)
+		config.Sink = append(config.Sink, part.Sink...)
+		config.Alert.Rules = append(config.Alert.Rules, part.Alert.Rules...)
+		config.Sequences = append(config.Sequences, part.Sequences...)
+		config.Influx.Mappings = append(config.Influx.Mappings, part.Influx.Mappings...)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// controlSocketMaxRequest bounds a request line, which carries the payload of publish
+const controlSocketMaxRequest = 1024 * 1024
+
+// startControlSocket serves controller commands on a unix domain socket for
+// mqtt-monitorctl: one JSON request per line, each answered with one JSON line.
+// Only the owner of the process may connect; no token is required.
+func startControlSocket(path string, controller *Controller, logger zerolog.Logger, ctx context.Context) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+	logger.Info().Str("socket", path).Msg("Control socket listening")
+
+	go func() {
+		<-ctx.Done()
+		listener.Close() // Also removes the socket file
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveControlConn(conn, controller, logger, ctx)
+		}
+	}()
+	return nil
+}
+
+// removeStaleSocket removes a socket left behind by a previous run, but refuses to
+// take over one that another instance is still serving
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("control socket %s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %s is in use by another instance", path)
+	}
+	return os.Remove(path)
+}
+
+func serveControlConn(conn net.Conn, controller *Controller, logger zerolog.Logger, ctx context.Context) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), controlSocketMaxRequest)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		response := controller.ExecuteJSON(scanner.Bytes(), "")
+		if _, err := conn.Write(append(response, '\n')); err != nil {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		logger.Debug().Err(err).Msg("Control socket client failed")
+	}
+}
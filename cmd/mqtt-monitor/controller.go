@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/control"
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+// Controller executes control commands against the running monitor
+type Controller struct {
+	state         *monitor.State
+	clientsMu     sync.RWMutex
+	clients       []*monitor.Client
+	sessionLogger *sessionlogger.Logger
+	stateStore    *StateStore // Keeps added filters across restarts, may be nil
+	ui            *UI         // Switches themes and keymaps, nil when headless
+	notify        func(error) // Reports executed commands in the UI status feed
+}
+
+func NewController(state *monitor.State, clients []*monitor.Client, sessionLogger *sessionlogger.Logger, stateStore *StateStore, ui *UI, notify func(error)) *Controller {
+	return &Controller{
+		state:         state,
+		clients:       clients,
+		sessionLogger: sessionLogger,
+		stateStore:    stateStore,
+		ui:            ui,
+		notify:        notify,
+	}
+}
+
+// SetClients replaces the connections commands act on, e.g. after a configuration reload
+func (c *Controller) SetClients(clients []*monitor.Client) {
+	c.clientsMu.Lock()
+	c.clients = clients
+	c.clientsMu.Unlock()
+}
+
+// ExecuteJSON decodes a request, executes it and encodes the response
+func (c *Controller) ExecuteJSON(data []byte, token string) []byte {
+	var req control.Request
+	var resp control.Response
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp = control.Response{Error: fmt.Sprintf("invalid request: %v", err)}
+	} else if token != "" && req.Token != token {
+		resp = control.Response{ID: req.ID, Error: "invalid token"}
+	} else {
+		resp = c.Execute(req)
+	}
+
+	encoded, _ := json.Marshal(resp)
+	return encoded
+}
+
+// Execute runs a single command
+func (c *Controller) Execute(req control.Request) control.Response {
+	result, err := c.execute(req)
+	if err != nil {
+		return control.Response{ID: req.ID, Error: err.Error()}
+	}
+
+	if req.Command != control.CommandStatus && c.notify != nil {
+		c.notify(infof("control: %s executed", req.Command))
+	}
+	return control.Response{ID: req.ID, OK: true, Result: result}
+}
+
+func (c *Controller) execute(req control.Request) (any, error) {
+	switch req.Command {
+	case control.CommandStatus:
+		stats := c.state.Stats(0)
+		status := map[string]any{
+			"uptime":          stats.Uptime,
+			"messages":        stats.Messages,
+			"errors":          stats.Errors,
+			"rate_per_second": stats.RatePerSecond,
+			"connections":     c.state.Connections(),
+		}
+		if c.sessionLogger != nil {
+			status["logging_paused"] = c.sessionLogger.Paused()
+			status["log_filters"] = c.sessionLogger.TopicFilters()
+		}
+		return status, nil
+
+	case control.CommandPauseLogging, control.CommandResumeLogging:
+		if c.sessionLogger == nil {
+			return nil, fmt.Errorf("session logging is not enabled")
+		}
+		c.sessionLogger.SetPaused(req.Command == control.CommandPauseLogging)
+		return nil, nil
+
+	case control.CommandRotateLog:
+		if c.sessionLogger == nil {
+			return nil, fmt.Errorf("session logging is not enabled")
+		}
+		path, err := c.sessionLogger.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"path": path}, nil
+
+	case control.CommandAddFilter:
+		if c.sessionLogger == nil {
+			return nil, fmt.Errorf("session logging is not enabled")
+		}
+		if err := c.sessionLogger.AddTopicFilter(req.Filter, req.Exclude); err != nil {
+			return nil, err
+		}
+		if c.stateStore != nil {
+			err := c.stateStore.Update(func(state *SavedState) {
+				state.LogFilters = c.sessionLogger.AddedTopicFilters()
+			})
+			if err != nil && c.notify != nil {
+				c.notify(warnf("control: filter added but not saved: %w", err))
+			}
+		}
+		return c.sessionLogger.TopicFilters(), nil
+
+	case control.CommandPublish:
+		return nil, c.publish(req)
+
+	case control.CommandSetTheme:
+		if c.ui == nil {
+			return nil, fmt.Errorf("themes need the TUI")
+		}
+		names := c.ui.ThemeNames()
+		if req.Name != "" {
+			// Only configured themes: a remote command must not read arbitrary files
+			if !slices.Contains(names, req.Name) {
+				return nil, fmt.Errorf("unknown theme %q (expected %s)", req.Name, strings.Join(names, ", "))
+			}
+			if err := c.ui.SetTheme(req.Name); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]any{"theme": c.ui.ThemeName(), "themes": names}, nil
+
+	case control.CommandSetKeymap:
+		if c.ui == nil {
+			return nil, fmt.Errorf("keymaps need the TUI")
+		}
+		names := c.ui.KeymapNames()
+		if req.Name != "" {
+			if !slices.Contains(names, req.Name) {
+				return nil, fmt.Errorf("unknown keymap %q (expected %s)", req.Name, strings.Join(names, ", "))
+			}
+			if err := c.ui.SetKeymap(req.Name); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]any{"keymap": c.ui.KeymapName(), "keymaps": names}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", req.Command)
+	}
+}
+
+func (c *Controller) publish(req control.Request) error {
+	if err := mqtt.ValidateTopicName(req.Topic); err != nil {
+		return err
+	}
+	if req.QoS > 2 {
+		return fmt.Errorf("invalid qos %d", req.QoS)
+	}
+
+	c.clientsMu.RLock()
+	clients := c.clients
+	c.clientsMu.RUnlock()
+
+	for _, client := range clients {
+		if req.Connection != "" && client.Name() != req.Connection {
+			continue
+		}
+		if req.Connection == "" && !client.Status().Connected {
+			continue
+		}
+		return client.Publish(req.Topic, []byte(req.Payload), req.QoS, req.Retain)
+	}
+
+	if req.Connection != "" {
+		return fmt.Errorf("unknown connection %q", req.Connection)
+	}
+	return fmt.Errorf("no connected connection")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// showCoverage shows which topics seen the subscription filters of every
+// connection matched, and with a topic, which filters would match it
+func showCoverage(ui *UI, state *monitor.State, topic string) {
+	var last []monitor.Message
+	if topic != "" {
+		if err := mqtt.ValidateTopicName(topic); err != nil {
+			ui.ShowPanel("Coverage", tview.Escape(err.Error()))
+			return
+		}
+		last = state.LastValues(topic)
+	}
+	ui.ShowPanel("Coverage", formatCoverage(state.Coverage(), last, topic))
+}
+
+// formatCoverage describes the coverage of the filters of every connection for the
+// coverage panel: filters that matched nothing in red, filters another one
+// covers in yellow, and topics no filter matched. With a topic it first tells
+// for every connection whether a filter matches it and whether it was seen;
+// last are the last values of the topic.
+func formatCoverage(coverage []monitor.ConnectionCoverage, last []monitor.Message, topic string) string {
+	var b strings.Builder
+	if topic != "" {
+		fmt.Fprintf(&b, "[::b]%s[::-]\n", tview.Escape(topic))
+		for _, conn := range coverage {
+			var filters []string
+			for _, fc := range conn.Filters {
+				if mqtt.TopicMatches(mqtt.SharedFilter(fc.Filter), topic) {
+					filters = append(filters, fc.Filter)
+				}
+			}
+			seen := slices.ContainsFunc(last, func(msg monitor.Message) bool { return msg.Source == conn.Connection })
+
+			switch {
+			case len(filters) == 0:
+				fmt.Fprintf(&b, "  %s: [red]no filter matches[-]\n", tview.Escape(conn.Connection))
+			case !seen:
+				fmt.Fprintf(&b, "  %s: matched by %s, [yellow]nothing received yet[-]\n",
+					tview.Escape(conn.Connection), tview.Escape(strings.Join(filters, ", ")))
+			default:
+				fmt.Fprintf(&b, "  %s: matched by %s, [green]received[-]\n",
+					tview.Escape(conn.Connection), tview.Escape(strings.Join(filters, ", ")))
+			}
+		}
+		b.WriteByte('\n')
+	}
+
+	for i, conn := range coverage {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "[::b]%s[::-]: %d %s seen\n", tview.Escape(conn.Connection), conn.Topics, topicsNoun(conn.Topics))
+		width := len("outside the filters")
+		for _, fc := range conn.Filters {
+			width = max(width, len(fc.Filter))
+		}
+
+		for _, fc := range conn.Filters {
+			color := "green"
+			switch {
+			case fc.Topics == 0:
+				color = "red"
+			case fc.CoveredBy != "":
+				color = "yellow"
+			}
+			fmt.Fprintf(&b, "  [%s]%-*s[-] %s", color, width, tview.Escape(fc.Filter), coverageExamples(fc.Topics, fc.Examples))
+			if fc.CoveredBy != "" {
+				fmt.Fprintf(&b, " (covered by %s)", tview.Escape(fc.CoveredBy))
+			}
+			b.WriteByte('\n')
+		}
+		if conn.Unmatched > 0 {
+			fmt.Fprintf(&b, "  [yellow]%-*s[-] %s\n", width, "outside the filters", coverageExamples(conn.Unmatched, conn.UnmatchedExamples))
+		}
+	}
+	return b.String()
+}
+
+// coverageExamples describes a number of topics with some examples
+func coverageExamples(topics int, examples []string) string {
+	text := fmt.Sprintf("%5d %-6s  %s", topics, topicsNoun(topics), tview.Escape(strings.Join(examples, ", ")))
+	if topics > len(examples) {
+		text += ", ..."
+	}
+	return text
+}
+
+// topicsNoun returns "topic" or "topics" for a number of topics
+func topicsNoun(topics int) string {
+	if topics == 1 {
+		return "topic"
+	}
+	return "topics"
+}
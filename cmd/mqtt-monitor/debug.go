@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// DebugConfig configures the profiling endpoint for long-running sessions
+type DebugConfig struct {
+	Listen string `toml:"listen"` // Loopback address for /debug/pprof/ and /debug/vars, e.g. "127.0.0.1:6060" (disabled when empty)
+}
+
+// validateDebugConfig checks that the debug endpoint stays on the local host, as
+// profiles expose memory contents such as payloads and credentials
+func validateDebugConfig(c DebugConfig) error {
+	if c.Listen == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid debug listen %q: %w", c.Listen, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("invalid debug listen %q: must be a loopback address such as 127.0.0.1", c.Listen)
+	}
+	return nil
+}
+
+// debugVars is what /debug/vars shows under "mqtt_monitor"
+type debugVars struct {
+	DecodeQueued      int                        `json:"decode_queued"`   // Received messages waiting for a decode worker
+	MessagesQueued    int                        `json:"messages_queued"` // Decoded messages waiting for the message handler
+	MessagesQueueSize int                        `json:"messages_queue_size"`
+	ErrorsQueued      int                        `json:"errors_queued"`
+	ErrorsQueueSize   int                        `json:"errors_queue_size"`
+	SubscriberDrops   uint64                     `json:"subscriber_drops"` // Messages and events missed by slow API and sink subscribers
+	StringBuilders    int64                      `json:"string_builder_pool"`
+	FormatData        int64                      `json:"format_data_pool"`
+	Messages          uint64                     `json:"messages"`
+	Errors            uint64                     `json:"errors"`
+	Drops             map[string]uint64          `json:"drops"`
+	Connections       []monitor.ConnectionStatus `json:"connections"` // With the messages each connection dropped
+}
+
+// startDebug serves pprof profiles and expvar counters of the channels, pools and
+// drops when [debug] listen is set
+func startDebug(config *Config, m *monitor.Monitor, ctx context.Context) {
+	if config.Debug.Listen == "" {
+		return
+	}
+	logger := log.With().Str("component", "debug").Logger()
+
+	// Published once: the monitor runs once per process
+	expvar.Publish("mqtt_monitor", expvar.Func(func() any {
+		state, queues := m.State(), m.Queues()
+		stats := state.Stats(0)
+		return debugVars{
+			DecodeQueued:      queues.Decode,
+			MessagesQueued:    queues.Messages,
+			MessagesQueueSize: queues.MessagesSize,
+			ErrorsQueued:      queues.Errors,
+			ErrorsQueueSize:   queues.ErrorsSize,
+			SubscriberDrops:   state.Dropped(),
+			StringBuilders:    atomic.LoadInt64(&stringBuilderPoolCount),
+			FormatData:        atomic.LoadInt64(&formatDataPoolCount),
+			Messages:          stats.Messages,
+			Errors:            stats.Errors,
+			Drops:             state.Drops(),
+			Connections:       state.Connections(),
+		}
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	listener, err := net.Listen("tcp", config.Debug.Listen)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to start debug server")
+		return
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("Debug server stopped")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	logger.Info().Str("listen", listener.Addr().String()).Msg("Debug server started")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// dropUIQueue counts the messages the TUI replaced before drawing them, because
+// more arrived between two frames than it keeps
+const dropUIQueue = "ui_queue"
+
+// dropDescriptions explains the drop points shown in the diagnostics pane
+var dropDescriptions = map[string]string{
+	monitor.DropDecodeQueue:     "received messages the decode workers had no room for",
+	monitor.DropMessagesChannel: "decoded messages the message handler had no room for",
+	monitor.DropEventsChannel:   "connection events the handler had no room for",
+	monitor.DropErrorsChannel:   "errors and status messages the handler had no room for",
+	monitor.DropDecoderFailure:  "messages a decoder failed on",
+	monitor.DropSubscriber:      "messages and events API, stream and sink clients missed",
+	dropUIQueue:                 "messages replaced before the TUI drew them",
+}
+
+// showDiagnostics opens a pane with the drop counters and the queue levels of the
+// pipeline, so lost messages do not go unnoticed
+func showDiagnostics(ui *UI, m *monitor.Monitor) {
+	ui.ShowPanel("Diagnostics", formatDiagnostics(m.State(), m.Queues()))
+}
+
+// formatDiagnostics describes the drop counters and queue levels for the
+// diagnostics pane
+func formatDiagnostics(state *monitor.State, queues monitor.Queues) string {
+	var b strings.Builder
+
+	drops := state.Drops()
+	b.WriteString("[::b]Drops[::-]\n")
+	for _, name := range slices.Sorted(maps.Keys(drops)) {
+		color := "green"
+		if drops[name] > 0 {
+			color = "red"
+		}
+		fmt.Fprintf(&b, "  [%s]%-17s %10d[-]  %s\n", color, name, drops[name], dropDescriptions[name])
+	}
+
+	b.WriteString("\n[::b]Queues[::-]\n")
+	fmt.Fprintf(&b, "  %-17s %10d\n", "decode workers", queues.Decode)
+	fmt.Fprintf(&b, "  %-17s %10s\n", "messages channel", fmt.Sprintf("%d/%d", queues.Messages, queues.MessagesSize))
+	fmt.Fprintf(&b, "  %-17s %10s\n", "events channel", fmt.Sprintf("%d/%d", queues.Events, queues.EventsSize))
+	fmt.Fprintf(&b, "  %-17s %10s\n", "errors channel", fmt.Sprintf("%d/%d", queues.Errors, queues.ErrorsSize))
+
+	b.WriteString("\n[::b]Connections[::-]\n")
+	for _, status := range state.Connections() {
+		fmt.Fprintf(&b, "  %s: %d messages, %d dropped", tview.Escape(status.Name), status.Messages, status.Dropped)
+		var points []string
+		for _, name := range []string{monitor.DropDecodeQueue, monitor.DropMessagesChannel, monitor.DropEventsChannel, monitor.DropErrorsChannel, monitor.DropDecoderFailure} {
+			if status.Drops[name] > 0 {
+				points = append(points, fmt.Sprintf("%s %d", name, status.Drops[name]))
+			}
+		}
+		if len(points) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(points, ", "))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
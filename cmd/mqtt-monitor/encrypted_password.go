@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// passphraseEnv holds the master passphrase for headless runs
+const passphraseEnv = "MQTT_MONITOR_PASSPHRASE"
+
+// Encrypted passwords are "v1:" and the base64 of salt, nonce and the AES-256-GCM
+// ciphertext, with the key derived from the passphrase by PBKDF2-HMAC-SHA256
+const (
+	encryptedPrefix     = "v1:"
+	encryptedSaltSize   = 16
+	encryptedIterations = 600_000
+	passphraseAttempts  = 3
+)
+
+// errWrongPassphrase is returned when a password does not decrypt
+var errWrongPassphrase = errors.New("wrong passphrase or damaged password_encrypted")
+
+// masterPassphrase is the passphrase once known, so reloads decrypt without
+// asking again
+var masterPassphrase struct {
+	sync.Mutex
+	value    string
+	noPrompt bool // The TUI owns the terminal
+}
+
+// encryptPassword encrypts password with a key derived from passphrase
+func encryptPassword(password, passphrase string) (string, error) {
+	salt := make([]byte, encryptedSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := passwordCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(append(salt, nonce...), nonce, []byte(password), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptPassword reverses encryptPassword
+func decryptPassword(value, passphrase string) (string, error) {
+	salt, nonce, ciphertext, err := splitEncryptedPassword(value)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := passwordCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	password, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errWrongPassphrase
+	}
+	return string(password), nil
+}
+
+// splitEncryptedPassword decodes a password_encrypted value into its parts
+func splitEncryptedPassword(value string) (salt, nonce, ciphertext []byte, err error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("invalid password_encrypted (expected the %q output of \"%s encrypt\")", encryptedPrefix+"...", appName)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	// 12 bytes of GCM nonce and a 16 byte tag follow the salt
+	if err != nil || len(data) < encryptedSaltSize+12+16 {
+		return nil, nil, nil, fmt.Errorf("invalid password_encrypted: not a complete encrypted value")
+	}
+	return data[:encryptedSaltSize], data[encryptedSaltSize : encryptedSaltSize+12], data[encryptedSaltSize+12:], nil
+}
+
+// passwordCipher returns the AES-GCM cipher for passphrase and salt
+func passwordCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, encryptedIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// resolvePasswords fills in the passwords kept outside the config file, in the
+// OS keyring or encrypted
+func resolvePasswords(connections []monitor.ConnectionConfig) error {
+	if err := resolveKeyringPasswords(connections); err != nil {
+		return err
+	}
+	return resolveEncryptedPasswords(connections)
+}
+
+// resolveEncryptedPasswords decrypts the password of every connection with a
+// password_encrypted value. A password set in the config file or through the
+// environment takes precedence.
+func resolveEncryptedPasswords(connections []monitor.ConnectionConfig) error {
+	var encrypted []*monitor.ConnectionConfig
+	for i := range connections {
+		if connections[i].PasswordEncrypted != "" && connections[i].Password == "" {
+			encrypted = append(encrypted, &connections[i])
+		}
+	}
+	if len(encrypted) == 0 {
+		return nil
+	}
+
+	passphrase, err := unlockPassphrase(encrypted[0].PasswordEncrypted)
+	if err != nil {
+		return fmt.Errorf("connection %s: %w", encrypted[0].Name, err)
+	}
+	for _, conn := range encrypted {
+		password, err := decryptPassword(conn.PasswordEncrypted, passphrase)
+		if err != nil {
+			return fmt.Errorf("connection %s: %w", conn.Name, err)
+		}
+		conn.Password = password
+	}
+	return nil
+}
+
+// unlockPassphrase returns the master passphrase that decrypts sample: the one
+// already known, the one of MQTT_MONITOR_PASSPHRASE, or one prompted for on the
+// terminal
+func unlockPassphrase(sample string) (string, error) {
+	masterPassphrase.Lock()
+	defer masterPassphrase.Unlock()
+
+	if masterPassphrase.value != "" {
+		if _, err := decryptPassword(sample, masterPassphrase.value); !errors.Is(err, errWrongPassphrase) {
+			return masterPassphrase.value, err
+		}
+	}
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		if _, err := decryptPassword(sample, passphrase); err != nil {
+			return "", fmt.Errorf("%s: %w", passphraseEnv, err)
+		}
+		masterPassphrase.value = passphrase
+		return passphrase, nil
+	}
+	if masterPassphrase.noPrompt || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("encrypted password needs the passphrase in %s", passphraseEnv)
+	}
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := readPassword("Passphrase for encrypted passwords: ")
+		if err != nil {
+			return "", err
+		}
+		_, err = decryptPassword(sample, passphrase)
+		if err == nil {
+			masterPassphrase.value = passphrase
+			return passphrase, nil
+		}
+		if !errors.Is(err, errWrongPassphrase) || attempt == passphraseAttempts {
+			return "", err
+		}
+		fmt.Fprintln(os.Stderr, "Wrong passphrase, try again")
+	}
+}
+
+// disablePassphrasePrompt makes later decryptions, e.g. on reload, fail instead
+// of prompting once the terminal belongs to the TUI
+func disablePassphrasePrompt() {
+	masterPassphrase.Lock()
+	masterPassphrase.noPrompt = true
+	masterPassphrase.Unlock()
+}
+
+// runEncrypt prints a password_encrypted value for a password
+func runEncrypt(args []string) error {
+	flags := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s encrypt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prompts for the master passphrase (default: env %s) and the password,\n", passphraseEnv)
+		fmt.Fprintln(os.Stderr, "or reads them from the first lines of stdin when it is not a terminal")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		var err error
+		if passphrase, err = readPassword("Master passphrase: "); err != nil {
+			return err
+		}
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			again, err := readPassword("Repeat the passphrase: ")
+			if err != nil {
+				return err
+			}
+			if again != passphrase {
+				return fmt.Errorf("the passphrases differ")
+			}
+		}
+	}
+	if passphrase == "" {
+		return fmt.Errorf("empty passphrase")
+	}
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encryptPassword(password, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("password_encrypted = %q\n", encrypted)
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+)
+
+// exportColumns maps CSV column names to record field extractors
+var exportColumns = map[string]func(sessionlog.Record) string{
+	"timestamp":     func(r sessionlog.Record) string { return r.Timestamp.Format(time.RFC3339Nano) },
+	"source":        func(r sessionlog.Record) string { return r.Source },
+	"topic":         func(r sessionlog.Record) string { return r.Topic },
+	"display_topic": func(r sessionlog.Record) string { return r.DisplayTopic },
+	"payload":       func(r sessionlog.Record) string { return r.Payload },
+	"raw_payload":   func(r sessionlog.Record) string { return base64.StdEncoding.EncodeToString(r.RawPayload) },
+	"qos":           func(r sessionlog.Record) string { return strconv.Itoa(int(r.QoS)) },
+	"retained":      func(r sessionlog.Record) string { return strconv.FormatBool(r.Retained) },
+}
+
+// RecordFilter selects session log records by topic and time range
+type RecordFilter struct {
+	Topics []string // MQTT topic filters; empty matches all topics
+	From   time.Time
+	To     time.Time
+}
+
+// Match reports whether a message record passes the filter
+func (f RecordFilter) Match(record sessionlog.Record) bool {
+	if !f.From.IsZero() && record.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && record.Timestamp.After(f.To) {
+		return false
+	}
+	if len(f.Topics) == 0 {
+		return true
+	}
+	for _, filter := range f.Topics {
+		if mqtt.TopicMatches(filter, record.Topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// runExport implements the "export" subcommand: structured session logs to CSV
+// or InfluxDB line protocol
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "csv", "Output format: csv or influx")
+	configFile := fs.String("config", findConfigFile(), "Configuration file with [[influx.mapping]] entries (influx format only)")
+	columns := fs.String("columns", "timestamp,source,topic,payload", "Comma separated columns: timestamp, source, topic, display_topic, payload, raw_payload, qos, retained")
+	topics := fs.String("topics", "", "Comma separated MQTT topic filters to include (default: all)")
+	from := fs.String("from", "", "Only include messages at or after this RFC3339 time")
+	to := fs.String("to", "", "Only include messages at or before this RFC3339 time")
+	output := fs.String("o", "", "Output file (default: stdout)")
+	noHeader := fs.Bool("no-header", false, "Do not write a CSV header row")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export [flags] <session.jsonl>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no session log files given")
+	}
+
+	filter, err := parseRecordFilter(*topics, *from, *to)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch *format {
+	case "csv":
+		return exportCSV(out, fs.Args(), splitList(*columns), filter, !*noHeader)
+	case "influx":
+		config, err := LoadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		if len(config.Influx.Mappings) == 0 {
+			return fmt.Errorf("no [[influx.mapping]] entries in %s", *configFile)
+		}
+		return exportInflux(out, fs.Args(), config.Influx, filter)
+	default:
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+}
+
+func exportCSV(out io.Writer, paths []string, selected []string, filter RecordFilter, header bool) error {
+	for _, column := range selected {
+		if _, ok := exportColumns[column]; !ok {
+			return fmt.Errorf("unknown column %q", column)
+		}
+	}
+
+	writer := csv.NewWriter(out)
+	if header {
+		writer.Write(selected)
+	}
+
+	row := make([]string, len(selected))
+	err := scanMessageRecords(paths, filter, func(record sessionlog.Record) error {
+		for i, column := range selected {
+			row[i] = exportColumns[column](record)
+		}
+		return writer.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exportInflux(out io.Writer, paths []string, influx InfluxConfig, filter RecordFilter) error {
+	return scanMessageRecords(paths, filter, func(record sessionlog.Record) error {
+		payload := record.RawPayload
+		if payload == nil {
+			payload = []byte(record.Payload)
+		}
+		line, ok := influx.ToLineProtocol(record.Topic, record.Source, payload, record.Timestamp)
+		if !ok {
+			return nil
+		}
+		_, err := fmt.Fprintln(out, line)
+		return err
+	})
+}
+
+// scanMessageRecords calls fn for every message record in paths that passes filter
+func scanMessageRecords(paths []string, filter RecordFilter, fn func(sessionlog.Record) error) error {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open session log: %w", err)
+		}
+
+		err = sessionlog.Scan(file, func(record sessionlog.Record) error {
+			if record.Type != sessionlog.TypeMessage || !filter.Match(record) {
+				return nil
+			}
+			return fn(record)
+		})
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func parseRecordFilter(topics, from, to string) (RecordFilter, error) {
+	filter := RecordFilter{Topics: splitList(topics)}
+
+	var err error
+	if from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, fmt.Errorf("invalid -from time: %w", err)
+		}
+	}
+	if to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, fmt.Errorf("invalid -to time: %w", err)
+		}
+	}
+
+	return filter, nil
+}
+
+// splitList splits a comma separated list, trimming blanks and empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
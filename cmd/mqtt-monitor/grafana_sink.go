@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	defaultGrafanaStream        = "mqtt_monitor"
+	defaultGrafanaFlushInterval = 100 * time.Millisecond
+	grafanaMaxBatch             = 1000
+)
+
+// grafanaStreamID matches the stream IDs accepted by the Grafana Live push endpoint
+var grafanaStreamID = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// GrafanaSinkConfig configures pushing values to Grafana Live
+type GrafanaSinkConfig struct {
+	URL           string `toml:"url"`            // Grafana base URL, e.g. "http://localhost:3000"
+	Stream        string `toml:"stream"`         // Stream ID; channels are stream/<stream>/<measurement> (default: "mqtt_monitor")
+	Token         string `toml:"token"`          // Service account token (default: GRAFANA_TOKEN environment variable)
+	FlushInterval string `toml:"flush_interval"` // Maximum time values wait before being pushed (default: "100ms")
+}
+
+func init() {
+	RegisterSink("grafana", func(entry SinkEntry, config *Config, logger zerolog.Logger) (Sink, error) {
+		var c GrafanaSinkConfig
+		if err := entry.Decode(&c); err != nil {
+			return nil, err
+		}
+		return NewGrafanaSink(c, config.Influx, logger)
+	})
+}
+
+// GrafanaSink converts messages with the [[influx.mapping]] rules and pushes them to a
+// Grafana Live stream. Live data is only useful while fresh, so failed pushes are not retried.
+type GrafanaSink struct {
+	sinkQueue
+	token         string
+	pushURL       string
+	flushInterval time.Duration
+	mappings      InfluxConfig
+	client        *http.Client
+	logger        zerolog.Logger
+}
+
+func NewGrafanaSink(config GrafanaSinkConfig, mappings InfluxConfig, logger zerolog.Logger) (*GrafanaSink, error) {
+	if len(mappings.Mappings) == 0 {
+		return nil, fmt.Errorf("grafana sink requires at least one [[influx.mapping]]")
+	}
+
+	stream := config.Stream
+	if stream == "" {
+		stream = defaultGrafanaStream
+	}
+	if !grafanaStreamID.MatchString(stream) {
+		return nil, fmt.Errorf("invalid grafana stream %q: only letters, digits, '_' and '-' are allowed", stream)
+	}
+
+	flushInterval := defaultGrafanaFlushInterval
+	if config.FlushInterval != "" {
+		d, err := time.ParseDuration(config.FlushInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid grafana flush_interval %q", config.FlushInterval)
+		}
+		flushInterval = d
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid grafana url %q", config.URL)
+	}
+
+	token := config.Token
+	if token == "" {
+		token = os.Getenv("GRAFANA_TOKEN")
+	}
+
+	return &GrafanaSink{
+		token:         token,
+		pushURL:       base.String() + "/api/live/push/" + stream,
+		flushInterval: flushInterval,
+		mappings:      mappings,
+		client:        &http.Client{Timeout: 5 * time.Second},
+		logger:        logger,
+	}, nil
+}
+
+func (s *GrafanaSink) Start(ctx context.Context) error {
+	s.start(ctx, s.run)
+	return nil
+}
+
+// run consumes messages until ctx is cancelled or messages is closed
+func (s *GrafanaSink) run(ctx context.Context, messages <-chan monitor.Message) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	var batch []string
+	failing := false
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := s.push(ctx, []byte(strings.Join(batch, "\n")))
+		switch {
+		case err != nil && !failing:
+			// Log the first failure only, a dashboard push can fail at the message rate
+			s.logger.Warn().Err(err).Msg("Grafana Live push failed, dropping values until it recovers")
+		case err == nil && failing:
+			s.logger.Info().Msg("Grafana Live push recovered")
+		}
+		failing = err != nil
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flush()
+		case msg, ok := <-messages:
+			if !ok {
+				flush()
+				return
+			}
+			line, ok := s.mappings.ToLineProtocol(msg.Topic, msg.Source, msg.RawPayload, msg.Timestamp)
+			if !ok {
+				continue
+			}
+			batch = append(batch, line)
+			if len(batch) >= grafanaMaxBatch {
+				flush()
+			}
+		}
+	}
+}
+
+func (s *GrafanaSink) push(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("grafana returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+}
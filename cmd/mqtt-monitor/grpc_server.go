@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/rawrobot/tui-mqtt-monitor/api/monitorpb"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// GRPCServer serves the monitorpb.Monitor service from the monitor's state
+type GRPCServer struct {
+	monitorpb.UnimplementedMonitorServer
+
+	server   *grpc.Server
+	listener net.Listener
+	state    *monitor.State
+	logger   zerolog.Logger
+}
+
+func NewGRPCServer(listen string, state *monitor.State, logger zerolog.Logger) (*GRPCServer, error) {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+
+	s := &GRPCServer{
+		server:   grpc.NewServer(),
+		listener: listener,
+		state:    state,
+		logger:   logger,
+	}
+	monitorpb.RegisterMonitorServer(s.server, s)
+	return s, nil
+}
+
+// Addr returns the address the gRPC service is listening on
+func (s *GRPCServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Start serves requests until ctx is cancelled
+func (s *GRPCServer) Start(ctx context.Context) {
+	go func() {
+		if err := s.server.Serve(s.listener); err != nil {
+			s.logger.Error().Err(err).Msg("gRPC server stopped")
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		// Subscribe streams only end with their clients, so don't wait for them
+		s.server.Stop()
+	}()
+}
+
+// Subscribe sends the requested backlog of buffered messages, then every new matching message
+func (s *GRPCServer) Subscribe(req *monitorpb.SubscribeRequest, stream grpc.ServerStreamingServer[monitorpb.Message]) error {
+	query := monitor.MessageQuery{
+		Topic:  req.GetTopic(),
+		Source: req.GetSource(),
+		Text:   req.GetText(),
+	}
+
+	// Subscribe before reading the backlog so no message is lost in between; a message
+	// arriving meanwhile may be sent twice
+	messages, unsubscribe := s.state.Subscribe(streamBuffer)
+	defer unsubscribe()
+
+	if req.GetBacklog() > 0 {
+		backlog := query
+		backlog.Limit = int(req.GetBacklog())
+		for _, msg := range s.state.Messages(backlog) {
+			if err := stream.Send(toProtoMessage(msg)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			if !query.Match(msg) {
+				continue
+			}
+			if err := stream.Send(toProtoMessage(msg)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *GRPCServer) GetStatus(ctx context.Context, req *monitorpb.GetStatusRequest) (*monitorpb.Status, error) {
+	stats := s.state.Stats(0)
+	status := &monitorpb.Status{
+		StartTime: timestamppb.New(stats.StartTime),
+		Messages:  stats.Messages,
+		Errors:    stats.Errors,
+	}
+	for _, conn := range s.state.Connections() {
+		status.Connections = append(status.Connections, &monitorpb.Connection{
+			Name:      conn.Name,
+			Server:    conn.Server,
+			Topics:    conn.Topics,
+			Connected: conn.Connected,
+			LastEvent: conn.LastEvent,
+			Since:     timestamppb.New(conn.Since),
+			Messages:  conn.Messages,
+		})
+	}
+	return status, nil
+}
+
+func toProtoMessage(msg monitor.Message) *monitorpb.Message {
+	return &monitorpb.Message{
+		Timestamp:    timestamppb.New(msg.Timestamp),
+		Source:       msg.Source,
+		Topic:        msg.Topic,
+		DisplayTopic: msg.DisplayTopic,
+		Payload:      msg.RawPayload,
+		Qos:          uint32(msg.QoS),
+		Retained:     msg.Retained,
+	}
+}
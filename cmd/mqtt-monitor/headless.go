@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+// Headless output formats
+const (
+	OutputJSON  = "json"  // One JSON record per line
+	OutputPlain = "plain" // The TUI's line layout without color tags
+)
+
+// HeadlessOutput writes the message feed to plain streams instead of the TUI:
+// one line per message on out, errors and status events on errOut
+type HeadlessOutput struct {
+	mu     sync.Mutex
+	format string
+	out    *bufio.Writer
+	errOut io.Writer
+	enc    *json.Encoder
+}
+
+func NewHeadlessOutput(format string, out, errOut io.Writer) (*HeadlessOutput, error) {
+	if format != OutputJSON && format != OutputPlain {
+		return nil, fmt.Errorf("invalid output format %q (expected %q or %q)", format, OutputJSON, OutputPlain)
+	}
+
+	w := bufio.NewWriter(out)
+	return &HeadlessOutput{
+		format: format,
+		out:    w,
+		errOut: errOut,
+		enc:    json.NewEncoder(w),
+	}, nil
+}
+
+func (h *HeadlessOutput) AddMessage(msg monitor.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.format == OutputPlain {
+		h.out.WriteString(formatPlainLine(msg))
+		h.out.WriteByte('\n')
+	} else if err := h.enc.Encode(sessionlogger.NewMessageRecord(msg)); err != nil {
+		return
+	}
+	// Flush per message so consumers reading a pipe see messages as they arrive
+	h.out.Flush()
+}
+
+func (h *HeadlessOutput) AddConnectionEvent(event monitor.ConnectionEvent) {
+	fmt.Fprintf(h.errOut, "%s %s\n", event.Time.Format(time.RFC3339Nano), event)
+}
+
+func (h *HeadlessOutput) AddError(err error) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(h.errOut, "%s %s\n", time.Now().Format(time.RFC3339Nano), err)
+}
+
+// formatPlainLine lays out a message like the TUI does: time, source, display topic and payload
+func formatPlainLine(msg monitor.Message) string {
+	return fmt.Sprintf("%s %s %s %s", msg.Timestamp.Format("15:04:05.000"), msg.Source, msg.DisplayTopic, msg.Payload)
+}
+
+// UpdateStatus is a no-op; the running totals are only shown by the TUI
+func (h *HeadlessOutput) UpdateStatus(string) {}
+
+// configureHeadlessLogging sends application logs to stderr, which the TUI
+// otherwise has to keep silent
+func configureHeadlessLogging(config *Config) {
+	var w io.Writer = os.Stderr
+	if config.Logging.Pretty {
+		w = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+	}
+	log.Logger = zerolog.New(w).With().Timestamp().Logger()
+}
+
+// runHeadless runs the monitor without the TUI until interrupted, so the same
+// configuration can be used from scripts, containers and cron jobs
+func runHeadless(config *Config, opts *cliOptions, format string) {
+	output, err := NewHeadlessOutput(format, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	configureHeadlessLogging(config)
+	spool := newPayloadSpool(config)
+	defer spool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sessionLogger := initializeSessionLogger(config)
+	if sessionLogger != nil {
+		sessionLogger.Start(ctx)
+		defer sessionLogger.Close()
+		startLogTail(config, sessionLogger, ctx)
+	}
+
+	m := newMonitor(config)
+	state := m.State()
+	state.SetMemoryLimit(config.Display.memoryLimit)
+	state.SetPayloadSpool(spool)
+	if err := state.SetSequenceRules(config.Sequences); err != nil {
+		m.Notify(err)
+	}
+	startAPI(config, state, ctx)
+	startDebug(config, m, ctx)
+	telemetry := startTelemetry(config, state, ctx)
+	defer stopTelemetry(telemetry)
+	defer startSinks(config, state, ctx)()
+	statusPublisher := startStatusPublisher(config, state, m.Clients(), ctx)
+	defer startAlerts(config, state, m.Notify, ctx)()
+	stateStore := restoreRuntimeState(opts.configFile, sessionLogger, m.Notify)
+	controller := NewController(state, m.Clients(), sessionLogger, stateStore, nil, m.Notify)
+	remoteControl := startControl(config, controller, m.Clients(), ctx)
+	reloader := NewReloader(opts.configFile, opts.loadConfig, config, m, controller, sessionLogger, nil, spool, ctx)
+	reloader.SetClientHooks(statusPublisher, remoteControl)
+	reloader.Start()
+
+	if sessionLogger != nil {
+		warnSharedOutputDir(config, sessionLogger, m.Notify)
+		handleRotateSignal(ctx, func() { rotateSessionLog(sessionLogger, m.Notify) })
+	}
+
+	systemd := NewSystemdNotifier(log.With().Str("component", "systemd").Logger())
+
+	sigCh := setupSignalHandler()
+	m.AddHandler(newViewHandler(output, state, telemetry, sessionLogger))
+	monitorDone := runPipeline(m, ctx)
+	systemd.Ready(m, ctx)
+
+	sig := <-sigCh
+	log.Info().Str("signal", sig.String()).Msg("Shutting down")
+	systemd.Stopping()
+
+	cancel()
+	waitForMonitor(monitorDone)
+}
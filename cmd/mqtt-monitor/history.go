@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+)
+
+// MaxHistoryResults caps the number of records returned by a history search
+const MaxHistoryResults = 500
+
+var errHistoryLimit = errors.New("history result limit reached")
+
+// HistoryQuery selects records from the structured session logs in output_dir.
+// Text terms match case-insensitively against topic, source and payload.
+type HistoryQuery struct {
+	Terms  []string
+	Filter RecordFilter
+}
+
+// ParseHistoryQuery parses "text topic:<filter> since:<duration> from:<RFC3339> to:<RFC3339>"
+func ParseHistoryQuery(input string, now time.Time) (HistoryQuery, error) {
+	var query HistoryQuery
+
+	for _, field := range strings.Fields(input) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok || value == "" {
+			query.Terms = append(query.Terms, strings.ToLower(field))
+			continue
+		}
+
+		var err error
+		switch key {
+		case "topic":
+			query.Filter.Topics = append(query.Filter.Topics, value)
+		case "since":
+			var d time.Duration
+			if d, err = time.ParseDuration(value); err == nil {
+				query.Filter.From = now.Add(-d)
+			}
+		case "from":
+			query.Filter.From, err = time.Parse(time.RFC3339, value)
+		case "to":
+			query.Filter.To, err = time.Parse(time.RFC3339, value)
+		default:
+			query.Terms = append(query.Terms, strings.ToLower(field))
+		}
+		if err != nil {
+			return query, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	return query, nil
+}
+
+func (q HistoryQuery) match(record sessionlog.Record) bool {
+	if record.Type != sessionlog.TypeMessage || !q.Filter.Match(record) {
+		return false
+	}
+	for _, term := range q.Terms {
+		if !strings.Contains(strings.ToLower(record.Topic), term) &&
+			!strings.Contains(strings.ToLower(record.Source), term) &&
+			!strings.Contains(strings.ToLower(record.Payload), term) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchHistory scans the structured session logs in dir, oldest file first,
+// and returns up to limit matching records. The boolean reports truncation.
+func SearchHistory(dir string, query HistoryQuery, limit int) ([]sessionlog.Record, bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []logFile
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".jsonl" && ext != ".mqcap") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		// Skip files that ended before the requested time range
+		if !query.Filter.From.IsZero() && info.ModTime().Before(query.Filter.From) {
+			continue
+		}
+		files = append(files, logFile{filepath.Join(dir, entry.Name()), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	var results []sessionlog.Record
+	for _, f := range files {
+		file, err := os.Open(f.path)
+		if err != nil {
+			continue
+		}
+		err = sessionlog.Scan(file, func(record sessionlog.Record) error {
+			if !query.match(record) {
+				return nil
+			}
+			results = append(results, record)
+			if len(results) >= limit {
+				return errHistoryLimit
+			}
+			return nil
+		})
+		file.Close()
+
+		if errors.Is(err, errHistoryLimit) {
+			return results, true, nil
+		}
+		if err != nil {
+			return results, false, fmt.Errorf("%s: %w", f.path, err)
+		}
+	}
+
+	return results, false, nil
+}
+
+// FormatHistoryResults renders search results for the history panel
+func FormatHistoryResults(records []sessionlog.Record, truncated bool) string {
+	if len(records) == 0 {
+		return "No matching messages found"
+	}
+
+	var b strings.Builder
+	for _, record := range records {
+		fmt.Fprintf(&b, "[yellow]%s[white] [cyan]%s[white] [green]%s[white] %s\n",
+			record.Timestamp.Format("2006-01-02 15:04:05.000"),
+			tview.Escape(record.Source),
+			tview.Escape(record.Topic),
+			tview.Escape(record.Payload))
+	}
+	if truncated {
+		fmt.Fprintf(&b, "[red]... stopped after %d results, refine the query[white]\n", len(records))
+	}
+	return b.String()
+}
+
+// promptHistorySearch asks for a query, searches dir and shows the results
+func promptHistorySearch(ui *UI, dir string) {
+	ui.Prompt("History search (text topic:a/# since:1h from:/to:RFC3339): ", "", func(input string) {
+		query, err := ParseHistoryQuery(input, time.Now())
+		if err != nil {
+			ui.ShowPanel("History search", tview.Escape(err.Error()))
+			return
+		}
+
+		records, truncated, err := SearchHistory(dir, query, MaxHistoryResults)
+		if err != nil {
+			ui.ShowPanel("History search", tview.Escape(err.Error()))
+			return
+		}
+
+		ui.ShowPanel(fmt.Sprintf("History: %s (%d results)", tview.Escape(input), len(records)),
+			FormatHistoryResults(records, truncated))
+	})
+}
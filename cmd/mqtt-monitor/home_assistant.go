@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultDiscoveryPrefix = "homeassistant"
+
+// HomeAssistantConfig configures Home Assistant MQTT discovery of the monitor's status
+type HomeAssistantConfig struct {
+	Enabled         bool   `toml:"enabled"`          // Publish discovery configs for the status sensors
+	DiscoveryPrefix string `toml:"discovery_prefix"` // Home Assistant discovery prefix (default: "homeassistant")
+}
+
+// haEntity is a Home Assistant MQTT discovery config
+type haEntity struct {
+	Name                 string   `json:"name"`
+	UniqueID             string   `json:"unique_id"`
+	ObjectID             string   `json:"object_id"`
+	StateTopic           string   `json:"state_topic"`
+	ValueTemplate        string   `json:"value_template"`
+	UnitOfMeasurement    string   `json:"unit_of_measurement,omitempty"`
+	StateClass           string   `json:"state_class,omitempty"`
+	DeviceClass          string   `json:"device_class,omitempty"`
+	EntityCategory       string   `json:"entity_category,omitempty"`
+	Icon                 string   `json:"icon,omitempty"`
+	PayloadOn            string   `json:"payload_on,omitempty"`
+	PayloadOff           string   `json:"payload_off,omitempty"`
+	AvailabilityTopic    string   `json:"availability_topic"`
+	AvailabilityTemplate string   `json:"availability_template"`
+	PayloadAvailable     string   `json:"payload_available"`
+	PayloadNotAvailable  string   `json:"payload_not_available"`
+	Device               haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+	Model       string   `json:"model"`
+	SWVersion   string   `json:"sw_version,omitempty"`
+}
+
+// haDiscoveryMessage is a discovery config with the topic it is published on
+type haDiscoveryMessage struct {
+	topic   string
+	payload []byte
+}
+
+var haIDUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// haID makes s usable as a Home Assistant node or object ID
+func haID(s string) string {
+	return strings.Trim(haIDUnsafe.ReplaceAllString(strings.ToLower(s), "_"), "_")
+}
+
+// validateHomeAssistantConfig checks the discovery settings
+func validateHomeAssistantConfig(c HomeAssistantConfig) error {
+	if strings.ContainsAny(c.DiscoveryPrefix, "+#") {
+		return fmt.Errorf("home_assistant discovery_prefix %q must not contain wildcards", c.DiscoveryPrefix)
+	}
+	return nil
+}
+
+// homeAssistantDiscovery builds the discovery configs that expose the StatusReport on
+// statusTopic as the sensors of a device identified by node
+func homeAssistantDiscovery(config HomeAssistantConfig, node, deviceName, statusTopic string, connections []string) []haDiscoveryMessage {
+	prefix := strings.TrimSuffix(config.DiscoveryPrefix, "/")
+	if prefix == "" {
+		prefix = defaultDiscoveryPrefix
+	}
+
+	device := haDevice{
+		Identifiers: []string{node},
+		Name:        deviceName,
+		Model:       "tui-mqtt-monitor",
+		SWVersion:   gitHash,
+	}
+
+	newEntity := func(id, name, template string) haEntity {
+		return haEntity{
+			Name:                 name,
+			UniqueID:             node + "_" + id,
+			ObjectID:             node + "_" + id,
+			StateTopic:           statusTopic,
+			ValueTemplate:        template,
+			AvailabilityTopic:    statusTopic,
+			AvailabilityTemplate: "{{ value_json.state }}",
+			PayloadAvailable:     "online",
+			PayloadNotAvailable:  "offline",
+			Device:               device,
+		}
+	}
+
+	var messages []haDiscoveryMessage
+	add := func(component, id string, entity haEntity) {
+		payload, err := json.Marshal(entity)
+		if err != nil {
+			return
+		}
+		messages = append(messages, haDiscoveryMessage{
+			topic:   fmt.Sprintf("%s/%s/%s/%s/config", prefix, component, node, id),
+			payload: payload,
+		})
+	}
+
+	rate := newEntity("rate", "Message rate", "{{ value_json.rate_per_second | round(2) }}")
+	rate.UnitOfMeasurement, rate.StateClass, rate.Icon = "msg/s", "measurement", "mdi:speedometer"
+	add("sensor", "rate", rate)
+
+	total := newEntity("messages", "Messages", "{{ value_json.messages }}")
+	total.UnitOfMeasurement, total.StateClass, total.Icon = "messages", "total_increasing", "mdi:message-text"
+	add("sensor", "messages", total)
+
+	errorCount := newEntity("errors", "Errors", "{{ value_json.errors }}")
+	errorCount.StateClass, errorCount.Icon, errorCount.EntityCategory = "total_increasing", "mdi:alert-circle", "diagnostic"
+	add("sensor", "errors", errorCount)
+
+	started := newEntity("start_time", "Started", "{{ value_json.start_time }}")
+	started.DeviceClass, started.EntityCategory = "timestamp", "diagnostic"
+	add("sensor", "start_time", started)
+
+	for _, name := range connections {
+		id := "connection_" + haID(name)
+		connected := newEntity(id, name+" connected", fmt.Sprintf(
+			"{{ 'ON' if (value_json.connections | selectattr('name', 'eq', %s) | map(attribute='connected') | first) else 'OFF' }}",
+			jinjaString(name)))
+		connected.DeviceClass, connected.EntityCategory = "connectivity", "diagnostic"
+		connected.PayloadOn, connected.PayloadOff = "ON", "OFF"
+		add("binary_sensor", id, connected)
+	}
+
+	return messages
+}
+
+// jinjaString quotes s as a Jinja string literal
+func jinjaString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
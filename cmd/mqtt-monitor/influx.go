@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// InfluxConfig maps JSON payload fields of MQTT topics to InfluxDB measurements
+type InfluxConfig struct {
+	Mappings []InfluxMapping `toml:"mapping"`
+}
+
+// InfluxMapping describes how messages on matching topics become line protocol points
+type InfluxMapping struct {
+	Topic       string         `toml:"topic"`       // MQTT topic filter, wildcards allowed
+	Measurement string         `toml:"measurement"` // Measurement name (default: last topic level)
+	Fields      []string       `toml:"fields"`      // JSON fields to write, nested as "a.b"; empty writes all numeric and boolean fields
+	TopicTags   map[string]int `toml:"topic_tags"`  // Tag name to zero-based topic level, e.g. { site = 1 }
+}
+
+// ToLineProtocol converts a message into an InfluxDB line protocol point using the first
+// matching mapping. It returns false when no mapping matches or no fields were extracted.
+func (c InfluxConfig) ToLineProtocol(topic, source string, payload []byte, ts time.Time) (string, bool) {
+	for _, mapping := range c.Mappings {
+		if mqtt.TopicMatches(mapping.Topic, topic) {
+			return mapping.lineProtocol(topic, source, payload, ts)
+		}
+	}
+	return "", false
+}
+
+func (m InfluxMapping) lineProtocol(topic, source string, payload []byte, ts time.Time) (string, bool) {
+	var document any
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return "", false
+	}
+
+	values := make(map[string]any)
+	monitor.FlattenJSON("", document, values)
+
+	fields := m.Fields
+	if len(fields) == 0 {
+		for name, value := range values {
+			switch value.(type) {
+			case float64, bool:
+				fields = append(fields, name)
+			}
+		}
+		sort.Strings(fields)
+	}
+
+	var fieldSet []string
+	for _, name := range fields {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if encoded, ok := encodeInfluxField(value); ok {
+			fieldSet = append(fieldSet, escapeInfluxKey(name)+"="+encoded)
+		}
+	}
+	if len(fieldSet) == 0 {
+		return "", false
+	}
+
+	levels := strings.Split(topic, "/")
+	measurement := m.Measurement
+	if measurement == "" {
+		measurement = levels[len(levels)-1]
+	}
+
+	tags := map[string]string{"topic": topic}
+	if source != "" {
+		tags["source"] = source
+	}
+	for name, level := range m.TopicTags {
+		if level >= 0 && level < len(levels) {
+			tags[name] = levels[level]
+		}
+	}
+	tagNames := make([]string, 0, len(tags))
+	for name := range tags {
+		tagNames = append(tagNames, name)
+	}
+	sort.Strings(tagNames) // InfluxDB recommends sorted tag keys
+
+	var b strings.Builder
+	b.WriteString(escapeInfluxMeasurement(measurement))
+	for _, name := range tagNames {
+		if tags[name] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(escapeInfluxKey(name))
+		b.WriteByte('=')
+		b.WriteString(escapeInfluxKey(tags[name]))
+	}
+	b.WriteByte(' ')
+	b.WriteString(strings.Join(fieldSet, ","))
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+
+	return b.String(), true
+}
+
+func encodeInfluxField(value any) (string, bool) {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`, true
+	default:
+		return "", false
+	}
+}
+
+func escapeInfluxMeasurement(s string) string {
+	return strings.NewReplacer(",", `\,`, " ", `\ `).Replace(s)
+}
+
+func escapeInfluxKey(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
+
+// validateInfluxConfig checks the measurement mappings
+func validateInfluxConfig(c InfluxConfig) error {
+	for i, mapping := range c.Mappings {
+		if mapping.Topic == "" {
+			return fmt.Errorf("influx mapping %d: topic is required", i+1)
+		}
+		if err := validateTopicFilters(fmt.Sprintf("influx mapping %d", i+1), []string{mapping.Topic}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	defaultInfluxBatchSize     = 500
+	defaultInfluxFlushInterval = time.Second
+	defaultInfluxMaxRetries    = 3
+)
+
+// InfluxSinkConfig configures live writes to InfluxDB v2
+type InfluxSinkConfig struct {
+	URL           string `toml:"url"`            // InfluxDB base URL, e.g. "http://localhost:8086"
+	Org           string `toml:"org"`            // Organization name
+	Bucket        string `toml:"bucket"`         // Destination bucket
+	Token         string `toml:"token"`          // API token (default: INFLUX_TOKEN environment variable)
+	BatchSize     int    `toml:"batch_size"`     // Points per write request (default: 500)
+	FlushInterval string `toml:"flush_interval"` // Maximum time points wait before being written (default: "1s")
+	MaxRetries    int    `toml:"max_retries"`    // Retries for a failed batch before it is dropped (default: 3)
+}
+
+func init() {
+	RegisterSink("influxdb", func(entry SinkEntry, config *Config, logger zerolog.Logger) (Sink, error) {
+		var c InfluxSinkConfig
+		if err := entry.Decode(&c); err != nil {
+			return nil, err
+		}
+		return NewInfluxSink(c, config.Influx, logger)
+	})
+}
+
+// InfluxSink converts messages with the [[influx.mapping]] rules and writes them to InfluxDB
+// in batches, retrying transient failures with exponential backoff
+type InfluxSink struct {
+	sinkQueue
+	config        InfluxSinkConfig
+	mappings      InfluxConfig
+	writeURL      string
+	flushInterval time.Duration
+	client        *http.Client
+	logger        zerolog.Logger
+}
+
+func NewInfluxSink(config InfluxSinkConfig, mappings InfluxConfig, logger zerolog.Logger) (*InfluxSink, error) {
+	if config.Org == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("influxdb sink requires org and bucket")
+	}
+	if len(mappings.Mappings) == 0 {
+		return nil, fmt.Errorf("influxdb sink requires at least one [[influx.mapping]]")
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("INFLUX_TOKEN")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultInfluxBatchSize
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultInfluxMaxRetries
+	}
+
+	flushInterval := defaultInfluxFlushInterval
+	if config.FlushInterval != "" {
+		d, err := time.ParseDuration(config.FlushInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid influxdb flush_interval %q", config.FlushInterval)
+		}
+		flushInterval = d
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid influxdb url %q", config.URL)
+	}
+	query := url.Values{"org": {config.Org}, "bucket": {config.Bucket}, "precision": {"ns"}}
+	writeURL := base.String() + "/api/v2/write?" + query.Encode()
+
+	return &InfluxSink{
+		config:        config,
+		mappings:      mappings,
+		writeURL:      writeURL,
+		flushInterval: flushInterval,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		logger:        logger,
+	}, nil
+}
+
+func (s *InfluxSink) Start(ctx context.Context) error {
+	s.start(ctx, s.run)
+	return nil
+}
+
+// run consumes messages until ctx is cancelled or messages is closed, then flushes
+// the pending batch
+func (s *InfluxSink) run(ctx context.Context, messages <-chan monitor.Message) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]string, 0, s.config.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.writeWithRetry(ctx, batch); err != nil {
+			s.logger.Error().Err(err).Int("points", len(batch)).Msg("Dropping InfluxDB batch")
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Give the final batch a short grace period of its own
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			flush(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			flush(ctx)
+		case msg, ok := <-messages:
+			if !ok {
+				flush(ctx)
+				return
+			}
+			line, ok := s.mappings.ToLineProtocol(msg.Topic, msg.Source, msg.RawPayload, msg.Timestamp)
+			if !ok {
+				continue
+			}
+			batch = append(batch, line)
+			if len(batch) >= s.config.BatchSize {
+				flush(ctx)
+			}
+		}
+	}
+}
+
+func (s *InfluxSink) writeWithRetry(ctx context.Context, lines []string) error {
+	body := []byte(strings.Join(lines, "\n"))
+	return retryWithBackoff(ctx, s.config.MaxRetries, func() error {
+		err := s.write(ctx, body)
+		if err != nil {
+			s.logger.Warn().Err(err).Msg("InfluxDB write failed")
+		}
+		return err
+	})
+}
+
+func (s *InfluxSink) write(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.config.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("influxdb returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return &permanentError{err}
+}
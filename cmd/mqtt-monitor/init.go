@@ -0,0 +1,80 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// starterConfig is the fully commented config written by the init subcommand
+//
+//go:embed templates/config.toml
+var starterConfig []byte
+
+// runInit writes a starter config listing every section, so new setups do not
+// have to piece the schema together from the README
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	force := flags.Bool("force", false, "Overwrite an existing file")
+	wizard := flags.Bool("wizard", false, "Set up the connection in a form that can test it before writing the file")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s init [-force] [-wizard] [config.toml]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one config file")
+	}
+	path := "config.toml"
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	if *wizard {
+		if _, err := os.Stat(path); err == nil && !*force {
+			return fmt.Errorf("%s already exists (use -force to overwrite)", path)
+		}
+		saved, err := runSetupWizard(path, *force)
+		if err != nil || !saved {
+			return err
+		}
+		fmt.Printf("Wrote %s\nStart monitoring with: %s -config %s\n", path, os.Args[0], path)
+		return nil
+	}
+
+	if err := writeConfigFile(path, starterConfig, *force); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\nEdit the [[connection]] section, then run: %s check %s\n", path, os.Args[0], path)
+	return nil
+}
+
+// writeConfigFile creates a config file readable only by its owner, as it may
+// hold passwords. An existing file is kept unless force is set.
+func writeConfigFile(path string, data []byte, force bool) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, mode, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists (use -force to overwrite)", path)
+	} else if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// splitKeyringEntry splits a password_keyring value into service and account
+func splitKeyringEntry(entry string) (service, account string, err error) {
+	service, account, ok := strings.Cut(entry, "/")
+	if !ok || service == "" || account == "" {
+		return "", "", fmt.Errorf("invalid password_keyring %q (expected \"service/account\")", entry)
+	}
+	return service, account, nil
+}
+
+// resolveKeyringPasswords looks up the password of every connection with a
+// password_keyring entry in the OS keyring (Secret Service, macOS Keychain or
+// Windows Credential Manager). A password set in the config file or through the
+// environment takes precedence.
+func resolveKeyringPasswords(connections []monitor.ConnectionConfig) error {
+	for i := range connections {
+		conn := &connections[i]
+		if conn.PasswordKeyring == "" || conn.Password != "" {
+			continue
+		}
+		password, err := lookupKeyringPassword(conn.PasswordKeyring)
+		if err != nil {
+			return fmt.Errorf("connection %s: %w", conn.Name, err)
+		}
+		conn.Password = password
+	}
+	return nil
+}
+
+// lookupKeyringPassword returns the secret of a password_keyring entry
+func lookupKeyringPassword(entry string) (string, error) {
+	service, account, err := splitKeyringEntry(entry)
+	if err != nil {
+		return "", err
+	}
+	password, err := keyring.Get(service, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("no keyring entry %s (store it with: %s keyring set %s)", entry, os.Args[0], entry)
+	} else if err != nil {
+		return "", fmt.Errorf("keyring entry %s: %w", entry, err)
+	}
+	return password, nil
+}
+
+// runKeyring stores or removes the passwords referenced by password_keyring
+func runKeyring(args []string) error {
+	flags := flag.NewFlagSet("keyring", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s keyring set|delete service/account\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "set reads the password from the terminal, or the first line of stdin when it is not a terminal")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected a command and a keyring entry")
+	}
+	service, account, err := splitKeyringEntry(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	switch flags.Arg(0) {
+	case "set":
+		password, err := readPassword("Password for " + flags.Arg(1) + ": ")
+		if err != nil {
+			return err
+		}
+		if password == "" {
+			return fmt.Errorf("empty password")
+		}
+		if err := keyring.Set(service, account, password); err != nil {
+			return err
+		}
+		fmt.Printf("Stored %s; reference it with password_keyring = %q\n", flags.Arg(1), flags.Arg(1))
+	case "delete":
+		if err := keyring.Delete(service, account); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s\n", flags.Arg(1))
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", flags.Arg(0))
+	}
+	return nil
+}
+
+// stdinReader reads piped secrets line by line, shared so that a second secret is
+// not lost in the buffer of the first
+var stdinReader = sync.OnceValue(func() *bufio.Reader { return bufio.NewReader(os.Stdin) })
+
+// readPassword reads a password without echoing it, or a line of piped input
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdinReader().ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
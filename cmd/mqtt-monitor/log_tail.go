@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// tailClientBuffer is the number of lines queued per tail client before lines are dropped
+const tailClientBuffer = 256
+
+// LogTailServer streams session log lines to clients connected over a unix domain
+// socket or a TCP address, e.g. for "nc -U /tmp/mqtt-monitor.sock"
+type LogTailServer struct {
+	listener net.Listener
+	network  string
+	address  string
+	logger   zerolog.Logger
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+// NewLogTailServer listens on spec, which is "unix:/path/to.sock" or "tcp:127.0.0.1:7070"
+func NewLogTailServer(spec string, logger zerolog.Logger) (*LogTailServer, error) {
+	network, address, err := parseListenSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		// Remove a stale socket left behind by a previous run
+		os.Remove(address)
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", spec, err)
+	}
+
+	return &LogTailServer{
+		listener: listener,
+		network:  network,
+		address:  address,
+		logger:   logger,
+		clients:  make(map[chan []byte]struct{}),
+	}, nil
+}
+
+// parseListenSpec splits "unix:/path" or "tcp:host:port" into network and address
+func parseListenSpec(spec string) (string, string, error) {
+	network, address, ok := strings.Cut(spec, ":")
+	if !ok || address == "" || (network != "unix" && network != "tcp") {
+		return "", "", fmt.Errorf("invalid listen address %q (expected unix:/path or tcp:host:port)", spec)
+	}
+	return network, address, nil
+}
+
+// Start accepts clients until ctx is cancelled
+func (s *LogTailServer) Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(ctx, conn)
+		}
+	}()
+}
+
+func (s *LogTailServer) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	lines := make(chan []byte, tailClientBuffer)
+	s.mu.Lock()
+	s.clients[lines] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, lines)
+		s.mu.Unlock()
+	}()
+
+	s.logger.Debug().Str("client", conn.RemoteAddr().String()).Msg("Log tail client connected")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case line := <-lines:
+			if _, err := conn.Write(line); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Broadcast sends a log line to every connected client, dropping it for slow clients
+func (s *LogTailServer) Broadcast(line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.clients) == 0 {
+		return
+	}
+
+	data := append([]byte(nil), line...)
+	for client := range s.clients {
+		select {
+		case client <- data:
+		default:
+		}
+	}
+}
+
+func (s *LogTailServer) Close() error {
+	err := s.listener.Close()
+	if s.network == "unix" {
+		os.Remove(s.address)
+	}
+	return err
+}
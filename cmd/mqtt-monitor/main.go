@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/signal"
-	"sync"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/publisher"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
 )
 
 var (
@@ -20,15 +28,156 @@ var (
 	buildDate string
 )
 
+// shutdownTimeout bounds how long shutdown waits for the monitor to disconnect
+// and stop decoding
+const shutdownTimeout = 3 * time.Second
+
 func main() {
 	// Configure zerolog before loading configuration
 	configureZerolog()
 
-	config := loadConfiguration()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "verify":
+			if err := runVerify(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Verify failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "init":
+			if err := runInit(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Init failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "keyring":
+			if err := runKeyring(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Keyring failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "check":
+			if err := runCheck(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Check failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "encrypt":
+			if err := runEncrypt(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Encrypt failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "bench":
+			if err := runBench(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Bench failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "probe":
+			if err := runProbe(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Probe failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "publish":
+			if err := publisher.Run(os.Args[0]+" publish", os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Publish failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "monitor", "replay":
+			runMonitor(os.Args[1], os.Args[2:])
+			return
+		case "help":
+			printCommands(os.Stdout)
+			return
+		default:
+			if !strings.HasPrefix(os.Args[1], "-") {
+				fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+				printCommands(os.Stderr)
+				os.Exit(2)
+			}
+		}
+	}
+
+	// Without a command, the flags are those of monitor
+	runMonitor("monitor", os.Args[1:])
+}
+
+// commands lists the commands of mqtt-monitor in usage order
+var commands = []struct{ name, usage string }{
+	{"monitor", "Monitor brokers in the TUI or headless (the default without a command)"},
+	{"replay", "Browse a recorded session log, or publish it back to a broker with -publish"},
+	{"publish", "Publish test traffic: generated readings, scenarios, CSV scripts, load tests"},
+	{"export", "Export recorded messages as CSV or InfluxDB line protocol"},
+	{"verify", "Check recorded session logs against their manifests"},
+	{"check", "Validate a config file without connecting"},
+	{"probe", "Report which topic filters the broker's ACLs let each connection subscribe to"},
+	{"init", "Write a commented starter config file"},
+	{"keyring", "Store or delete the passwords referenced by password_keyring"},
+	{"encrypt", "Encrypt a password for password_encrypted with a master passphrase"},
+	{"bench", "Measure the message pipeline's throughput, drops and allocations"},
+}
+
+// printCommands writes the command overview shown by help and by the usage of monitor
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags] [args]\n\nCommands:\n", os.Args[0])
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", command.name, command.usage)
+	}
+	fmt.Fprintf(w, "\nRun %s <command> -h for the flags of a command.\n", os.Args[0])
+}
+
+// runMonitor runs the monitor or replay command: everything that shows messages
+// or publishes recorded ones, selected by the flags
+func runMonitor(command string, args []string) {
+	config, opts := loadConfiguration(command, args)
 	if config == nil {
 		os.Exit(1)
 	}
 
+	if opts.replayFile != "" {
+		runReplay(config, opts.replayFile)
+		return
+	}
+
+	if opts.attach != "" {
+		runAttach(config, opts.attach)
+		return
+	}
+
+	if opts.republishFile != "" {
+		if err := runRepublish(config, opts.republishFile, opts.republish); err != nil {
+			fmt.Fprintf(os.Stderr, "Republish failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	preflight(config, opts)
+
+	if opts.noTUI || opts.output != "" {
+		format := opts.output
+		if format == "" {
+			format = OutputJSON
+		}
+		runHeadless(config, opts, format)
+		return
+	}
+
+	ui := newUI(config)
+	spool := newPayloadSpool(config)
+	defer spool.Close()
+	ui.SetPayloadSpool(spool)
+	ui.SetConnectionTabs(config.Connections)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -36,21 +185,56 @@ func main() {
 	if sessionLogger != nil {
 		sessionLogger.Start(ctx)
 		defer sessionLogger.Close()
+		startLogTail(config, sessionLogger, ctx)
+	}
+
+	m := newMonitor(config)
+	state := m.State()
+	state.SetMemoryLimit(config.Display.memoryLimit)
+	state.SetPayloadSpool(spool)
+	if err := state.SetSequenceRules(config.Sequences); err != nil {
+		m.Notify(err)
+	}
+	state.AddDropCounter(dropUIQueue, ui.Dropped)
+	startAPI(config, state, ctx)
+	startDebug(config, m, ctx)
+	telemetry := startTelemetry(config, state, ctx)
+	defer stopTelemetry(telemetry)
+	defer startSinks(config, state, ctx)()
+	statusPublisher := startStatusPublisher(config, state, m.Clients(), ctx)
+	defer startAlerts(config, state, m.Notify, ctx)()
+	stateStore := restoreRuntimeState(opts.configFile, sessionLogger, m.Notify)
+	controller := NewController(state, m.Clients(), sessionLogger, stateStore, ui, m.Notify)
+	remoteControl := startControl(config, controller, m.Clients(), ctx)
+	reloader := NewReloader(opts.configFile, opts.loadConfig, config, m, controller, sessionLogger, ui, spool, ctx)
+	reloader.SetClientHooks(statusPublisher, remoteControl)
+	reloader.Start()
+
+	if sessionLogger != nil {
+		warnSharedOutputDir(config, sessionLogger, m.Notify)
+		rotate := func() { rotateSessionLog(sessionLogger, m.Notify) }
+		ui.BindAction("rotate_log", rotate)
+		handleRotateSignal(ctx, rotate)
+	}
+	ui.BindAction("command", func() { promptCommand(ui, state) })
+	ui.BindAction("diagnostics", func() { showDiagnostics(ui, m) })
+	ui.BindAction("coverage", func() { showCoverage(ui, state, "") })
+	if config.Logging.OutputDir != "" {
+		ui.BindAction("history", func() { promptHistorySearch(ui, config.Logging.OutputDir) })
 	}
 
-	ui := NewUI(config.Display.Truncate) // Pass truncate setting to UI
-	messagesCh, errorsCh := make(chan MonitorMessage, 1000), make(chan error, 100)
-	clients := createMQTTClients(config, messagesCh, errorsCh, ctx)
+	if opts.restore != "" {
+		m.Notify(restoreSnapshot(ui, opts.restore))
+	}
 
 	sigCh := setupSignalHandler()
 	uiDone := startUI(ui, ctx)
 
-	connectClients(clients, errorsCh, ctx)
-
-	messageHandlerDone := handleMessagesAndErrors(ui, messagesCh, errorsCh, clients, sessionLogger, ctx)
+	m.AddHandler(newViewHandler(ui, state, telemetry, sessionLogger))
+	monitorDone := runPipeline(m, ctx)
 
 	shutdownReason := waitForShutdownSignal(sigCh, uiDone)
-	performGracefulShutdown(cancel, ui, clients, messageHandlerDone, messagesCh, errorsCh, shutdownReason)
+	performGracefulShutdown(cancel, ui, monitorDone, shutdownReason)
 }
 
 func configureZerolog() {
@@ -62,40 +246,198 @@ func configureZerolog() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 }
 
-func loadConfiguration() *Config {
-	configFile := flag.String("config", "config.toml", "Path to configuration file")
-	versionFlag := flag.Bool("version", false, "Display version information")
+// cliOptions holds command line settings that are not part of the config file
+type cliOptions struct {
+	configFile    string
+	replayFile    string
+	attach        string
+	republishFile string
+	republish     RepublishOptions
+	noTUI         bool
+	output        string
+	connection    connectionFlags
+	profile       string
+	theme         string
+	keymap        string
+	preflight     bool
+	preflightOnly bool
+	restore       string // Snapshot file to start the TUI with
+}
+
+// runsMonitor reports whether the options start the monitor in the TUI
+func (o *cliOptions) runsMonitor() bool {
+	return !o.noTUI && o.output == "" && o.replayFile == "" && o.attach == "" && o.republishFile == "" && !o.preflightOnly
+}
+
+// loadConfig reads the config file. A connection given on the command line replaces
+// the configured ones and makes the file optional.
+func (o *cliOptions) loadConfig() (*Config, error) {
+	config, err := LoadConfig(o.configFile)
+	if err == nil && o.profile != "" {
+		err = config.UseProfile(o.profile)
+	}
+	if err == nil {
+		o.applyDisplayFlags(config)
+	}
+	if !o.connection.Given() {
+		if err == nil {
+			err = resolvePasswords(config.Connections)
+		}
+		return config, err
+	}
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		config = DefaultConfig()
+	}
+	return config, o.connection.apply(config)
+}
+
+// applyDisplayFlags selects the theme and keymap given on the command line
+func (o *cliOptions) applyDisplayFlags(config *Config) {
+	if o.theme != "" {
+		config.Display.Theme = o.theme
+	}
+	if o.keymap != "" {
+		config.Display.Keymap = o.keymap
+	}
+}
 
-	// Override default usage function
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nBuild Information:\n")
-		fmt.Fprintf(os.Stderr, "  Build Date: %s\n", buildDate)
-		fmt.Fprintf(os.Stderr, "  Git Hash: %s\n", gitHash)
+// loadConfiguration parses the flags of command, monitor or replay, and loads the
+// configuration they select
+func loadConfiguration(command string, args []string) (*Config, *cliOptions) {
+	opts := &cliOptions{}
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(&opts.configFile, "config", findConfigFile(), "Path to configuration file (searched in $XDG_CONFIG_HOME/mqtt-monitor, ~/.config/mqtt-monitor and the working directory)")
+	flags.StringVar(&opts.profile, "profile", "", "Use the connections and display settings of this [profile.<name>] (default: pick one at startup when profiles are configured)")
+	flags.StringVar(&opts.theme, "theme", "", "Theme to start with: a name from [display.themes] or a theme file (default: display theme)")
+	flags.StringVar(&opts.keymap, "keymap", "", "Keymap to start with: a name from [display.keymaps] or a keymap file (default: display keymap)")
+
+	var versionFlag, publish *bool
+	if command == "replay" {
+		publish = flags.Bool("publish", false, "Publish the messages back to a broker instead of browsing them")
+		flags.StringVar(&opts.republish.Connection, "connection", "", "Connection name used by -publish (default: first connection)")
+		flags.Float64Var(&opts.republish.Speed, "speed", 1, "Playback speed factor for -publish")
+		flags.StringVar(&opts.republish.TopicPrefix, "topic-prefix", "", "Prefix added to every topic published by -publish")
+		opts.connection.register(flags, "Publish to this broker instead of a connection of the config file, e.g. tcp://localhost:1883", false)
+		flags.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage: %s replay [flags] <session.jsonl>\n", os.Args[0])
+			flags.PrintDefaults()
+		}
+	} else {
+		versionFlag = flags.Bool("version", false, "Display version information")
+		flags.StringVar(&opts.replayFile, "replay", "", "Browse a recorded structured session log instead of connecting to brokers (same as the replay command)")
+		flags.StringVar(&opts.attach, "attach", "", "Show the messages captured by a collector (a monitor running with -no-tui and [api] listen) at this API address instead of connecting to brokers")
+		flags.StringVar(&opts.republishFile, "republish", "", "Publish the messages of a recorded structured session log back to a broker (same as replay -publish)")
+		flags.StringVar(&opts.republish.Connection, "republish-connection", "", "Connection name used by -republish (default: first connection)")
+		flags.Float64Var(&opts.republish.Speed, "republish-speed", 1, "Playback speed factor for -republish")
+		flags.StringVar(&opts.republish.TopicPrefix, "republish-topic-prefix", "", "Prefix added to every topic published by -republish")
+		flags.BoolVar(&opts.noTUI, "no-tui", false, "Write messages to stdout as JSON lines instead of starting the TUI")
+		flags.StringVar(&opts.output, "output", "", "Headless output format: \"json\" or \"plain\" (implies -no-tui)")
+		flags.BoolVar(&opts.preflight, "preflight", false, "Check DNS, TCP, TLS and the credentials of every connection before monitoring and print the results")
+		flags.BoolVar(&opts.preflightOnly, "preflight-only", false, "Run the checks of -preflight and exit, with status 1 when one failed")
+		flags.StringVar(&opts.restore, "restore", "", "Start the TUI with the messages, filter, search, events and layout of a snapshot saved with :snapshot")
+		opts.connection.register(flags, "Monitor this broker instead of the connections of the config file, e.g. tcp://localhost:1883", true)
+		flags.Usage = func() {
+			printCommands(os.Stderr)
+			fmt.Fprintf(os.Stderr, "\nFlags of monitor:\n")
+			flags.PrintDefaults()
+			fmt.Fprintf(os.Stderr, "\nBuild Information:\n")
+			fmt.Fprintf(os.Stderr, "  Build Date: %s\n", buildDate)
+			fmt.Fprintf(os.Stderr, "  Git Hash: %s\n", gitHash)
+		}
 	}
 
-	flag.Parse()
+	flags.Parse(args)
 
 	// Check if version flag is set
-	if *versionFlag {
+	if versionFlag != nil && *versionFlag {
 		fmt.Printf("Build Date: %s\nGit Hash: %s\n", buildDate, gitHash)
 		os.Exit(0)
 	}
 
-	config, err := LoadConfig(*configFile)
+	if command == "replay" {
+		if flags.NArg() != 1 {
+			flags.Usage()
+			fmt.Fprintln(os.Stderr, "Expected one session log")
+			return nil, opts
+		}
+		if *publish {
+			opts.republishFile = flags.Arg(0)
+		} else {
+			opts.replayFile = flags.Arg(0)
+		}
+	} else if flags.NArg() > 0 {
+		flags.Usage()
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q\n", flags.Arg(0))
+		return nil, opts
+	}
+
+	config, err := opts.loadConfig()
+	if errors.Is(err, fs.ErrNotExist) && opts.runsMonitor() && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		// First run: set up a connection instead of failing on the missing file
+		path := userConfigFile()
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "config" {
+				path = opts.configFile
+			}
+		})
+		saved, wizardErr := runSetupWizard(path, false)
+		if wizardErr != nil {
+			fmt.Fprintf(os.Stderr, "Setup failed: %v\n", wizardErr)
+			return nil, opts
+		}
+		if !saved {
+			fmt.Fprintf(os.Stderr, "No config file: run %s init to write one, or use -broker\n", os.Args[0])
+			return nil, opts
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+		opts.configFile = path
+		config, err = opts.loadConfig()
+	}
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to load configuration")
+		// Replay and attach do not need broker connections, so a missing config file is fine
+		if (opts.replayFile == "" && opts.attach == "") || !errors.Is(err, fs.ErrNotExist) {
+			// Logging is discarded until the configuration is known, so report on stderr
+			fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+			return nil, opts
+		}
+		config = DefaultConfig()
 	}
 
-	if len(config.Connections) == 0 {
-		log.Fatal().Msg("No connections configured")
+	if opts.profile == "" && len(config.Profiles) > 0 && !opts.connection.Given() && opts.runsMonitor() {
+		profile, err := pickProfile(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil, opts
+		}
+		if profile != "" {
+			opts.profile = profile
+			config.UseProfile(profile)
+			if err := resolvePasswords(config.Connections); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+				return nil, opts
+			}
+		}
+	}
+
+	opts.applyDisplayFlags(config) // Again for the picked profile or the default config
+
+	if len(config.Connections) == 0 && opts.replayFile == "" && opts.attach == "" {
+		if len(config.Profiles) > 0 {
+			fmt.Fprintf(os.Stderr, "No connections configured: select a profile with -profile (%s)\n", strings.Join(config.ProfileNames(), ", "))
+		} else {
+			fmt.Fprintln(os.Stderr, "No connections configured: add [[connection]] entries to the config file or use -broker")
+		}
+		return nil, opts
 	}
 
 	// Configure zerolog based on config
 	configureZerologFromConfig(config)
 
-	return config
+	disablePassphrasePrompt() // Reloads must not read the terminal
+	return config, opts
 }
 
 func configureZerologFromConfig(config *Config) {
@@ -121,14 +463,14 @@ func configureZerologFromConfig(config *Config) {
 	log.Logger = zerolog.New(io.Discard).With().Timestamp().Logger()
 }
 
-func initializeSessionLogger(config *Config) *SessionLogger {
+func initializeSessionLogger(config *Config) *sessionlogger.Logger {
 	if !config.Logging.EnableSessionLog {
 		return nil
 	}
 
-	sessionLogMaxDuration, err := time.ParseDuration(config.Logging.SessionLogMaxDuration)
+	loggerConfig, err := newSessionLoggerConfig(config.Logging, connectionNames(config))
 	if err != nil {
-		log.Fatal().Err(err).Msg("Invalid session_log_max_duration")
+		log.Fatal().Err(err).Msg("Invalid session log settings")
 	}
 
 	// Create output directory if it doesn't exist
@@ -137,7 +479,7 @@ func initializeSessionLogger(config *Config) *SessionLogger {
 		return nil
 	}
 
-	sessionLogger, err := NewSessionLogger(config.Logging.OutputDir, sessionLogMaxDuration, log.Logger)
+	sessionLogger, err := sessionlogger.New(loggerConfig, log.Logger)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to initialize session logger")
 		return nil
@@ -146,19 +488,208 @@ func initializeSessionLogger(config *Config) *SessionLogger {
 	return sessionLogger
 }
 
-func createMQTTClients(config *Config, messagesCh chan MonitorMessage, errorsCh chan error, ctx context.Context) []*MQTTClient {
-	var clients []*MQTTClient
-	// Define colors for different clients
-	colors := []string{"green", "blue", "yellow", "magenta", "cyan", "white", "orange", "purple", "brown", "red"}
+// warnSharedOutputDir tells when other instances write session logs to the output
+// directory too, and how the file names of this instance differ from theirs
+func warnSharedOutputDir(config *Config, sessionLogger *sessionlogger.Logger, notify func(error)) {
+	instance, others := sessionLogger.Instance()
+	if instance <= 1 {
+		return
+	}
+	pids := make([]string, len(others))
+	for i, pid := range others {
+		pids[i] = strconv.Itoa(pid)
+	}
+	notify(warnf("output_dir %s is also written by another instance (pid %s); the session logs of this one end in _instance%d",
+		config.Logging.OutputDir, strings.Join(pids, ", "), instance))
+}
+
+// newSessionLoggerConfig parses the session log settings of logging
+func newSessionLoggerConfig(logging Logging, connection string) (sessionlogger.Config, error) {
+	var maxDuration time.Duration
+	var err error
+	if logging.SessionLogRotation == sessionlogger.RotationDuration || logging.SessionLogMaxDuration != "" {
+		maxDuration, err = time.ParseDuration(logging.SessionLogMaxDuration)
+		if err != nil {
+			return sessionlogger.Config{}, fmt.Errorf("invalid session_log_max_duration: %w", err)
+		}
+	}
+
+	var maxSize int64
+	if logging.SessionLogMaxSize != "" {
+		maxSize, err = ParseByteSize(logging.SessionLogMaxSize)
+		if err != nil {
+			return sessionlogger.Config{}, fmt.Errorf("invalid session_log_max_size: %w", err)
+		}
+	}
+
+	retention := sessionlogger.RetentionPolicy{MaxFiles: logging.MaxLogFiles}
+	if logging.MaxLogAge != "" {
+		retention.MaxAge, err = time.ParseDuration(logging.MaxLogAge)
+		if err != nil {
+			return sessionlogger.Config{}, fmt.Errorf("invalid max_log_age: %w", err)
+		}
+	}
+	if logging.MaxTotalLogSize != "" {
+		retention.MaxTotalSize, err = ParseByteSize(logging.MaxTotalLogSize)
+		if err != nil {
+			return sessionlogger.Config{}, fmt.Errorf("invalid max_total_log_size: %w", err)
+		}
+	}
+
+	return sessionlogger.Config{
+		OutputDir:   logging.OutputDir,
+		Format:      logging.LogFormat,
+		MaxDuration: maxDuration,
+		Rotation:    logging.SessionLogRotation,
+		MaxSize:     maxSize,
+		Retention:   retention,
+		Topics: sessionlogger.TopicFilterSet{
+			Include: logging.LogTopics,
+			Exclude: logging.LogExcludeTopics,
+		},
+		Filename:     logging.SessionLogFilename,
+		Connection:   connection,
+		Append:       logging.SessionLogAppend,
+		Checksums:    logging.SessionLogChecksums,
+		ShardByTopic: logging.SessionLogShardByTopic,
+		Summary:      logging.SessionLogSummary,
+	}, nil
+}
+
+// connectionColors are assigned cyclically to distinguish message sources
+var connectionColors = []string{"green", "blue", "yellow", "magenta", "cyan", "white", "orange", "purple", "brown", "red"}
 
-	for i, connConfig := range config.Connections {
-		client := NewMQTTClient(connConfig, messagesCh, errorsCh, config.Display.TopicDepth)
-		client.SetContext(ctx)
-		// Assign color cyclically
-		client.SetColor(colors[i%len(colors)])
-		clients = append(clients, client)
+// startLogTail exposes the session log stream on the configured tail socket
+func startLogTail(config *Config, sessionLogger *sessionlogger.Logger, ctx context.Context) {
+	if config.Logging.TailListen == "" {
+		return
 	}
-	return clients
+
+	tail, err := NewLogTailServer(config.Logging.TailListen, log.Logger)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to start log tail socket")
+		return
+	}
+
+	tail.Start(ctx)
+	sessionLogger.SetTap(tail.Broadcast)
+}
+
+// startAPI serves the HTTP API and the gRPC service when their addresses are configured
+func startAPI(config *Config, state *monitor.State, ctx context.Context) {
+	logger := log.With().Str("component", "api").Logger()
+
+	if config.API.Listen != "" {
+		server, err := NewAPIServer(config.API, state, logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to start API server")
+		} else {
+			server.Mux().Handle("GET /metrics", NewMetricsHandler(config.Metrics, state, ctx))
+			if config.API.WebUI {
+				server.Mux().HandleFunc("GET /{$}", handleWebUI)
+			}
+			server.Start(ctx)
+			logger.Info().Str("listen", server.Addr()).Msg("API server started")
+		}
+	}
+
+	if config.API.GRPCListen != "" {
+		server, err := NewGRPCServer(config.API.GRPCListen, state, logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to start gRPC server")
+		} else {
+			server.Start(ctx)
+			logger.Info().Str("listen", server.Addr()).Msg("gRPC server started")
+		}
+	}
+}
+
+// startStatusPublisher publishes the monitor's own status when [status] is
+// enabled, and returns the publisher, nil when disabled.
+// It must run before the clients connect so the offline status is set as their last will.
+func startStatusPublisher(config *Config, state *monitor.State, clients []*monitor.Client, ctx context.Context) *StatusPublisher {
+	if !config.Status.Enabled {
+		return nil
+	}
+
+	logger := log.With().Str("component", "status").Logger()
+	publisher := NewStatusPublisher(config.Status, state, clients, logger)
+	go publisher.Run(ctx)
+	return publisher
+}
+
+// startControl exposes the controller on the configured control transports,
+// and returns the remote control of the command topic, nil when disabled. It must
+// run before the clients connect.
+func startControl(config *Config, controller *Controller, clients []*monitor.Client, ctx context.Context) *RemoteControl {
+	logger := log.With().Str("component", "control").Logger()
+	var remote *RemoteControl
+	if config.Control.Enabled {
+		remote = startRemoteControl(config.Control, controller, clients, logger)
+	}
+	if config.Control.Socket != "" {
+		if err := startControlSocket(config.Control.Socket, controller, logger, ctx); err != nil {
+			logger.Error().Err(err).Msg("Failed to start control socket")
+		}
+	}
+	return remote
+}
+
+// infof formats a notice of severity info like fmt.Errorf
+func infof(format string, args ...any) error {
+	return monitor.Noticef(monitor.SeverityInfo, format, args...)
+}
+
+// warnf formats a notice of severity warning like fmt.Errorf
+func warnf(format string, args ...any) error {
+	return monitor.Noticef(monitor.SeverityWarning, format, args...)
+}
+
+// connectionNames joins the configured connection names for use in log filenames
+func connectionNames(config *Config) string {
+	names := make([]string, 0, len(config.Connections))
+	for _, conn := range config.Connections {
+		names = append(names, conn.Name)
+	}
+	return strings.Join(names, "-")
+}
+
+// hostname returns the local host name or "unknown"
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// newMonitor returns the capture engine for the connections of config, colored
+// cyclically to distinguish message sources
+func newMonitor(config *Config) *monitor.Monitor {
+	return monitor.New(monitor.Options{
+		Connections: config.Connections,
+		TopicDepth:  config.Display.TopicDepth,
+		BufferSize:  MaxDisplayedMessages,
+		Colors:      connectionColors,
+	})
+}
+
+// runPipeline runs m until ctx is cancelled, and returns a channel closed once
+// it has disconnected and stopped decoding
+func runPipeline(m *monitor.Monitor, ctx context.Context) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx)
+	}()
+	return done
+}
+
+// newPayloadSpool returns the spool keeping the large payloads of the kept
+// messages on disk. It only creates files once spool_threshold is set and
+// exceeded, so a reload can enable it.
+func newPayloadSpool(config *Config) *monitor.PayloadSpool {
+	return monitor.NewPayloadSpool(config.Display.SpoolDir, config.Display.spoolThreshold)
 }
 
 func setupSignalHandler() chan os.Signal {
@@ -167,6 +698,48 @@ func setupSignalHandler() chan os.Signal {
 	return sigCh
 }
 
+// handleRotateSignal calls rotate whenever SIGHUP is received, so external
+// log shippers can trigger rotation on their own schedule
+func handleRotateSignal(ctx context.Context, rotate func()) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hupCh)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupCh:
+				rotate()
+			}
+		}
+	}()
+}
+
+// rotateSessionLog forces a session log rotation and reports the result in the UI
+func rotateSessionLog(sessionLogger *sessionlogger.Logger, notify func(error)) {
+	path, err := sessionLogger.Rotate()
+	report := infof("session log rotated to %s", path)
+	if err != nil {
+		report = fmt.Errorf("session log rotation failed: %w", err)
+	}
+	notify(report)
+}
+
+// newUI creates the TUI with the display settings of config, exiting when the
+// selected theme or keymap cannot be used
+func newUI(config *Config) *UI {
+	ui := NewUI(config.Display.Truncate)
+	ui.SetMemoryLimit(config.Display.memoryLimit)
+	ui.SetEventLevel(config.Display.eventLevel)
+	ui.SetPrettyJSON(config.Display.PrettyJSON)
+	if err := ui.SetStyles(config.Display, config.Display.Theme, config.Display.Keymap); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up the display: %v\n", err)
+		os.Exit(1)
+	}
+	return ui
+}
+
 func startUI(ui *UI, ctx context.Context) chan error {
 	uiDone := make(chan error, 1)
 	go func() {
@@ -181,81 +754,76 @@ func startUI(ui *UI, ctx context.Context) chan error {
 	return uiDone
 }
 
-func connectClients(clients []*MQTTClient, errorsCh chan error, ctx context.Context) {
-	var wg sync.WaitGroup
-	for _, client := range clients {
-		wg.Add(1)
-		go func(c *MQTTClient) {
-			defer wg.Done()
-			if err := c.Connect(); err != nil {
-				select {
-				case errorsCh <- fmt.Errorf("failed to connect %s: %w", c.name, err):
-				case <-ctx.Done():
-				}
-			}
-		}(client)
-	}
+// MessageView renders the message feed, either in the TUI or on plain output streams
+type MessageView interface {
+	AddMessage(msg monitor.Message)
+	AddConnectionEvent(event monitor.ConnectionEvent)
+	AddError(err error)
+	UpdateStatus(status string)
 }
 
-func handleMessagesAndErrors(ui *UI, messagesCh chan MonitorMessage, errorsCh chan error, clients []*MQTTClient, sessionLogger *SessionLogger, ctx context.Context) chan struct{} {
-	messageHandlerDone := make(chan struct{})
-	go func() {
-		defer close(messageHandlerDone)
-		messageCount, errorCount := 0, 0
+// viewHandler shows what the monitor records in a view with running totals, and
+// passes it on to the session log and telemetry
+type viewHandler struct {
+	view          MessageView
+	state         *monitor.State
+	telemetry     *Telemetry            // nil without telemetry
+	sessionLogger *sessionlogger.Logger // nil without session logging
+	messages      int
+	errors        int
+}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case msg, ok := <-messagesCh:
-				if !ok {
-					return
-				}
-				handleMessage(ui, msg, &messageCount, errorCount, len(clients), sessionLogger)
-			case err, ok := <-errorsCh:
-				if !ok {
-					return
-				}
-				handleError(ui, err, messageCount, &errorCount, len(clients), sessionLogger)
-			}
-		}
-	}()
-	return messageHandlerDone
+func newViewHandler(view MessageView, state *monitor.State, telemetry *Telemetry, sessionLogger *sessionlogger.Logger) *viewHandler {
+	return &viewHandler{view: view, state: state, telemetry: telemetry, sessionLogger: sessionLogger}
 }
 
-func handleMessage(ui *UI, msg MonitorMessage, messageCount *int, errorCount, clientCount int, sessionLogger *SessionLogger) {
-	ui.AddMessage(msg)
-	*messageCount++
-	ui.UpdateStatus(fmt.Sprintf("Messages: %d | Errors: %d | Connections: %d", *messageCount, errorCount, clientCount))
+func (h *viewHandler) HandleMessage(msg monitor.Message) {
+	h.view.AddMessage(msg)
+	h.messages++
+	h.updateStatus()
 
-	if sessionLogger != nil {
-		// Let zerolog handle the timestamp - just log the message content without color
-		logMessage := fmt.Sprintf("[%s] %s: %s",
-			msg.Source,
-			msg.DisplayTopic,
-			msg.Payload)
-		if err := sessionLogger.Log(logMessage); err != nil {
+	if h.sessionLogger != nil {
+		if err := h.sessionLogger.LogMessage(msg); err != nil {
 			log.Error().Err(err).Msg("Failed to write to session log")
 		}
 	}
+	h.telemetry.ObserveMessage(msg)
 }
 
-func handleError(ui *UI, err error, messageCount int, errorCount *int, clientCount int, sessionLogger *SessionLogger) {
-	ui.AddError(err)
-	if err != nil {
-		*errorCount++
-		ui.UpdateStatus(fmt.Sprintf("Messages: %d | Errors: %d | Connections: %d", messageCount, *errorCount, clientCount))
-
-		if sessionLogger != nil {
-			logMessage := fmt.Sprintf("Connection event: %s",
-				err.Error())
-			if logErr := sessionLogger.Log(logMessage); logErr != nil {
-				log.Error().Err(logErr).Msg("Failed to write error to session log")
-			}
+// HandleConnectionEvent shows a connection event and logs it, counting lost and
+// failed connections as errors
+func (h *viewHandler) HandleConnectionEvent(event monitor.ConnectionEvent) {
+	h.view.AddConnectionEvent(event)
+	if event.Severity() == monitor.SeverityError {
+		h.errors++
+		h.updateStatus()
+	}
+
+	if h.sessionLogger != nil {
+		if err := h.sessionLogger.LogEvent(event.String()); err != nil {
+			log.Error().Err(err).Msg("Failed to write event to session log")
+		}
+	}
+}
+
+func (h *viewHandler) HandleError(err error) {
+	h.view.AddError(err)
+	if monitor.SeverityOf(err) == monitor.SeverityError {
+		h.errors++
+		h.updateStatus()
+	}
+
+	if h.sessionLogger != nil {
+		if logErr := h.sessionLogger.LogEvent(err.Error()); logErr != nil {
+			log.Error().Err(logErr).Msg("Failed to write error to session log")
 		}
 	}
 }
 
+func (h *viewHandler) updateStatus() {
+	h.view.UpdateStatus(fmt.Sprintf("Messages: %d | Errors: %d | Connections: %d", h.messages, h.errors, h.state.ConnectionCount()))
+}
+
 func waitForShutdownSignal(sigCh chan os.Signal, uiDone chan error) string {
 	select {
 	case sig := <-sigCh:
@@ -268,50 +836,22 @@ func waitForShutdownSignal(sigCh chan os.Signal, uiDone chan error) string {
 	}
 }
 
-func performGracefulShutdown(cancel context.CancelFunc,
-	ui *UI, clients []*MQTTClient, messageHandlerDone chan struct{},
-	messagesCh chan MonitorMessage, errorsCh chan error, shutdownReason string) {
-
+// performGracefulShutdown stops the UI and the monitor, giving up on the monitor
+// after shutdownTimeout
+func performGracefulShutdown(cancel context.CancelFunc, ui *UI, monitorDone chan struct{}, shutdownReason string) {
 	// Don't log to console during shutdown - it interferes with TUI
 	cancel()
 	ui.Stop()
-
-	disconnectClients(clients)
-	waitForMessageHandler(messageHandlerDone)
-
-	close(messagesCh)
-	close(errorsCh)
-}
-
-func disconnectClients(clients []*MQTTClient) {
-	// Remove console logging during disconnect
-	disconnectDone := make(chan struct{})
-	go func() {
-		defer close(disconnectDone)
-		var wg sync.WaitGroup
-		for _, client := range clients {
-			wg.Add(1)
-			go func(c *MQTTClient) {
-				defer wg.Done()
-				c.Disconnect()
-			}(client)
-		}
-		wg.Wait()
-	}()
-
-	select {
-	case <-disconnectDone:
-		// Silent completion
-	case <-time.After(2 * time.Second):
-		// Silent timeout
-	}
+	waitForMonitor(monitorDone)
 }
 
-func waitForMessageHandler(messageHandlerDone chan struct{}) {
+// waitForMonitor waits until the monitor has disconnected and stopped decoding,
+// at most shutdownTimeout
+func waitForMonitor(monitorDone chan struct{}) {
 	select {
-	case <-messageHandlerDone:
+	case <-monitorDone:
 		// Silent completion
-	case <-time.After(1 * time.Second):
+	case <-time.After(shutdownTimeout):
 		// Silent timeout
 	}
 }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	defaultMetricsMaxSeries = 1000
+	metricsOverflowValue    = "__overflow__"
+)
+
+// metricName matches valid Prometheus metric and label names
+var metricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetricsConfig configures the Prometheus metrics served on /metrics of the API
+type MetricsConfig struct {
+	Topics    []TopicMetricConfig `toml:"topic"`
+	MaxSeries int                 `toml:"max_series"` // Label combinations per topic metric before new ones are folded into "__overflow__" (default: 1000)
+}
+
+// TopicMetricConfig counts the messages on a topic pattern, labeled by topic levels
+type TopicMetricConfig struct {
+	Name   string         `toml:"name"`   // Metrics are named mqtt_monitor_<name>_messages_total and mqtt_monitor_<name>_bytes_total
+	Topic  string         `toml:"topic"`  // MQTT topic filter, wildcards allowed
+	Labels map[string]int `toml:"labels"` // Label name to zero-based topic level, e.g. { site = 0, device = 1 }
+}
+
+// validateMetricsConfig checks the topic metric definitions
+func validateMetricsConfig(c MetricsConfig) error {
+	if c.MaxSeries < 0 {
+		return fmt.Errorf("invalid metrics max_series %d", c.MaxSeries)
+	}
+	names := make(map[string]bool)
+	for _, m := range c.Topics {
+		if !metricName.MatchString(m.Name) {
+			return fmt.Errorf("invalid topic metric name %q", m.Name)
+		}
+		if names[m.Name] || m.Name == "payload" { // mqtt_monitor_payload_bytes_total is a global metric
+			return fmt.Errorf("duplicate topic metric name %q", m.Name)
+		}
+		names[m.Name] = true
+		if err := mqtt.ValidateTopicFilter(m.Topic); err != nil {
+			return fmt.Errorf("topic metric %q: %w", m.Name, err)
+		}
+		for label, level := range m.Labels {
+			if !metricName.MatchString(label) || strings.HasPrefix(label, "__") || label == "source" || label == "pattern" {
+				return fmt.Errorf("topic metric %q: invalid label name %q", m.Name, label)
+			}
+			if level < 0 {
+				return fmt.Errorf("topic metric %q: invalid topic level %d for label %q", m.Name, level, label)
+			}
+		}
+	}
+	return nil
+}
+
+// NewMetricsHandler returns the /metrics handler with the monitor's global metrics and
+// the configured topic metrics, which are counted from the message feed until ctx is done
+func NewMetricsHandler(config MetricsConfig, state *monitor.State, ctx context.Context) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		&stateCollector{state: state},
+	)
+
+	if len(config.Topics) > 0 {
+		maxSeries := config.MaxSeries
+		if maxSeries == 0 {
+			maxSeries = defaultMetricsMaxSeries
+		}
+		var counters []*topicCounter
+		for _, m := range config.Topics {
+			counter := newTopicCounter(m, maxSeries)
+			registry.MustRegister(counter.messages, counter.bytes)
+			counters = append(counters, counter)
+		}
+
+		messages, unsubscribe := state.Subscribe(sinkQueueSize)
+		go func() {
+			defer unsubscribe()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg, ok := <-messages:
+					if !ok {
+						return
+					}
+					for _, counter := range counters {
+						counter.observe(msg)
+					}
+				}
+			}
+		}()
+	}
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// stateCollector exposes the monitor.State counters at scrape time
+type stateCollector struct {
+	state *monitor.State
+}
+
+var (
+	messagesDesc = prometheus.NewDesc("mqtt_monitor_messages_total",
+		"Messages received per connection.", []string{"source"}, nil)
+	bytesDesc = prometheus.NewDesc("mqtt_monitor_payload_bytes_total",
+		"Payload bytes received.", nil, nil)
+	eventsDesc = prometheus.NewDesc("mqtt_monitor_events_total",
+		"Connection status events and errors.", nil, nil)
+	droppedDesc = prometheus.NewDesc("mqtt_monitor_dropped_total",
+		"Messages and events lost at each drop point of the pipeline.", []string{"stage", "source"}, nil)
+	connectedDesc = prometheus.NewDesc("mqtt_monitor_connection_up",
+		"Whether the connection is established.", []string{"source"}, nil)
+	topicsDesc = prometheus.NewDesc("mqtt_monitor_topics",
+		"Distinct topics seen.", nil, nil)
+	startTimeDesc = prometheus.NewDesc("mqtt_monitor_start_time_seconds",
+		"Start time of the monitor since the Unix epoch.", nil, nil)
+)
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- messagesDesc
+	ch <- bytesDesc
+	ch <- eventsDesc
+	ch <- droppedDesc
+	ch <- connectedDesc
+	ch <- topicsDesc
+	ch <- startTimeDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.state.Stats(0)
+
+	for source, count := range stats.Sources {
+		ch <- prometheus.MustNewConstMetric(messagesDesc, prometheus.CounterValue, float64(count), source)
+	}
+	ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(stats.Bytes))
+	ch <- prometheus.MustNewConstMetric(eventsDesc, prometheus.CounterValue, float64(stats.Errors))
+	ch <- prometheus.MustNewConstMetric(topicsDesc, prometheus.GaugeValue, float64(stats.Topics))
+	ch <- prometheus.MustNewConstMetric(startTimeDesc, prometheus.GaugeValue, float64(stats.StartTime.Unix()))
+	for name, count := range c.state.Drops() {
+		if !connectionDrop(name) {
+			ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(count), name, "")
+		}
+	}
+
+	for _, status := range c.state.Connections() {
+		up := 0.0
+		if status.Connected {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(connectedDesc, prometheus.GaugeValue, up, status.Name)
+		for name, count := range status.Drops {
+			ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(count), name, status.Name)
+		}
+	}
+}
+
+// connectionDrop reports whether the drop point name is counted per connection,
+// so the metrics have it with the connection as source
+func connectionDrop(name string) bool {
+	switch name {
+	case monitor.DropDecodeQueue, monitor.DropMessagesChannel, monitor.DropEventsChannel, monitor.DropErrorsChannel, monitor.DropDecoderFailure:
+		return true
+	}
+	return false
+}
+
+// topicCounter counts the messages of one TopicMetricConfig
+type topicCounter struct {
+	config    TopicMetricConfig
+	labels    []string // Sorted label names, "source" last
+	messages  *prometheus.CounterVec
+	bytes     *prometheus.CounterVec
+	series    map[string]struct{}
+	maxSeries int
+}
+
+func newTopicCounter(config TopicMetricConfig, maxSeries int) *topicCounter {
+	labels := make([]string, 0, len(config.Labels)+1)
+	for name := range config.Labels {
+		labels = append(labels, name)
+	}
+	sort.Strings(labels)
+	labels = append(labels, "source")
+
+	return &topicCounter{
+		config: config,
+		labels: labels,
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "mqtt_monitor_" + config.Name + "_messages_total",
+			Help:        "Messages received on " + config.Topic + ".",
+			ConstLabels: prometheus.Labels{"pattern": config.Topic},
+		}, labels),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "mqtt_monitor_" + config.Name + "_bytes_total",
+			Help:        "Payload bytes received on " + config.Topic + ".",
+			ConstLabels: prometheus.Labels{"pattern": config.Topic},
+		}, labels),
+		series:    make(map[string]struct{}),
+		maxSeries: maxSeries,
+	}
+}
+
+// observe counts msg when its topic matches. Label combinations beyond maxSeries
+// are counted under "__overflow__" so a topic explosion cannot exhaust memory.
+func (c *topicCounter) observe(msg monitor.Message) {
+	if !mqtt.TopicMatches(c.config.Topic, msg.Topic) {
+		return
+	}
+
+	levels := strings.Split(msg.Topic, "/")
+	values := make([]string, len(c.labels))
+	for i, name := range c.labels[:len(c.labels)-1] {
+		if level := c.config.Labels[name]; level < len(levels) {
+			values[i] = levels[level]
+		}
+	}
+	values[len(values)-1] = msg.Source
+
+	key := strings.Join(values, "\x00")
+	if _, ok := c.series[key]; !ok {
+		if len(c.series) >= c.maxSeries {
+			for i := range values {
+				values[i] = metricsOverflowValue
+			}
+		} else {
+			c.series[key] = struct{}{}
+		}
+	}
+
+	c.messages.WithLabelValues(values...).Inc()
+	c.bytes.WithLabelValues(values...).Add(float64(len(msg.RawPayload)))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// NATSSinkConfig configures republishing of MQTT messages onto NATS
+type NATSSinkConfig struct {
+	URL       string        `toml:"url"`        // NATS server URL(s), comma separated
+	User      string        `toml:"user"`       // Optional username
+	Password  string        `toml:"password"`   // Optional password
+	Token     string        `toml:"token"`      // Optional authentication token
+	CredsFile string        `toml:"creds_file"` // Optional NATS credentials file
+	Mappings  []NATSMapping `toml:"mapping"`    // Topic to subject rules; empty republishes every message
+}
+
+// NATSMapping selects MQTT topics and names the NATS subject they are published on
+type NATSMapping struct {
+	Topic   string `toml:"topic"`   // MQTT topic filter, wildcards allowed
+	Subject string `toml:"subject"` // Subject template; "{topic}" is the whole topic, "{0}", "{1}"... single levels (default: "{topic}")
+}
+
+var subjectPlaceholder = regexp.MustCompile(`\{(topic|\d+)\}`)
+
+func init() {
+	RegisterSink("nats", func(entry SinkEntry, _ *Config, logger zerolog.Logger) (Sink, error) {
+		var c NATSSinkConfig
+		if err := entry.Decode(&c); err != nil {
+			return nil, err
+		}
+		return NewNATSSink(c, logger)
+	})
+}
+
+// NATSSink republishes messages onto NATS subjects with the MQTT metadata in headers
+type NATSSink struct {
+	config  NATSSinkConfig
+	options []nats.Option
+	conn    *nats.Conn
+	logger  zerolog.Logger
+}
+
+// validateNATSSinkConfig checks the URL and mapping rules without connecting
+func validateNATSSinkConfig(c NATSSinkConfig) error {
+	if c.URL == "" {
+		return fmt.Errorf("nats sink requires url")
+	}
+	for i, mapping := range c.Mappings {
+		if mapping.Topic == "" {
+			return fmt.Errorf("nats mapping %d: topic is required", i+1)
+		}
+		if err := validateTopicFilters(fmt.Sprintf("nats mapping %d", i+1), []string{mapping.Topic}); err != nil {
+			return err
+		}
+		if strings.ContainsAny(subjectPlaceholder.ReplaceAllString(mapping.Subject, "x"), " \t*>{}") {
+			return fmt.Errorf("nats mapping %d: invalid subject template %q", i+1, mapping.Subject)
+		}
+	}
+	return nil
+}
+
+func NewNATSSink(config NATSSinkConfig, logger zerolog.Logger) (*NATSSink, error) {
+	if err := validateNATSSinkConfig(config); err != nil {
+		return nil, err
+	}
+
+	options := []nats.Option{
+		nats.Name("mqtt-monitor"),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true), // Keep retrying in the background if NATS is down at startup
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.Warn().Err(err).Msg("Disconnected from NATS")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info().Str("server", nc.ConnectedUrl()).Msg("Reconnected to NATS")
+		}),
+	}
+	if config.User != "" {
+		options = append(options, nats.UserInfo(config.User, config.Password))
+	}
+	if config.Token != "" {
+		options = append(options, nats.Token(config.Token))
+	}
+	if config.CredsFile != "" {
+		options = append(options, nats.UserCredentials(config.CredsFile))
+	}
+
+	return &NATSSink{config: config, options: options, logger: logger}, nil
+}
+
+// Start connects to NATS, which keeps retrying in the background if the server is down
+func (s *NATSSink) Start(context.Context) error {
+	conn, err := nats.Connect(s.config.URL, s.options...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Write publishes msg on the subject of the first matching mapping
+func (s *NATSSink) Write(msg monitor.Message) error {
+	subject, ok := s.subjectFor(msg.Topic)
+	if !ok {
+		return nil
+	}
+
+	out := nats.NewMsg(subject)
+	out.Data = msg.RawPayload
+	out.Header.Set("Mqtt-Topic", msg.Topic)
+	out.Header.Set("Mqtt-Source", msg.Source)
+	out.Header.Set("Mqtt-Qos", strconv.Itoa(int(msg.QoS)))
+	out.Header.Set("Mqtt-Retained", strconv.FormatBool(msg.Retained))
+	if err := s.conn.PublishMsg(out); err != nil {
+		return fmt.Errorf("publish on %s: %w", subject, err)
+	}
+	return nil
+}
+
+// Close flushes buffered publishes and disconnects
+func (s *NATSSink) Close() error {
+	if err := s.conn.Drain(); err != nil {
+		s.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// subjectFor returns the subject for topic using the first matching mapping
+func (s *NATSSink) subjectFor(topic string) (string, bool) {
+	if len(s.config.Mappings) == 0 {
+		return natsSubject(topic, "{topic}"), true
+	}
+	for _, mapping := range s.config.Mappings {
+		if mqtt.TopicMatches(mapping.Topic, topic) {
+			template := mapping.Subject
+			if template == "" {
+				template = "{topic}"
+			}
+			return natsSubject(topic, template), true
+		}
+	}
+	return "", false
+}
+
+// natsSubject expands a subject template. MQTT levels become subject tokens, so
+// characters NATS treats specially inside a token are replaced with "_".
+func natsSubject(topic, template string) string {
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		levels[i] = sanitizeSubjectToken(level)
+	}
+
+	return subjectPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if name == "topic" {
+			return strings.Join(levels, ".")
+		}
+		index, _ := strconv.Atoi(name)
+		if index < len(levels) {
+			return levels[index]
+		}
+		return "_"
+	})
+}
+
+func sanitizeSubjectToken(level string) string {
+	if level == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, level)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// PreflightTimeout bounds every step of the preflight of a connection
+const PreflightTimeout = 5 * time.Second
+
+// preflightSteps are the steps of the preflight of a connection in order; a step
+// only runs when the ones before it passed
+var preflightSteps = []string{"DNS", "TCP", "TLS", "AUTH"}
+
+// preflightStep is the outcome of a step of the preflight of a connection
+type preflightStep struct {
+	ran     bool // False when an earlier step failed or, for TLS, without TLS
+	err     error
+	elapsed time.Duration
+}
+
+// preflightResult is the outcome of the preflight of a connection, by step
+type preflightResult struct {
+	connection monitor.ConnectionConfig
+	steps      map[string]preflightStep
+}
+
+// failed reports whether a step of the preflight failed
+func (r preflightResult) failed() bool {
+	for _, step := range r.steps {
+		if step.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// runPreflight checks every connection before monitoring, all at once: it
+// resolves the broker host, opens a TCP connection, makes the TLS handshake of a
+// TLS connection, and connects with the credentials of the connection
+func runPreflight(connections []monitor.ConnectionConfig) []preflightResult {
+	results := make([]preflightResult, len(connections))
+	var wg sync.WaitGroup
+	for i, conn := range connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = preflightConnection(conn)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// preflightConnection runs the steps of the preflight of a connection until one
+// fails
+func preflightConnection(conn monitor.ConnectionConfig) preflightResult {
+	result := preflightResult{connection: conn, steps: make(map[string]preflightStep)}
+	run := func(name string, fn func(ctx context.Context) error) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), PreflightTimeout)
+		defer cancel()
+		start := time.Now()
+		err := fn(ctx)
+		result.steps[name] = preflightStep{ran: true, err: err, elapsed: time.Since(start)}
+		return err == nil
+	}
+
+	var (
+		server *url.URL
+		tcp    net.Conn
+	)
+	ok := run("DNS", func(ctx context.Context) error {
+		if err := checkBrokerURL(conn.Server); err != nil {
+			return err
+		}
+		server, _ = url.Parse(conn.Server)
+		_, err := net.DefaultResolver.LookupHost(ctx, server.Hostname())
+		return err
+	})
+	ok = ok && run("TCP", func(ctx context.Context) error {
+		var err error
+		var dialer net.Dialer
+		tcp, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(server.Hostname(), brokerPort(server)))
+		return err
+	})
+	if tcp != nil {
+		defer tcp.Close()
+	}
+
+	mqttConfig := conn.ToMQTTConfig()
+	tlsConfig, err := mqtt.NewTLSConfig(mqttConfig)
+	if tlsConfig == nil && err == nil && server != nil && server.Scheme == "wss" {
+		tlsConfig = &tls.Config{InsecureSkipVerify: conn.TLSInsecureSkipVerify}
+	}
+	if ok && (tlsConfig != nil || err != nil) {
+		ok = run("TLS", func(ctx context.Context) error {
+			if err != nil {
+				return err
+			}
+			tlsConfig.ServerName = server.Hostname()
+			return tls.Client(tcp, tlsConfig).HandshakeContext(ctx)
+		})
+	}
+
+	// A client ID of its own keeps the check from taking over, or with its clean
+	// session discarding, the persistent session of the connection
+	mqttConfig.ClientID = conn.GetUniqueClientID() + "-preflight"
+	if ok {
+		run("AUTH", func(context.Context) error {
+			return mqtt.CheckConnection(mqttConfig, nil, 0, PreflightTimeout)
+		})
+	}
+	return result
+}
+
+// brokerPort returns the port of a broker URL, or the default of its scheme
+func brokerPort(server *url.URL) string {
+	switch {
+	case server.Port() != "":
+		return server.Port()
+	case server.Scheme == "ws":
+		return "80"
+	case server.Scheme == "wss":
+		return "443"
+	case slices.Contains([]string{"ssl", "tls", "mqtts", "tcps"}, server.Scheme):
+		return "8883"
+	}
+	return "1883"
+}
+
+// writePreflightReport writes a table of the preflight results, followed by the
+// errors of the failed steps
+func writePreflightReport(w io.Writer, results []preflightResult) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "CONNECTION\tSERVER\t%s\n", strings.Join(preflightSteps, "\t"))
+	for _, result := range results {
+		fmt.Fprintf(table, "%s\t%s", result.connection.Name, result.connection.Server)
+		for _, name := range preflightSteps {
+			step := result.steps[name]
+			switch {
+			case !step.ran:
+				fmt.Fprint(table, "\t-")
+			case step.err != nil:
+				fmt.Fprint(table, "\tFAIL")
+			default:
+				fmt.Fprintf(table, "\tok %v", step.elapsed.Round(time.Millisecond))
+			}
+		}
+		fmt.Fprintln(table)
+	}
+	table.Flush()
+
+	for _, result := range results {
+		for _, name := range preflightSteps {
+			if err := result.steps[name].err; err != nil {
+				fmt.Fprintf(w, "%s: %s: %v\n", result.connection.Name, name, err)
+			}
+		}
+	}
+}
+
+// preflight runs the preflight of the connections of config when asked to by
+// opts. With -preflight-only it prints the results and exits, with status 1 when
+// a check failed. With -preflight the results are written to stderr; in the TUI,
+// which would hide them, a failure waits for Enter before monitoring.
+func preflight(config *Config, opts *cliOptions) {
+	if !opts.preflight && !opts.preflightOnly {
+		return
+	}
+
+	results := runPreflight(config.Connections)
+	failed := slices.ContainsFunc(results, preflightResult.failed)
+	if opts.preflightOnly {
+		writePreflightReport(os.Stdout, results)
+		if failed {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	writePreflightReport(os.Stderr, results)
+	if failed && opts.runsMonitor() {
+		fmt.Fprint(os.Stderr, "\nPreflight failed. Press Enter to start monitoring anyway, Ctrl+C to quit. ")
+		bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// probeOutcome is the outcome of the subscription probe of a connection
+type probeOutcome struct {
+	connection monitor.ConnectionConfig
+	probe      *mqtt.SubscriptionProbe
+	err        error // The broker refused the connection
+}
+
+// runProbe subscribes to test filters on every connection, or the one given, and
+// reports which the ACLs of the broker allow, to tell permission problems apart
+// from topics nobody publishes to
+func runProbe(args []string) error {
+	flags := flag.NewFlagSet("probe", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "Path to configuration file")
+	profile := flags.String("profile", "", "Probe the connections of this [profile.<name>]")
+	connection := flags.String("connection", "", "Probe only this connection (default: every connection)")
+	filterFile := flags.String("file", "", "File with a topic filter per line to probe, in addition to those given as arguments")
+	qos := flags.Int("qos", -1, "QoS to subscribe with, 0, 1 or 2 (default: the qos of each connection)")
+	var cliConn connectionFlags
+	cliConn.register(flags, "Probe this broker instead of the connections of the config file, e.g. tcp://localhost:1883", false)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s probe [flags] [filter...]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Subscribes to topic filters and reports which the broker allows, from its SUBACK (default: the topics of each connection)")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *qos > 2 {
+		return fmt.Errorf("invalid -qos %d (expected 0, 1 or 2)", *qos)
+	}
+
+	filters := flags.Args()
+	if *filterFile != "" {
+		read, err := readFilterFile(*filterFile)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, read...)
+	}
+
+	connections, err := probeConnections(*configFile, *profile, *connection, &cliConn)
+	if err != nil {
+		return err
+	}
+
+	outcomes := make([]probeOutcome, len(connections))
+	var wg sync.WaitGroup
+	for i, conn := range connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcomes[i] = probeConnection(conn, filters, *qos)
+		}()
+	}
+	wg.Wait()
+
+	writeProbeReport(os.Stdout, outcomes)
+	var refused, denied, total int
+	for _, outcome := range outcomes {
+		if outcome.err != nil {
+			refused++
+			continue
+		}
+		for _, result := range outcome.probe.Results {
+			total++
+			if !result.Allowed {
+				denied++
+			}
+		}
+	}
+	switch {
+	case refused > 0:
+		return fmt.Errorf("%d of %d connections refused", refused, len(outcomes))
+	case denied > 0:
+		return fmt.Errorf("%d of %d subscriptions not allowed", denied, total)
+	}
+	return nil
+}
+
+// probeConnections returns the connections to probe: the one given with -broker,
+// or those of the config file, with their passwords
+func probeConnections(configFile, profile, name string, cliConn *connectionFlags) ([]monitor.ConnectionConfig, error) {
+	config, err := LoadConfig(configFile)
+	if cliConn.Given() {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		config = DefaultConfig()
+		if err := cliConn.apply(config); err != nil {
+			return nil, err
+		}
+		return config.Connections, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		if err := config.UseProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+
+	connections := config.Connections
+	if name != "" {
+		connections = slices.DeleteFunc(connections, func(conn monitor.ConnectionConfig) bool { return conn.Name != name })
+		if len(connections) == 0 {
+			return nil, fmt.Errorf("no connection named %q", name)
+		}
+	}
+	if len(connections) == 0 {
+		return nil, fmt.Errorf("no connections configured in %s", configFile)
+	}
+	return connections, resolvePasswords(connections)
+}
+
+// probeConnection probes filters, or the topics of conn without any, on conn
+func probeConnection(conn monitor.ConnectionConfig, filters []string, qos int) probeOutcome {
+	if len(filters) == 0 {
+		filters = conn.Topics
+	}
+	if qos < 0 {
+		qos = int(conn.QoS)
+	}
+	mqttConfig := conn.ToMQTTConfig()
+	// A client ID of its own keeps the probe from taking over, or with its clean
+	// session discarding, the persistent session of the connection
+	mqttConfig.ClientID = conn.GetUniqueClientID() + "-probe"
+	probe, err := mqtt.ProbeSubscriptions(mqttConfig, filters, byte(qos), PreflightTimeout)
+	return probeOutcome{connection: conn, probe: probe, err: err}
+}
+
+// readFilterFile reads the topic filters of a file, one per line; blank lines
+// are skipped
+func readFilterFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var filters []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			filters = append(filters, line)
+		}
+	}
+	return filters, scanner.Err()
+}
+
+// writeProbeReport writes a table of the subscriptions probed on every
+// connection, followed by the errors of the connections the broker refused
+func writeProbeReport(w io.Writer, outcomes []probeOutcome) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CONNECTION\tPROTOCOL\tFILTER\tRESULT\tCODE\tREASON")
+	for _, outcome := range outcomes {
+		if outcome.err != nil {
+			fmt.Fprintf(table, "%s\t-\t-\tFAIL\t-\t-\n", outcome.connection.Name)
+			continue
+		}
+		for _, result := range outcome.probe.Results {
+			fmt.Fprintf(table, "%s\t%s\t%s\t", outcome.connection.Name, outcome.probe.Protocol, result.Filter)
+			switch {
+			case result.Err != nil:
+				fmt.Fprintf(table, "ERROR\t-\t%v\n", result.Err)
+			case result.Allowed:
+				fmt.Fprintf(table, "allowed\t0x%02x\t%s\n", result.Code, result.Reason)
+			default:
+				fmt.Fprintf(table, "DENIED\t0x%02x\t%s\n", result.Code, result.Reason)
+			}
+		}
+	}
+	table.Flush()
+
+	for _, outcome := range outcomes {
+		if outcome.err != nil {
+			fmt.Fprintf(w, "%s: %v\n", outcome.connection.Name, outcome.err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// ProfileConfig is a named set of connections and display settings, selected
+// at launch with -profile instead of keeping a config file per environment
+type ProfileConfig struct {
+	Connections []monitor.ConnectionConfig `toml:"connection"` // Replace the top-level connections
+	Display     ProfileDisplay             `toml:"display"`
+}
+
+// ProfileDisplay overrides the top-level display settings it sets
+type ProfileDisplay struct {
+	TopicDepth *int    `toml:"topic_depth"`
+	Truncate   *bool   `toml:"truncate"`
+	Theme      *string `toml:"theme"`
+	Keymap     *string `toml:"keymap"`
+}
+
+// errProfileCancelled is returned when the profile picker is closed without a choice
+var errProfileCancelled = errors.New("no profile selected")
+
+// validateProfiles checks the connections of every profile
+func validateProfiles(profiles map[string]ProfileConfig) error {
+	for name, profile := range profiles {
+		if len(profile.Connections) == 0 {
+			return fmt.Errorf("profile %s has no connections", name)
+		}
+		applyCredentialEnv(profile.Connections)
+		if err := validateConnections(profile.Connections); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateProfileStyles checks that the themes and keymaps selected by profiles exist
+func validateProfileStyles(profiles map[string]ProfileConfig, display *DisplayConfig) error {
+	for name, profile := range profiles {
+		var theme, keymap string
+		if profile.Display.Theme != nil {
+			theme = *profile.Display.Theme
+		}
+		if profile.Display.Keymap != nil {
+			keymap = *profile.Display.Keymap
+		}
+		if err := display.checkSelection(theme, keymap); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ProfileNames returns the names of the configured profiles in order
+func (c *Config) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(c.Profiles))
+}
+
+// UseProfile replaces the connections and display settings with those of a profile
+func (c *Config) UseProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return fmt.Errorf("unknown profile %q: no [profile.<name>] sections configured", name)
+		}
+		return fmt.Errorf("unknown profile %q (expected %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	c.Connections = profile.Connections
+	if profile.Display.TopicDepth != nil {
+		c.Display.TopicDepth = *profile.Display.TopicDepth
+	}
+	if profile.Display.Truncate != nil {
+		c.Display.Truncate = *profile.Display.Truncate
+	}
+	if profile.Display.Theme != nil {
+		c.Display.Theme = *profile.Display.Theme
+	}
+	if profile.Display.Keymap != nil {
+		c.Display.Keymap = *profile.Display.Keymap
+	}
+	return nil
+}
+
+// pickProfile lets the user choose a profile in a small TUI before the monitor
+// starts. The top-level connections are offered as "default" when there are any;
+// choosing them returns "".
+func pickProfile(config *Config) (string, error) {
+	app := tview.NewApplication()
+	list := tview.NewList()
+	list.SetBorder(true).SetTitle(" Select a profile (Esc to quit) ")
+
+	var (
+		names  []string
+		chosen = -1
+	)
+	add := func(name string, connections []monitor.ConnectionConfig) {
+		summary := make([]string, len(connections))
+		for i, conn := range connections {
+			summary[i] = conn.Name
+		}
+		shortcut := rune(0)
+		if len(names) < 9 {
+			shortcut = rune('1' + len(names))
+		}
+		index := len(names)
+		names = append(names, name)
+		list.AddItem(name, "Connections: "+strings.Join(summary, ", "), shortcut, func() {
+			chosen = index
+			app.Stop()
+		})
+	}
+	if len(config.Connections) > 0 {
+		add("default", config.Connections)
+	}
+	for _, name := range config.ProfileNames() {
+		add(name, config.Profiles[name].Connections)
+	}
+
+	list.SetDoneFunc(app.Stop)
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune && event.Rune() == 'q' {
+			app.Stop()
+			return nil
+		}
+		return event
+	})
+
+	if err := app.SetRoot(list, true).Run(); err != nil {
+		return "", err
+	}
+	if chosen < 0 {
+		return "", errProfileCancelled
+	}
+	if chosen == 0 && len(config.Connections) > 0 {
+		return "", nil
+	}
+	return names[chosen], nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+// reloadPollInterval is how often [reload] watch checks the config file for changes
+const reloadPollInterval = 2 * time.Second
+
+// Reloader applies changes of the config file at runtime. Connections are matched
+// by name: new ones are connected, removed ones disconnected, and a connection
+// whose only change is its topics is resubscribed without reconnecting. Display
+// settings and the logging topic filters are applied; other sections need a restart.
+type Reloader struct {
+	path          string
+	load          func() (*Config, error) // Reads path, applying command line overrides
+	monitor       *monitor.Monitor
+	state         *monitor.State
+	controller    *Controller
+	sessionLogger *sessionlogger.Logger // nil without session logging
+	ui            *UI                   // nil when headless
+	spool         *monitor.PayloadSpool
+	notify        func(error)
+	logger        zerolog.Logger
+	ctx           context.Context
+
+	// Registered on new connections before they connect, nil when disabled
+	statusPublisher *StatusPublisher
+	remoteControl   *RemoteControl
+
+	mu     sync.Mutex // Guards config
+	config *Config
+}
+
+func NewReloader(path string, load func() (*Config, error), config *Config, m *monitor.Monitor, controller *Controller,
+	sessionLogger *sessionlogger.Logger, ui *UI, spool *monitor.PayloadSpool, ctx context.Context) *Reloader {
+	return &Reloader{
+		path:          path,
+		load:          load,
+		monitor:       m,
+		state:         m.State(),
+		controller:    controller,
+		sessionLogger: sessionLogger,
+		ui:            ui,
+		spool:         spool,
+		notify:        m.Notify,
+		logger:        log.With().Str("component", "reload").Logger(),
+		ctx:           ctx,
+		config:        config,
+	}
+}
+
+// SetClientHooks makes new connections of a reload publish the monitor status
+// and accept remote control like those they replace. Must be called before Start.
+func (r *Reloader) SetClientHooks(statusPublisher *StatusPublisher, remoteControl *RemoteControl) {
+	r.statusPublisher, r.remoteControl = statusPublisher, remoteControl
+}
+
+// Start reloads on SIGUSR1 and, with [reload] watch, whenever the config file or
+// one of its included files changes
+func (r *Reloader) Start() {
+	usrCh := make(chan os.Signal, 1)
+	notifyReload(usrCh)
+	watch := r.config.Reload.Watch
+
+	go func() {
+		defer signal.Stop(usrCh)
+
+		var poll <-chan time.Time
+		if watch {
+			ticker := time.NewTicker(reloadPollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+
+		last, _ := r.watchedVersion()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-usrCh:
+				last, _ = r.watchedVersion()
+				r.Reload()
+			case <-poll:
+				version, err := r.watchedVersion()
+				if err != nil || version == last {
+					continue // A missing file is usually an editor replacing it
+				}
+				last = version
+				r.Reload()
+			}
+		}
+	}()
+}
+
+// watchedVersion identifies the content of the config file and its included files
+func (r *Reloader) watchedVersion() (string, error) {
+	r.mu.Lock()
+	patterns := r.config.Include
+	r.mu.Unlock()
+
+	files, err := includedFiles(r.path, patterns)
+	if err != nil {
+		return "", err
+	}
+	var versions []string
+	for _, file := range append([]string{r.path}, files...) {
+		version, err := fileVersion(file)
+		if err != nil {
+			return "", err
+		}
+		versions = append(versions, file+"="+version)
+	}
+	return strings.Join(versions, ";"), nil
+}
+
+// fileVersion identifies the content of a file by its modification time and size
+func fileVersion(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// Reload reads the config file and applies the differences to the running monitor.
+// An invalid file is reported and leaves everything as it was.
+func (r *Reloader) Reload() {
+	config, err := r.load()
+	if err == nil && len(config.Connections) == 0 {
+		err = fmt.Errorf("no connections configured")
+	}
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Config reload failed")
+		r.notify(fmt.Errorf("config reload failed: %w", err))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		clients              []*monitor.Client
+		connect, disconnect  []*monitor.Client
+		reconnected, updated []string
+		added                int
+	)
+	depth := config.Display.TopicDepth
+	current := slices.Clone(r.monitor.Clients())
+	for _, conn := range config.Connections {
+		i := slices.IndexFunc(current, func(c *monitor.Client) bool { return c != nil && c.Name() == conn.Name })
+		if i < 0 {
+			client := r.monitor.NewClient(conn, depth, r.monitor.NextColor())
+			clients, connect = append(clients, client), append(connect, client)
+			added++
+			continue
+		}
+		client := current[i]
+		current[i] = nil
+
+		old := client.Config()
+		switch {
+		case reflect.DeepEqual(withoutTopics(old), withoutTopics(conn)):
+			if !slices.Equal(old.Topics, conn.Topics) {
+				if err := client.SetTopics(conn.Topics); err != nil {
+					r.notify(fmt.Errorf("%s: failed to update topics: %w", conn.Name, err))
+				}
+				updated = append(updated, conn.Name)
+			}
+			client.SetTopicDepth(depth)
+			clients = append(clients, client)
+		default:
+			// Any other change needs a new connection
+			replacement := r.monitor.NewClient(conn, depth, client.Color())
+			disconnect = append(disconnect, client)
+			clients, connect = append(clients, replacement), append(connect, replacement)
+			reconnected = append(reconnected, conn.Name)
+		}
+	}
+	removed := 0
+	for _, client := range current {
+		if client != nil {
+			disconnect = append(disconnect, client)
+			removed++
+		}
+	}
+
+	r.monitor.Disconnect(disconnect...)
+	r.monitor.SetClients(clients)
+	r.controller.SetClients(clients)
+	if r.statusPublisher != nil {
+		r.statusPublisher.SetClients(clients)
+	}
+	if r.remoteControl != nil {
+		r.remoteControl.AddClients(connect)
+	}
+	if r.ui != nil {
+		r.ui.SetConnectionTabs(config.Connections)
+	}
+	r.monitor.Connect(connect...)
+
+	r.logger.Info().Int("connections", len(clients)).Strs("reconnected", reconnected).Strs("resubscribed", updated).Msg("Config reloaded")
+	r.notify(infof("config reloaded: %d connections added, %d removed, %d reconnected, %d resubscribed",
+		added, removed, len(reconnected), len(updated)))
+
+	r.applySettings(config)
+	r.config = config
+}
+
+// applySettings applies the display and logging filter settings and reports
+// changes to settings that only take effect on restart
+func (r *Reloader) applySettings(config *Config) {
+	if r.ui != nil && config.Display.Truncate != r.config.Display.Truncate {
+		r.ui.SetTruncate(config.Display.Truncate)
+	}
+	if r.ui != nil && config.Display.PrettyJSON != r.config.Display.PrettyJSON {
+		r.ui.SetPrettyJSON(config.Display.PrettyJSON)
+	}
+	if config.Display.memoryLimit != r.config.Display.memoryLimit {
+		r.state.SetMemoryLimit(config.Display.memoryLimit)
+		if r.ui != nil {
+			r.ui.SetMemoryLimit(config.Display.memoryLimit)
+		}
+	}
+	if !slices.Equal(config.Sequences, r.config.Sequences) {
+		if err := r.state.SetSequenceRules(config.Sequences); err != nil {
+			r.notify(fmt.Errorf("config reload: %w", err))
+		}
+	}
+	if config.Display.spoolThreshold != r.config.Display.spoolThreshold {
+		r.spool.SetThreshold(config.Display.spoolThreshold)
+	}
+	if r.ui != nil && config.Display.eventLevel != r.config.Display.eventLevel {
+		r.ui.SetEventLevel(config.Display.eventLevel)
+	}
+	if config.Display.SpoolDir != r.config.Display.SpoolDir {
+		r.notify(warnf("config reload: changes to spool_dir need a restart"))
+	}
+	if r.ui != nil {
+		// Keep a theme or keymap switched at runtime unless the config selects another
+		theme, keymap := r.ui.ThemeName(), r.ui.KeymapName()
+		if config.Display.Theme != r.config.Display.Theme {
+			theme = config.Display.Theme
+		}
+		if config.Display.Keymap != r.config.Display.Keymap {
+			keymap = config.Display.Keymap
+		}
+		if err := r.ui.SetStyles(config.Display, theme, keymap); err != nil {
+			r.notify(fmt.Errorf("config reload: %w", err))
+		}
+	}
+
+	logging, previous := config.Logging, r.config.Logging
+	if r.sessionLogger != nil && (!slices.Equal(logging.LogTopics, previous.LogTopics) ||
+		!slices.Equal(logging.LogExcludeTopics, previous.LogExcludeTopics)) {
+		topics := sessionlogger.TopicFilterSet{Include: logging.LogTopics, Exclude: logging.LogExcludeTopics}
+		if err := r.sessionLogger.SetTopicFilters(topics); err != nil {
+			r.notify(fmt.Errorf("config reload: invalid logging topic filter: %w", err))
+		}
+	}
+
+	// Ignore what was applied above
+	logging.LogTopics, logging.LogExcludeTopics = previous.LogTopics, previous.LogExcludeTopics
+	sections := []struct {
+		name     string
+		old, new any
+	}{
+		{"logging", previous, logging},
+		{"influx", r.config.Influx, config.Influx},
+		{"api", r.config.API, config.API},
+		{"sink", r.config.Sink, config.Sink},
+		{"status", r.config.Status, config.Status},
+		{"control", r.config.Control, config.Control},
+		{"telemetry", r.config.Telemetry, config.Telemetry},
+		{"alert", r.config.Alert, config.Alert},
+		{"metrics", r.config.Metrics, config.Metrics},
+		{"reload", r.config.Reload, config.Reload},
+	}
+	var restart []string
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.old, section.new) {
+			restart = append(restart, "["+section.name+"]")
+		}
+	}
+	if len(restart) > 0 {
+		r.notify(warnf("config reload: changes to %s need a restart", strings.Join(restart, ", ")))
+	}
+}
+
+// withoutTopics returns conn with its topics cleared, for comparing the remaining settings
+func withoutTopics(conn monitor.ConnectionConfig) monitor.ConnectionConfig {
+	conn.Topics = nil
+	return conn
+}
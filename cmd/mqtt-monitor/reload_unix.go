@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReload relays SIGUSR1, the signal asking for a config reload, to ch
+func notifyReload(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGUSR1)
+}
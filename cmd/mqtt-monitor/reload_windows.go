@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// notifyReload does nothing: Windows has no SIGUSR1, so configs are reloaded
+// with [reload] watch only
+func notifyReload(ch chan<- os.Signal) {}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	defaultControlTopic      = "mqtt-monitor/{hostname}/cmd"
+	defaultControlReplyTopic = "mqtt-monitor/{hostname}/reply"
+)
+
+// ControlConfig configures remote control through an MQTT command topic and the
+// local control socket
+type ControlConfig struct {
+	Socket      string   `toml:"socket"`      // Unix socket for mqtt-monitorctl, e.g. "/run/mqtt-monitor/control.sock" (disabled when empty)
+	Enabled     bool     `toml:"enabled"`     // Accept commands on the command topic
+	Topic       string   `toml:"topic"`       // Command topic template with {hostname} and {connection} (default: "mqtt-monitor/{hostname}/cmd")
+	ReplyTopic  string   `toml:"reply_topic"` // Response topic template (default: "mqtt-monitor/{hostname}/reply")
+	Connections []string `toml:"connections"` // Connections to listen on (default: all)
+	Token       string   `toml:"token"`       // Shared secret every command must carry (recommended)
+	QoS         byte     `toml:"qos"`         // QoS of the command subscription and replies
+}
+
+// validateControlConfig checks the remote control settings
+func validateControlConfig(c ControlConfig, connections []monitor.ConnectionConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.QoS > 2 {
+		return fmt.Errorf("invalid control qos %d", c.QoS)
+	}
+	if c.Topic != "" {
+		if err := mqtt.ValidateTopicFilter(c.Topic); err != nil {
+			return fmt.Errorf("invalid control topic: %w", err)
+		}
+	}
+	if c.ReplyTopic != "" {
+		if err := mqtt.ValidateTopicName(c.ReplyTopic); err != nil {
+			return fmt.Errorf("invalid control reply_topic: %w", err)
+		}
+	}
+	for _, name := range c.Connections {
+		if !slices.ContainsFunc(connections, func(conn monitor.ConnectionConfig) bool { return conn.Name == name }) {
+			return fmt.Errorf("control connection %q is not configured", name)
+		}
+	}
+	return nil
+}
+
+// RemoteControl answers the commands on the command topic of the selected
+// connections
+type RemoteControl struct {
+	config        ControlConfig
+	controller    *Controller
+	topicTemplate string
+	replyTemplate string
+	host          string
+	logger        zerolog.Logger
+}
+
+// startRemoteControl subscribes the selected clients to the command topic. Each
+// command is executed by controller and answered on the reply topic of the same
+// connection. Must be called before the clients connect.
+func startRemoteControl(config ControlConfig, controller *Controller, clients []*monitor.Client, logger zerolog.Logger) *RemoteControl {
+	c := &RemoteControl{
+		config:        config,
+		controller:    controller,
+		topicTemplate: config.Topic,
+		replyTemplate: config.ReplyTopic,
+		host:          hostname(),
+		logger:        logger,
+	}
+	if c.topicTemplate == "" {
+		c.topicTemplate = defaultControlTopic
+	}
+	if c.replyTemplate == "" {
+		c.replyTemplate = defaultControlReplyTopic
+	}
+	if config.Token == "" {
+		logger.Warn().Msg("Remote control enabled without a token; anyone who can publish to the command topic controls this monitor")
+	}
+	c.AddClients(clients)
+	return c
+}
+
+// AddClients subscribes the selected clients of clients to the command topic,
+// such as the new connections of a reload. Must be called before they connect.
+func (c *RemoteControl) AddClients(clients []*monitor.Client) {
+	for _, client := range clients {
+		if len(c.config.Connections) > 0 && !slices.Contains(c.config.Connections, client.Name()) {
+			continue
+		}
+
+		expand := strings.NewReplacer("{hostname}", topicLevel(c.host), "{connection}", topicLevel(client.Name())).Replace
+		topic, replyTopic := expand(c.topicTemplate), expand(c.replyTemplate)
+
+		err := client.SubscribeHandler(topic, c.config.QoS, func(msg mqtt.Message) {
+			if msg.Retained {
+				return // Never replay stale commands
+			}
+			response := c.controller.ExecuteJSON(msg.Payload, c.config.Token)
+			if err := client.Publish(replyTopic, response, c.config.QoS, false); err != nil {
+				c.logger.Warn().Err(err).Str("topic", replyTopic).Msg("Failed to publish control reply")
+			}
+		})
+		if err != nil {
+			c.logger.Error().Err(err).Str("topic", topic).Msg("Failed to subscribe to control topic")
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+const (
+	ReplaySeekStep = 10 * time.Second
+	ReplayMinSpeed = 0.125
+	ReplayMaxSpeed = 64
+)
+
+// Replayer feeds recorded session log records into the message pipeline,
+// honouring the original timing scaled by a playback speed
+type Replayer struct {
+	records    []sessionlog.Record
+	messagesCh chan<- monitor.Message
+	errorsCh   chan<- error
+	*recordConverter
+
+	mu         sync.Mutex
+	pos        int
+	speed      float64
+	paused     bool
+	generation int
+	epoch      uint64              // Bumped by every seek, tags the messages emitted since
+	backlog    []sessionlog.Record // Up to the position of the last seek, still to emit
+	wake       chan struct{}
+
+	onReset  func(epoch uint64)
+	onChange func(ReplayState)
+}
+
+// ReplayState describes the current playback position for display
+type ReplayState struct {
+	Position time.Duration
+	Total    time.Duration
+	Speed    float64
+	Paused   bool
+	Finished bool
+}
+
+func NewReplayer(records []sessionlog.Record, messagesCh chan<- monitor.Message, errorsCh chan<- error, topicDepth int) *Replayer {
+	return &Replayer{
+		records:         records,
+		messagesCh:      messagesCh,
+		errorsCh:        errorsCh,
+		recordConverter: newRecordConverter(topicDepth),
+		speed:           1,
+		wake:            make(chan struct{}, 1),
+	}
+}
+
+// SetResetHandler registers a callback used to clear the display when seeking,
+// called with the epoch of the messages emitted for the seek
+func (r *Replayer) SetResetHandler(fn func(epoch uint64)) {
+	r.onReset = fn
+}
+
+// SetStateHandler registers a callback invoked whenever the playback state changes
+func (r *Replayer) SetStateHandler(fn func(ReplayState)) {
+	r.onChange = fn
+}
+
+func (r *Replayer) Run(ctx context.Context) {
+	r.notify()
+
+	for {
+		r.mu.Lock()
+		// The display is rebuilt after a seek regardless of pause and speed
+		if len(r.backlog) > 0 {
+			record, epoch := r.backlog[0], r.epoch
+			r.backlog = r.backlog[1:]
+			r.mu.Unlock()
+			if ctx.Err() != nil {
+				return
+			}
+			r.emit(ctx, record, epoch)
+			continue
+		}
+		if r.paused || r.pos >= len(r.records) {
+			r.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.wake:
+				continue
+			}
+		}
+
+		generation := r.generation
+		delay := time.Duration(0)
+		if r.pos > 0 {
+			delay = time.Duration(float64(r.records[r.pos].Timestamp.Sub(r.records[r.pos-1].Timestamp)) / r.speed)
+		}
+		r.mu.Unlock()
+
+		timer := time.NewTimer(max(delay, 0))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.wake:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		r.mu.Lock()
+		if generation != r.generation || r.paused || r.pos >= len(r.records) {
+			r.mu.Unlock()
+			continue
+		}
+		record, epoch := r.records[r.pos], r.epoch
+		r.pos++
+		finished := r.pos == len(r.records)
+		r.mu.Unlock()
+
+		r.emit(ctx, record, epoch)
+		if finished {
+			r.notify()
+		}
+	}
+}
+
+// TogglePause pauses or resumes playback
+func (r *Replayer) TogglePause() {
+	r.mu.Lock()
+	r.paused = !r.paused
+	r.generation++
+	r.mu.Unlock()
+	r.signal()
+	r.notify()
+}
+
+// ChangeSpeed multiplies the playback speed by factor within the allowed range
+func (r *Replayer) ChangeSpeed(factor float64) {
+	r.mu.Lock()
+	r.speed = min(max(r.speed*factor, ReplayMinSpeed), ReplayMaxSpeed)
+	r.generation++
+	r.mu.Unlock()
+	r.signal()
+	r.notify()
+}
+
+// Seek moves the playback position by offset relative to the current record.
+// The display is rebuilt from the start of the recording up to the new position
+// by Run, with messages of a new epoch so those of before the seek still queued
+// are told apart.
+func (r *Replayer) Seek(offset time.Duration) {
+	r.mu.Lock()
+	if len(r.records) == 0 {
+		r.mu.Unlock()
+		return
+	}
+
+	target := r.currentTime().Add(offset)
+	r.generation++
+	r.epoch++
+	epoch := r.epoch
+	r.pos = 0
+	for r.pos < len(r.records) && !r.records[r.pos].Timestamp.After(target) {
+		r.pos++
+	}
+	r.backlog = r.records[:r.pos]
+	r.mu.Unlock()
+
+	if r.onReset != nil {
+		r.onReset(epoch)
+	}
+	r.signal()
+	r.notify()
+}
+
+// State returns a snapshot of the playback state
+func (r *Replayer) State() ReplayState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stateLocked()
+}
+
+func (r *Replayer) stateLocked() ReplayState {
+	state := ReplayState{
+		Speed:    r.speed,
+		Paused:   r.paused,
+		Finished: r.pos >= len(r.records),
+	}
+	if len(r.records) > 0 {
+		start := r.records[0].Timestamp
+		state.Total = r.records[len(r.records)-1].Timestamp.Sub(start)
+		state.Position = r.currentTime().Sub(start)
+	}
+	return state
+}
+
+// currentTime returns the timestamp of the last emitted record; caller must hold r.mu
+func (r *Replayer) currentTime() time.Time {
+	if r.pos == 0 {
+		return r.records[0].Timestamp
+	}
+	return r.records[r.pos-1].Timestamp
+}
+
+// replayedEvent returns a logged event for the errors channel. The log keeps only
+// its text, so the severity is told from that.
+func replayedEvent(text string) error {
+	switch {
+	case sessionlogger.IsErrorEvent(text):
+		return errors.New(text)
+	case strings.HasSuffix(text, ": reconnecting"):
+		return warnf("%s", text)
+	}
+	return infof("%s", text)
+}
+
+// emit sends a record into the pipeline, tagged with epoch; only called by Run,
+// so the record converter needs no lock and r.mu is not held while blocked
+func (r *Replayer) emit(ctx context.Context, record sessionlog.Record, epoch uint64) {
+	if record.Type == sessionlog.TypeEvent {
+		select {
+		case r.errorsCh <- replayedEvent(record.Event):
+		case <-ctx.Done():
+		default:
+		}
+		return
+	}
+
+	msg := r.toMessage(record)
+	msg.Epoch = epoch
+	select {
+	case r.messagesCh <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// recordConverter turns session log records back into messages, assigning each
+// source a display color in order of appearance
+type recordConverter struct {
+	topicDepth int
+	colors     map[string]string
+}
+
+func newRecordConverter(topicDepth int) *recordConverter {
+	return &recordConverter{topicDepth: topicDepth, colors: make(map[string]string)}
+}
+
+func (c *recordConverter) toMessage(record sessionlog.Record) monitor.Message {
+	color, ok := c.colors[record.Source]
+	if !ok {
+		color = connectionColors[len(c.colors)%len(connectionColors)]
+		c.colors[record.Source] = color
+	}
+
+	payload := record.Payload
+	if record.RawPayload != nil {
+		payload = mqtt.SanitizePayload(record.RawPayload)
+	}
+
+	topic := record.Topic
+	if topic == "" {
+		topic = record.DisplayTopic
+	}
+
+	return monitor.Message{
+		Topic:        topic,
+		DisplayTopic: mqtt.TruncateTopic(topic, c.topicDepth),
+		Payload:      payload,
+		RawPayload:   record.RawPayload,
+		Source:       record.Source,
+		Timestamp:    record.Timestamp,
+		QoS:          record.QoS,
+		Retained:     record.Retained,
+		Color:        color,
+	}
+}
+
+func (r *Replayer) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Replayer) notify() {
+	if r.onChange != nil {
+		r.onChange(r.State())
+	}
+}
+
+// FormatReplayTitle renders the playback state for the messages view title
+func FormatReplayTitle(state ReplayState) string {
+	status := "playing"
+	if state.Finished {
+		status = "finished"
+	} else if state.Paused {
+		status = "paused"
+	}
+	return fmt.Sprintf(" Messages - Replay [%s] %gx %s / %s ",
+		status, state.Speed,
+		state.Position.Truncate(time.Second), state.Total.Truncate(time.Second))
+}
+
+// runReplay loads a structured session log and browses it in the TUI
+func runReplay(config *Config, path string) {
+	records, err := sessionlog.Read(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load session log for replay")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ui := newUI(config)
+	m := monitor.New(monitor.Options{BufferSize: MaxDisplayedMessages})
+	messagesCh, errorsCh := m.Feed()
+
+	replayer := NewReplayer(records, messagesCh, errorsCh, config.Display.TopicDepth)
+	replayer.SetResetHandler(ui.ResetMessages)
+	replayer.SetStateHandler(func(state ReplayState) {
+		ui.SetMessagesTitle(FormatReplayTitle(state))
+	})
+
+	ui.BindAction("replay_pause", replayer.TogglePause)
+	ui.BindAction("replay_faster", func() { replayer.ChangeSpeed(2) })
+	ui.BindAction("replay_slower", func() { replayer.ChangeSpeed(0.5) })
+	ui.BindAction("replay_forward", func() { replayer.Seek(ReplaySeekStep) })
+	ui.BindAction("replay_back", func() { replayer.Seek(-ReplaySeekStep) })
+
+	sigCh := setupSignalHandler()
+	uiDone := startUI(ui, ctx)
+
+	replayDone := make(chan struct{})
+	go func() {
+		defer close(replayDone)
+		replayer.Run(ctx)
+	}()
+	m.AddHandler(newViewHandler(ui, m.State(), nil, nil))
+	monitorDone := runPipeline(m, ctx)
+
+	waitForShutdownSignal(sigCh, uiDone)
+
+	cancel()
+	<-replayDone
+	performGracefulShutdown(cancel, ui, monitorDone, "replay finished")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// RepublishOptions controls how a recorded session is sent back to a broker
+type RepublishOptions struct {
+	Connection  string  // Name of the configured connection to publish through
+	Speed       float64 // Playback speed factor (2 = twice as fast)
+	TopicPrefix string  // Prepended to every recorded topic
+}
+
+// runRepublish publishes the messages of a structured session log to a broker,
+// preserving the original relative timing
+func runRepublish(config *Config, path string, opts RepublishOptions) error {
+	records, err := sessionlog.Read(path)
+	if err != nil {
+		return err
+	}
+
+	conn, err := findConnection(config, opts.Connection)
+	if err != nil {
+		return err
+	}
+
+	if opts.Speed <= 0 {
+		return fmt.Errorf("speed must be positive")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	client := mqtt.NewClient(conn.ToMQTTConfig(), log.With().Str("component", "republish").Logger())
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect %s: %w", conn.Name, err)
+	}
+	defer client.Disconnect()
+
+	fmt.Fprintf(os.Stderr, "Republishing %s to %s (%s) at %gx\n", path, conn.Name, conn.Server, opts.Speed)
+
+	published := 0
+	var previous time.Time
+	for _, record := range records {
+		if record.Type != sessionlog.TypeMessage {
+			continue
+		}
+
+		if !previous.IsZero() {
+			delay := time.Duration(float64(record.Timestamp.Sub(previous)) / opts.Speed)
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					fmt.Fprintf(os.Stderr, "Interrupted after %d messages\n", published)
+					return nil
+				case <-time.After(delay):
+				}
+			}
+		}
+		previous = record.Timestamp
+
+		payload := record.RawPayload
+		if payload == nil {
+			payload = []byte(record.Payload)
+		}
+
+		topic := opts.TopicPrefix + record.Topic
+		if err := client.Publish(topic, payload, record.QoS, record.Retained); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to publish to %s: %v\n", topic, err)
+			continue
+		}
+		published++
+	}
+
+	fmt.Fprintf(os.Stderr, "Republished %d messages\n", published)
+	return nil
+}
+
+// findConnection returns the named connection, or the first one when name is empty
+func findConnection(config *Config, name string) (*monitor.ConnectionConfig, error) {
+	if len(config.Connections) == 0 {
+		return nil, fmt.Errorf("no connections configured")
+	}
+	if name == "" {
+		return &config.Connections[0], nil
+	}
+	for i := range config.Connections {
+		if config.Connections[i].Name == name {
+			return &config.Connections[i], nil
+		}
+	}
+	return nil, fmt.Errorf("connection %q not found in configuration", name)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+// appName names the per-user config and state directories
+const appName = "mqtt-monitor"
+
+// findConfigFile returns the config file used when -config is not given: the
+// first existing of $XDG_CONFIG_HOME/mqtt-monitor/config.toml and
+// ~/.config/mqtt-monitor/config.toml, else config.toml in the working directory
+func findConfigFile() string {
+	var dirs []string
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config"))
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, appName, "config.toml")
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return "config.toml"
+}
+
+// userConfigFile returns where the setup wizard writes a new config when -config
+// is not given: in the first directory findConfigFile searches
+func userConfigFile() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, appName, "config.toml")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", appName, "config.toml")
+	}
+	return "config.toml"
+}
+
+// stateDir returns $XDG_STATE_HOME/mqtt-monitor, or ~/.local/state/mqtt-monitor
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("no state directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", appName), nil
+}
+
+// SavedState is the runtime state kept for one config file
+type SavedState struct {
+	LogFilters sessionlogger.TopicFilterSet `json:"log_filters"` // Session log filters added with the add_filter command
+}
+
+// StateStore keeps runtime state across restarts in state.json of the state
+// directory, with one entry per config file so monitors of different configs
+// do not share filters
+type StateStore struct {
+	path string
+	key  string // Absolute path of the config file
+	mu   sync.Mutex
+}
+
+// NewStateStore returns the store of the state of configFile
+func NewStateStore(configFile string) (*StateStore, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+	key, err := filepath.Abs(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return &StateStore{path: filepath.Join(dir, "state.json"), key: key}, nil
+}
+
+// Path returns the state file
+func (s *StateStore) Path() string {
+	return s.path
+}
+
+// Load returns the saved state, empty when nothing was saved yet
+func (s *StateStore) Load() (SavedState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAll()
+	return all[s.key], err
+}
+
+// Update changes the saved state with update, leaving the entries of other
+// config files alone
+func (s *StateStore) Update(update func(state *SavedState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAll()
+	if err != nil {
+		return err
+	}
+	state := all[s.key]
+	update(&state)
+	all[s.key] = state
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	// Write a temporary file first so a crash cannot leave a truncated state file
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// readAll reads the state of all config files; caller must hold s.mu
+func (s *StateStore) readAll() (map[string]SavedState, error) {
+	all := map[string]SavedState{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return all, nil
+	} else if err != nil {
+		return all, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return map[string]SavedState{}, fmt.Errorf("invalid state file %s: %w", s.path, err)
+	}
+	return all, nil
+}
+
+// restoreRuntimeState opens the state store of configFile and re-applies the
+// saved state. Problems are reported through notify; the monitor runs without
+// saved state then, and nil is returned if the store is unusable.
+func restoreRuntimeState(configFile string, sessionLogger *sessionlogger.Logger, notify func(error)) *StateStore {
+	store, err := NewStateStore(configFile)
+	if err != nil {
+		notify(fmt.Errorf("runtime state disabled: %w", err))
+		return nil
+	}
+	state, err := store.Load()
+	if err != nil {
+		notify(fmt.Errorf("runtime state not restored: %w", err))
+		return store
+	}
+
+	if sessionLogger != nil {
+		filters := state.LogFilters
+		for _, filter := range filters.Include {
+			if err := sessionLogger.AddTopicFilter(filter, false); err != nil {
+				notify(fmt.Errorf("saved log filter %s: %w", filter, err))
+			}
+		}
+		for _, filter := range filters.Exclude {
+			if err := sessionLogger.AddTopicFilter(filter, true); err != nil {
+				notify(fmt.Errorf("saved log filter %s: %w", filter, err))
+			}
+		}
+		if len(filters.Include)+len(filters.Exclude) > 0 {
+			log.Info().Strs("include", filters.Include).Strs("exclude", filters.Exclude).
+				Str("state_file", store.Path()).Msg("Restored session log filters")
+		}
+	}
+	return store
+}
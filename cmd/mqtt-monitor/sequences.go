@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// showSequences shows the sequence counts of the topics matching the sequence
+// rules, those with the most lost messages first
+func showSequences(ui *UI, state *monitor.State) {
+	stats := state.Sequences()
+	ui.ShowPanel(fmt.Sprintf("Sequences (%d %s)", len(stats), topicsNoun(len(stats))), formatSequences(stats))
+}
+
+// formatSequences writes a table of sequence counts for the sequences panel:
+// topics that lost messages in red, topics whose sequence went back in yellow
+func formatSequences(stats []monitor.SequenceStats) string {
+	if len(stats) == 0 {
+		return "No sequence numbers seen yet. Sequence rules are set in [[sequence]] sections of the config."
+	}
+
+	width := len("TOPIC")
+	for _, st := range stats {
+		width = max(width, len(st.Topic)+len(st.Source)+3)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[::b]%-*s %12s %10s %8s %6s %6s %6s[::-]\n", width, "TOPIC", "LAST", "MESSAGES", "LOST", "GAPS", "RESETS", "DUPS")
+	for _, st := range stats {
+		color := "green"
+		switch {
+		case st.Lost > 0:
+			color = "red"
+		case st.Resets > 0:
+			color = "yellow"
+		}
+		name := fmt.Sprintf("%s (%s)", st.Topic, st.Source)
+		fmt.Fprintf(&b, "[%s]%-*s[-] %12d %10d %8d %6d %6d %6d\n", color, width, tview.Escape(name),
+			st.Last, st.Messages, st.Lost, st.Gaps, st.Resets, st.Duplicates)
+	}
+	return b.String()
+}
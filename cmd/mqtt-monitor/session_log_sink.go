@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+func init() {
+	RegisterSink("session_log", newSessionLogSink)
+}
+
+// sessionLogSink writes an additional session log, e.g. one limited to some topics or
+// in another format than the [logging] one. Its entry takes the session log keys of
+// [logging]: output_dir, log_format, log_topics, session_log_max_duration and so on.
+type sessionLogSink struct {
+	config sessionlogger.Config
+	logger zerolog.Logger
+	*sessionlogger.Logger
+}
+
+func newSessionLogSink(entry SinkEntry, config *Config, logger zerolog.Logger) (Sink, error) {
+	var logging Logging
+	if err := entry.Decode(&logging); err != nil {
+		return nil, err
+	}
+	if logging.OutputDir == "" {
+		return nil, fmt.Errorf("sink %s: output_dir is required", entry.Name)
+	}
+	if err := validateSessionLogSettings(&logging); err != nil {
+		return nil, fmt.Errorf("sink %s: %w", entry.Name, err)
+	}
+	loggerConfig, err := newSessionLoggerConfig(logging, connectionNames(config))
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: %w", entry.Name, err)
+	}
+	return &sessionLogSink{config: loggerConfig, logger: logger}, nil
+}
+
+// Start creates the output directory and opens the first log file
+func (s *sessionLogSink) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.config.OutputDir, 0755); err != nil {
+		return err
+	}
+	sessionLogger, err := sessionlogger.New(s.config, s.logger)
+	if err != nil {
+		return err
+	}
+	s.Logger = sessionLogger
+	s.Logger.Start(ctx)
+	return nil
+}
+
+func (s *sessionLogSink) Write(msg monitor.Message) error {
+	return s.LogMessage(msg)
+}
+
+func (s *sessionLogSink) WriteEvent(event monitor.Event) error {
+	return s.LogEvent(event.Message)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// sinkQueueSize is the number of messages queued per sink before messages are dropped
+const sinkQueueSize = 10000
+
+var errSinkClosed = errors.New("sink is closed")
+
+// Sink is an output that receives messages alongside the display. Start is called once
+// before the first Write and may connect; Write is called from a single goroutine and
+// should not block for long, since messages are dropped while a sink falls behind;
+// Close flushes pending output and is called after the last Write.
+type Sink interface {
+	Start(ctx context.Context) error
+	Write(msg monitor.Message) error
+	Close() error
+}
+
+// EventSink is implemented by sinks that also record connection events and errors
+type EventSink interface {
+	WriteEvent(event monitor.Event) error
+}
+
+// SinkFactory creates a sink from its configuration entry. It must not connect or
+// create files: it also runs when the configuration is validated.
+type SinkFactory func(entry SinkEntry, config *Config, logger zerolog.Logger) (Sink, error)
+
+var sinkFactories = make(map[string]SinkFactory)
+
+// RegisterSink makes a sink type available to [[sink]] entries
+func RegisterSink(sinkType string, factory SinkFactory) {
+	if _, exists := sinkFactories[sinkType]; exists {
+		panic("sink type registered twice: " + sinkType)
+	}
+	sinkFactories[sinkType] = factory
+}
+
+// SinkConfig lists the outputs that receive messages alongside the display. Each
+// [[sink]] entry selects a registered type; the older form with one [sink.<type>]
+// table per type is still accepted.
+type SinkConfig []SinkEntry
+
+// SinkEntry is one configured sink
+type SinkEntry struct {
+	Type    string         // Registered sink type, e.g. "influxdb"
+	Name    string         // Name in logs (default: "<type>[<n>]")
+	Options map[string]any // The other keys of the entry, decoded by the sink type
+}
+
+// UnmarshalTOML reads either an array of [[sink]] tables or the [sink.<type>] tables
+func (c *SinkConfig) UnmarshalTOML(data any) error {
+	*c = nil
+	switch v := data.(type) {
+	case []map[string]any:
+		for i, table := range v {
+			sinkType, _ := table["type"].(string)
+			if sinkType == "" {
+				return fmt.Errorf("sink %d: type is required", i+1)
+			}
+			name, _ := table["name"].(string)
+			options := make(map[string]any, len(table))
+			for key, value := range table {
+				if key != "type" && key != "name" {
+					options[key] = value
+				}
+			}
+			*c = append(*c, SinkEntry{Type: sinkType, Name: name, Options: options})
+		}
+	case map[string]any:
+		types := make([]string, 0, len(v))
+		for sinkType := range v {
+			types = append(types, sinkType)
+		}
+		sort.Strings(types)
+		for _, sinkType := range types {
+			options, ok := v[sinkType].(map[string]any)
+			if !ok {
+				return fmt.Errorf("sink.%s must be a table", sinkType)
+			}
+			*c = append(*c, SinkEntry{Type: sinkType, Options: options})
+		}
+	default:
+		return fmt.Errorf("sink must be an array of tables")
+	}
+	return nil
+}
+
+// setDefaultNames names unnamed entries "<type>[<n>]", counting all entries of a
+// type including those of included files
+func (c SinkConfig) setDefaultNames() {
+	counts := make(map[string]int)
+	for i := range c {
+		entry := &c[i]
+		if entry.Name == "" {
+			entry.Name = fmt.Sprintf("%s[%d]", entry.Type, counts[entry.Type])
+		}
+		counts[entry.Type]++
+	}
+}
+
+// Decode decodes the entry's options into v, a struct with toml tags
+func (e SinkEntry) Decode(v any) error {
+	data, err := toml.Marshal(e.Options)
+	if err != nil {
+		return err
+	}
+	if _, err := toml.Decode(string(data), v); err != nil {
+		return fmt.Errorf("sink %s: %w", e.Name, err)
+	}
+	return nil
+}
+
+// newSink creates the sink of entry with its registered factory
+func newSink(entry SinkEntry, config *Config, logger zerolog.Logger) (Sink, error) {
+	factory, ok := sinkFactories[entry.Type]
+	if !ok {
+		return nil, fmt.Errorf("sink %s: unknown type %q", entry.Name, entry.Type)
+	}
+	return factory(entry, config, logger)
+}
+
+// validateSinkConfig checks the settings of every configured sink
+func validateSinkConfig(config *Config) error {
+	names := make(map[string]bool)
+	for _, entry := range config.Sink {
+		if names[entry.Name] {
+			return fmt.Errorf("duplicate sink name %q", entry.Name)
+		}
+		names[entry.Name] = true
+		if _, err := newSink(entry, config, zerolog.Nop()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startSinks starts each configured sink and subscribes it to the message feed. The
+// returned function waits for the sinks to flush and close after ctx is cancelled.
+func startSinks(config *Config, state *monitor.State, ctx context.Context) func() {
+	var wg sync.WaitGroup
+	for _, entry := range config.Sink {
+		logger := log.With().Str("component", entry.Type+"-sink").Str("sink", entry.Name).Logger()
+		sink, err := newSink(entry, config, logger)
+		if err == nil {
+			err = sink.Start(ctx)
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to start sink")
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runSink(ctx, sink, state, logger)
+		}()
+	}
+	return wg.Wait
+}
+
+// runSink feeds sink from the state until ctx is cancelled, then closes it
+func runSink(ctx context.Context, sink Sink, state *monitor.State, logger zerolog.Logger) {
+	messages, unsubscribe := state.Subscribe(sinkQueueSize)
+	defer unsubscribe()
+
+	var events <-chan monitor.Event
+	eventSink, ok := sink.(EventSink)
+	if ok {
+		var unsubscribeEvents func()
+		events, unsubscribeEvents = state.SubscribeEvents(sinkQueueSize)
+		defer unsubscribeEvents()
+	}
+
+	defer func() {
+		if err := sink.Close(); err != nil {
+			logger.Warn().Err(err).Msg("Failed to close sink")
+		}
+	}()
+
+	failing := false
+	report := func(err error) {
+		switch {
+		case err != nil && !failing && ctx.Err() == nil:
+			// Log the first failure only, a sink can fail at the message rate
+			logger.Warn().Err(err).Msg("Sink write failed, dropping messages until it recovers")
+		case err == nil && failing:
+			logger.Info().Msg("Sink recovered")
+		}
+		failing = err != nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			report(sink.Write(msg))
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			report(eventSink.WriteEvent(event))
+		}
+	}
+}
+
+// sinkQueue implements Write and Close for sinks that batch messages in a goroutine of
+// their own. Write blocks while the goroutine is busy, so the subscription queue absorbs
+// slow flushes.
+type sinkQueue struct {
+	messages chan monitor.Message
+	done     chan struct{}
+}
+
+// start runs loop until ctx is cancelled or the queue is closed
+func (q *sinkQueue) start(ctx context.Context, loop func(context.Context, <-chan monitor.Message)) {
+	q.messages = make(chan monitor.Message)
+	q.done = make(chan struct{})
+	go func() {
+		defer close(q.done)
+		loop(ctx, q.messages)
+	}()
+}
+
+func (q *sinkQueue) Write(msg monitor.Message) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	case <-q.done:
+		return errSinkClosed
+	}
+}
+
+// Close lets the loop flush and waits for it to return
+func (q *sinkQueue) Close() error {
+	close(q.messages)
+	<-q.done
+	return nil
+}
+
+// permanentError marks a rejected write that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// retryWithBackoff calls fn until it succeeds, returns a permanentError or has
+// been retried maxRetries times, doubling the delay between attempts from one second
+func retryWithBackoff(ctx context.Context, maxRetries int, fn func() error) error {
+	backoff := time.Second
+
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		err = fn()
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+)
+
+// snapshotVersion is the version of the snapshot file format, raised when a
+// change would make older monitors misread a snapshot
+const snapshotVersion = 1
+
+// Snapshot is what the TUI shows, saved by the snapshot command so an
+// investigation can be resumed later, also after a reboot, with restore or
+// -restore: the kept messages of every tab, the topic filter, the search, the
+// status events and the layout
+type Snapshot struct {
+	Version    int               `json:"version"`
+	Saved      time.Time         `json:"saved"`
+	Tab        string            `json:"tab,omitempty"` // Connection of the shown tab, "" for the All tab
+	Paused     bool              `json:"paused"`
+	Filter     string            `json:"filter,omitempty"` // Topic filter of the messages view
+	Search     string            `json:"search,omitempty"`
+	PrettyJSON bool              `json:"pretty_json"`
+	EventLevel string            `json:"event_level"`
+	Theme      string            `json:"theme"`
+	Keymap     string            `json:"keymap"`
+	Colors     map[string]string `json:"colors,omitempty"` // Color of the messages of each connection
+	Tabs       []SnapshotTab     `json:"tabs"`             // The All tab first
+	Events     []SnapshotEvent   `json:"events,omitempty"` // Of the status view, oldest first
+}
+
+// SnapshotTab holds the kept messages of a tab
+type SnapshotTab struct {
+	Connection string              `json:"connection,omitempty"` // "" for the All tab
+	Messages   []sessionlog.Record `json:"messages"`             // Oldest first
+}
+
+// SnapshotEvent is an event of the status view
+type SnapshotEvent struct {
+	Time     time.Time `json:"time"`
+	Text     string    `json:"text"`
+	Severity string    `json:"severity"`
+}
+
+// defaultSnapshotFile returns the file the snapshot and restore commands use
+// without a file: snapshot.json in the state directory
+func defaultSnapshotFile() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "snapshot.json"), nil
+}
+
+// writeSnapshot writes snapshot to path, readable only by the user as it holds
+// payloads
+func writeSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Write a temporary file first so a crash cannot leave a truncated snapshot
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readSnapshot reads a snapshot written by writeSnapshot
+func readSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	if snapshot.Version > snapshotVersion {
+		return nil, fmt.Errorf("snapshot %s has version %d, this monitor reads up to %d", path, snapshot.Version, snapshotVersion)
+	}
+	return &snapshot, nil
+}
+
+// snapshotPath returns the file given to the snapshot or restore command, or the
+// default one
+func snapshotPath(arg string) (string, error) {
+	if arg != "" {
+		return arg, nil
+	}
+	return defaultSnapshotFile()
+}
+
+// saveSnapshot saves what the TUI shows to the file given, or the default file,
+// and returns the outcome to report in the status view
+func saveSnapshot(ui *UI, arg string) error {
+	path, err := snapshotPath(arg)
+	if err == nil {
+		err = writeSnapshot(path, ui.Snapshot())
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot not saved: %w", err)
+	}
+	return infof("snapshot saved to %s", path)
+}
+
+// restoreSnapshot brings back the snapshot in the file given, or the default
+// file, and returns the outcome to report in the status view
+func restoreSnapshot(ui *UI, arg string) error {
+	path, err := snapshotPath(arg)
+	var snapshot *Snapshot
+	if err == nil {
+		snapshot, err = readSnapshot(path)
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot not restored: %w", err)
+	}
+	if err := ui.RestoreSnapshot(snapshot); err != nil {
+		return warnf("snapshot %s restored in part: %w", path, err)
+	}
+	return infof("snapshot of %s restored from %s", snapshot.Saved.Local().Format(time.DateTime), path)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	defaultStatusTopic    = "mqtt-monitor/{hostname}/status"
+	defaultStatusInterval = 30 * time.Second
+)
+
+// StatusConfig configures publishing of the monitor's own status
+type StatusConfig struct {
+	Enabled     bool     `toml:"enabled"`     // Publish the monitor status as retained JSON
+	Topic       string   `toml:"topic"`       // Topic template with {hostname} and {connection} (default: "mqtt-monitor/{hostname}/status")
+	Interval    string   `toml:"interval"`    // Time between updates (default: "30s")
+	Connections []string `toml:"connections"` // Connections to publish through (default: all)
+	QoS         byte     `toml:"qos"`         // QoS of status messages
+
+	HomeAssistant HomeAssistantConfig `toml:"home_assistant"`
+}
+
+// StatusReport is the retained status payload
+type StatusReport struct {
+	State         string                     `json:"state"` // "online" or "offline"
+	Host          string                     `json:"host"`
+	Timestamp     time.Time                  `json:"timestamp"`
+	StartTime     time.Time                  `json:"start_time,omitzero"`
+	Uptime        string                     `json:"uptime,omitempty"`
+	Messages      uint64                     `json:"messages"`
+	Errors        uint64                     `json:"errors"`
+	RatePerSecond float64                    `json:"rate_per_second"`
+	Connections   []monitor.ConnectionStatus `json:"connections,omitempty"`
+}
+
+// StatusPublisher periodically publishes a StatusReport through the selected connections
+type StatusPublisher struct {
+	config   StatusConfig
+	template string // Status topic template
+	interval time.Duration
+	qos      byte
+	host     string
+	state    *monitor.State
+	logger   zerolog.Logger
+
+	mu      sync.Mutex                 // Guards targets
+	targets map[*monitor.Client]string // Client to its status topic
+}
+
+// validateStatusConfig checks the status settings
+func validateStatusConfig(c StatusConfig, connections []monitor.ConnectionConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval != "" {
+		if d, err := time.ParseDuration(c.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid status interval %q", c.Interval)
+		}
+	}
+	if c.QoS > 2 {
+		return fmt.Errorf("invalid status qos %d", c.QoS)
+	}
+	if strings.ContainsAny(c.Topic, "+#") {
+		return fmt.Errorf("status topic %q must not contain wildcards", c.Topic)
+	}
+	for _, name := range c.Connections {
+		if !slices.ContainsFunc(connections, func(conn monitor.ConnectionConfig) bool { return conn.Name == name }) {
+			return fmt.Errorf("status connection %q is not configured", name)
+		}
+	}
+	return validateHomeAssistantConfig(c.HomeAssistant)
+}
+
+// NewStatusPublisher registers the offline status as last will on the selected clients,
+// so it must be called before they connect
+func NewStatusPublisher(config StatusConfig, state *monitor.State, clients []*monitor.Client, logger zerolog.Logger) *StatusPublisher {
+	interval := defaultStatusInterval
+	if d, err := time.ParseDuration(config.Interval); err == nil && d > 0 {
+		interval = d
+	}
+	template := config.Topic
+	if template == "" {
+		template = defaultStatusTopic
+	}
+
+	p := &StatusPublisher{
+		config:   config,
+		template: template,
+		interval: interval,
+		qos:      config.QoS,
+		host:     hostname(),
+		state:    state,
+		targets:  make(map[*monitor.Client]string),
+		logger:   logger,
+	}
+	p.SetClients(clients)
+	return p
+}
+
+// SetClients publishes the status through the selected clients of clients from
+// now on. Clients not seen before get the offline status as last will, so it
+// must be called before they connect, as after a reload replaced connections.
+func (p *StatusPublisher) SetClients(clients []*monitor.Client) {
+	names := make([]string, 0, len(clients))
+	for _, client := range clients {
+		names = append(names, client.Name())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	targets := make(map[*monitor.Client]string)
+	for _, client := range clients {
+		if len(p.config.Connections) > 0 && !slices.Contains(p.config.Connections, client.Name()) {
+			continue
+		}
+		if topic, ok := p.targets[client]; ok {
+			targets[client] = topic
+			continue
+		}
+
+		topic := strings.NewReplacer("{hostname}", topicLevel(p.host), "{connection}", topicLevel(client.Name())).Replace(p.template)
+		targets[client] = topic
+
+		offline, _ := json.Marshal(StatusReport{State: "offline", Host: p.host, Timestamp: time.Now()})
+		client.SetOfflineStatus(topic, offline, p.qos)
+		client.OnConnected(func() { p.publish(client, topic) })
+
+		if p.config.HomeAssistant.Enabled {
+			node, device := haID("mqtt_monitor_"+p.host), "MQTT Monitor "+p.host
+			if strings.Contains(p.template, "{connection}") {
+				// One status topic per connection, so one device per connection too
+				node, device = node+"_"+haID(client.Name()), device+" ("+client.Name()+")"
+			}
+			discovery := homeAssistantDiscovery(p.config.HomeAssistant, node, device, topic, names)
+			client.OnConnected(func() { p.publishDiscovery(client, discovery) })
+		}
+	}
+	p.targets = targets
+}
+
+// topicLevel makes s usable as a single topic level
+func topicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// Run publishes the status every interval until ctx is cancelled
+func (p *StatusPublisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			targets := maps.Clone(p.targets)
+			p.mu.Unlock()
+			for client, topic := range targets {
+				if client.Status().Connected {
+					p.publish(client, topic)
+				}
+			}
+		}
+	}
+}
+
+// publishDiscovery announces the status sensors to Home Assistant as retained configs
+func (p *StatusPublisher) publishDiscovery(client *monitor.Client, discovery []haDiscoveryMessage) {
+	for _, msg := range discovery {
+		if err := client.Publish(msg.topic, msg.payload, p.qos, true); err != nil {
+			p.logger.Warn().Err(err).Str("topic", msg.topic).Msg("Failed to publish Home Assistant discovery config")
+		}
+	}
+}
+
+func (p *StatusPublisher) publish(client *monitor.Client, topic string) {
+	stats := p.state.Stats(0)
+	payload, err := json.Marshal(StatusReport{
+		State:         "online",
+		Host:          p.host,
+		Timestamp:     time.Now(),
+		StartTime:     stats.StartTime,
+		Uptime:        stats.Uptime,
+		Messages:      stats.Messages,
+		Errors:        stats.Errors,
+		RatePerSecond: stats.RatePerSecond,
+		Connections:   p.state.Connections(),
+	})
+	if err != nil {
+		return
+	}
+
+	if err := client.Publish(topic, payload, p.qos, true); err != nil {
+		p.logger.Warn().Err(err).Str("topic", topic).Msg("Failed to publish monitor status")
+	}
+}
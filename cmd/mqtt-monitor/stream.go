@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+const (
+	streamBuffer       = 1000 // Messages queued per stream client before messages are dropped
+	streamWriteTimeout = 10 * time.Second
+	streamPingInterval = 30 * time.Second
+)
+
+// handleStream upgrades the request to a WebSocket and pushes every received
+// message matching the topic, source and q query parameters as a JSON record
+func (s *APIServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	query, err := parseMessageQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	query.Since, query.Limit = time.Time{}, 0
+
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		return
+	}
+	defer conn.Close()
+
+	messages, unsubscribe := s.state.Subscribe(streamBuffer)
+	defer unsubscribe()
+
+	// The stream is one-way; reading only detects the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if !query.Match(msg) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(sessionlogger.NewMessageRecord(msg)); err != nil {
+				s.logger.Debug().Err(err).Msg("Stream client write failed")
+				return
+			}
+		}
+	}
+}
+
+// checkOrigin accepts same-origin requests, non-browser clients and the
+// configured allowed origins
+func (s *APIServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(s.allowedOrigins, "*") || slices.Contains(s.allowedOrigins, origin) {
+		return true
+	}
+	return websocket.IsWebSocketUpgrade(r) && sameOrigin(r, origin)
+}
+
+func sameOrigin(r *http.Request, origin string) bool {
+	for _, scheme := range []string{"http://", "https://"} {
+		if origin == scheme+r.Host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// Syslog severities used by the sink (RFC 5424 section 6.2.1)
+const (
+	syslogSeverityError   = 3
+	syslogSeverityWarning = 4
+	syslogSeverityNotice  = 5
+	syslogSeverityInfo    = 6
+)
+
+// syslogSDID identifies the structured data element carrying MQTT metadata
+const syslogSDID = "mqtt@32473"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogSinkConfig configures forwarding of messages and events to syslog
+type SyslogSinkConfig struct {
+	Address       string   `toml:"address"`         // "local", "udp://host:514", "tcp://host:514" or "tls://host:6514"
+	Facility      string   `toml:"facility"`        // Syslog facility name (default: "local0")
+	AppName       string   `toml:"app_name"`        // APP-NAME field (default: "mqtt-monitor")
+	Messages      bool     `toml:"messages"`        // Forward received messages
+	Events        bool     `toml:"events"`          // Forward connection events and errors
+	Topics        []string `toml:"topics"`          // Only forward messages matching these topic filters (default: all)
+	TLSCAFile     string   `toml:"tls_ca_file"`     // CA certificate for tls:// (default: system roots)
+	TLSSkipVerify bool     `toml:"tls_skip_verify"` // Accept any server certificate for tls://
+}
+
+func init() {
+	RegisterSink("syslog", func(entry SinkEntry, _ *Config, _ zerolog.Logger) (Sink, error) {
+		var c SyslogSinkConfig
+		if err := entry.Decode(&c); err != nil {
+			return nil, err
+		}
+		return NewSyslogSink(c)
+	})
+}
+
+// SyslogSink writes RFC 5424 records to a local or remote syslog daemon
+type SyslogSink struct {
+	config   SyslogSinkConfig
+	facility int
+	network  string
+	address  string
+	hostname string
+	procID   string
+	conn     net.Conn
+}
+
+// parseSyslogAddress splits the address into network and host:port; "local" uses the local socket
+func parseSyslogAddress(address string) (string, string, error) {
+	if address == "local" {
+		for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			if _, err := os.Stat(path); err == nil {
+				return "unixgram", path, nil
+			}
+		}
+		return "", "", fmt.Errorf("no local syslog socket found")
+	}
+
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid syslog address %q (expected local, udp://, tcp:// or tls://host:port)", address)
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return "", "", fmt.Errorf("unsupported syslog scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "514"
+		if u.Scheme == "tls" {
+			port = "6514"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u.Scheme, host, nil
+}
+
+// validateSyslogSinkConfig checks the settings without connecting
+func validateSyslogSinkConfig(c SyslogSinkConfig) error {
+	if err := validateTopicFilters("syslog topics", c.Topics); err != nil {
+		return err
+	}
+	if c.Facility != "" {
+		if _, ok := syslogFacilities[c.Facility]; !ok {
+			return fmt.Errorf("unknown syslog facility %q", c.Facility)
+		}
+	}
+	if !c.Messages && !c.Events {
+		return fmt.Errorf("syslog sink forwards nothing: enable messages and/or events")
+	}
+	if c.Address != "local" {
+		if _, _, err := parseSyslogAddress(c.Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewSyslogSink(config SyslogSinkConfig) (*SyslogSink, error) {
+	if err := validateSyslogSinkConfig(config); err != nil {
+		return nil, err
+	}
+	network, address, err := parseSyslogAddress(config.Address)
+	if err != nil {
+		return nil, err
+	}
+	if config.Facility == "" {
+		config.Facility = "local0"
+	}
+	if config.AppName == "" {
+		config.AppName = "mqtt-monitor"
+	}
+
+	return &SyslogSink{
+		config:   config,
+		facility: syslogFacilities[config.Facility],
+		network:  network,
+		address:  address,
+		hostname: hostname(),
+		procID:   strconv.Itoa(os.Getpid()),
+	}, nil
+}
+
+// Start does nothing, the connection is opened by the first record
+func (s *SyslogSink) Start(context.Context) error {
+	return nil
+}
+
+func (s *SyslogSink) Write(msg monitor.Message) error {
+	if !s.config.Messages || !s.matches(msg.Topic) {
+		return nil
+	}
+	return s.send(syslogSeverityInfo, msg.Timestamp, "message", s.messageData(msg), msg.Payload)
+}
+
+func (s *SyslogSink) WriteEvent(event monitor.Event) error {
+	if !s.config.Events {
+		return nil
+	}
+	severity := syslogSeverityNotice
+	switch event.Severity {
+	case monitor.SeverityError:
+		severity = syslogSeverityError
+	case monitor.SeverityWarning:
+		severity = syslogSeverityWarning
+	}
+	return s.send(severity, event.Timestamp, "event", "-", event.Message)
+}
+
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *SyslogSink) matches(topic string) bool {
+	if len(s.config.Topics) == 0 {
+		return true
+	}
+	for _, filter := range s.config.Topics {
+		if mqtt.TopicMatches(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SyslogSink) messageData(msg monitor.Message) string {
+	return fmt.Sprintf(`[%s source="%s" topic="%s" qos="%d" retained="%t"]`,
+		syslogSDID, escapeSDParam(msg.Source), escapeSDParam(msg.Topic), msg.QoS, msg.Retained)
+}
+
+// escapeSDParam escapes a structured data parameter value (RFC 5424 section 6.3.3)
+func escapeSDParam(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// formatSyslog builds an RFC 5424 record
+func (s *SyslogSink) formatSyslog(severity int, ts time.Time, msgID, data, text string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s",
+		s.facility*8+severity, ts.Format(time.RFC3339Nano), s.hostname, s.config.AppName, s.procID, msgID, data, text)
+}
+
+// send writes one record, reconnecting once if the connection was lost
+func (s *SyslogSink) send(severity int, ts time.Time, msgID, data, text string) error {
+	record := s.formatSyslog(severity, ts, msgID, data, text)
+	if s.network == "tcp" || s.network == "tls" {
+		// Octet counting framing (RFC 6587 / RFC 5425)
+		record = strconv.Itoa(len(record)) + " " + record
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if err := s.dial(); err != nil {
+				return fmt.Errorf("syslog connection failed: %w", err)
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err = s.conn.Write([]byte(record)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return fmt.Errorf("syslog write failed: %w", err)
+}
+
+func (s *SyslogSink) dial() error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if s.network != "tls" {
+		conn, err := dialer.Dial(s.network, s.address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+		return nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: s.config.TLSSkipVerify}
+	if s.config.TLSCAFile != "" {
+		pool, err := monitor.LoadCertPool(s.config.TLSCAFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", s.address, tlsConfig)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// systemdStatusInterval is how often STATUS= is refreshed when the watchdog is off
+const systemdStatusInterval = 10 * time.Second
+
+// SystemdNotifier speaks the sd_notify protocol of Type=notify services: it reports
+// readiness, a status line and shutdown, and sends watchdog keep-alive pings only
+// while the message loop answers liveness probes, so systemd restarts a monitor
+// whose pipeline is stuck even though the process is still running
+type SystemdNotifier struct {
+	socket   *net.UnixAddr
+	watchdog time.Duration // WATCHDOG_USEC; 0 when the watchdog is disabled
+	logger   zerolog.Logger
+}
+
+// NewSystemdNotifier returns nil unless the process was started by systemd with
+// NOTIFY_SOCKET set, i.e. as a Type=notify service
+func NewSystemdNotifier(logger zerolog.Logger) *SystemdNotifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // Abstract namespace
+	}
+
+	n := &SystemdNotifier{
+		socket: &net.UnixAddr{Name: socket, Net: "unixgram"},
+		logger: logger,
+	}
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		// WATCHDOG_PID, when set, names the process the watchdog is meant for
+		if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			n.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return n
+}
+
+// notify sends one or more newline separated assignments to systemd
+func (n *SystemdNotifier) notify(state string) error {
+	conn, err := net.DialUnix("unixgram", nil, n.socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Ready tells systemd that startup is complete and starts the status and watchdog
+// loop, which runs until ctx is cancelled
+func (n *SystemdNotifier) Ready(m *monitor.Monitor, ctx context.Context) {
+	if n == nil {
+		return
+	}
+	state := m.State()
+	if err := n.notify("READY=1\nSTATUS=" + systemdStatus(state)); err != nil {
+		n.logger.Warn().Err(err).Msg("Failed to notify systemd")
+		return
+	}
+	if n.watchdog > 0 {
+		n.logger.Info().Dur("timeout", n.watchdog).Msg("systemd watchdog enabled")
+	}
+	go n.run(m, ctx)
+}
+
+// Stopping tells systemd that shutdown has begun
+func (n *SystemdNotifier) Stopping() {
+	if n == nil {
+		return
+	}
+	n.notify("STOPPING=1")
+}
+
+func (n *SystemdNotifier) run(m *monitor.Monitor, ctx context.Context) {
+	interval := systemdStatusInterval
+	if n.watchdog > 0 {
+		// Ping at half the timeout, as sd_watchdog_enabled(3) recommends
+		interval = n.watchdog / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stalled := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status := "STATUS=" + systemdStatus(m.State())
+		if n.watchdog > 0 {
+			if !probe(m, ctx, interval/2) {
+				if !stalled && ctx.Err() == nil {
+					n.logger.Error().Msg("Message loop is not responding, withholding watchdog pings")
+				}
+				stalled = true
+				continue
+			}
+			if stalled {
+				n.logger.Info().Msg("Message loop is responding again")
+			}
+			stalled = false
+			status = "WATCHDOG=1\n" + status
+		}
+		if err := n.notify(status); err != nil {
+			n.logger.Warn().Err(err).Msg("Failed to notify systemd")
+		}
+	}
+}
+
+// probe reports whether the message loop of m answered a probe within timeout
+func probe(m *monitor.Monitor, ctx context.Context, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return m.Alive(ctx)
+}
+
+// systemdStatus summarizes the monitor for "systemctl status"
+func systemdStatus(state *monitor.State) string {
+	connections := state.Connections()
+	up := 0
+	for _, c := range connections {
+		if c.Connected {
+			up++
+		}
+	}
+	stats := state.Stats(0)
+	return fmt.Sprintf("%d/%d connections up, %d messages, %.1f msg/s", up, len(connections), stats.Messages, stats.RatePerSecond)
+}
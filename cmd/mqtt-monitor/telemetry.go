@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	defaultTelemetryService  = "mqtt-monitor"
+	defaultTelemetryInterval = 15 * time.Second
+	telemetryScope           = "github.com/rawrobot/tui-mqtt-monitor"
+)
+
+// TelemetryConfig configures the OpenTelemetry export of the monitor's own metrics and traces
+type TelemetryConfig struct {
+	Enabled     bool   `toml:"enabled"`      // Export metrics over OTLP/HTTP
+	Endpoint    string `toml:"endpoint"`     // Collector base URL, e.g. "http://localhost:4318" (default: OTEL_EXPORTER_OTLP_ENDPOINT)
+	ServiceName string `toml:"service_name"` // service.name resource attribute (default: "mqtt-monitor")
+	Interval    string `toml:"interval"`     // Metric export interval (default: "15s")
+	// Traces emits a span for every message whose JSON payload has a top-level
+	// "traceparent" (and optionally "tracestate") field. MQTT 5 user properties
+	// are not read: the client speaks MQTT 3.1.1, which has none.
+	Traces bool `toml:"traces"`
+}
+
+// Telemetry records pipeline metrics and receipt spans. A nil *Telemetry records nothing.
+type Telemetry struct {
+	messages metric.Int64Counter
+	bytes    metric.Int64Counter
+	latency  metric.Float64Histogram
+
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	shutdown []func(context.Context) error
+}
+
+// traceCarrier holds the W3C trace context fields of a JSON payload, the only
+// place a message carries them for this client, see TelemetryConfig.Traces
+type traceCarrier struct {
+	Traceparent string `json:"traceparent"`
+	Tracestate  string `json:"tracestate"`
+}
+
+// validateTelemetryConfig checks the telemetry settings
+func validateTelemetryConfig(c TelemetryConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid telemetry endpoint %q: must be an http:// or https:// URL", c.Endpoint)
+		}
+	}
+	if c.Interval != "" {
+		if d, err := time.ParseDuration(c.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid telemetry interval %q", c.Interval)
+		}
+	}
+	return nil
+}
+
+// NewTelemetry sets up the OTLP exporters and registers the metric instruments.
+// Drop counts are read from state and its connections at each export.
+func NewTelemetry(ctx context.Context, config TelemetryConfig, state *monitor.State) (*Telemetry, error) {
+	interval := defaultTelemetryInterval
+	if d, err := time.ParseDuration(config.Interval); err == nil && d > 0 {
+		interval = d
+	}
+	service := config.ServiceName
+	if service == "" {
+		service = defaultTelemetryService
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", service)}
+	if host, err := os.Hostname(); err == nil {
+		attrs = append(attrs, attribute.String("host.name", host))
+	}
+	res := resource.NewSchemaless(attrs...)
+
+	metricOpts, err := otlpMetricOptions(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, metricOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(interval))),
+	)
+	t := &Telemetry{shutdown: []func(context.Context) error{provider.Shutdown}}
+
+	if err := t.registerMetrics(provider.Meter(telemetryScope), state); err != nil {
+		provider.Shutdown(ctx)
+		return nil, err
+	}
+
+	if config.Traces {
+		traceOpts, err := otlpTraceOptions(config.Endpoint)
+		if err != nil {
+			provider.Shutdown(ctx)
+			return nil, err
+		}
+		traceExporter, err := otlptracehttp.New(ctx, traceOpts...)
+		if err != nil {
+			provider.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+		}
+		tracerProvider := sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithBatcher(traceExporter),
+		)
+		t.tracer = tracerProvider.Tracer(telemetryScope)
+		t.propagator = propagation.TraceContext{}
+		t.shutdown = append(t.shutdown, tracerProvider.Shutdown)
+	}
+
+	return t, nil
+}
+
+// otlpMetricOptions points the metric exporter at the /v1/metrics path below endpoint
+func otlpMetricOptions(endpoint string) ([]otlpmetrichttp.Option, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telemetry endpoint: %w", err)
+	}
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(u.Host),
+		otlpmetrichttp.WithURLPath(path.Join("/", u.Path, "v1/metrics")),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	return opts, nil
+}
+
+// otlpTraceOptions points the trace exporter at the /v1/traces path below endpoint
+func otlpTraceOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telemetry endpoint: %w", err)
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path.Join("/", u.Path, "v1/traces")),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return opts, nil
+}
+
+func (t *Telemetry) registerMetrics(meter metric.Meter, state *monitor.State) error {
+	var err error
+	if t.messages, err = meter.Int64Counter("mqtt_monitor.messages",
+		metric.WithDescription("Messages processed by the monitor"),
+		metric.WithUnit("{message}")); err != nil {
+		return err
+	}
+	if t.bytes, err = meter.Int64Counter("mqtt_monitor.payload.size",
+		metric.WithDescription("Payload bytes processed by the monitor"),
+		metric.WithUnit("By")); err != nil {
+		return err
+	}
+	if t.latency, err = meter.Float64Histogram("mqtt_monitor.processing.duration",
+		metric.WithDescription("Time from message receipt until it is displayed and logged"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5)); err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("mqtt_monitor.dropped",
+		metric.WithDescription("Messages and events lost at each drop point of the pipeline"),
+		metric.WithUnit("{message}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			for _, status := range state.Connections() {
+				for name, count := range status.Drops {
+					o.Observe(int64(count), metric.WithAttributes(
+						attribute.String("stage", name),
+						attribute.String("source", status.Name)))
+				}
+			}
+			for name, count := range state.Drops() {
+				if !connectionDrop(name) {
+					o.Observe(int64(count), metric.WithAttributes(attribute.String("stage", name)))
+				}
+			}
+			return nil
+		}))
+	return err
+}
+
+// ObserveMessage records a message that has been fully processed. With traces enabled
+// it also emits a span from receipt to now, parented to the trace context in the payload.
+func (t *Telemetry) ObserveMessage(msg monitor.Message) {
+	if t == nil {
+		return
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	source := metric.WithAttributes(attribute.String("source", msg.Source))
+	t.messages.Add(ctx, 1, source)
+	t.bytes.Add(ctx, int64(len(msg.RawPayload)), source)
+	t.latency.Record(ctx, now.Sub(msg.Timestamp).Seconds(), source)
+
+	if t.tracer == nil {
+		return
+	}
+	parent, ok := t.extractTraceContext(msg.RawPayload)
+	if !ok {
+		return
+	}
+	_, span := t.tracer.Start(parent, "mqtt receive "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithTimestamp(msg.Timestamp),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "mqtt"),
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.String("messaging.operation.type", "receive"),
+			attribute.Int("messaging.message.body.size", len(msg.RawPayload)),
+			attribute.Int("mqtt.qos", int(msg.QoS)),
+			attribute.Bool("mqtt.retained", msg.Retained),
+			attribute.String("mqtt_monitor.source", msg.Source),
+		))
+	span.End(trace.WithTimestamp(now))
+}
+
+// extractTraceContext reads the traceparent and tracestate fields of a JSON object payload
+func (t *Telemetry) extractTraceContext(payload []byte) (context.Context, bool) {
+	if len(payload) == 0 || payload[0] != '{' {
+		return nil, false
+	}
+	var carrier traceCarrier
+	if err := json.Unmarshal(payload, &carrier); err != nil || carrier.Traceparent == "" {
+		return nil, false
+	}
+
+	ctx := t.propagator.Extract(context.Background(), propagation.MapCarrier{
+		"traceparent": carrier.Traceparent,
+		"tracestate":  carrier.Tracestate,
+	})
+	return ctx, trace.SpanContextFromContext(ctx).IsValid()
+}
+
+// Shutdown flushes pending metrics and spans
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	var errs []error
+	for _, fn := range t.shutdown {
+		errs = append(errs, fn(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// startTelemetry sets up OpenTelemetry export when [telemetry] is enabled.
+// The returned *Telemetry is nil otherwise; a setup failure is logged, not fatal.
+func startTelemetry(config *Config, state *monitor.State, ctx context.Context) *Telemetry {
+	if !config.Telemetry.Enabled {
+		return nil
+	}
+
+	logger := log.With().Str("component", "telemetry").Logger()
+	telemetry, err := NewTelemetry(ctx, config.Telemetry, state)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to start telemetry export")
+		return nil
+	}
+	logger.Info().Str("endpoint", config.Telemetry.Endpoint).Bool("traces", config.Telemetry.Traces).Msg("Exporting telemetry")
+	return telemetry
+}
+
+// stopTelemetry flushes the exporters with a bounded wait
+func stopTelemetry(telemetry *Telemetry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := telemetry.Shutdown(ctx); err != nil {
+		log.Warn().Str("component", "telemetry").Err(err).Msg("Failed to flush telemetry")
+	}
+}
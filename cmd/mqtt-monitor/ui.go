@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -11,6 +13,8 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
 )
 
 const (
@@ -37,7 +41,17 @@ const (
 	TimestampFormatWidth = 12 // "15:04:05.000" + space = 12 chars
 
 	// Performance settings
-	MaxDisplayedMessages = 1000 // maximum messages to keep in display
+	MaxDisplayedMessages = 1000                  // maximum messages to keep in display
+	MessageFlushInterval = 40 * time.Millisecond // new messages are drawn in batches, at most 25 times a second
+
+	// Retained message bursts, e.g. after subscribing to a broad wildcard
+	RetainedBurstMinimum       = 100                    // retained messages before the burst shows its progress
+	RetainedBurstQuiet         = 500 * time.Millisecond // a burst ends this long after its last retained message
+	RetainedBurstFlushInterval = 250 * time.Millisecond // messages are drawn in larger chunks during a burst
+
+	defaultMessagesTitle = " Messages "
+	defaultEventsTitle   = " Connection Status & Errors "
+	MaxStatusEvents      = 1000 // events kept in the errors view, to draw them again at another level
 
 	// Pool settings with size limits
 	InitialBuilderCapacity = 256  // Initial capacity for string builders
@@ -48,8 +62,7 @@ const (
 
 var (
 	// Pre-compiled regex for better performance
-	colorTagRegex   = regexp.MustCompile(`\[[^\]]*\]`)
-	multiSpaceRegex = regexp.MustCompile(`\s+`)
+	colorTagRegex = regexp.MustCompile(`\[[^\]]*\]`)
 
 	// Pool counters for monitoring
 	stringBuilderPoolCount int64
@@ -72,10 +85,8 @@ var (
 		New: func() interface{} {
 			atomic.AddInt64(&formatDataPoolCount, 1)
 			return &formatData{
-				timestamp:    make([]byte, 0, 16),
-				sourceColor:  make([]byte, 0, 16),
-				displayTopic: make([]byte, 0, 64),
-				payload:      make([]byte, 0, 256),
+				payload: make([]byte, 0, 256),
+				line:    make([]byte, 0, InitialBuilderCapacity),
 			}
 		},
 	}
@@ -98,63 +109,162 @@ func (psb *pooledStringBuilder) Reset() {
 
 // formatData holds reusable byte slices for formatting
 type formatData struct {
-	timestamp    []byte
-	sourceColor  []byte
-	displayTopic []byte
-	payload      []byte
+	payload []byte // Payload with whitespace collapsed, for truncation
+	line    []byte // The formatted message
 }
 
 func (fd *formatData) reset() {
-	fd.timestamp = fd.timestamp[:0]
-	fd.sourceColor = fd.sourceColor[:0]
-	fd.displayTopic = fd.displayTopic[:0]
 	fd.payload = fd.payload[:0]
+	fd.line = fd.line[:0]
 }
 
 // shouldReturnToPool checks if the formatData should be returned to pool
 func (fd *formatData) shouldReturnToPool() bool {
 	// Don't return to pool if any slice has grown too large
-	return cap(fd.timestamp) <= 32 &&
-		cap(fd.sourceColor) <= 32 &&
-		cap(fd.displayTopic) <= 128 &&
-		cap(fd.payload) <= 512
+	return cap(fd.payload) <= 1024 &&
+		cap(fd.line) <= 2*MaxBuilderCapacity
+}
+
+// layoutKey identifies the messages sharing a messageLayout. Layouts of an
+// earlier epoch are stale and never looked up again.
+type layoutKey struct {
+	epoch    uint64
+	source   string
+	topic    string
+	color    string
+	truncate bool
+}
+
+// messageLayout is the cached part of a formatted message between the timestamp
+// and the payload: the colored source and topic, and the room left for the payload
+type messageLayout struct {
+	prefix       string // From the color tag after the timestamp to the space before the payload
+	payloadWidth int    // Payload characters that fit the view when truncating
 }
 
 type UI struct {
 	app          *tview.Application
-	messagesView *tview.TextView
+	messagesView *tview.TextView // View of the shown tab, only changed on the UI goroutine
 	errorsView   *tview.TextView
 	statusView   *tview.TextView
 	flex         *tview.Flex
-	messages     []MonitorMessage // Store raw messages for reformatting
-	maxMessages  int
-	truncate     bool // Whether to truncate messages to fit terminal width
+	pages        *tview.Pages           // Root: main layout plus prompt/panel overlays
+	messagesMu   sync.Mutex             // Guards the tabs, and keeps their messages and unflushed in step
+	burst        retainedBurst          // Retained messages arriving at once, protected by messagesMu
+	epoch        uint64                 // Replay seek of the kept messages, older ones are dropped; protected by messagesMu
+	cleared      bool                   // The views are cleared with the next flush, protected by messagesMu
+	flushQueued  atomic.Bool            // A flush waits on the UI goroutine
+	flushWake    chan struct{}          // Wakes flushMessagesLoop when it is idle
+	queueDrops   atomic.Uint64          // Messages replaced in the ring before they were drawn
+	lastFlush    time.Time              // Only accessed by flushMessagesLoop
+	statusQueued atomic.Pointer[string] // Status line to draw with the next flush
+	overBudget   atomic.Bool            // The memory limit dropped messages since the last cleanup
+	truncate     atomic.Bool            // Whether to truncate messages to fit terminal width
+	prettyJSON   atomic.Bool            // Whether to indent JSON payloads, set on the UI goroutine once started
+	paused       atomic.Bool            // New messages are kept but not drawn, set on the UI goroutine
+	pausedNew    int                    // Messages of the shown tab received while paused, only accessed on the UI goroutine
+	search       messageSearch          // Only accessed on the UI goroutine
+	viewFilter   viewFilter             // Topics shown, only accessed on the UI goroutine
+
+	// Tabs of the messages view, the pages of tabPages. The All tab is always the
+	// first; the others are replaced by SetConnectionTabs under messagesMu.
+	all          *messageTab
+	tabs         []*messageTab
+	tabsBySource map[string]*messageTab
+	tab          *messageTab // Shown, only accessed on the UI goroutine
+	tabPages     *tview.Pages
+	tabBar       *tview.TextView
+	memoryLimit  int64                 // Of each tab, protected by messagesMu
+	spool        *monitor.PayloadSpool // Shared by the tabs, protected by messagesMu
+
+	// Job control: the process is stopped with Ctrl+Z or SIGTSTP from outside and
+	// nothing is drawn while suspended
+	suspended      atomic.Bool
+	suspendSignals chan os.Signal // SIGTSTP and SIGCONT
 
 	// Cache for performance
-	lastTerminalWidth int
-	formatCache       map[string]string // Cache formatted strings
-	cacheMutex        sync.RWMutex      // Protect cache access
+	lastTerminalWidth int                         // Screen width at the last draw, only accessed on the UI goroutine
+	layoutWidth       atomic.Int64                // Width of the messages view in the current layout epoch
+	layoutEpoch       atomic.Uint64               // Bumped on resize and theme changes to retire cached layouts
+	formatCache       map[layoutKey]messageLayout // Source and topic layouts, not whole messages
+	cacheMutex        sync.RWMutex                // Protect cache access
 
 	// Pool management
 	lastPoolCleanup time.Time
+
+	// Key actions registered by the caller
+	actions map[string]func()
+
+	// Selectable themes and keymaps, and the ones in use
+	stylesMu sync.Mutex
+	styles   DisplayConfig
+	theme    atomic.Pointer[Theme]
+	keymap   atomic.Pointer[Keymap]
+
+	// Events of the errors view, oldest first, only accessed on the UI goroutine
+	events     []statusEvent
+	eventLevel atomic.Int32 // Least monitor.Severity shown in the errors view
+	// Events not yet drawn, so they need a single queued update however many
+	// arrive while the UI goroutine is busy or suspended
+	eventsMu      sync.Mutex
+	pendingEvents []statusEvent
+
+	status        string      // Last status line, only accessed on the UI goroutine
+	messagesTitle string      // Title of the messages view without burst progress, only accessed on the UI goroutine
+	started       atomic.Bool // Start was called; UI updates are queued from then on
+}
+
+// statusEvent is an event of the errors view, kept to draw it again when the event
+// level or the theme changes
+type statusEvent struct {
+	time     time.Time
+	text     string
+	severity monitor.Severity
+}
+
+// retainedBurst counts the retained messages a broker sends at once, typically
+// all the retained messages matching a new subscription
+type retainedBurst struct {
+	count int       // Retained messages since the burst started, 0 without a burst
+	last  time.Time // Latest retained message
+}
+
+// add counts a retained message received at now, starting a burst when the
+// previous one is over
+func (b *retainedBurst) add(now time.Time) {
+	if b.count == 0 || b.over(now) {
+		b.count = 0
+	}
+	b.count++
+	b.last = now
+}
+
+// over reports whether a burst ended before now
+func (b *retainedBurst) over(now time.Time) bool {
+	return b.count > 0 && now.Sub(b.last) > RetainedBurstQuiet
+}
+
+// active reports whether the burst is still going on at now and large enough to
+// be drawn in chunks
+func (b *retainedBurst) active(now time.Time) bool {
+	return b.count >= RetainedBurstMinimum && !b.over(now)
 }
 
 func NewUI(truncate bool) *UI {
 	app := tview.NewApplication()
 
-	// Messages view (main area)
-	messagesView := tview.NewTextView().
-		SetDynamicColors(true).
-		SetScrollable(true).
-		SetMaxLines(MaxDisplayedMessages)
-	messagesView.SetBorder(true).SetTitle(" Messages ")
+	// Messages view (main area), one page per tab with the tab bar above
+	all := newMessageTab("")
+	tabPages := tview.NewPages().AddPage(all.page(), all.view, true, true)
+	tabBar := tview.NewTextView().
+		SetDynamicColors(true)
 
 	// Errors/Status view (bottom area)
 	errorsView := tview.NewTextView().
 		SetDynamicColors(true).
 		SetScrollable(true).
-		SetMaxLines(1000)
-	errorsView.SetBorder(true).SetTitle(" Connection Status & Errors ")
+		SetMaxLines(MaxStatusEvents)
+	errorsView.SetBorder(true).SetTitle(defaultEventsTitle)
 
 	// Status bar
 	statusView := tview.NewTextView().
@@ -163,66 +273,214 @@ func NewUI(truncate bool) *UI {
 
 	// Layout
 	flex := tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(messagesView, 0, 3, true).
+		AddItem(tabBar, 0, 0, false). // Shown by SetConnectionTabs
+		AddItem(tabPages, 0, 3, true).
 		AddItem(errorsView, 0, 1, false).
 		AddItem(statusView, 3, 0, false)
 
-	return &UI{
+	pages := tview.NewPages().AddPage(pageMain, flex, true, true)
+
+	ui := &UI{
 		app:             app,
-		messagesView:    messagesView,
+		messagesView:    all.view,
 		errorsView:      errorsView,
 		statusView:      statusView,
 		flex:            flex,
-		messages:        make([]MonitorMessage, 0, MaxDisplayedMessages),
-		maxMessages:     MaxDisplayedMessages,
-		truncate:        truncate,
-		formatCache:     make(map[string]string, MaxCacheSize),
+		pages:           pages,
+		all:             all,
+		tabs:            []*messageTab{all},
+		tab:             all,
+		tabPages:        tabPages,
+		tabBar:          tabBar,
+		formatCache:     make(map[layoutKey]messageLayout, MaxCacheSize),
 		lastPoolCleanup: time.Now(),
+		actions:         make(map[string]func()),
+		messagesTitle:   defaultMessagesTitle,
+		flushWake:       make(chan struct{}, 1),
+		suspendSignals:  make(chan os.Signal, 1),
+	}
+	ui.truncate.Store(truncate)
+	ui.layoutWidth.Store(int64(ui.getTerminalWidth()))
+	ui.theme.Store(defaultTheme())
+	ui.keymap.Store(defaultKeymap())
+	return ui
+}
+
+// SetTruncate switches truncation of messages to the terminal width and redraws them
+func (ui *UI) SetTruncate(truncate bool) {
+	if ui.truncate.Swap(truncate) != truncate {
+		ui.refreshAllMessages()
+	}
+}
+
+// SetPrettyJSON switches indenting JSON payloads over several lines in the
+// messages view and redraws them. Must not be called on the UI goroutine.
+func (ui *UI) SetPrettyJSON(pretty bool) {
+	if ui.prettyJSON.Swap(pretty) != pretty && ui.started.Load() {
+		ui.refreshAllMessages()
+	}
+}
+
+// BindAction registers the function run by the keys of an action of keyActions,
+// e.g. "rotate_log"; must be called before Start. Actions run on their own
+// goroutine, not on the UI event loop.
+func (ui *UI) BindAction(action string, fn func()) {
+	ui.actions[action] = fn
+}
+
+// SetMessagesTitle replaces the title of the messages view
+func (ui *UI) SetMessagesTitle(title string) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.messagesTitle = title
+		ui.drawMessagesTitle(0)
+	})
+}
+
+// drawMessagesTitle sets the title of the messages view, with the number of
+// messages received while paused, or else of the retained messages received so
+// far during a burst, and the search. Must be called on the UI goroutine.
+func (ui *UI) drawMessagesTitle(burst int) {
+	title := ui.messagesTitle
+	switch {
+	case ui.paused.Load():
+		title = fmt.Sprintf("%s- paused, %d new ", title, ui.pausedNew)
+	case burst > 0:
+		title = fmt.Sprintf("%s- loading retained messages: %d ", title, burst)
+	}
+	ui.messagesView.SetTitle(title + ui.searchTitle())
+}
+
+// togglePause stops drawing new messages, so the view can be read and scrolled
+// on a busy broker, or draws the messages received since and follows the feed
+// again, ending a search. Messages are kept while paused, up to
+// MaxDisplayedMessages. Must be called on the UI goroutine.
+func (ui *UI) togglePause() {
+	if !ui.paused.Load() {
+		ui.messagesMu.Lock()
+		ui.pausedNew = ui.tab.unflushed
+		ui.messagesMu.Unlock()
+		ui.paused.Store(true)
+		ui.drawMessagesTitle(0)
+		return
+	}
+
+	if ui.search.query != "" {
+		// The matches are those of the paused view
+		ui.search.paused = true
+		ui.endSearch()
+		return
 	}
+	ui.paused.Store(false)
+	ui.drawMessagesTitle(0)
+	ui.catchUp()
+}
+
+// catchUp draws the messages received while paused or suspended: with the next
+// flush, or right away all kept messages when more arrived than are kept, as
+// none of those shown is left to append to. Must be called on the UI goroutine.
+func (ui *UI) catchUp() {
+	ui.messagesMu.Lock()
+	replaced := slices.ContainsFunc(ui.tabs, func(tab *messageTab) bool {
+		return tab.unflushed >= tab.messages.Len()
+	})
+	ui.messagesMu.Unlock()
+	if replaced && !ui.paused.Load() {
+		ui.drawAllMessages()
+	}
+	ui.wakeFlush()
 }
 
 func (ui *UI) Start(ctx context.Context) error {
-	ui.app.SetRoot(ui.flex, true)
+	ui.app.SetRoot(ui.pages, true)
+	ui.started.Store(true)
+	ui.theme.Load().applyTo(ui.themedViews()...)
 
 	// Key bindings
 	ui.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Prompts and panels handle their own keys; only Ctrl+C and Ctrl+Z stay global
 		switch event.Key() {
 		case tcell.KeyCtrlC:
 			ui.app.Stop()
 			return nil
-		case tcell.KeyEscape:
-			ui.app.Stop()
+		case tcell.KeyCtrlZ:
+			ui.suspend()
 			return nil
-		case tcell.KeyTab:
-			if ui.app.GetFocus() == ui.messagesView {
-				ui.app.SetFocus(ui.errorsView)
-			} else {
-				ui.app.SetFocus(ui.messagesView)
+		}
+		if ui.overlayActive() {
+			return event
+		}
+
+		action, ok := ui.keymap.Load().Action(event)
+		if !ok {
+			return event
+		}
+
+		switch action {
+		case "quit":
+			ui.app.Stop()
+		case "switch_view":
+			ui.switchView()
+		case "next_tab":
+			ui.cycleTab()
+		case "select_tab":
+			ui.selectTab(ui.keymap.Load().KeyIndex(action, event))
+		case "redraw":
+			ui.drawAllMessages()
+		case "next_theme":
+			go ui.cycleTheme()
+		case "next_keymap":
+			go ui.cycleKeymap()
+		case "event_level":
+			ui.cycleEventLevel()
+		case "pause":
+			ui.togglePause()
+		case "search":
+			go ui.promptSearch(ui.search.query)
+		case "search_next":
+			ui.stepMatch(-1)
+		case "search_previous":
+			ui.stepMatch(1)
+		case "filter":
+			go ui.promptFilter(ui.viewFilter.text)
+		case "pretty_json":
+			ui.prettyJSON.Store(!ui.prettyJSON.Load())
+			ui.drawAllMessages()
+		case "detail":
+			ui.showDetail()
+		default:
+			fn, ok := ui.actions[action]
+			if !ok {
+				return event // Not available here, e.g. replay keys while monitoring
 			}
-			return nil
-		case tcell.KeyCtrlL:
-			ui.refreshAllMessages()
-			return nil
+			// Run outside the event loop so actions may queue UI updates
+			go fn()
 		}
-		return event
+		return nil
 	})
 
-	// Handle resize events and periodic cleanup
+	// Periodic cleanup, only while something is drawn
 	ui.app.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
-		currentWidth := ui.getTerminalWidth()
-		if currentWidth != ui.lastTerminalWidth {
-			ui.lastTerminalWidth = currentWidth
-			ui.clearFormatCache()
+		// Periodic pool cleanup (every 30 seconds), every second while the memory
+		// limit drops messages, then also releasing the format cache
+		interval := 30 * time.Second
+		if ui.overBudget.Load() {
+			interval = time.Second
 		}
-
-		// Periodic pool cleanup (every 30 seconds)
-		if time.Since(ui.lastPoolCleanup) > 30*time.Second {
+		if time.Since(ui.lastPoolCleanup) > interval {
+			if ui.overBudget.Swap(false) {
+				ui.releaseFormatCache()
+			}
 			ui.cleanupPools()
 			ui.lastPoolCleanup = time.Now()
 		}
 
 		return false
 	})
+	// Handle resize events once the views have their new size
+	ui.app.SetAfterDrawFunc(ui.checkLayoutWidth)
+
+	go ui.flushMessagesLoop(ctx)
+	ui.handleSuspendSignals(ctx)
 
 	// Monitor context for cancellation
 	go func() {
@@ -235,6 +493,16 @@ func (ui *UI) Start(ctx context.Context) error {
 	return ui.app.Run()
 }
 
+// switchView moves the focus between the messages view and the errors view. Must
+// be called on the UI goroutine.
+func (ui *UI) switchView() {
+	if ui.app.GetFocus() == ui.messagesView {
+		ui.app.SetFocus(ui.errorsView)
+	} else {
+		ui.app.SetFocus(ui.messagesView)
+	}
+}
+
 func (ui *UI) Stop() {
 	go func() {
 		time.Sleep(10 * time.Millisecond)
@@ -242,77 +510,424 @@ func (ui *UI) Stop() {
 	}()
 }
 
-func (ui *UI) AddMessage(msg MonitorMessage) {
-	if ui.messagesView == nil {
+func (ui *UI) AddMessage(msg monitor.Message) {
+	if ui.all == nil {
 		return
 	}
 
-	// Store the raw message
-	ui.messages = append(ui.messages, msg)
+	// Store the raw message in the All tab and the tab of its connection, replacing
+	// the oldest once MaxDisplayedMessages are kept. It is drawn with the next batch
+	// by flushMessagesLoop. A message of a later replay seek than the kept ones
+	// replaces them, one of an earlier seek is stale and dropped.
+	ui.messagesMu.Lock()
+	if msg.Epoch < ui.epoch {
+		ui.messagesMu.Unlock()
+		return
+	}
+	if msg.Epoch > ui.epoch {
+		ui.clearMessagesLocked(msg.Epoch)
+	}
+	for _, tab := range []*messageTab{ui.all, ui.tabsBySource[msg.Source]} {
+		if tab == nil {
+			continue
+		}
+		if tab.messages.Add(msg) > 0 {
+			ui.overBudget.Store(true)
+		}
+		tab.unflushed++
+	}
+	if msg.Retained {
+		ui.burst.add(time.Now())
+	}
+	ui.messagesMu.Unlock()
+	ui.wakeFlush()
+}
 
-	// Keep only the last maxMessages
-	if len(ui.messages) > ui.maxMessages {
-		copy(ui.messages, ui.messages[1:])
-		ui.messages = ui.messages[:ui.maxMessages]
+// SetMemoryLimit caps the total size of the messages kept by each tab in bytes, 0
+// for no limit besides MaxDisplayedMessages. Lowering it redraws the messages that
+// are left.
+func (ui *UI) SetMemoryLimit(limit int64) {
+	ui.messagesMu.Lock()
+	ui.memoryLimit = limit
+	trimmed := 0
+	for _, tab := range ui.tabs {
+		trimmed += tab.messages.SetMaxBytes(limit)
+	}
+	ui.messagesMu.Unlock()
+	if trimmed > 0 {
+		ui.overBudget.Store(true)
+		ui.refreshAllMessages()
 	}
+}
 
-	// Add formatted message to display
-	formattedMessage := ui.formatMessageForDisplay(msg)
-	ui.app.QueueUpdateDraw(func() {
-		fmt.Fprintf(ui.messagesView, "%s\n", formattedMessage)
-		ui.messagesView.ScrollToEnd()
-	})
+// Dropped returns how many messages were replaced by newer ones before they were
+// drawn, because more arrived between two frames than MaxDisplayedMessages
+func (ui *UI) Dropped() uint64 {
+	return ui.queueDrops.Load()
 }
 
-func (ui *UI) AddError(err error) {
-	timestamp := time.Now().Format("15:04:05.000")
+// SetPayloadSpool makes the kept messages hold only a preview of large payloads,
+// with the full payload in spool
+func (ui *UI) SetPayloadSpool(spool *monitor.PayloadSpool) {
+	ui.messagesMu.Lock()
+	defer ui.messagesMu.Unlock()
+	ui.spool = spool
+	for _, tab := range ui.tabs {
+		tab.messages.SetSpool(spool)
+	}
+}
+
+// flushMessagesLoop writes the messages added since the last flush to the view
+// every MessageFlushInterval, so a burst costs one redraw per frame rather than
+// one per message. During a burst of retained messages they are written in
+// chunks every RetainedBurstFlushInterval, with the progress in the title.
+// While nothing arrives the loop sleeps until AddMessage or UpdateStatus wakes
+// it, so an idle monitor does not wake up 25 times a second.
+func (ui *UI) flushMessagesLoop(ctx context.Context) {
+	ticker := time.NewTicker(MessageFlushInterval)
+	defer ticker.Stop()
+	idle := false
+
+	for {
+		if idle {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ui.flushWake:
+			}
+			ticker.Reset(MessageFlushInterval)
+			idle = false
+		}
 
-	errMsg := err.Error()
-	var color string
-	if strings.Contains(errMsg, "connected") || strings.Contains(errMsg, "subscribed") {
-		color = "green"
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if ui.suspended.Load() {
+				// Woken by new messages; they are drawn on resume
+				ticker.Stop()
+				idle = true
+				continue
+			}
+			ui.messagesMu.Lock()
+			pending := ui.all.unflushed > 0 && !ui.paused.Load() || ui.cleared // Every message is in the All tab
+			bursting, burstOver, inBurst := ui.burst.active(now), ui.burst.over(now), ui.burst.count > 0
+			ui.messagesMu.Unlock()
+
+			if !pending && !burstOver && ui.statusQueued.Load() == nil {
+				// Keep ticking until a burst is over, to remove its progress
+				if !inBurst {
+					ticker.Stop()
+					idle = true
+				}
+				continue
+			}
+			if bursting && now.Sub(ui.lastFlush) < RetainedBurstFlushInterval {
+				continue
+			}
+			// Skip the frame while the previous flush still waits for the UI goroutine
+			if !ui.flushQueued.CompareAndSwap(false, true) {
+				continue
+			}
+			ui.lastFlush = now
+			ui.app.QueueUpdateDraw(ui.flushMessages)
+		}
+	}
+}
+
+// flushMessages writes the unflushed messages matching the topic filter to the
+// views of the tabs, and the burst progress and the last status, or only the
+// number of new messages and the status while paused. Must be called on the UI
+// goroutine. Messages evicted before they were drawn are skipped, and the views
+// are cleared first after ResetMessages.
+func (ui *UI) flushMessages() {
+	ui.flushQueued.Store(false)
+	paused := ui.paused.Load()
+	var (
+		tabs    []*messageTab
+		batches [][]monitor.Message // By tab
+	)
+	ui.messagesMu.Lock()
+	if ui.cleared {
+		for _, tab := range ui.tabs {
+			tab.view.Clear()
+		}
+		ui.cleared = false
+	}
+	if paused {
+		ui.pausedNew = ui.tab.unflushed
 	} else {
-		color = "red"
+		tabs = ui.tabs
+		batches = make([][]monitor.Message, len(tabs))
+		for i, tab := range tabs {
+			batches[i] = tab.messages.Last(tab.unflushed)
+			if tab == ui.all && tab.unflushed > len(batches[i]) {
+				ui.queueDrops.Add(uint64(tab.unflushed - len(batches[i])))
+			}
+			tab.unflushed = 0
+		}
+	}
+	now := time.Now()
+	burst := ui.burst
+	if burst.over(now) {
+		ui.burst = retainedBurst{}
 	}
+	ui.messagesMu.Unlock()
 
-	// Use string builder pool for error formatting
-	pooledBuilder := stringBuilderPool.Get().(*pooledStringBuilder)
-	defer func() {
-		pooledBuilder.Reset()
-		// Only return to pool if capacity is reasonable
-		if pooledBuilder.Builder.Cap() <= pooledBuilder.maxCap {
-			stringBuilderPool.Put(pooledBuilder)
-		} else {
-			atomic.AddInt64(&stringBuilderPoolCount, -1)
+	if status := ui.statusQueued.Swap(nil); status != nil {
+		ui.status = *status
+		ui.drawStatus()
+	}
+	if paused {
+		ui.drawMessagesTitle(0)
+	} else if burst.active(now) {
+		ui.drawMessagesTitle(burst.count)
+	} else if burst.count >= RetainedBurstMinimum {
+		ui.drawMessagesTitle(0) // The burst is over
+	}
+	for i, tab := range tabs {
+		ui.appendMessages(tab.view, ui.viewFilter.apply(batches[i]))
+	}
+}
+
+// appendMessages writes batch to the end of view and follows it. Must be called
+// on the UI goroutine.
+func (ui *UI) appendMessages(view *tview.TextView, batch []monitor.Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(batch) * 100)
+	for _, msg := range batch {
+		builder.WriteString(ui.formatMessageForDisplay(msg))
+		builder.WriteByte('\n')
+	}
+	fmt.Fprint(view, builder.String())
+	view.ScrollToEnd()
+}
+
+// ResetMessages drops all stored messages for replay seek epoch and clears the
+// views of the tabs with the next flush. Messages of earlier seeks still queued
+// are dropped when they arrive; a reset for an earlier seek is ignored.
+func (ui *UI) ResetMessages(epoch uint64) {
+	ui.messagesMu.Lock()
+	if epoch <= ui.epoch {
+		ui.messagesMu.Unlock()
+		return
+	}
+	ui.clearMessagesLocked(epoch)
+	ui.messagesMu.Unlock()
+	ui.wakeFlush()
+}
+
+// clearMessagesLocked drops all stored messages and moves on to epoch; caller
+// must hold ui.messagesMu
+func (ui *UI) clearMessagesLocked(epoch uint64) {
+	for _, tab := range ui.tabs {
+		tab.messages.Clear()
+		tab.unflushed = 0
+	}
+	ui.epoch = epoch
+	ui.cleared = true
+}
+
+// AddConnectionEvent shows a connection event in the errors view
+func (ui *UI) AddConnectionEvent(event monitor.ConnectionEvent) {
+	ui.addEvent(statusEvent{time: event.Time, text: event.String(), severity: event.Severity()})
+}
+
+// AddError shows an error or status message in the errors view
+func (ui *UI) AddError(err error) {
+	ui.addEvent(statusEvent{time: time.Now(), text: err.Error(), severity: monitor.SeverityOf(err)})
+}
+
+// addEvent keeps an event and shows it in the color of its severity, unless it is
+// below the event level
+func (ui *UI) addEvent(event statusEvent) {
+	ui.eventsMu.Lock()
+	if len(ui.pendingEvents) == MaxStatusEvents {
+		ui.pendingEvents = ui.pendingEvents[1:]
+	}
+	ui.pendingEvents = append(ui.pendingEvents, event)
+	first := len(ui.pendingEvents) == 1
+	ui.eventsMu.Unlock()
+
+	if first {
+		ui.app.QueueUpdateDraw(ui.drawPendingEvents)
+	}
+}
+
+// drawPendingEvents moves the events added since the last call to the errors
+// view. Must be called on the UI goroutine.
+func (ui *UI) drawPendingEvents() {
+	ui.eventsMu.Lock()
+	pending := ui.pendingEvents
+	ui.pendingEvents = nil
+	ui.eventsMu.Unlock()
+
+	level := ui.EventLevel()
+	var text strings.Builder
+	for _, event := range pending {
+		if len(ui.events) == MaxStatusEvents {
+			ui.events = ui.events[1:]
 		}
-	}()
+		ui.events = append(ui.events, event)
+		if event.severity >= level {
+			text.WriteString(ui.formatEvent(event))
+		}
+	}
+	if text.Len() > 0 {
+		fmt.Fprint(ui.errorsView, text.String())
+		ui.errorsView.ScrollToEnd()
+	}
+}
+
+// formatEvent returns the line of an event in the errors view
+func (ui *UI) formatEvent(event statusEvent) string {
+	theme := ui.theme.Load()
+	color := theme.Error
+	switch event.severity {
+	case monitor.SeverityInfo:
+		color = theme.Status
+	case monitor.SeverityWarning:
+		color = theme.Warning
+	}
 
-	builder := pooledBuilder.Builder
-	builder.WriteString("[yellow]")
-	builder.WriteString(timestamp)
-	builder.WriteString("[white] [")
+	var builder strings.Builder
+	builder.WriteString("[")
+	builder.WriteString(theme.Timestamp)
+	builder.WriteString("]")
+	builder.WriteString(event.time.Format("15:04:05.000"))
+	builder.WriteString("[")
+	builder.WriteString(theme.Text)
+	builder.WriteString("] [")
 	builder.WriteString(color)
 	builder.WriteString("]")
-	builder.WriteString(errMsg)
-	builder.WriteString("[white]\n")
+	builder.WriteString(tview.Escape(event.text))
+	builder.WriteString("[")
+	builder.WriteString(theme.Text)
+	builder.WriteString("]\n")
+	return builder.String()
+}
 
-	formattedErr := builder.String()
+// EventLevel returns the least severity of the events shown in the errors view
+func (ui *UI) EventLevel() monitor.Severity {
+	return monitor.Severity(ui.eventLevel.Load())
+}
 
-	ui.app.QueueUpdateDraw(func() {
-		fmt.Fprint(ui.errorsView, formattedErr)
-		ui.errorsView.ScrollToEnd()
-	})
+// SetEventLevel hides the events below level in the errors view, including those
+// already shown
+func (ui *UI) SetEventLevel(level monitor.Severity) {
+	ui.eventLevel.Store(int32(level))
+	if !ui.started.Load() {
+		ui.errorsView.SetTitle(eventsTitle(level))
+		return
+	}
+	ui.app.QueueUpdateDraw(ui.drawEvents)
 }
 
+// cycleEventLevel switches to the next event level, from info to error and back.
+// Must be called on the UI goroutine.
+func (ui *UI) cycleEventLevel() {
+	ui.eventLevel.Store(int32((ui.EventLevel() + 1) % (monitor.SeverityError + 1)))
+	ui.drawEvents()
+}
+
+// drawEvents writes the kept events at or above the event level to the errors
+// view. Must be called on the UI goroutine.
+func (ui *UI) drawEvents() {
+	level := ui.EventLevel()
+	var text strings.Builder
+	for _, event := range ui.events {
+		if event.severity >= level {
+			text.WriteString(ui.formatEvent(event))
+		}
+	}
+	ui.errorsView.SetText(text.String()).ScrollToEnd()
+	ui.errorsView.SetTitle(eventsTitle(level))
+}
+
+// eventsTitle returns the title of the errors view at an event level
+func eventsTitle(level monitor.Severity) string {
+	switch level {
+	case monitor.SeverityWarning:
+		return " Connection Status & Errors (warnings and errors) "
+	case monitor.SeverityError:
+		return " Connection Status & Errors (errors only) "
+	}
+	return defaultEventsTitle
+}
+
+// UpdateStatus sets the status line; it is drawn with the next batch of
+// messages, so updating it for every message costs no extra redraws
 func (ui *UI) UpdateStatus(status string) {
-	ui.app.QueueUpdateDraw(func() {
-		ui.statusView.Clear()
-		// Add pool statistics to status for monitoring
-		poolStats := fmt.Sprintf(" | Pools: SB=%d FD=%d",
-			atomic.LoadInt64(&stringBuilderPoolCount),
-			atomic.LoadInt64(&formatDataPoolCount))
-		fmt.Fprintf(ui.statusView, " %s%s | Press Ctrl+C or Esc to quit | Tab to switch views", status, poolStats)
-	})
+	ui.statusQueued.Store(&status)
+	ui.wakeFlush()
+}
+
+// wakeFlush makes an idle flushMessagesLoop draw again
+func (ui *UI) wakeFlush() {
+	select {
+	case ui.flushWake <- struct{}{}:
+	default: // Already woken
+	}
+}
+
+// drawStatus writes the last status, the topic filter of the messages view and
+// the key help of the current keymap to the status bar. Must be called on the UI goroutine.
+func (ui *UI) drawStatus() {
+	if ui.status == "" {
+		return // Nothing to show before the first update
+	}
+	ui.statusView.Clear()
+	// Add pool statistics to status for monitoring
+	poolStats := fmt.Sprintf(" | Pools: SB=%d FD=%d",
+		atomic.LoadInt64(&stringBuilderPoolCount),
+		atomic.LoadInt64(&formatDataPoolCount))
+	filter := ""
+	if ui.viewFilter.text != "" {
+		filter = " | Filter: " + tview.Escape(ui.viewFilter.text)
+	}
+	fmt.Fprintf(ui.statusView, " %s%s%s | %s", ui.status, poolStats, filter, ui.keyHints())
+}
+
+// keyHints describes the keys of the available actions in the current keymap
+func (ui *UI) keyHints() string {
+	keymap := ui.keymap.Load()
+	quit := "Press Ctrl+C to quit"
+	if keys := keymap.Keys("quit"); keys != "" {
+		quit = "Press Ctrl+C or " + keys + " to quit"
+	}
+	hints := []string{quit}
+	if keys := keymap.Keys("switch_view"); keys != "" {
+		hints = append(hints, keys+" to switch views")
+	}
+	for _, action := range keyActions {
+		keys := keymap.Keys(action.name)
+		if keys != "" && action.hint != "" && ui.actionAvailable(action.name) {
+			hints = append(hints, keys+" "+action.hint)
+		}
+	}
+	return strings.Join(hints, " | ")
+}
+
+// actionAvailable reports whether the keys of action do something in this UI
+func (ui *UI) actionAvailable(action string) bool {
+	ui.stylesMu.Lock()
+	defer ui.stylesMu.Unlock()
+	switch action {
+	case "next_theme":
+		return len(ui.styles.ThemeNames()) > 1
+	case "next_keymap":
+		return len(ui.styles.KeymapNames()) > 1
+	case "event_level", "pause", "search", "filter", "pretty_json", "detail":
+		return true
+	case "next_tab", "select_tab":
+		return len(ui.tabList()) > 1
+	}
+	_, ok := ui.actions[action]
+	return ok
 }
 
 func (ui *UI) getTerminalWidth() int {
@@ -338,60 +953,93 @@ func (ui *UI) getTerminalWidth() int {
 	return 120
 }
 
-func (ui *UI) formatMessageForDisplay(msg MonitorMessage) string {
-	// Create cache key for this message format
-	terminalWidth := ui.getTerminalWidth()
-
-	// Use string builder pool for cache key creation
-	keyBuilder := stringBuilderPool.Get().(*pooledStringBuilder)
+// formatMessageForDisplay formats msg into a pooled buffer, so the only
+// allocation per message is the returned line once the layout of its source and
+// topic is cached
+func (ui *UI) formatMessageForDisplay(msg monitor.Message) string {
+	truncate := ui.truncate.Load()
+	// The epoch is read first: a theme or width newer than it only ends up in
+	// layouts that are already stale
+	epoch := ui.layoutEpoch.Load()
+	theme := ui.theme.Load()
+	layout := ui.messageLayout(msg, epoch, theme, truncate)
+
+	fd := formatDataPool.Get().(*formatData)
 	defer func() {
-		keyBuilder.Reset()
 		// Only return to pool if capacity is reasonable
-		if keyBuilder.Builder.Cap() <= keyBuilder.maxCap {
-			stringBuilderPool.Put(keyBuilder)
+		if fd.shouldReturnToPool() {
+			fd.reset()
+			formatDataPool.Put(fd)
 		} else {
-			atomic.AddInt64(&stringBuilderPoolCount, -1)
+			atomic.AddInt64(&formatDataPoolCount, -1)
 		}
 	}()
 
-	keyBuilder.Builder.WriteString(msg.Source)
-	keyBuilder.Builder.WriteByte('|')
-	keyBuilder.Builder.WriteString(msg.DisplayTopic)
-	keyBuilder.Builder.WriteByte('|')
-	keyBuilder.Builder.WriteString(msg.Payload)
-	keyBuilder.Builder.WriteByte('|')
-	if ui.truncate {
-		keyBuilder.Builder.WriteString("t")
-	} else {
-		keyBuilder.Builder.WriteString("f")
+	fd.line = append(fd.line, '[')
+	fd.line = append(fd.line, theme.Timestamp...)
+	fd.line = append(fd.line, ']')
+	fd.line = msg.Timestamp.AppendFormat(fd.line, "15:04:05.000")
+	fd.line = append(fd.line, layout.prefix...)
+
+	// An indented JSON payload starts on the line of the topic
+	if ui.prettyJSON.Load() && len(msg.RawPayload) <= MaxInlineJSONSize {
+		var ok bool
+		if fd.line, ok = appendPrettyJSON(fd.line, msg.RawPayload, jsonIndent, theme); ok {
+			return string(fd.line)
+		}
+	}
+
+	// If truncation is disabled, the payload is written as is
+	if !truncate {
+		fd.line = append(fd.line, msg.Payload...)
+		return string(fd.line)
 	}
-	keyBuilder.Builder.WriteByte('|')
-	keyBuilder.Builder.WriteString(fmt.Sprintf("%d", terminalWidth))
 
-	cacheKey := keyBuilder.Builder.String()
+	fd.payload = appendCleanPayload(fd.payload, msg.Payload)
+	fd.line = appendTruncated(fd.line, fd.payload, layout.payloadWidth)
+	return string(fd.line)
+}
+
+// messageLayout returns the layout of the source and topic of msg, from the cache
+// when another message of the epoch had the same ones
+func (ui *UI) messageLayout(msg monitor.Message, epoch uint64, theme *Theme, truncate bool) messageLayout {
+	key := layoutKey{epoch: epoch, source: msg.Source, topic: msg.DisplayTopic, color: msg.Color, truncate: truncate}
 
 	// Check cache first with read lock
 	ui.cacheMutex.RLock()
-	if cached, exists := ui.formatCache[cacheKey]; exists {
-		ui.cacheMutex.RUnlock()
-		return cached
-	}
+	layout, exists := ui.formatCache[key]
 	ui.cacheMutex.RUnlock()
+	if exists {
+		return layout
+	}
 
-	var result string
-
-	// If truncation is disabled, use a simple format without width calculations
-	if !ui.truncate {
-		result = ui.formatWithoutTruncation(msg)
-	} else {
-		result = ui.formatWithTruncation(msg)
+	displaySource, displayTopic := msg.Source, msg.DisplayTopic
+	if truncate {
+		displaySource = truncateTextIfNeeded(msg.Source, MaxSourceDisplayWidth, TruncatedSourceWidth)
+		displayTopic = truncateTextIfNeeded(msg.DisplayTopic, MaxTopicDisplayWidth, TruncatedTopicWidth)
 	}
+	prefix := fmt.Sprintf("[%s] [%s]%s[%s] [%s]%s[%s] ",
+		theme.Text, getSourceColor(msg.Color, theme.Source), displaySource, theme.Text,
+		theme.Topic, displayTopic, theme.Text)
+	maxWidth := int(ui.layoutWidth.Load())
+	if maxWidth < 50 {
+		maxWidth = 120
+	}
+	visiblePrefixLength := TimestampFormatWidth + getVisibleLengthOptimized(prefix)
+	layout = messageLayout{prefix: prefix, payloadWidth: max(maxWidth-visiblePrefixLength, MinimumPayloadWidth)}
 
 	// Cache the result with write lock
 	ui.cacheMutex.Lock()
-	// Check cache size and clean if necessary
+	// Check cache size and clean if necessary: stale epochs first, then half the
+	// cache (simple LRU approximation)
+	if len(ui.formatCache) >= MaxCacheSize {
+		for k := range ui.formatCache {
+			if k.epoch != epoch {
+				delete(ui.formatCache, k)
+			}
+		}
+	}
 	if len(ui.formatCache) >= MaxCacheSize {
-		// Clear half the cache (simple LRU approximation)
 		count := 0
 		for k := range ui.formatCache {
 			delete(ui.formatCache, k)
@@ -401,84 +1049,103 @@ func (ui *UI) formatMessageForDisplay(msg MonitorMessage) string {
 			}
 		}
 	}
-	ui.formatCache[cacheKey] = result
+	ui.formatCache[key] = layout
 	ui.cacheMutex.Unlock()
 
-	return result
+	return layout
 }
 
-func (ui *UI) formatWithoutTruncation(msg MonitorMessage) string {
-	timestamp := msg.Timestamp.Format("15:04:05.000")
-	sourceColor := getSourceColor(msg.Color)
+func (ui *UI) refreshAllMessages() {
+	if ui.all == nil {
+		return
+	}
 
-	return fmt.Sprintf("[yellow]%s[white] [%s]%s[white] [green]%s[white] %s",
-		timestamp, sourceColor, msg.Source, msg.DisplayTopic, msg.Payload)
+	ui.app.QueueUpdateDraw(ui.drawAllMessages)
 }
 
-func (ui *UI) formatWithTruncation(msg MonitorMessage) string {
-	maxWidth := ui.getTerminalWidth()
-	if maxWidth < 50 {
-		maxWidth = 120
+// drawAllMessages writes the stored messages to the views of the tabs again. Must
+// be called on the UI goroutine.
+func (ui *UI) drawAllMessages() {
+	for _, tab := range ui.tabList() {
+		ui.drawTab(tab)
 	}
+}
 
-	displaySource := truncateTextIfNeeded(msg.Source, MaxSourceDisplayWidth, TruncatedSourceWidth)
-	displayTopic := truncateTextIfNeeded(msg.DisplayTopic, MaxTopicDisplayWidth, TruncatedTopicWidth)
-	sourceColor := getSourceColor(msg.Color)
-
-	timestamp := msg.Timestamp.Format("15:04:05.000")
-	prefix := fmt.Sprintf("[yellow]%s[white] [%s]%s[white] [green]%s[white] ",
-		timestamp, sourceColor, displaySource, displayTopic)
-
-	visiblePrefixLength := getVisibleLengthOptimized(prefix)
-	availableForPayload := maxWidth - visiblePrefixLength
-
-	if availableForPayload < MinimumPayloadWidth {
-		availableForPayload = MinimumPayloadWidth
+// drawTab writes the stored messages of tab to its view again, leaving out those
+// received while paused and those the topic filter hides, and marks the matches
+// of the search in the shown tab. Must be called on the UI goroutine.
+func (ui *UI) drawTab(tab *messageTab) {
+	tab.view.Clear()
+	// Use strings.Builder for better performance when concatenating many strings
+	builder := stringBuilderPool.Get().(*pooledStringBuilder)
+	defer func() {
+		builder.Reset()
+		// Only return to pool if capacity is reasonable
+		if builder.Builder.Cap() <= builder.maxCap {
+			stringBuilderPool.Put(builder)
+		} else {
+			atomic.AddInt64(&stringBuilderPoolCount, -1)
+		}
+	}()
+	ui.messagesMu.Lock()
+	messages := tab.messages.Snapshot()
+	if ui.paused.Load() {
+		messages = messages[:len(messages)-min(tab.unflushed, len(messages))]
+	} else {
+		// Every stored message is written, so none is left for the next flush
+		tab.unflushed = 0
 	}
+	ui.messagesMu.Unlock()
+	messages = ui.viewFilter.apply(messages)
+	builder.Builder.Grow(len(messages) * 100) // Pre-allocate approximate space
 
-	cleanPayload := cleanPayloadTextOptimized(msg.Payload)
-	truncatedPayload := truncateText(cleanPayload, availableForPayload)
+	searching := ui.search.query != "" && tab == ui.tab
+	if searching {
+		ui.search.matches = ui.search.matches[:0]
+	}
+	for i, msg := range messages {
+		formattedMessage := ui.formatMessageForDisplay(msg)
+		if searching {
+			ui.appendSearchLine(builder.Builder, msg, formattedMessage, len(messages)-1-i)
+		} else {
+			builder.Builder.WriteString(formattedMessage)
+		}
+		builder.Builder.WriteByte('\n')
+	}
 
-	return prefix + truncatedPayload
+	fmt.Fprint(tab.view, builder.Builder.String())
+	if searching {
+		ui.showMatch()
+	} else if !ui.paused.Load() {
+		tab.view.ScrollToEnd()
+	}
 }
 
-func (ui *UI) refreshAllMessages() {
-	if ui.messagesView == nil {
+// checkLayoutWidth starts a new layout epoch when the screen, and with it the
+// messages view, changed width. Must be called on the UI goroutine after a draw,
+// once the view has its new size.
+func (ui *UI) checkLayoutWidth(screen tcell.Screen) {
+	screenWidth, _ := screen.Size()
+	if screenWidth == ui.lastTerminalWidth {
 		return
 	}
+	ui.lastTerminalWidth = screenWidth
+	if width := int64(ui.getTerminalWidth()); width != ui.layoutWidth.Load() {
+		ui.layoutWidth.Store(width)
+		ui.retireLayouts()
+	}
+}
 
-	ui.app.QueueUpdateDraw(func() {
-		ui.messagesView.Clear()
-		// Use strings.Builder for better performance when concatenating many strings
-		builder := stringBuilderPool.Get().(*pooledStringBuilder)
-		defer func() {
-			builder.Reset()
-			// Only return to pool if capacity is reasonable
-			if builder.Builder.Cap() <= builder.maxCap {
-				stringBuilderPool.Put(builder)
-			} else {
-				atomic.AddInt64(&stringBuilderPoolCount, -1)
-			}
-		}()
-		builder.Builder.Grow(len(ui.messages) * 100) // Pre-allocate approximate space
-
-		for _, msg := range ui.messages {
-			formattedMessage := ui.formatMessageForDisplay(msg)
-			builder.Builder.WriteString(formattedMessage)
-			builder.Builder.WriteByte('\n')
-		}
-
-		fmt.Fprint(ui.messagesView, builder.Builder.String())
-		ui.messagesView.ScrollToEnd()
-	})
+// retireLayouts makes the cached layouts stale, e.g. when the terminal width
+// changes, without touching the cache: they are evicted as new ones fill it
+func (ui *UI) retireLayouts() {
+	ui.layoutEpoch.Add(1)
 }
 
-func (ui *UI) clearFormatCache() {
-	// Clear the format cache when terminal width changes
+// releaseFormatCache drops every cached layout to free its memory
+func (ui *UI) releaseFormatCache() {
 	ui.cacheMutex.Lock()
-	for k := range ui.formatCache {
-		delete(ui.formatCache, k)
-	}
+	ui.formatCache = make(map[layoutKey]messageLayout, MaxCacheSize)
 	ui.cacheMutex.Unlock()
 }
 
@@ -514,11 +1181,11 @@ func (ui *UI) cleanupPools() {
 
 // Optimized helper functions
 
-func getSourceColor(color string) string {
+func getSourceColor(color, fallback string) string {
 	if color != "" {
 		return color
 	}
-	return "cyan"
+	return fallback
 }
 
 func truncateTextIfNeeded(text string, maxWidth, truncatedWidth int) string {
@@ -541,10 +1208,36 @@ func truncateText(text string, maxWidth int) string {
 	return text[:maxWidth-EllipsisLength] + "..."
 }
 
-func cleanPayloadTextOptimized(payload string) string {
-	// Remove characters that could break display formatting using regex
-	cleaned := multiSpaceRegex.ReplaceAllString(payload, " ")
-	return strings.TrimSpace(cleaned)
+// appendCleanPayload appends payload to dst with runs of whitespace collapsed
+// into one space and leading and trailing whitespace removed
+func appendCleanPayload(dst []byte, payload string) []byte {
+	start, space := len(dst), false
+	for i := 0; i < len(payload); i++ {
+		switch c := payload[i]; c {
+		case ' ', '\t', '\n', '\f', '\r':
+			space = true
+		default:
+			if space && len(dst) > start {
+				dst = append(dst, ' ')
+			}
+			space = false
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// appendTruncated appends text to dst, cut to maxWidth with "..." like truncateText
+func appendTruncated(dst, text []byte, maxWidth int) []byte {
+	switch {
+	case maxWidth <= 0:
+		return dst
+	case len(text) <= maxWidth:
+		return append(dst, text...)
+	case maxWidth <= EllipsisLength:
+		return append(dst, text[:maxWidth]...)
+	}
+	return append(append(dst, text[:maxWidth-EllipsisLength]...), "..."...)
 }
 
 func getVisibleLengthOptimized(text string) int {
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// showDetail shows the message of the current search match, or else the newest
+// message of the shown tab, in a panel with its full payload, a JSON payload
+// indented. Must be called on the UI goroutine.
+func (ui *UI) showDetail() {
+	msg, ok := ui.selectedMessage()
+	if !ok {
+		return
+	}
+	theme := ui.theme.Load()
+	go func() {
+		// Reading a spooled payload back must not hold up the UI goroutine
+		full, err := msg.Unspooled()
+		if err != nil {
+			ui.ShowPanel("Message", tview.Escape(fmt.Sprintf("payload not available: %v", err)))
+			return
+		}
+		ui.ShowPanel("Message", formatDetail(full, theme))
+	}()
+}
+
+// selectedMessage returns the message drawn as the current search match, or
+// else the newest message of the shown tab the topic filter lets through. Must be
+// called on the UI goroutine.
+func (ui *UI) selectedMessage() (monitor.Message, bool) {
+	ui.messagesMu.Lock()
+	messages := ui.tab.messages.Snapshot()
+	if ui.paused.Load() {
+		messages = messages[:len(messages)-min(ui.tab.unflushed, len(messages))]
+	}
+	ui.messagesMu.Unlock()
+	messages = ui.viewFilter.apply(messages)
+
+	age := max(ui.search.current, 0)
+	if age >= len(messages) {
+		return monitor.Message{}, false
+	}
+	return messages[len(messages)-1-age], true
+}
+
+// formatDetail describes a message for the detail panel: where and when it was
+// received, then its payload, indented and colored when it is a JSON object or
+// array, otherwise as text with its line breaks
+func formatDetail(msg monitor.Message, theme *Theme) string {
+	payload := msg.RawPayload
+	if payload == nil {
+		payload = []byte(msg.Payload) // Replayed from a text log
+	}
+
+	var b strings.Builder
+	flags := fmt.Sprintf("QoS %d", msg.QoS)
+	if msg.Retained {
+		flags += ", retained"
+	}
+	for _, field := range [][2]string{
+		{"Topic", msg.Topic},
+		{"Connection", msg.Source},
+		{"Time", msg.Timestamp.Format("2006-01-02 15:04:05.000 MST")},
+		{"Delivery", flags},
+		{"Size", fmt.Sprintf("%d bytes", len(payload))},
+	} {
+		fmt.Fprintf(&b, "[::b]%-11s[::-] %s\n", field[0], tview.Escape(field[1]))
+	}
+	b.WriteByte('\n')
+
+	if pretty, ok := appendPrettyJSON(nil, payload, "", theme); ok {
+		b.Write(pretty)
+	} else if utf8.Valid(payload) {
+		b.WriteString(tview.Escape(string(payload)))
+	} else {
+		b.WriteString(tview.Escape(msg.Payload))
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// viewFilter selects the messages the messages view shows by topic: an MQTT topic
+// filter when the text has a + or # wildcard, otherwise a part of the topic. The
+// zero value shows every message.
+type viewFilter struct {
+	text     string
+	wildcard bool
+}
+
+// parseViewFilter parses the text entered in the filter bar, "" for no filter
+func parseViewFilter(text string) (viewFilter, error) {
+	if !strings.ContainsAny(text, "+#") {
+		return viewFilter{text: text}, nil
+	}
+	if err := mqtt.ValidateTopicFilter(text); err != nil {
+		return viewFilter{}, err
+	}
+	return viewFilter{text: text, wildcard: true}, nil
+}
+
+// match reports whether the view shows messages on topic
+func (f viewFilter) match(topic string) bool {
+	switch {
+	case f.text == "":
+		return true
+	case f.wildcard:
+		return mqtt.TopicMatches(f.text, topic)
+	}
+	return strings.Contains(topic, f.text)
+}
+
+// apply removes the messages the view does not show from messages, which it may
+// reuse
+func (f viewFilter) apply(messages []monitor.Message) []monitor.Message {
+	if f.text == "" {
+		return messages
+	}
+	return slices.DeleteFunc(messages, func(msg monitor.Message) bool {
+		return !f.match(msg.Topic)
+	})
+}
+
+// promptFilter asks for the topic filter of the messages view, starting with
+// initial, the current one. Must not be called on the UI goroutine.
+func (ui *UI) promptFilter(initial string) {
+	ui.Prompt("Filter topics: ", initial, func(text string) {
+		filter, err := parseViewFilter(strings.TrimSpace(text))
+		if err != nil {
+			ui.ShowPanel("Filter", tview.Escape(err.Error()))
+			return
+		}
+		ui.app.QueueUpdateDraw(func() {
+			ui.setViewFilter(filter)
+		})
+	})
+}
+
+// setViewFilter shows only the stored and new messages matching filter, and the
+// filter in the status bar. Must be called on the UI goroutine.
+func (ui *UI) setViewFilter(filter viewFilter) {
+	if filter == ui.viewFilter {
+		return
+	}
+	ui.viewFilter = filter
+	ui.drawAllMessages()
+	ui.drawStatus()
+}
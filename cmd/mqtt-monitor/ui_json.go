@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/rivo/tview"
+)
+
+// MaxInlineJSONSize is the largest payload pretty_json indents in the messages
+// view; larger ones stay on one line, and the detail view shows them indented
+const MaxInlineJSONSize = 4096
+
+// jsonIndent is the indentation of a level of pretty-printed JSON
+const jsonIndent = "  "
+
+// isJSONDocument reports whether payload is a JSON object or array, the payloads
+// that read better indented
+func isJSONDocument(payload []byte) bool {
+	trimmed := bytes.TrimSpace(payload)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed)
+}
+
+// appendPrettyJSON appends a JSON object or array to dst indented, with tview
+// color tags of theme for keys, strings, numbers and true, false and null,
+// starting every line after the first with prefix. It appends nothing and
+// returns false when payload is not a JSON object or array.
+func appendPrettyJSON(dst, payload []byte, prefix string, theme *Theme) ([]byte, bool) {
+	if !isJSONDocument(payload) {
+		return dst, false
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, bytes.TrimSpace(payload), prefix, jsonIndent); err != nil {
+		return dst, false
+	}
+
+	colors := map[jsonTokenKind]string{
+		jsonKey: theme.JSONKey, jsonString: theme.JSONString,
+		jsonNumber: theme.JSONNumber, jsonLiteral: theme.JSONLiteral,
+	}
+	text := indented.Bytes()
+	for len(text) > 0 {
+		n, kind := nextJSONToken(text)
+		if kind == jsonPunctuation {
+			dst = append(dst, tview.Escape(string(text[:n]))...)
+		} else {
+			dst = append(dst, '[')
+			dst = append(dst, colors[kind]...)
+			dst = append(dst, ']')
+			dst = append(dst, tview.Escape(string(text[:n]))...)
+			dst = append(dst, "[-]"...)
+		}
+		text = text[n:]
+	}
+	return dst, true
+}
+
+// jsonTokenKind is what a token of pretty-printed JSON is drawn as
+type jsonTokenKind int
+
+const (
+	jsonPunctuation jsonTokenKind = iota // Brackets, commas, colons and whitespace
+	jsonKey
+	jsonString
+	jsonNumber
+	jsonLiteral // true, false or null
+)
+
+// nextJSONToken returns the length and kind of the token at the start of valid,
+// indented JSON text. Punctuation runs up to the next other token.
+func nextJSONToken(text []byte) (int, jsonTokenKind) {
+	switch c := text[0]; {
+	case c == '"':
+		end := len(text)
+		for i := 1; i < len(text); i++ {
+			if text[i] == '\\' {
+				i++
+			} else if text[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+		// Indent puts a key's colon right after it
+		if end < len(text) && text[end] == ':' {
+			return end, jsonKey
+		}
+		return end, jsonString
+	case c == '-' || (c >= '0' && c <= '9'):
+		return valueEnd(text), jsonNumber
+	case c == 't' || c == 'f' || c == 'n':
+		return valueEnd(text), jsonLiteral
+	}
+	if end := bytes.IndexFunc(text, func(r rune) bool {
+		return r == '"' || r == '-' || (r >= '0' && r <= '9') || r == 't' || r == 'f' || r == 'n'
+	}); end >= 0 {
+		return end, jsonPunctuation
+	}
+	return len(text), jsonPunctuation
+}
+
+// valueEnd returns the length of the number or literal at the start of text
+func valueEnd(text []byte) int {
+	if end := bytes.IndexAny(text, ",]}\n"); end >= 0 {
+		return end
+	}
+	return len(text)
+}
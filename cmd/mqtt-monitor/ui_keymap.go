@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// keyAction is an action keys can be bound to
+type keyAction struct {
+	name string
+	keys []string // Default keys
+	hint string   // Shown in the status bar while the action is available
+}
+
+// keyActions lists the actions in status bar order. quit, switch_view, redraw,
+// next_theme, next_keymap, event_level, pause, filter, detail, pretty_json, the
+// search and the tab actions are handled by the UI, the others run what is
+// registered with BindAction. The nth key of select_tab shows the nth tab.
+var keyActions = []keyAction{
+	{"quit", []string{"Esc"}, ""},
+	{"switch_view", []string{"Backtab"}, ""},
+	{"next_tab", []string{"Tab"}, "next tab"},
+	{"select_tab", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}, ""},
+	{"redraw", []string{"Ctrl-L"}, ""},
+	{"pause", []string{"P"}, "pause"},
+	{"search", []string{"/"}, "search"},
+	{"search_next", []string{"n"}, ""},
+	{"search_previous", []string{"N"}, ""},
+	{"filter", []string{"f"}, "filter"},
+	{"detail", []string{"Enter"}, "details"},
+	{"pretty_json", []string{"J"}, "json"},
+	{"rotate_log", []string{"R"}, "rotate log"},
+	{"history", []string{"H"}, "history"},
+	{"replay_pause", []string{"Space"}, "pause"},
+	{"replay_faster", []string{"+"}, "faster"},
+	{"replay_slower", []string{"-"}, "slower"},
+	{"replay_forward", []string{"]"}, "seek"},
+	{"replay_back", []string{"["}, "seek back"},
+	{"next_theme", []string{"T"}, "theme"},
+	{"next_keymap", []string{"K"}, "keymap"},
+	{"command", []string{":"}, "command"},
+	{"diagnostics", []string{"D"}, "diagnostics"},
+	{"coverage", []string{"C"}, "coverage"},
+	{"event_level", []string{"L"}, "event level"},
+}
+
+// keySpec is a key as reported by tcell: a rune for tcell.KeyRune, otherwise a
+// special key such as Esc or Ctrl-L
+type keySpec struct {
+	key  tcell.Key
+	rune rune
+}
+
+// keysByName maps the lower case tcell key names ("esc", "ctrl-l", "f1") to keys
+var keysByName = func() map[string]tcell.Key {
+	keys := make(map[string]tcell.Key, len(tcell.KeyNames)+1)
+	for key, name := range tcell.KeyNames {
+		keys[strings.ToLower(name)] = key
+	}
+	keys["escape"] = tcell.KeyEscape
+	return keys
+}()
+
+// parseKey parses a key: a single character, "Space", or a tcell key name such
+// as "Esc", "F1" or "Ctrl-L" (also "Ctrl+L"), ignoring case
+func parseKey(name string) (keySpec, error) {
+	if utf8.RuneCountInString(name) == 1 {
+		r, _ := utf8.DecodeRuneInString(name)
+		return keySpec{key: tcell.KeyRune, rune: r}, nil
+	}
+	normalized := strings.ToLower(strings.ReplaceAll(name, "+", "-"))
+	if normalized == "space" {
+		return keySpec{key: tcell.KeyRune, rune: ' '}, nil
+	}
+	key, ok := keysByName[normalized]
+	if !ok {
+		return keySpec{}, fmt.Errorf("unknown key %q", name)
+	}
+	if key == tcell.KeyCtrlC {
+		return keySpec{}, fmt.Errorf("key Ctrl-C always quits and cannot be bound")
+	}
+	if key == tcell.KeyCtrlZ {
+		return keySpec{}, fmt.Errorf("key Ctrl-Z always suspends and cannot be bound")
+	}
+	return keySpec{key: key}, nil
+}
+
+// String returns the name of the key as shown in the status bar
+func (k keySpec) String() string {
+	switch {
+	case k.key != tcell.KeyRune:
+		return tcell.KeyNames[k.key]
+	case k.rune == ' ':
+		return "Space"
+	default:
+		return string(k.rune)
+	}
+}
+
+// Keymap binds keys to the actions of keyActions
+type Keymap struct {
+	keys    map[string][]keySpec // By action
+	actions map[keySpec]string   // By key
+	name    string               // Name the keymap was selected by
+}
+
+// defaultKeymap returns the built-in keymap
+func defaultKeymap() *Keymap {
+	keymap := &Keymap{keys: make(map[string][]keySpec, len(keyActions)), name: defaultStyleName}
+	for _, action := range keyActions {
+		for _, name := range action.keys {
+			key, _ := parseKey(name)
+			keymap.keys[action.name] = append(keymap.keys[action.name], key)
+		}
+	}
+	keymap.index()
+	return keymap
+}
+
+// LoadKeymap reads a keymap file (TOML, YAML or JSON) mapping actions to a key or
+// a list of keys, e.g. history = "?" or quit = ["Esc", "q"]. Actions the file
+// leaves out keep their default keys, but those the file binds to another action;
+// an empty list unbinds an action.
+func LoadKeymap(path string) (*Keymap, error) {
+	var bindings map[string]any
+	if _, err := decodeConfigFile(path, &bindings); err != nil {
+		return nil, err
+	}
+
+	keymap := defaultKeymap()
+	for action, value := range bindings {
+		if !slices.ContainsFunc(keyActions, func(a keyAction) bool { return a.name == action }) {
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+
+		var names []string
+		switch v := value.(type) {
+		case string:
+			names = []string{v}
+		case []any:
+			for _, item := range v {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: keys must be strings", action)
+				}
+				names = append(names, name)
+			}
+		default:
+			return nil, fmt.Errorf("%s: expected a key or a list of keys", action)
+		}
+
+		keys := make([]keySpec, 0, len(names))
+		for _, name := range names {
+			key, err := parseKey(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", action, err)
+			}
+			keys = append(keys, key)
+		}
+		keymap.keys[action] = keys
+	}
+
+	// A key the file binds, e.g. Tab to switch_view as before tabs, is taken from
+	// the action it is a default key of
+	for _, action := range keyActions {
+		if _, ok := bindings[action.name]; ok {
+			continue
+		}
+		keymap.keys[action.name] = slices.DeleteFunc(keymap.keys[action.name], func(key keySpec) bool {
+			for bound := range bindings {
+				if bound != action.name && slices.Contains(keymap.keys[bound], key) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	if err := keymap.index(); err != nil {
+		return nil, err
+	}
+	return keymap, nil
+}
+
+// index builds the lookup by key, failing when a key is bound to two actions
+func (k *Keymap) index() error {
+	k.actions = make(map[keySpec]string, len(k.keys))
+	for _, action := range keyActions {
+		for _, key := range k.keys[action.name] {
+			if other, ok := k.actions[key]; ok && other != action.name {
+				return fmt.Errorf("key %s is bound to both %s and %s", key, other, action.name)
+			}
+			k.actions[key] = action.name
+		}
+	}
+	return nil
+}
+
+// Action returns the action bound to the key of event
+func (k *Keymap) Action(event *tcell.EventKey) (string, bool) {
+	action, ok := k.actions[eventKey(event)]
+	return action, ok
+}
+
+// KeyIndex returns the position of the key of event among the keys of action, or
+// -1 when it is not bound to action
+func (k *Keymap) KeyIndex(action string, event *tcell.EventKey) int {
+	return slices.Index(k.keys[action], eventKey(event))
+}
+
+// eventKey returns the key of event
+func eventKey(event *tcell.EventKey) keySpec {
+	key := keySpec{key: event.Key()}
+	if key.key == tcell.KeyRune {
+		key.rune = event.Rune()
+	}
+	return key
+}
+
+// Keys returns the keys bound to action for display, e.g. "Esc/q", or "" when
+// the action is unbound
+func (k *Keymap) Keys(action string) string {
+	names := make([]string, len(k.keys[action]))
+	for i, key := range k.keys[action] {
+		names[i] = key.String()
+	}
+	return strings.Join(names, "/")
+}
+
+// lookupKeymap returns the keymap called name: "default", a keymap of
+// display.keymaps or, for another name, the keymap file of that name
+func (d *DisplayConfig) lookupKeymap(name string) (*Keymap, error) {
+	if name == "" {
+		name = defaultStyleName
+	}
+	if keymap, ok := d.keymaps[name]; ok {
+		return keymap, nil
+	}
+	if name == defaultStyleName {
+		return defaultKeymap(), nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("unknown keymap %q (expected %s or a keymap file)", name, strings.Join(d.KeymapNames(), ", "))
+	}
+	keymap, err := LoadKeymap(name)
+	if err != nil {
+		return nil, fmt.Errorf("keymap %s: %w", name, err)
+	}
+	keymap.name = name
+	return keymap, nil
+}
+
+// KeymapNames returns the names of the built-in and the configured keymaps in order
+func (d *DisplayConfig) KeymapNames() []string {
+	return styleNames(d.keymaps)
+}
+
+// SetKeymap switches to the keymap called name: "default", a configured keymap
+// or a keymap file
+func (ui *UI) SetKeymap(name string) error {
+	ui.stylesMu.Lock()
+	keymap, err := ui.styles.lookupKeymap(name)
+	ui.stylesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ui.keymap.Store(keymap)
+	if ui.started.Load() {
+		ui.app.QueueUpdateDraw(func() {
+			ui.drawStatus()
+			ui.drawTabBar()
+		})
+	}
+	return nil
+}
+
+// KeymapName returns the name of the current keymap
+func (ui *UI) KeymapName() string {
+	return ui.keymap.Load().name
+}
+
+// KeymapNames returns the names of the selectable keymaps
+func (ui *UI) KeymapNames() []string {
+	ui.stylesMu.Lock()
+	defer ui.stylesMu.Unlock()
+	return ui.styles.KeymapNames()
+}
+
+// cycleKeymap switches to the keymap after the current one
+func (ui *UI) cycleKeymap() {
+	names := ui.KeymapNames()
+	next := names[(slices.Index(names, ui.KeymapName())+1)%len(names)]
+	if err := ui.SetKeymap(next); err != nil {
+		ui.AddError(fmt.Errorf("keymap %s: %w", next, err))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Overlay page names
+const (
+	pageMain   = "main"
+	pagePrompt = "prompt"
+	pagePanel  = "panel"
+)
+
+// overlayActive reports whether a prompt or panel currently owns the keyboard.
+// Must be called on the UI goroutine.
+func (ui *UI) overlayActive() bool {
+	name, _ := ui.pages.GetFrontPage()
+	return name != pageMain
+}
+
+// Prompt shows a single line input at the bottom of the screen. onSubmit is called on
+// its own goroutine with the entered text when Enter is pressed; Esc cancels.
+func (ui *UI) Prompt(label, initial string, onSubmit func(string)) {
+	ui.app.QueueUpdateDraw(func() {
+		input := tview.NewInputField().
+			SetLabel(label).
+			SetText(initial).
+			SetFieldBackgroundColor(tcell.ColorDefault)
+		input.SetBorder(true)
+
+		input.SetDoneFunc(func(key tcell.Key) {
+			ui.closeOverlay(pagePrompt)
+			if key == tcell.KeyEnter {
+				text := input.GetText()
+				go onSubmit(text)
+			}
+		})
+
+		layout := tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(input, 3, 0, true)
+
+		ui.pages.AddPage(pagePrompt, layout, true, true)
+		ui.app.SetFocus(input)
+	})
+}
+
+// ShowPanel displays text in a scrollable window over the main layout until
+// Esc, Enter or q is pressed
+func (ui *UI) ShowPanel(title, text string) {
+	ui.app.QueueUpdateDraw(func() {
+		view := tview.NewTextView().
+			SetDynamicColors(true).
+			SetScrollable(true).
+			SetText(text)
+		view.SetBorder(true).SetTitle(" " + title + " (Esc to close) ")
+
+		view.SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEscape || key == tcell.KeyEnter {
+				ui.closeOverlay(pagePanel)
+			}
+		})
+		view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Key() == tcell.KeyRune && event.Rune() == 'q' {
+				ui.closeOverlay(pagePanel)
+				return nil
+			}
+			return event
+		})
+
+		layout := tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+				AddItem(nil, 0, 1, false).
+				AddItem(view, 0, 8, true).
+				AddItem(nil, 0, 1, false), 0, 8, true).
+			AddItem(nil, 0, 1, false)
+
+		ui.pages.AddPage(pagePanel, layout, true, true)
+		ui.app.SetFocus(view)
+	})
+}
+
+// closeOverlay removes an overlay page and returns focus to the messages view.
+// Must be called on the UI goroutine.
+func (ui *UI) closeOverlay(name string) {
+	ui.pages.RemovePage(name)
+	if !ui.overlayActive() {
+		ui.app.SetFocus(ui.messagesView)
+	}
+}
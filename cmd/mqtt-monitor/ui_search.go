@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// regionTagRegex matches text tview takes for a region tag, e.g. the JSON array
+// ["on"], which has to be escaped while the messages view uses regions
+var regionTagRegex = regexp.MustCompile(`(\["[a-zA-Z0-9_,;: \-.]*")\]`)
+
+// messageSearch is the search in the messages view, only accessed on the UI
+// goroutine. Matching messages are regions named by their age, 0 being the newest
+// message drawn; as the view is paused while searching, the names stay the same
+// when the view is redrawn.
+type messageSearch struct {
+	query   string // As entered, "" without a search
+	lower   string // query in lower case
+	matches []int  // Regions of the matching messages, oldest first
+	current int    // Region of the highlighted match, -1 without matches
+	paused  bool   // The search paused the view, so ending it resumes the view
+}
+
+// match reports whether the topic, payload or source of msg contains the
+// query, ignoring case
+func (s *messageSearch) match(msg monitor.Message) bool {
+	return strings.Contains(strings.ToLower(msg.Topic), s.lower) ||
+		strings.Contains(strings.ToLower(msg.Payload), s.lower) ||
+		strings.Contains(strings.ToLower(msg.Source), s.lower)
+}
+
+// promptSearch asks for the text to search the messages view for, starting with
+// initial, the current search. Must not be called on the UI goroutine.
+func (ui *UI) promptSearch(initial string) {
+	ui.Prompt("/", initial, func(query string) {
+		ui.app.QueueUpdateDraw(func() {
+			ui.startSearch(query)
+		})
+	})
+}
+
+// startSearch pauses the view and marks the messages containing query, showing
+// the newest of them, or ends the search for an empty query. Must be called on
+// the UI goroutine.
+func (ui *UI) startSearch(query string) {
+	if query == "" {
+		if ui.search.query != "" {
+			ui.endSearch()
+		}
+		return
+	}
+
+	// The matches must not scroll away while stepping through them
+	pausedBySearch := ui.search.paused
+	if !ui.paused.Load() {
+		ui.togglePause()
+		pausedBySearch = true
+	}
+	ui.search = messageSearch{query: query, lower: strings.ToLower(query), current: -1, paused: pausedBySearch}
+	ui.messagesView.SetRegions(true)
+	ui.drawAllMessages()
+}
+
+// endSearch removes the marks of the search, and resumes the view when the search
+// paused it. Must be called on the UI goroutine.
+func (ui *UI) endSearch() {
+	if ui.search.paused {
+		ui.paused.Store(false)
+	}
+	ui.search = messageSearch{}
+	ui.messagesView.Highlight().SetRegions(false)
+	ui.drawAllMessages()
+	ui.drawMessagesTitle(0)
+}
+
+// appendSearchLine appends the line of a drawn message of the given age to b,
+// with the match background and as a region when it matches the search
+func (ui *UI) appendSearchLine(b *strings.Builder, msg monitor.Message, line string, age int) {
+	line = regionTagRegex.ReplaceAllString(line, "$1[]")
+	if !ui.search.match(msg) {
+		b.WriteString(line)
+		return
+	}
+	ui.search.matches = append(ui.search.matches, age)
+	fmt.Fprintf(b, `["%d"][:%s]%s[:-][""]`, age, ui.theme.Load().Match, line)
+}
+
+// showMatch highlights the current match and scrolls to it, keeping it when it is
+// still drawn, or else taking the newest match. Must be called on the UI goroutine
+// after the matches were drawn.
+func (ui *UI) showMatch() {
+	matches := ui.search.matches
+	if !slices.Contains(matches, ui.search.current) {
+		ui.search.current = -1
+		if len(matches) > 0 {
+			ui.search.current = matches[len(matches)-1]
+		}
+	}
+
+	if ui.search.current < 0 {
+		ui.messagesView.Highlight()
+	} else {
+		ui.messagesView.Highlight(strconv.Itoa(ui.search.current)).ScrollToHighlight()
+	}
+	ui.drawMessagesTitle(0)
+}
+
+// stepMatch highlights the match step matches newer than the current one, or
+// older for a negative step, wrapping around. Must be called on the UI goroutine.
+func (ui *UI) stepMatch(step int) {
+	matches := ui.search.matches
+	if len(matches) == 0 {
+		return
+	}
+	i := slices.Index(matches, ui.search.current)
+	ui.search.current = matches[((i+step)%len(matches)+len(matches))%len(matches)]
+	ui.showMatch()
+}
+
+// searchTitle describes the search for the title of the messages view, "" without
+// a search. Must be called on the UI goroutine.
+func (ui *UI) searchTitle() string {
+	switch {
+	case ui.search.query == "":
+		return ""
+	case len(ui.search.matches) == 0:
+		return fmt.Sprintf("- \"%s\" not found ", tview.Escape(ui.search.query))
+	}
+	return fmt.Sprintf("- search \"%s\": %d/%d ", tview.Escape(ui.search.query),
+		slices.Index(ui.search.matches, ui.search.current)+1, len(ui.search.matches))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+// Snapshot returns what the TUI shows, with the full payloads of spooled
+// messages. Must not be called on the UI goroutine.
+func (ui *UI) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Version:    snapshotVersion,
+		Saved:      time.Now(),
+		PrettyJSON: ui.prettyJSON.Load(),
+		EventLevel: ui.EventLevel().String(),
+		Theme:      ui.ThemeName(),
+		Keymap:     ui.KeymapName(),
+		Colors:     make(map[string]string),
+	}
+	done := make(chan struct{})
+	ui.app.QueueUpdate(func() {
+		defer close(done)
+		snapshot.Tab = ui.tab.name
+		snapshot.Paused = ui.paused.Load() && !ui.search.paused
+		snapshot.Filter = ui.viewFilter.text
+		snapshot.Search = ui.search.query
+		for _, event := range ui.events {
+			snapshot.Events = append(snapshot.Events, SnapshotEvent{Time: event.time, Text: event.text, Severity: event.severity.String()})
+		}
+	})
+	<-done
+
+	ui.messagesMu.Lock()
+	tabs := ui.tabs
+	messages := make([][]monitor.Message, len(tabs))
+	for i, tab := range tabs {
+		messages[i] = tab.messages.Snapshot()
+	}
+	ui.messagesMu.Unlock()
+
+	// Spooled payloads are read back outside the lock
+	for i, tab := range tabs {
+		records := make([]sessionlog.Record, 0, len(messages[i]))
+		for _, msg := range messages[i] {
+			records = append(records, sessionlogger.NewMessageRecord(msg))
+			snapshot.Colors[msg.Source] = msg.Color
+		}
+		snapshot.Tabs = append(snapshot.Tabs, SnapshotTab{Connection: tab.name, Messages: records})
+	}
+	return snapshot
+}
+
+// RestoreSnapshot brings back a snapshot: the messages of its tabs go before the
+// kept messages received after it was saved, as do its events, and its filter,
+// search and layout replace the current ones. A tab of a connection the snapshot
+// has no tab of gets its messages from the All tab of the snapshot. A theme,
+// keymap or filter that no longer works is skipped and returned in the error.
+// Must not be called on the UI goroutine.
+func (ui *UI) RestoreSnapshot(snapshot *Snapshot) error {
+	var errs []error
+	if snapshot.Theme != "" && snapshot.Theme != ui.ThemeName() {
+		if err := ui.SetTheme(snapshot.Theme); err != nil {
+			errs = append(errs, fmt.Errorf("theme %s: %w", snapshot.Theme, err))
+		}
+	}
+	if snapshot.Keymap != "" && snapshot.Keymap != ui.KeymapName() {
+		if err := ui.SetKeymap(snapshot.Keymap); err != nil {
+			errs = append(errs, fmt.Errorf("keymap %s: %w", snapshot.Keymap, err))
+		}
+	}
+	level, err := monitor.ParseSeverity(snapshot.EventLevel)
+	if err != nil {
+		level = ui.EventLevel()
+		errs = append(errs, err)
+	}
+	filter, err := parseViewFilter(snapshot.Filter)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("filter %s: %w", snapshot.Filter, err))
+	}
+
+	ui.restoreMessages(snapshot)
+
+	events := make([]statusEvent, 0, len(snapshot.Events))
+	for _, event := range snapshot.Events {
+		severity, err := monitor.ParseSeverity(event.Severity)
+		if err != nil {
+			severity = monitor.SeverityError
+		}
+		events = append(events, statusEvent{time: event.Time, text: event.Text, severity: severity})
+	}
+
+	apply := func() {
+		kept := slices.DeleteFunc(slices.Clone(ui.events), func(event statusEvent) bool {
+			return !event.time.After(snapshot.Saved)
+		})
+		ui.events = append(events, kept...)
+		ui.events = ui.events[max(len(ui.events)-MaxStatusEvents, 0):]
+		ui.eventLevel.Store(int32(level))
+		ui.drawEvents()
+
+		ui.prettyJSON.Store(snapshot.PrettyJSON)
+		if ui.search.query != "" {
+			ui.endSearch()
+		}
+		ui.viewFilter = filter
+		tabs := ui.tabList()
+		if i := slices.IndexFunc(tabs, func(tab *messageTab) bool { return tab.name == snapshot.Tab }); i >= 0 {
+			ui.showTab(tabs[i])
+		}
+		ui.paused.Store(snapshot.Paused)
+		ui.messagesMu.Lock()
+		ui.pausedNew = 0
+		ui.messagesMu.Unlock()
+		ui.drawAllMessages()
+		ui.startSearch(snapshot.Search)
+		ui.drawMessagesTitle(0)
+		ui.drawStatus()
+	}
+	if !ui.started.Load() {
+		apply()
+	} else {
+		ui.app.QueueUpdateDraw(apply)
+	}
+	return errors.Join(errs...)
+}
+
+// restoreMessages puts the messages of the tabs of snapshot before the messages
+// of the tabs received after it was saved
+func (ui *UI) restoreMessages(snapshot *Snapshot) {
+	bySource := make(map[string][]monitor.Message, len(snapshot.Tabs))
+	for _, tab := range snapshot.Tabs {
+		messages := make([]monitor.Message, 0, len(tab.Messages))
+		for _, record := range tab.Messages {
+			messages = append(messages, snapshotMessage(record, snapshot.Colors[record.Source]))
+		}
+		bySource[tab.Connection] = messages
+	}
+
+	ui.messagesMu.Lock()
+	defer ui.messagesMu.Unlock()
+	for _, tab := range ui.tabs {
+		restored, ok := bySource[tab.name]
+		if !ok {
+			restored = slices.DeleteFunc(slices.Clone(bySource[""]), func(msg monitor.Message) bool {
+				return msg.Source != tab.name
+			})
+		}
+		kept := slices.DeleteFunc(tab.messages.Snapshot(), func(msg monitor.Message) bool {
+			return !msg.Timestamp.After(snapshot.Saved)
+		})
+
+		tab.messages.Clear()
+		for _, msg := range append(restored, kept...) {
+			tab.messages.Add(msg)
+		}
+		tab.unflushed = 0
+	}
+}
+
+// snapshotMessage turns a message record of a snapshot back into a message
+func snapshotMessage(record sessionlog.Record, color string) monitor.Message {
+	displayTopic := record.DisplayTopic
+	if displayTopic == "" {
+		displayTopic = record.Topic
+	}
+	return monitor.Message{
+		Topic:        record.Topic,
+		DisplayTopic: displayTopic,
+		Payload:      record.Payload,
+		RawPayload:   record.RawPayload,
+		Source:       record.Source,
+		Timestamp:    record.Timestamp,
+		QoS:          record.QoS,
+		Retained:     record.Retained,
+		Color:        color,
+	}
+}
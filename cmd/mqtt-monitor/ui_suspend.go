@@ -0,0 +1,46 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+)
+
+// handleSuspendSignals suspends the UI on SIGTSTP sent by another process, as
+// Ctrl+Z does, and repaints the whole screen on SIGCONT, as the terminal may
+// have been used while the process was stopped
+func (ui *UI) handleSuspendSignals(ctx context.Context) {
+	signal.Notify(ui.suspendSignals, syscall.SIGTSTP, syscall.SIGCONT)
+	go func() {
+		defer signal.Stop(ui.suspendSignals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ui.suspendSignals:
+				if sig == syscall.SIGTSTP {
+					ui.app.QueueUpdate(ui.suspend)
+				} else {
+					ui.app.Sync()
+				}
+			}
+		}
+	}()
+}
+
+// suspend restores the terminal and stops the process like Ctrl+Z in a shell.
+// Messages are kept but not drawn until the shell continues the process; then
+// the screen is redrawn with the messages received meanwhile. Must be called on
+// the UI goroutine, so nothing is drawn while suspended.
+func (ui *UI) suspend() {
+	ui.suspended.Store(true)
+	ui.app.Suspend(func() {
+		// SIGTSTP stays caught by the Go runtime even after signal.Reset, so
+		// stop with SIGSTOP; the shell sees the same as after Ctrl+Z
+		syscall.Kill(syscall.Getpid(), syscall.SIGSTOP)
+	})
+	ui.suspended.Store(false)
+	ui.catchUp()
+}
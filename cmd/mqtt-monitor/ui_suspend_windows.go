@@ -0,0 +1,10 @@
+package main
+
+import "context"
+
+// handleSuspendSignals does nothing: Windows has no SIGTSTP or SIGCONT
+func (ui *UI) handleSuspendSignals(ctx context.Context) {}
+
+// suspend does nothing, as a Windows console cannot stop the process and hand
+// the terminal back to the shell
+func (ui *UI) suspend() {}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rivo/tview"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// allTabName is the label of the tab with the messages of every connection
+const allTabName = "All"
+
+// messageTab is a page of the messages view: the All tab with the messages of
+// every connection, or the tab of a single connection. Each tab keeps messages of
+// its own, so a quiet connection keeps its scrollback while a busy one floods the
+// All tab.
+type messageTab struct {
+	name      string // Connection name, "" for the All tab
+	view      *tview.TextView
+	messages  *monitor.MessageRing // Raw messages for reformatting
+	unflushed int                  // Newest messages not yet written to view, protected by messagesMu
+}
+
+// newMessageTab creates the tab of the connection called name, "" for the All tab
+func newMessageTab(name string) *messageTab {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetMaxLines(MaxDisplayedMessages)
+	view.SetBorder(true).SetTitle(defaultMessagesTitle)
+	return &messageTab{name: name, view: view, messages: monitor.NewMessageRing(MaxDisplayedMessages)}
+}
+
+// page returns the name of the page of the tab, apart from those of connections
+// called "All"
+func (t *messageTab) page() string {
+	if t.name == "" {
+		return "all"
+	}
+	return "connection:" + t.name
+}
+
+// label returns the name of the tab in the tab bar
+func (t *messageTab) label() string {
+	if t.name == "" {
+		return allTabName
+	}
+	return t.name
+}
+
+// SetConnectionTabs shows a tab for each connection after the All tab, or only
+// the All tab, without the tab bar, for a single connection. Tabs of connections
+// kept from the last call keep their messages; the tab of a new connection starts
+// with those of its messages the All tab still has.
+func (ui *UI) SetConnectionTabs(connections []monitor.ConnectionConfig) {
+	if len(connections) < 2 {
+		connections = nil
+	}
+
+	ui.messagesMu.Lock()
+	tabs := []*messageTab{ui.all}
+	bySource := make(map[string]*messageTab, len(connections))
+	for _, conn := range connections {
+		tab := ui.tabsBySource[conn.Name]
+		if tab == nil {
+			tab = newMessageTab(conn.Name)
+			tab.messages.SetSpool(ui.spool)
+			tab.messages.SetMaxBytes(ui.memoryLimit)
+			ui.all.messages.Each(func(msg monitor.Message) bool {
+				if msg.Source == conn.Name {
+					tab.messages.Add(msg)
+				}
+				return true
+			})
+		}
+		tabs = append(tabs, tab)
+		bySource[conn.Name] = tab
+	}
+	ui.tabs, ui.tabsBySource = tabs, bySource
+	ui.messagesMu.Unlock()
+
+	if !ui.started.Load() {
+		ui.layoutTabs()
+		return
+	}
+	ui.app.QueueUpdateDraw(ui.layoutTabs)
+}
+
+// tabList returns the tabs in tab bar order, the All tab first
+func (ui *UI) tabList() []*messageTab {
+	ui.messagesMu.Lock()
+	defer ui.messagesMu.Unlock()
+	return ui.tabs
+}
+
+// layoutTabs makes the tabs the pages of the messages view and draws them,
+// showing the All tab when the shown tab was removed. Must be called on the UI
+// goroutine, or before Start.
+func (ui *UI) layoutTabs() {
+	tabs := ui.tabList()
+	for _, page := range ui.tabPages.GetPageNames(false) {
+		if !slices.ContainsFunc(tabs, func(tab *messageTab) bool { return tab.page() == page }) {
+			ui.tabPages.RemovePage(page)
+		}
+	}
+	for _, tab := range tabs {
+		if !ui.tabPages.HasPage(tab.page()) {
+			ui.tabPages.AddPage(tab.page(), tab.view, true, false)
+		}
+	}
+	ui.theme.Load().applyTo(ui.themedViews()...)
+
+	barHeight := 0
+	if len(tabs) > 1 {
+		barHeight = 1
+	}
+	ui.flex.ResizeItem(ui.tabBar, barHeight, 0)
+
+	if !slices.Contains(tabs, ui.tab) {
+		ui.showTab(ui.all)
+	}
+	ui.drawAllMessages()
+	ui.drawTabBar()
+}
+
+// themedViews returns the views the theme colors: those of the tabs, the tab
+// bar, the errors view and the status bar
+func (ui *UI) themedViews() []*tview.TextView {
+	views := []*tview.TextView{ui.tabBar, ui.errorsView, ui.statusView}
+	for _, tab := range ui.tabList() {
+		views = append(views, tab.view)
+	}
+	return views
+}
+
+// showTab switches the messages view to tab. A search ends, as its matches are
+// those of the tab left; that tab keeps its scroll position. Must be called on
+// the UI goroutine.
+func (ui *UI) showTab(tab *messageTab) {
+	if tab == ui.tab {
+		return
+	}
+	if ui.search.query != "" {
+		ui.endSearch()
+	}
+
+	focused := ui.app.GetFocus() == ui.messagesView
+	ui.tab, ui.messagesView = tab, tab.view
+	ui.tabPages.SwitchToPage(tab.page())
+	if focused {
+		ui.app.SetFocus(tab.view)
+	}
+
+	ui.messagesMu.Lock()
+	ui.pausedNew = tab.unflushed
+	ui.messagesMu.Unlock()
+	ui.drawMessagesTitle(0)
+	ui.drawTabBar()
+}
+
+// cycleTab shows the tab after the shown one, the All tab after the last one, or
+// without tabs switches views like switch_view. Must be called on the UI
+// goroutine.
+func (ui *UI) cycleTab() {
+	tabs := ui.tabList()
+	if len(tabs) < 2 {
+		ui.switchView()
+		return
+	}
+	ui.showTab(tabs[(slices.Index(tabs, ui.tab)+1)%len(tabs)])
+}
+
+// selectTab shows the tab at index in the tab bar, if there is one. Must be
+// called on the UI goroutine.
+func (ui *UI) selectTab(index int) {
+	if tabs := ui.tabList(); index >= 0 && index < len(tabs) {
+		ui.showTab(tabs[index])
+	}
+}
+
+// drawTabBar writes the tabs with the select_tab keys to the tab bar, the shown
+// one highlighted. Must be called on the UI goroutine.
+func (ui *UI) drawTabBar() {
+	ui.tabBar.Clear()
+	tabs := ui.tabList()
+	if len(tabs) < 2 {
+		return
+	}
+	keys := ui.keymap.Load().keys["select_tab"]
+	for i, tab := range tabs {
+		label := tab.label()
+		if i < len(keys) {
+			label = keys[i].String() + " " + label
+		}
+		if tab == ui.tab {
+			fmt.Fprintf(ui.tabBar, "[::r] %s [::-] ", tview.Escape(label))
+		} else {
+			fmt.Fprintf(ui.tabBar, " %s  ", tview.Escape(label))
+		}
+	}
+}
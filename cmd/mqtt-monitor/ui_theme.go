@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// defaultStyleName names the built-in theme and keymap
+const defaultStyleName = "default"
+
+// Theme holds the colors of the TUI. Colors are tview color names such as
+// "yellow" or "darkcyan", "#rrggbb", or "default" for the terminal's color.
+type Theme struct {
+	Timestamp  string `toml:"timestamp"`
+	Text       string `toml:"text"`
+	Topic      string `toml:"topic"`
+	Source     string `toml:"source"`  // Sources without a connection color, e.g. in replays
+	Status     string `toml:"status"`  // Info events such as connected and subscribed
+	Warning    string `toml:"warning"` // Warning events such as reconnecting
+	Error      string `toml:"error"`
+	Border     string `toml:"border"`
+	Title      string `toml:"title"`
+	Background string `toml:"background"`
+	Match      string `toml:"match"` // Background of the messages matching a search
+
+	// Pretty-printed JSON payloads
+	JSONKey     string `toml:"json_key"`
+	JSONString  string `toml:"json_string"`
+	JSONNumber  string `toml:"json_number"`
+	JSONLiteral string `toml:"json_literal"` // true, false and null
+
+	name string // Name the theme was selected by
+}
+
+// defaultTheme returns the built-in theme, the colors of a dark terminal
+func defaultTheme() *Theme {
+	return &Theme{
+		Timestamp:   "yellow",
+		Text:        "white",
+		Topic:       "green",
+		Source:      "aqua",
+		Status:      "green",
+		Warning:     "orange",
+		Error:       "red",
+		Border:      "white",
+		Title:       "white",
+		Background:  "black",
+		Match:       "navy",
+		JSONKey:     "lightskyblue",
+		JSONString:  "lightgreen",
+		JSONNumber:  "gold",
+		JSONLiteral: "violet",
+		name:        defaultStyleName,
+	}
+}
+
+// LoadTheme reads a theme file (TOML, YAML or JSON). Colors the file leaves out
+// keep their default.
+func LoadTheme(path string) (*Theme, error) {
+	theme := defaultTheme()
+	md, err := decodeConfigFile(path, theme)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown setting %s", undecoded[0])
+	}
+	for _, color := range theme.colors() {
+		if !validColor(color.value) {
+			return nil, fmt.Errorf("invalid %s color %q", color.name, color.value)
+		}
+	}
+	return theme, nil
+}
+
+// colors returns the colors of the theme by setting name
+func (t *Theme) colors() []struct{ name, value string } {
+	return []struct{ name, value string }{
+		{"timestamp", t.Timestamp}, {"text", t.Text}, {"topic", t.Topic},
+		{"source", t.Source}, {"status", t.Status}, {"warning", t.Warning}, {"error", t.Error},
+		{"border", t.Border}, {"title", t.Title}, {"background", t.Background},
+		{"match", t.Match}, {"json_key", t.JSONKey}, {"json_string", t.JSONString},
+		{"json_number", t.JSONNumber}, {"json_literal", t.JSONLiteral},
+	}
+}
+
+// applyTo sets the border, title, background and text colors of views
+func (t *Theme) applyTo(views ...*tview.TextView) {
+	for _, view := range views {
+		view.SetTextColor(tcell.GetColor(t.Text))
+		view.SetBackgroundColor(tcell.GetColor(t.Background)) // Of the text too, unlike Box's
+		view.SetBorderColor(tcell.GetColor(t.Border)).SetTitleColor(tcell.GetColor(t.Title))
+	}
+}
+
+// validColor reports whether color can be used in a theme and as a tview color tag
+func validColor(color string) bool {
+	if color == "default" {
+		return true
+	}
+	if _, ok := tcell.ColorNames[color]; ok {
+		return true
+	}
+	if len(color) == 7 && color[0] == '#' {
+		_, err := strconv.ParseUint(color[1:], 16, 32)
+		return err == nil
+	}
+	return false
+}
+
+// loadDisplayFiles loads the theme and keymap files of display, resolving relative
+// paths against the directory of the config file filename, and checks that the
+// selected theme and keymap are configured
+func loadDisplayFiles(filename string, display *DisplayConfig) error {
+	display.themes = make(map[string]*Theme, len(display.Themes))
+	for name, path := range display.Themes {
+		theme, err := LoadTheme(resolveConfigPath(filename, path))
+		if err != nil {
+			return fmt.Errorf("display theme %s: %s: %w", name, path, err)
+		}
+		theme.name = name
+		display.themes[name] = theme
+	}
+
+	display.keymaps = make(map[string]*Keymap, len(display.Keymaps))
+	for name, path := range display.Keymaps {
+		keymap, err := LoadKeymap(resolveConfigPath(filename, path))
+		if err != nil {
+			return fmt.Errorf("display keymap %s: %s: %w", name, path, err)
+		}
+		keymap.name = name
+		display.keymaps[name] = keymap
+	}
+
+	return display.checkSelection(display.Theme, display.Keymap)
+}
+
+// checkSelection checks that theme and keymap, when set, name the built-in or a
+// configured theme and keymap. Files can only be selected at runtime.
+func (d *DisplayConfig) checkSelection(theme, keymap string) error {
+	if theme != "" && !slices.Contains(d.ThemeNames(), theme) {
+		return fmt.Errorf("unknown theme %q (expected %s; add theme files under [display.themes])", theme, strings.Join(d.ThemeNames(), ", "))
+	}
+	if keymap != "" && !slices.Contains(d.KeymapNames(), keymap) {
+		return fmt.Errorf("unknown keymap %q (expected %s; add keymap files under [display.keymaps])", keymap, strings.Join(d.KeymapNames(), ", "))
+	}
+	return nil
+}
+
+// resolveConfigPath returns path relative to the directory of the config file filename
+func resolveConfigPath(filename, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(filename), path)
+}
+
+// lookupTheme returns the theme called name: "default", a theme of display.themes
+// or, for another name, the theme file of that name
+func (d *DisplayConfig) lookupTheme(name string) (*Theme, error) {
+	if name == "" {
+		name = defaultStyleName
+	}
+	if theme, ok := d.themes[name]; ok {
+		return theme, nil
+	}
+	if name == defaultStyleName {
+		return defaultTheme(), nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("unknown theme %q (expected %s or a theme file)", name, strings.Join(d.ThemeNames(), ", "))
+	}
+	theme, err := LoadTheme(name)
+	if err != nil {
+		return nil, fmt.Errorf("theme %s: %w", name, err)
+	}
+	theme.name = name
+	return theme, nil
+}
+
+// ThemeNames returns the names of the built-in and the configured themes in order
+func (d *DisplayConfig) ThemeNames() []string {
+	return styleNames(d.themes)
+}
+
+// styleNames returns "default" and the keys of styles in order
+func styleNames[T any](styles map[string]T) []string {
+	names := slices.Sorted(maps.Keys(styles))
+	if !slices.Contains(names, defaultStyleName) {
+		names = append([]string{defaultStyleName}, names...)
+	}
+	return names
+}
+
+// SetStyles makes the themes and keymaps of display selectable and switches to
+// theme and keymap, names or files as for SetTheme and SetKeymap
+func (ui *UI) SetStyles(display DisplayConfig, theme, keymap string) error {
+	ui.stylesMu.Lock()
+	ui.styles = display
+	ui.stylesMu.Unlock()
+
+	if err := ui.SetTheme(theme); err != nil {
+		return err
+	}
+	return ui.SetKeymap(keymap)
+}
+
+// SetTheme switches to the theme called name: "default", a configured theme or
+// a theme file. Messages and events are redrawn in the new colors.
+func (ui *UI) SetTheme(name string) error {
+	ui.stylesMu.Lock()
+	theme, err := ui.styles.lookupTheme(name)
+	ui.stylesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ui.theme.Store(theme)
+	ui.retireLayouts()
+	if !ui.started.Load() {
+		return nil // Start applies the theme
+	}
+	ui.app.QueueUpdateDraw(func() {
+		theme.applyTo(ui.themedViews()...)
+		ui.drawEvents()
+		ui.drawStatus()
+	})
+	ui.refreshAllMessages()
+	return nil
+}
+
+// ThemeName returns the name of the current theme
+func (ui *UI) ThemeName() string {
+	return ui.theme.Load().name
+}
+
+// ThemeNames returns the names of the selectable themes
+func (ui *UI) ThemeNames() []string {
+	ui.stylesMu.Lock()
+	defer ui.stylesMu.Unlock()
+	return ui.styles.ThemeNames()
+}
+
+// cycleTheme switches to the theme after the current one
+func (ui *UI) cycleTheme() {
+	names := ui.ThemeNames()
+	next := names[(slices.Index(names, ui.ThemeName())+1)%len(names)]
+	if err := ui.SetTheme(next); err != nil {
+		ui.AddError(fmt.Errorf("theme %s: %w", next, err))
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor/sessionlogger"
+)
+
+// runVerify implements the "verify" subcommand
+func runVerify(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s verify <session-log>...", os.Args[0])
+	}
+
+	failed := 0
+	for _, path := range args {
+		if err := sessionlogger.VerifyManifest(path); err != nil {
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("OK   %s\n", path)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(args))
+	}
+	return nil
+}
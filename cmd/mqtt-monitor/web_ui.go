@@ -0,0 +1,19 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// webUIPage is the single page of the web UI. It renders /api/messages and
+// follows /stream with the same topic, source and q filters as the API.
+//
+//go:embed web/index.html
+var webUIPage []byte
+
+// handleWebUI serves the web UI for colleagues without shell access to the host
+func handleWebUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'unsafe-inline'; script-src 'unsafe-inline'; connect-src 'self' ws: wss:")
+	w.Write(webUIPage)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/zalando/go-keyring"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// wizardTestTimeout bounds each step of the wizard's connection test
+const wizardTestTimeout = 10 * time.Second
+
+// Where the wizard keeps the password, in the order of its drop-down
+const (
+	passwordInConfig = iota
+	passwordInKeyring
+	passwordFromEnv
+)
+
+// setupWizard is the form collecting the first connection of a new config
+type setupWizard struct {
+	app      *tview.Application
+	form     *tview.Form
+	status   *tview.TextView
+	path     string // Config file to write
+	force    bool   // Overwrite an existing file
+	saved    bool
+	testing  bool
+	name     *tview.InputField
+	server   *tview.InputField
+	topics   *tview.InputField
+	user     *tview.InputField
+	password *tview.InputField
+	storage  *tview.DropDown
+	caFile   *tview.InputField
+	certFile *tview.InputField
+	keyFile  *tview.InputField
+	insecure *tview.Checkbox
+}
+
+// runSetupWizard shows a form for the broker URL, credentials, TLS files and
+// topics, tests the connection on request and writes a starter config with it to
+// path. It reports whether the config was written; false means cancelled.
+func runSetupWizard(path string, force bool) (bool, error) {
+	w := &setupWizard{
+		app:      tview.NewApplication(),
+		form:     tview.NewForm(),
+		status:   tview.NewTextView().SetDynamicColors(true).SetWrap(true),
+		path:     path,
+		force:    force,
+		name:     tview.NewInputField().SetLabel("Name").SetText("local").SetFieldWidth(30),
+		server:   tview.NewInputField().SetLabel("Broker URL").SetText("tcp://localhost:1883").SetFieldWidth(50),
+		topics:   tview.NewInputField().SetLabel("Topics (comma separated)").SetText("#").SetFieldWidth(50),
+		user:     tview.NewInputField().SetLabel("Username").SetFieldWidth(30),
+		password: tview.NewInputField().SetLabel("Password").SetMaskCharacter('*').SetFieldWidth(30),
+		storage:  tview.NewDropDown().SetLabel("Keep the password").SetOptions([]string{"in the config file", "in the OS keyring", "nowhere (set MQTT_PASSWORD)"}, nil).SetCurrentOption(passwordInConfig),
+		caFile:   tview.NewInputField().SetLabel("CA certificate file").SetFieldWidth(50),
+		certFile: tview.NewInputField().SetLabel("Client certificate file").SetFieldWidth(50),
+		keyFile:  tview.NewInputField().SetLabel("Client key file").SetFieldWidth(50),
+		insecure: tview.NewCheckbox().SetLabel("Skip certificate verification"),
+	}
+
+	w.form.AddFormItem(w.name).AddFormItem(w.server).AddFormItem(w.topics).
+		AddFormItem(w.user).AddFormItem(w.password).AddFormItem(w.storage).
+		AddFormItem(w.caFile).AddFormItem(w.certFile).AddFormItem(w.keyFile).AddFormItem(w.insecure).
+		AddButton("Test", w.test).AddButton("Save", w.save).AddButton("Cancel", w.app.Stop)
+	w.form.SetItemPadding(0).SetCancelFunc(w.app.Stop)
+	w.form.SetBorder(true).SetTitle(" Set up a connection (Esc to cancel) ")
+	w.status.SetBorder(true)
+	w.setStatus("The config is written to [::b]%s[::-]. Test checks that the broker accepts the connection and the topics.", tview.Escape(path))
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(w.form, 0, 1, true).
+		AddItem(w.status, 4, 0, false)
+	w.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlC {
+			w.app.Stop()
+			return nil
+		}
+		return event
+	})
+	if err := w.app.SetRoot(layout, true).Run(); err != nil {
+		return false, err
+	}
+	return w.saved, nil
+}
+
+// setStatus shows a message below the form
+func (w *setupWizard) setStatus(format string, args ...any) {
+	w.status.SetText(fmt.Sprintf(format, args...))
+}
+
+// connection returns the connection entered in the form, validated as LoadConfig
+// would. TLS files are made absolute, as the config may be written elsewhere.
+func (w *setupWizard) connection() (monitor.ConnectionConfig, error) {
+	conn := monitor.ConnectionConfig{
+		Name:                  strings.TrimSpace(w.name.GetText()),
+		Server:                strings.TrimSpace(w.server.GetText()),
+		Topics:                splitList(w.topics.GetText()),
+		User:                  strings.TrimSpace(w.user.GetText()),
+		Password:              w.password.GetText(),
+		TLSInsecureSkipVerify: w.insecure.IsChecked(),
+	}
+	if conn.Name == "" {
+		return conn, fmt.Errorf("a name is required")
+	}
+	if err := checkBrokerURL(conn.Server); err != nil {
+		return conn, fmt.Errorf("broker URL: %w", err)
+	}
+	for field, input := range map[*string]*tview.InputField{&conn.TLSCAFile: w.caFile, &conn.TLSCertFile: w.certFile, &conn.TLSKeyFile: w.keyFile} {
+		if path := strings.TrimSpace(input.GetText()); path != "" {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return conn, err
+			}
+			*field = abs
+		}
+	}
+
+	connections := []monitor.ConnectionConfig{conn}
+	if err := validateConnections(connections); err != nil {
+		return conn, err
+	}
+	return connections[0], nil
+}
+
+// test connects to the broker in the background and shows the outcome
+func (w *setupWizard) test() {
+	conn, err := w.connection()
+	if err != nil {
+		w.setStatus("[red]%s", tview.Escape(err.Error()))
+		return
+	}
+	if w.testing {
+		return
+	}
+	w.testing = true
+	w.setStatus("[yellow]Connecting to %s...", tview.Escape(conn.Server))
+
+	go func() {
+		err := mqtt.CheckConnection(conn.ToMQTTConfig(), conn.Topics, conn.QoS, wizardTestTimeout)
+		w.app.QueueUpdateDraw(func() {
+			w.testing = false
+			if err != nil {
+				w.setStatus("[red]Test failed: %s", tview.Escape(err.Error()))
+				return
+			}
+			w.setStatus("[green]Connected to %s and subscribed to %s. Save writes the config.", tview.Escape(conn.Server), tview.Escape(strings.Join(conn.Topics, ", ")))
+		})
+	}()
+}
+
+// save stores the password as chosen, writes the config and closes the form
+func (w *setupWizard) save() {
+	conn, err := w.connection()
+	if err == nil {
+		err = w.storePassword(&conn)
+	}
+	if err == nil {
+		var data []byte
+		if data, err = wizardConfig(conn); err == nil {
+			err = writeConfigFile(w.path, data, w.force)
+		}
+	}
+	if err != nil {
+		w.setStatus("[red]%s", tview.Escape(err.Error()))
+		return
+	}
+	w.saved = true
+	w.app.Stop()
+}
+
+// storePassword moves the password of conn out of the config when it should not
+// be kept there
+func (w *setupWizard) storePassword(conn *monitor.ConnectionConfig) error {
+	option, _ := w.storage.GetCurrentOption()
+	switch {
+	case conn.Password == "":
+	case option == passwordInKeyring:
+		if err := keyring.Set(appName, conn.Name, conn.Password); err != nil {
+			return fmt.Errorf("keyring: %w", err)
+		}
+		conn.PasswordKeyring = appName + "/" + conn.Name
+		conn.Password = ""
+	case option == passwordFromEnv:
+		conn.Password = ""
+	}
+	return nil
+}
+
+// commentedSetting matches a commented-out option of the starter config
+var commentedSetting = regexp.MustCompile(`^# ([a-z_]+) =`)
+
+// wizardConfig returns the starter config with its [[connection]] block replaced
+// by conn. The commented options of the block that conn does not set are kept.
+func wizardConfig(conn monitor.ConnectionConfig) ([]byte, error) {
+	var block bytes.Buffer
+	encoder := toml.NewEncoder(&block)
+	encoder.Indent = ""
+	err := encoder.Encode(struct {
+		Connection []monitor.ConnectionConfig `toml:"connection"`
+	}{[]monitor.ConnectionConfig{conn}})
+	if err != nil {
+		return nil, err
+	}
+
+	var config bytes.Buffer
+	inBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(starterConfig))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "[[connection]]":
+			inBlock = true
+			config.WriteString(strings.TrimLeft(block.String(), "\n"))
+			continue
+		case inBlock && line == "":
+			inBlock = false
+		case inBlock:
+			match := commentedSetting.FindStringSubmatch(line)
+			if match == nil || bytes.Contains(block.Bytes(), []byte("\n"+match[1]+" =")) {
+				continue
+			}
+		}
+		config.WriteString(line + "\n")
+	}
+	return config.Bytes(), scanner.Err()
+}
@@ -0,0 +1,149 @@
+// mqtt-monitorctl controls a running mqtt-monitor through its control socket
+// ([control] socket in the monitor's configuration).
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/control"
+)
+
+const defaultSocket = "/tmp/mqtt-monitor-control.sock"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s [-socket path] [-timeout duration] <command> [arguments]
+
+Commands:
+  status                                   Uptime, message totals and connection state
+  pause-logging                            Stop writing the session log
+  resume-logging                           Resume writing the session log
+  rotate-log                               Start a new session log file
+  add-filter [-exclude] <filter>           Add a session log topic filter
+  publish [-connection name] [-qos n] [-retain] <topic> <payload|->
+                                           Publish a message ("-" reads the payload from stdin)
+  theme [name]                             Switch the TUI theme (without a name: list the themes)
+  keymap [name]                            Switch the TUI keymap (without a name: list the keymaps)
+
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	socket := flag.String("socket", envOr("MQTT_MONITOR_SOCKET", defaultSocket), "Control socket of the monitor (env MQTT_MONITOR_SOCKET)")
+	timeout := flag.Duration("timeout", 10*time.Second, "Time to wait for the monitor")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	req, err := parseCommand(flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		fail(err)
+	}
+
+	resp, err := control.Call(*socket, req, *timeout)
+	if err != nil {
+		fail(err)
+	}
+	if !resp.OK {
+		fail(fmt.Errorf("%s", resp.Error))
+	}
+	if resp.Result != nil {
+		out, _ := json.MarshalIndent(resp.Result, "", "  ")
+		fmt.Println(string(out))
+	}
+}
+
+// parseCommand builds the request for a command line
+func parseCommand(name string, args []string) (control.Request, error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	req := control.Request{}
+
+	switch name {
+	case "status":
+		req.Command = control.CommandStatus
+	case "pause-logging":
+		req.Command = control.CommandPauseLogging
+	case "resume-logging":
+		req.Command = control.CommandResumeLogging
+	case "rotate-log":
+		req.Command = control.CommandRotateLog
+
+	case "add-filter":
+		req.Command = control.CommandAddFilter
+		flags.BoolVar(&req.Exclude, "exclude", false, "Exclude matching topics instead of including them")
+		flags.Parse(args)
+		if flags.NArg() != 1 {
+			return req, fmt.Errorf("usage: add-filter [-exclude] <filter>")
+		}
+		req.Filter = flags.Arg(0)
+		return req, nil
+
+	case "publish":
+		req.Command = control.CommandPublish
+		var qos uint
+		flags.StringVar(&req.Connection, "connection", "", "Connection to publish on (default: first connected)")
+		flags.UintVar(&qos, "qos", 0, "QoS level (0, 1 or 2)")
+		flags.BoolVar(&req.Retain, "retain", false, "Set the retain flag")
+		flags.Parse(args)
+		if flags.NArg() != 2 {
+			return req, fmt.Errorf("usage: publish [-connection name] [-qos n] [-retain] <topic> <payload|->")
+		}
+		if qos > 2 {
+			return req, fmt.Errorf("invalid qos %d", qos)
+		}
+		req.QoS = byte(qos)
+		req.Topic = flags.Arg(0)
+		req.Payload = flags.Arg(1)
+		if req.Payload == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return req, err
+			}
+			req.Payload = string(data)
+		}
+		return req, nil
+
+	case "theme", "keymap":
+		req.Command = control.CommandSetTheme
+		if name == "keymap" {
+			req.Command = control.CommandSetKeymap
+		}
+		if len(args) > 1 {
+			return req, fmt.Errorf("usage: %s [name]", name)
+		}
+		if len(args) == 1 {
+			req.Name = args[0]
+		}
+		return req, nil
+
+	default:
+		return req, fmt.Errorf("unknown command %q", name)
+	}
+
+	if len(args) > 0 {
+		return req, fmt.Errorf("%s takes no arguments", name)
+	}
+	return req, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	os.Exit(1)
+}
@@ -0,0 +1,52 @@
+// Package cli holds the command line flags shared by the mqtt-monitor commands
+// that connect to a broker, so that monitor, replay and publish accept the same
+// connection flags.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// ConnectionFlags are the broker URL, credentials and TLS settings of a connection
+// given on the command line. Fields of Conn set before Register are the defaults.
+type ConnectionFlags struct {
+	Conn monitor.ConnectionConfig
+}
+
+// Register adds -broker, -user, -password and the -tls-* flags to flags, with
+// brokerUsage describing what the command does with -broker
+func (f *ConnectionFlags) Register(flags *flag.FlagSet, brokerUsage string) {
+	flags.StringVar(&f.Conn.Server, "broker", f.Conn.Server, brokerUsage+" (ssl://, tls:// or mqtts:// for TLS)")
+	flags.StringVar(&f.Conn.User, "user", f.Conn.User, "Username (default: env MQTT_USER)")
+	flags.StringVar(&f.Conn.Password, "password", f.Conn.Password, "Password (default: env MQTT_PASSWORD)")
+	flags.StringVar(&f.Conn.TLSCAFile, "tls-ca-file", f.Conn.TLSCAFile, "CA certificate file for verifying the broker")
+	flags.StringVar(&f.Conn.TLSCertFile, "tls-cert-file", f.Conn.TLSCertFile, "Client certificate file for mutual TLS")
+	flags.StringVar(&f.Conn.TLSKeyFile, "tls-key-file", f.Conn.TLSKeyFile, "Client private key file for mutual TLS")
+	flags.BoolVar(&f.Conn.TLSInsecureSkipVerify, "tls-insecure-skip-verify", f.Conn.TLSInsecureSkipVerify, "Accept any broker certificate (self-signed test brokers only)")
+}
+
+// Given reports whether a broker is set, on the command line or as the default
+func (f *ConnectionFlags) Given() bool {
+	return f.Conn.Server != ""
+}
+
+// Connection returns the connection given on the command line. Like the config
+// file, it takes missing credentials from the environment so they stay out of the
+// process list.
+func (f *ConnectionFlags) Connection() (monitor.ConnectionConfig, error) {
+	conn := f.Conn
+	if conn.User == "" {
+		conn.User = os.Getenv("MQTT_USER")
+	}
+	if conn.Password == "" {
+		conn.Password = os.Getenv("MQTT_PASSWORD")
+	}
+	if (conn.TLSCertFile == "") != (conn.TLSKeyFile == "") {
+		return conn, fmt.Errorf("-tls-cert-file and -tls-key-file must be given together")
+	}
+	return conn, nil
+}
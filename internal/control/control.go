@@ -0,0 +1,78 @@
+// Package control defines the commands accepted by a running mqtt-monitor. The
+// same JSON requests and responses travel over the MQTT command topic and the
+// control socket used by mqtt-monitorctl.
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Commands accepted by a running monitor
+const (
+	CommandStatus        = "status"
+	CommandPauseLogging  = "pause_logging"
+	CommandResumeLogging = "resume_logging"
+	CommandRotateLog     = "rotate_log"
+	CommandAddFilter     = "add_filter"
+	CommandPublish       = "publish"
+	CommandSetTheme      = "set_theme"
+	CommandSetKeymap     = "set_keymap"
+)
+
+// Request is a command sent to a running monitor
+type Request struct {
+	ID      string `json:"id,omitempty"`      // Echoed in the response to correlate replies
+	Token   string `json:"token,omitempty"`   // Shared secret, when the transport requires one
+	Command string `json:"command"`           // One of the Command* constants
+	Filter  string `json:"filter,omitempty"`  // add_filter: MQTT topic filter
+	Exclude bool   `json:"exclude,omitempty"` // add_filter: exclude instead of include
+	Name    string `json:"name,omitempty"`    // set_theme, set_keymap: configured name (empty lists them)
+
+	// publish
+	Connection string `json:"connection,omitempty"` // Default: first connected
+	Topic      string `json:"topic,omitempty"`
+	Payload    string `json:"payload,omitempty"`
+	QoS        byte   `json:"qos,omitempty"`
+	Retain     bool   `json:"retain,omitempty"`
+}
+
+// Response reports the outcome of a Request
+type Response struct {
+	ID     string `json:"id,omitempty"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Result any    `json:"result,omitempty"`
+}
+
+// Call sends req to the control socket at path and waits for the response. The
+// socket speaks one JSON request per line and answers each with one JSON line.
+func Call(path string, req Request, timeout time.Duration) (Response, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return Response{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return Response{}, err
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return Response{}, fmt.Errorf("no response: %w", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return Response{}, fmt.Errorf("invalid response: %w", err)
+	}
+	return resp, nil
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -27,6 +32,23 @@ type Config struct {
 	TLSKeyFile            string        `toml:"tls_key_file,omitempty"`
 	TLSCAFile             string        `toml:"tls_ca_file,omitempty"`
 	TLSInsecureSkipVerify bool          `toml:"tls_insecure_skip_verify,omitempty"`
+
+	// PasswordFunc fetches the password on every connection attempt instead of
+	// using Password, for short-lived secrets
+	PasswordFunc func() (string, error) `toml:"-"`
+	// TLSKeyPassphraseFunc fetches the passphrase of an encrypted TLS key on every handshake
+	TLSKeyPassphraseFunc func() (string, error) `toml:"-"`
+	// Client behavior; the zero value reconnects after a lost connection (and
+	// retries the first), subscribes again after reconnecting and delivers
+	// messages one at a time in arrival order
+	DisableAutoReconnect bool `toml:"disable_auto_reconnect,omitempty"`
+	DisableResubscribe   bool `toml:"disable_resubscribe,omitempty"`
+	DisableOrderMatters  bool `toml:"disable_order_matters,omitempty"`
+
+	WillTopic             string        `toml:"will_topic,omitempty"`
+	WillPayload           []byte        `toml:"will_payload,omitempty"`
+	WillQoS               byte          `toml:"will_qos,omitempty"`
+	WillRetained          bool          `toml:"will_retained,omitempty"`
 }
 
 // Message represents an MQTT message
@@ -41,6 +63,10 @@ type Message struct {
 // MessageHandler is a function type for handling received messages
 type MessageHandler func(msg Message)
 
+// ErrReconnecting is passed to the ConnectionHandler when the client starts
+// trying to connect again after losing the connection
+var ErrReconnecting = errors.New("reconnecting")
+
 // ConnectionHandler is a function type for handling connection events
 type ConnectionHandler func(connected bool, err error)
 
@@ -53,8 +79,19 @@ type Client struct {
 	cancel            context.CancelFunc
 	messageHandler    MessageHandler
 	connectionHandler ConnectionHandler
-	topics            []string
 	qos               byte
+
+	// subsMu guards topics and extraHandlers. It is held while subscribing, so a
+	// change from a reload and the re-subscription after a reconnect do not
+	// interleave.
+	subsMu        sync.Mutex
+	topics        []string
+	extraHandlers map[string]extraSubscription // Subscriptions outside the monitored topics
+}
+
+type extraSubscription struct {
+	qos     byte
+	handler MessageHandler
 }
 
 // NewClient creates a new universal MQTT client
@@ -80,6 +117,15 @@ func (c *Client) SetConnectionHandler(handler ConnectionHandler) {
 	c.connectionHandler = handler
 }
 
+// SetWill sets the last will message the broker publishes if the connection is lost.
+// It must be called before Connect.
+func (c *Client) SetWill(topic string, payload []byte, qos byte, retained bool) {
+	c.config.WillTopic = topic
+	c.config.WillPayload = payload
+	c.config.WillQoS = qos
+	c.config.WillRetained = retained
+}
+
 // SetQoS sets the Quality of Service level for subscriptions
 func (c *Client) SetQoS(qos byte) {
 	c.qos = qos
@@ -91,8 +137,9 @@ func (c *Client) Connect() error {
 	opts.AddBroker(c.config.BrokerURL)
 	opts.SetClientID(c.config.ClientID)
 	opts.SetCleanSession(c.config.CleanSession)
-	opts.SetAutoReconnect(true)
-	opts.SetConnectRetry(true)
+	opts.SetAutoReconnect(!c.config.DisableAutoReconnect)
+	opts.SetConnectRetry(!c.config.DisableAutoReconnect)
+	opts.SetOrderMatters(!c.config.DisableOrderMatters)
 
 	if c.config.ConnectRetryInterval > 0 {
 		opts.SetConnectRetryInterval(c.config.ConnectRetryInterval)
@@ -107,13 +154,28 @@ func (c *Client) Connect() error {
 	}
 
 	// Set credentials if provided
-	if c.config.Username != "" {
+	if c.config.PasswordFunc != nil {
+		opts.SetCredentialsProvider(func() (string, string) {
+			password, err := c.config.PasswordFunc()
+			if err != nil {
+				c.logger.Error().Err(err).Msg("Failed to fetch MQTT password")
+				if c.connectionHandler != nil {
+					c.connectionHandler(false, fmt.Errorf("failed to fetch password: %w", err))
+				}
+			}
+			return c.config.Username, password
+		})
+	} else if c.config.Username != "" {
 		opts.SetUsername(c.config.Username)
 		if c.config.Password != "" {
 			opts.SetPassword(c.config.Password)
 		}
 	}
 
+	if c.config.WillTopic != "" {
+		opts.SetBinaryWill(c.config.WillTopic, c.config.WillPayload, c.config.WillQoS, c.config.WillRetained)
+	}
+
 	// Configure TLS if needed
 	if c.needsTLS() {
 		tlsConfig, err := c.getTLSConfig()
@@ -136,7 +198,7 @@ func (c *Client) Connect() error {
 	opts.SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
 		c.logger.Info().Msg("MQTT reconnecting")
 		if c.connectionHandler != nil {
-			c.connectionHandler(false, fmt.Errorf("reconnecting"))
+			c.connectionHandler(false, ErrReconnecting)
 		}
 	})
 
@@ -146,12 +208,24 @@ func (c *Client) Connect() error {
 			c.connectionHandler(true, nil)
 		}
 
+		if c.config.DisableResubscribe {
+			return // The broker keeps the subscriptions of a persistent session
+		}
+
 		// Re-subscribe to all topics on reconnect
-		for _, topic := range c.topics {
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		topics, extraHandlers := slices.Clone(c.topics), maps.Clone(c.extraHandlers)
+		for _, topic := range topics {
 			if err := c.subscribeToTopic(topic); err != nil {
 				c.logger.Error().Err(err).Str("topic", topic).Msg("Failed to re-subscribe")
 			}
 		}
+		for topic, sub := range extraHandlers {
+			if err := c.subscribeWithHandler(topic, sub); err != nil {
+				c.logger.Error().Err(err).Str("topic", topic).Msg("Failed to re-subscribe")
+			}
+		}
 	})
 
 	c.client = mqtt.NewClient(opts)
@@ -175,16 +249,72 @@ func (c *Client) Subscribe(topics ...string) error {
 		return fmt.Errorf("client is not connected")
 	}
 
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
 	for _, topic := range topics {
 		if err := c.subscribeToTopic(topic); err != nil {
 			return err
 		}
-		c.topics = append(c.topics, topic)
+		if !slices.Contains(c.topics, topic) {
+			c.topics = append(c.topics, topic)
+		}
 	}
 
 	return nil
 }
 
+// Unsubscribe removes topics subscribed with Subscribe, so they are not restored
+// after reconnects either
+func (c *Client) Unsubscribe(topics ...string) error {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	c.topics = slices.DeleteFunc(c.topics, func(topic string) bool {
+		return slices.Contains(topics, topic)
+	})
+
+	if !c.IsConnected() {
+		return nil
+	}
+	token := c.client.Unsubscribe(topics...)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to unsubscribe from %s: %w", strings.Join(topics, ", "), token.Error())
+	}
+	return nil
+}
+
+// SubscribeHandler subscribes to topic with its own handler, so its messages do
+// not reach the regular message handler. It is restored after reconnects.
+func (c *Client) SubscribeHandler(topic string, qos byte, handler MessageHandler) error {
+	sub := extraSubscription{qos: qos, handler: handler}
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.extraHandlers == nil {
+		c.extraHandlers = make(map[string]extraSubscription)
+	}
+	c.extraHandlers[topic] = sub
+
+	if c.client == nil || !c.client.IsConnected() {
+		return nil // Subscribed by the connect handler
+	}
+	return c.subscribeWithHandler(topic, sub)
+}
+
+func (c *Client) subscribeWithHandler(topic string, sub extraSubscription) error {
+	token := c.client.Subscribe(topic, sub.qos, func(client mqtt.Client, msg mqtt.Message) {
+		sub.handler(Message{
+			Topic:     msg.Topic(),
+			Payload:   msg.Payload(),
+			QoS:       msg.Qos(),
+			Retained:  msg.Retained(),
+			Timestamp: time.Now(),
+		})
+	})
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to subscribe to topic %s: %w", topic, token.Error())
+	}
+	return nil
+}
+
 // subscribeToTopic subscribes to a single topic
 func (c *Client) subscribeToTopic(topic string) error {
 	c.logger.Info().Str("topic", topic).Uint8("qos", c.qos).Msg("Subscribing to topic")
@@ -234,13 +364,68 @@ func (c *Client) IsConnected() bool {
 
 // Disconnect disconnects from the MQTT broker
 func (c *Client) Disconnect() {
-	if c.client != nil && c.client.IsConnected() {
-		c.logger.Info().Msg("Disconnecting from MQTT broker")
-		c.client.Disconnect(250)
+	if c.client != nil {
+		if c.client.IsConnected() {
+			c.logger.Info().Msg("Disconnecting from MQTT broker")
+		}
+		c.client.Disconnect(250) // Also stops pending reconnect attempts
 	}
 	c.cancel()
 }
 
+// CheckConnection connects to the broker of config once, without retries, and
+// subscribes to topics, reporting the first failure: an unreachable broker,
+// rejected credentials or a subscription the broker refuses
+func CheckConnection(config Config, topics []string, qos byte, timeout time.Duration) error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(config.BrokerURL)
+	opts.SetClientID(config.ClientID)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(false)
+	opts.SetConnectTimeout(timeout)
+	opts.SetUsername(config.Username)
+	password := config.Password
+	if config.PasswordFunc != nil {
+		var err error
+		if password, err = config.PasswordFunc(); err != nil {
+			return fmt.Errorf("failed to fetch password: %w", err)
+		}
+	}
+	opts.SetPassword(password)
+	tlsConfig, err := NewTLSConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create TLS config: %w", err)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("no answer from %s within %v", config.BrokerURL, timeout)
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+	defer client.Disconnect(250)
+
+	for _, topic := range topics {
+		token := client.Subscribe(topic, qos, nil)
+		if !token.WaitTimeout(timeout) {
+			return fmt.Errorf("no answer to the subscription to %s within %v", topic, timeout)
+		}
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+		}
+		// A SUBACK return code of 0x80 means the broker refused the filter
+		if sub, ok := token.(*mqtt.SubscribeToken); ok && sub.Result()[topic] == 0x80 {
+			return fmt.Errorf("the broker refused the subscription to %s", topic)
+		}
+	}
+	return nil
+}
+
 // Context returns the client's context
 func (c *Client) Context() context.Context {
 	return c.ctx
@@ -248,36 +433,57 @@ func (c *Client) Context() context.Context {
 
 // needsTLS checks if TLS configuration is needed
 func (c *Client) needsTLS() bool {
-	return strings.HasPrefix(c.config.BrokerURL, "ssl://") ||
-		strings.HasPrefix(c.config.BrokerURL, "tls://") ||
-		strings.HasPrefix(c.config.BrokerURL, "mqtts://") ||
-		c.config.TLSCertFile != "" ||
-		c.config.TLSCAFile != "" ||
-		c.config.TLSInsecureSkipVerify
+	return c.config.usesTLS()
 }
 
 // getTLSConfig creates TLS configuration
 func (c *Client) getTLSConfig() (*tls.Config, error) {
-	if !c.needsTLS() {
+	return NewTLSConfig(c.config)
+}
+
+func (c Config) usesTLS() bool {
+	return strings.HasPrefix(c.BrokerURL, "ssl://") ||
+		strings.HasPrefix(c.BrokerURL, "tls://") ||
+		strings.HasPrefix(c.BrokerURL, "mqtts://") ||
+		c.TLSCertFile != "" ||
+		c.TLSCAFile != "" ||
+		c.TLSInsecureSkipVerify
+}
+
+// NewTLSConfig loads the certificates of config into a TLS configuration, nil
+// when the connection does not use TLS
+func NewTLSConfig(config Config) (*tls.Config, error) {
+	if !config.usesTLS() {
 		return nil, nil
 	}
 
 	tlsConfig := &tls.Config{
-		InsecureSkipVerify: c.config.TLSInsecureSkipVerify,
+		InsecureSkipVerify: config.TLSInsecureSkipVerify,
 	}
 
 	// Load client certificate if provided
-	if c.config.TLSCertFile != "" && c.config.TLSKeyFile != "" {
-		cert, err := tls.LoadX509KeyPair(c.config.TLSCertFile, c.config.TLSKeyFile)
+	if config.TLSCertFile != "" && config.TLSKeyFile != "" {
+		cert, err := loadKeyPair(config.TLSCertFile, config.TLSKeyFile, config.TLSKeyPassphraseFunc)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load client certificate: %w", err)
 		}
 		tlsConfig.Certificates = []tls.Certificate{cert}
+
+		// Fetch the passphrase again for every handshake, as it may have expired
+		if config.TLSKeyPassphraseFunc != nil {
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				cert, err := loadKeyPair(config.TLSCertFile, config.TLSKeyFile, config.TLSKeyPassphraseFunc)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load client certificate: %w", err)
+				}
+				return &cert, nil
+			}
+		}
 	}
 
 	// Load CA certificate if provided
-	if c.config.TLSCAFile != "" {
-		caCert, err := os.ReadFile(c.config.TLSCAFile)
+	if config.TLSCAFile != "" {
+		caCert, err := os.ReadFile(config.TLSCAFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
 		}
@@ -292,6 +498,43 @@ func (c *Client) getTLSConfig() (*tls.Config, error) {
 	return tlsConfig, nil
 }
 
+// loadKeyPair loads a client certificate and its key, decrypting a key in the
+// legacy encrypted PEM format ("Proc-Type: 4,ENCRYPTED") with the passphrase
+// passphrase returns
+func loadKeyPair(certFile, keyFile string, passphrase func() (string, error)) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return tls.Certificate{}, fmt.Errorf("no PEM data in %s", keyFile)
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		return tls.Certificate{}, fmt.Errorf("%s: encrypted PKCS#8 keys are not supported, convert with: openssl pkey -in %s -traditional -aes256", keyFile, keyFile)
+	}
+	// Deprecated as insecure, but still what "openssl ... -traditional -aes256" writes
+	if x509.IsEncryptedPEMBlock(block) {
+		if passphrase == nil {
+			return tls.Certificate{}, fmt.Errorf("%s is encrypted but no passphrase is configured", keyFile)
+		}
+		secret, err := passphrase()
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to fetch key passphrase: %w", err)
+		}
+		der, err := x509.DecryptPEMBlock(block, []byte(secret))
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to decrypt %s: %w", keyFile, err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
 // SanitizePayload sanitizes message payload for safe display without HTML escaping
 func SanitizePayload(payload []byte) string {
 	content := string(payload)
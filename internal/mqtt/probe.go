@@ -0,0 +1,504 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Protocol versions of the CONNECT packet
+const (
+	protocolMQTT311 byte = 4
+	protocolMQTT5   byte = 5
+)
+
+// MQTT control packet types, in the upper four bits of the first byte
+const (
+	packetConnect    byte = 0x10
+	packetConnack    byte = 0x20
+	packetPublish    byte = 0x30
+	packetSubscribe  byte = 0x82 // With the reserved flags SUBSCRIBE requires
+	packetSuback     byte = 0x90
+	packetDisconnect byte = 0xe0
+)
+
+// probeKeepAlive is the keep alive the probe connects with; a probe is over long
+// before the broker expects a ping
+const probeKeepAlive = 60
+
+// errUnsupportedProtocol reports a broker refusing MQTT 5, so the probe connects
+// again with MQTT 3.1.1
+var errUnsupportedProtocol = errors.New("unsupported protocol version")
+
+// ProbeResult is the broker's answer to a subscription of a probe
+type ProbeResult struct {
+	Filter  string
+	Allowed bool
+	QoS     byte   // QoS the broker granted, when allowed
+	Code    byte   // SUBACK reason code, or return code with MQTT 3.1.1
+	Reason  string // Meaning of Code, followed by the reason string of an MQTT 5 broker
+	Err     error  // No answer: an invalid filter, a timeout or the broker closing the connection
+}
+
+// SubscriptionProbe holds what a broker answered to the subscriptions of
+// ProbeSubscriptions
+type SubscriptionProbe struct {
+	Protocol string // "MQTT 5" or "MQTT 3.1.1"
+	Results  []ProbeResult
+}
+
+// ProbeSubscriptions connects to the broker of config with MQTT 5, or with MQTT
+// 3.1.1 when the broker does not speak it, and subscribes to every filter with
+// qos on its own, reporting whether the broker's ACLs allow it from the SUBACK.
+// MQTT 5 brokers tell why they refused a filter, MQTT 3.1.1 brokers only that
+// they did. A broker closing the connection on a refused filter counts as a
+// refusal, and the probe connects again for the filters after it. The
+// connection has a clean session and asks MQTT 5 brokers not to send retained
+// messages, so a probe leaves nothing behind. The error is for a connection the
+// broker refused.
+func ProbeSubscriptions(config Config, filters []string, qos byte, timeout time.Duration) (*SubscriptionProbe, error) {
+	probe := &SubscriptionProbe{Protocol: "MQTT 5"}
+	version := protocolMQTT5
+	results := make([]ProbeResult, len(filters))
+	pending := make([]int, 0, len(filters))
+	for i, filter := range filters {
+		results[i] = ProbeResult{Filter: filter}
+		if err := ValidateTopicFilter(filter); err != nil {
+			results[i].Err = err // Brokers close the connection on an invalid filter
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for connected := false; len(pending) > 0; {
+		session, err := openProbeSession(config, version, timeout)
+		if errors.Is(err, errUnsupportedProtocol) && version == protocolMQTT5 && !connected {
+			probe.Protocol, version = "MQTT 3.1.1", protocolMQTT311
+			continue
+		}
+		if err != nil && !connected {
+			return nil, err
+		}
+		if err != nil {
+			for _, i := range pending {
+				results[i].Err = fmt.Errorf("not probed, connecting again failed: %w", err)
+			}
+			break
+		}
+		connected = true
+
+		for len(pending) > 0 {
+			i := pending[0]
+			pending = pending[1:]
+			if err := session.subscribe(&results[i], uint16(i%65535+1), qos); err != nil {
+				results[i].Err = err
+				break // Connect again for the rest
+			}
+		}
+		session.close()
+	}
+	probe.Results = results
+	return probe, nil
+}
+
+// probeSession is a connection of a probe, speaking just enough MQTT to connect
+// and subscribe
+type probeSession struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	version byte
+	timeout time.Duration
+}
+
+// openProbeSession connects to the broker of config with the protocol version
+func openProbeSession(config Config, version byte, timeout time.Duration) (*probeSession, error) {
+	password := config.Password
+	if config.PasswordFunc != nil {
+		var err error
+		if password, err = config.PasswordFunc(); err != nil {
+			return nil, fmt.Errorf("failed to fetch password: %w", err)
+		}
+	}
+	conn, err := dialBroker(config, timeout)
+	if err != nil {
+		return nil, err
+	}
+	s := &probeSession{conn: conn, reader: bufio.NewReader(conn), version: version, timeout: timeout}
+
+	var body []byte
+	body = appendString(body, "MQTT")
+	flags := byte(0x02) // Clean session, or clean start with MQTT 5
+	if config.Username != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, version, flags)
+	body = binary.BigEndian.AppendUint16(body, probeKeepAlive)
+	if version == protocolMQTT5 {
+		body = append(body, 0) // No properties
+	}
+	body = appendString(body, config.ClientID)
+	if flags&0x80 != 0 {
+		body = appendString(body, config.Username)
+	}
+	if flags&0x40 != 0 {
+		body = appendString(body, password)
+	}
+
+	header, reply, err := s.exchange(packetConnect, body, packetConnack)
+	if err == nil {
+		err = s.connackError(header, reply)
+	}
+	if err != nil {
+		conn.Close()
+		if version == protocolMQTT5 && (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)) {
+			// Brokers that only speak MQTT 3.1.1 may close the connection instead of answering
+			return nil, errUnsupportedProtocol
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// connackError returns the error of a CONNACK refusing the connection
+func (s *probeSession) connackError(header byte, body []byte) error {
+	if header == packetDisconnect {
+		return s.disconnectError(body)
+	}
+	if len(body) < 2 {
+		return fmt.Errorf("malformed CONNACK")
+	}
+	code := body[1]
+	switch {
+	case s.version == protocolMQTT5 && (code == 0x84 || len(body) == 2):
+		// A broker speaking only MQTT 3.1.1 answers with its own CONNACK, which
+		// lacks the properties
+		return errUnsupportedProtocol
+	case code == 0:
+		return nil
+	case s.version == protocolMQTT5:
+		return fmt.Errorf("the broker refused the connection: %s", reasonText(mqtt5Reasons, code, body[2:]))
+	}
+	return fmt.Errorf("the broker refused the connection: %s", reasonText(connackReturnCodes, code, nil))
+}
+
+// subscribe subscribes to the filter of result and fills in the broker's answer
+func (s *probeSession) subscribe(result *ProbeResult, id uint16, qos byte) error {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	options := qos
+	if s.version == protocolMQTT5 {
+		body = append(body, 0) // No properties
+		options |= 0x20        // Retain handling 2: no retained messages
+	}
+	body = appendString(body, result.Filter)
+	body = append(body, options)
+
+	header, reply, err := s.exchange(packetSubscribe, body, packetSuback)
+	if err != nil {
+		return err
+	}
+	if header == packetDisconnect {
+		return s.disconnectError(reply)
+	}
+	if len(reply) < 2 || binary.BigEndian.Uint16(reply) != id {
+		return fmt.Errorf("malformed SUBACK")
+	}
+	reply = reply[2:]
+	properties := reply
+	if s.version == protocolMQTT5 {
+		if _, reply, err = splitProperties(reply); err != nil {
+			return err
+		}
+	}
+	if len(reply) != 1 {
+		return fmt.Errorf("malformed SUBACK")
+	}
+
+	result.Code = reply[0]
+	result.Allowed = result.Code <= 2
+	if result.Allowed {
+		result.QoS = result.Code
+		result.Reason = fmt.Sprintf("granted QoS %d", result.QoS)
+	} else if s.version == protocolMQTT5 {
+		result.Reason = reasonText(mqtt5Reasons, result.Code, properties)
+	} else {
+		result.Reason = reasonText(subackReturnCodes, result.Code, nil)
+	}
+	return nil
+}
+
+// exchange sends a packet and reads packets until the one of type want, or a
+// DISCONNECT, skipping messages the broker sends meanwhile
+func (s *probeSession) exchange(header byte, body []byte, want byte) (byte, []byte, error) {
+	s.conn.SetDeadline(time.Now().Add(s.timeout))
+	packet := append([]byte{header}, appendVarint(nil, len(body))...)
+	if _, err := s.conn.Write(append(packet, body...)); err != nil {
+		return 0, nil, err
+	}
+	for {
+		got, reply, err := s.readPacket()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, fmt.Errorf("the broker closed the connection: %w", io.EOF)
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return 0, nil, fmt.Errorf("no answer within %v", s.timeout)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if got == want || got == packetDisconnect {
+			return got, reply, nil
+		}
+	}
+}
+
+// readPacket reads a packet and returns its type and body; the body of a
+// PUBLISH, which may be large, is skipped
+func (s *probeSession) readPacket() (byte, []byte, error) {
+	first, err := s.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := readVarint(s.reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if first&0xf0 == packetPublish {
+		_, err := io.CopyN(io.Discard, s.reader, int64(length))
+		return packetPublish, nil, err
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(s.reader, body)
+	return first & 0xf0, body, err
+}
+
+// disconnectError describes a DISCONNECT of the broker
+func (s *probeSession) disconnectError(body []byte) error {
+	if len(body) == 0 {
+		return errors.New("the broker disconnected")
+	}
+	return fmt.Errorf("the broker disconnected: %s", reasonText(mqtt5Reasons, body[0], body[1:]))
+}
+
+// close disconnects from the broker
+func (s *probeSession) close() {
+	s.conn.SetDeadline(time.Now().Add(s.timeout))
+	s.conn.Write([]byte{packetDisconnect, 0})
+	s.conn.Close()
+}
+
+// dialBroker opens a network connection to the broker of config, with TLS or
+// over WebSocket as its URL asks
+func dialBroker(config Config, timeout time.Duration) (net.Conn, error) {
+	server, err := url.Parse(config.BrokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker URL %q: %w", config.BrokerURL, err)
+	}
+	tlsConfig, err := NewTLSConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TLS config: %w", err)
+	}
+	if server.Scheme == "ws" || server.Scheme == "wss" {
+		return mqtt.NewWebsocket(config.BrokerURL, tlsConfig, timeout, nil, nil)
+	}
+
+	address := server.Host
+	if server.Port() == "" {
+		port := "1883"
+		if tlsConfig != nil {
+			port = "8883"
+		}
+		address = net.JoinHostPort(server.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	if tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	}
+	return dialer.Dial("tcp", address)
+}
+
+// appendString appends an MQTT UTF-8 string: its length, then its bytes
+func appendString(dst []byte, s string) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(s)))
+	return append(dst, s...)
+}
+
+// appendVarint appends an MQTT variable byte integer
+func appendVarint(dst []byte, n int) []byte {
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n == 0 {
+			return append(dst, b)
+		}
+		dst = append(dst, b|0x80)
+	}
+}
+
+// readVarint reads an MQTT variable byte integer
+func readVarint(r io.ByteReader) (int, error) {
+	n, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return n, nil
+		}
+		shift += 7
+	}
+	return 0, errors.New("malformed packet length")
+}
+
+// splitProperties splits MQTT 5 properties, led by their length, off the front
+// of body
+func splitProperties(body []byte) ([]byte, []byte, error) {
+	reader := &byteSliceReader{data: body}
+	length, err := readVarint(reader)
+	if err != nil || length > len(body)-reader.pos {
+		return nil, nil, errors.New("malformed properties")
+	}
+	start := reader.pos
+	return body[start : start+length], body[start+length:], nil
+}
+
+// byteSliceReader reads the bytes of a slice one by one
+type byteSliceReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *byteSliceReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+// reasonString returns the Reason String property of MQTT 5 properties, led by
+// their length, if there is one
+func reasonString(properties []byte) string {
+	properties, _, err := splitProperties(properties)
+	if err != nil {
+		return ""
+	}
+	for len(properties) > 0 {
+		id := properties[0]
+		properties = properties[1:]
+		var size int
+		switch id {
+		case 0x01, 0x17, 0x19, 0x24, 0x25, 0x28, 0x29, 0x2a:
+			size = 1
+		case 0x13, 0x21, 0x22, 0x23:
+			size = 2
+		case 0x02, 0x11, 0x18, 0x27:
+			size = 4
+		case 0x0b:
+			reader := &byteSliceReader{data: properties}
+			if _, err := readVarint(reader); err != nil {
+				return ""
+			}
+			size = reader.pos
+		case 0x03, 0x08, 0x09, 0x12, 0x15, 0x16, 0x1a, 0x1c, 0x1f:
+			if len(properties) < 2 {
+				return ""
+			}
+			size = 2 + int(binary.BigEndian.Uint16(properties))
+		case 0x26: // User property: a pair of strings
+			if len(properties) < 2 {
+				return ""
+			}
+			size = 2 + int(binary.BigEndian.Uint16(properties))
+			if len(properties) < size+2 {
+				return ""
+			}
+			size += 2 + int(binary.BigEndian.Uint16(properties[size:]))
+		default:
+			return ""
+		}
+		if size > len(properties) {
+			return ""
+		}
+		if id == 0x1f {
+			return string(properties[2:size])
+		}
+		properties = properties[size:]
+	}
+	return ""
+}
+
+// reasonText names a reason or return code, followed by the reason string of
+// MQTT 5 properties, led by their length
+func reasonText(names map[byte]string, code byte, properties []byte) string {
+	text, ok := names[code]
+	if !ok {
+		text = "unknown reason"
+	}
+	if reason := reasonString(properties); reason != "" {
+		text += ": " + reason
+	}
+	return text
+}
+
+// connackReturnCodes are the CONNACK return codes of MQTT 3.1.1
+var connackReturnCodes = map[byte]string{
+	0x01: "unacceptable protocol version",
+	0x02: "identifier rejected",
+	0x03: "server unavailable",
+	0x04: "bad user name or password",
+	0x05: "not authorized",
+}
+
+// subackReturnCodes are the SUBACK return codes of MQTT 3.1.1 besides the
+// granted QoS
+var subackReturnCodes = map[byte]string{
+	0x80: "failure",
+}
+
+// mqtt5Reasons are the MQTT 5 reason codes of errors in CONNACK, SUBACK and
+// DISCONNECT packets
+var mqtt5Reasons = map[byte]string{
+	0x00: "normal disconnection",
+	0x80: "unspecified error",
+	0x81: "malformed packet",
+	0x82: "protocol error",
+	0x83: "implementation specific error",
+	0x84: "unsupported protocol version",
+	0x85: "client identifier not valid",
+	0x86: "bad user name or password",
+	0x87: "not authorized",
+	0x88: "server unavailable",
+	0x89: "server busy",
+	0x8a: "banned",
+	0x8b: "server shutting down",
+	0x8c: "bad authentication method",
+	0x8d: "keep alive timeout",
+	0x8e: "session taken over",
+	0x8f: "topic filter invalid",
+	0x91: "packet identifier in use",
+	0x93: "receive maximum exceeded",
+	0x95: "packet too large",
+	0x97: "quota exceeded",
+	0x98: "administrative action",
+	0x9c: "use another server",
+	0x9d: "server moved",
+	0x9e: "shared subscriptions not supported",
+	0x9f: "connection rate exceeded",
+	0xa1: "subscription identifiers not supported",
+	0xa2: "wildcard subscriptions not supported",
+}
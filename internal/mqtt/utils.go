@@ -1,9 +1,14 @@
 package mqtt
 
 import (
+    "fmt"
     "strings"
+    "unicode/utf8"
 )
 
+// MaxTopicLength is the longest topic or filter MQTT can encode, in bytes
+const MaxTopicLength = 65535
+
 // TruncateTopic truncates a topic to show only the last N levels
 // Example: "A/B/C/D" with depth 2 returns "C/D"
 func TruncateTopic(topic string, depth int) string {
@@ -18,3 +23,117 @@ func TruncateTopic(topic string, depth int) string {
     
     return strings.Join(parts[len(parts)-depth:], "/")
 }
+
+// TopicMatches reports whether topic matches the subscription filter,
+// honouring the single-level (+) and multi-level (#) wildcards
+// Example: "sensors/+/data" matches "sensors/kitchen/data"
+func TopicMatches(filter, topic string) bool {
+    filterParts := strings.Split(filter, "/")
+    topicParts := strings.Split(topic, "/")
+
+    for i, part := range filterParts {
+        if part == "#" {
+            return true
+        }
+        if i >= len(topicParts) {
+            return false
+        }
+        if part != "+" && part != topicParts[i] {
+            return false
+        }
+    }
+
+    return len(filterParts) == len(topicParts)
+}
+
+// SharedFilter returns the topic filter of a shared subscription
+// ("$share/group/filter"), or filter itself for other subscriptions
+func SharedFilter(filter string) string {
+    if rest, ok := strings.CutPrefix(filter, "$share/"); ok {
+        if _, shared, ok := strings.Cut(rest, "/"); ok {
+            return shared
+        }
+    }
+    return filter
+}
+
+// FilterCovers reports whether every topic matching the filter narrow also
+// matches the filter broad, e.g. "sensors/#" covers "sensors/+/data"
+func FilterCovers(broad, narrow string) bool {
+    broadParts := strings.Split(broad, "/")
+    narrowParts := strings.Split(narrow, "/")
+
+    for i, part := range broadParts {
+        if part == "#" {
+            return true
+        }
+        if i >= len(narrowParts) || narrowParts[i] == "#" {
+            return false
+        }
+        if part != "+" && part != narrowParts[i] {
+            return false
+        }
+    }
+
+    return len(broadParts) == len(narrowParts)
+}
+
+// ValidateTopicFilter checks that filter is a well-formed subscription filter:
+// non-empty UTF-8 without U+0000 and at most MaxTopicLength bytes, "#" only as
+// the last level and wildcards only as whole levels. Shared subscriptions
+// ("$share/group/filter") need a group without wildcards and a filter.
+func ValidateTopicFilter(filter string) error {
+    if filter == "" {
+        return fmt.Errorf("topic filter must not be empty")
+    }
+    if err := validateTopicString("topic filter", filter); err != nil {
+        return err
+    }
+
+    levels := strings.Split(filter, "/")
+    if levels[0] == "$share" {
+        switch {
+        case len(levels) < 3 || levels[1] == "" || strings.Join(levels[2:], "/") == "":
+            return fmt.Errorf("topic filter %q: shared subscriptions need a group and a filter, e.g. \"$share/group/sensors/#\"", filter)
+        case strings.ContainsAny(levels[1], "#+"):
+            return fmt.Errorf("topic filter %q: the share group must not contain wildcards", filter)
+        }
+        levels = levels[2:]
+    }
+    for i, level := range levels {
+        switch {
+        case level == "#" && i != len(levels)-1:
+            return fmt.Errorf("topic filter %q: '#' must be the last level", filter)
+        case level != "#" && level != "+" && strings.ContainsAny(level, "#+"):
+            return fmt.Errorf("topic filter %q: wildcards must occupy a whole level", filter)
+        }
+    }
+    return nil
+}
+
+// ValidateTopicName checks that topic can be published to: non-empty and without wildcards
+func ValidateTopicName(topic string) error {
+    if topic == "" {
+        return fmt.Errorf("topic must not be empty")
+    }
+    if err := validateTopicString("topic", topic); err != nil {
+        return err
+    }
+    if strings.ContainsAny(topic, "#+") {
+        return fmt.Errorf("topic %q must not contain wildcards", topic)
+    }
+    return nil
+}
+
+// validateTopicString checks the encoding rules topics and filters share
+func validateTopicString(kind, s string) error {
+    switch {
+    case len(s) > MaxTopicLength:
+        return fmt.Errorf("%s %.40q...: %d bytes long, the maximum is %d", kind, s, len(s), MaxTopicLength)
+    case !utf8.ValidString(s):
+        return fmt.Errorf("%s %q: not valid UTF-8", kind, s)
+    case strings.ContainsRune(s, 0):
+        return fmt.Errorf("%s %q: must not contain the null character", kind, s)
+    }
+    return nil
+}
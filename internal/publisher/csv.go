@@ -0,0 +1,194 @@
+package publisher
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// CSVRow is one message of a CSV script
+type CSVRow struct {
+	Line    int
+	At      time.Duration // Time since the start of the script
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// csvColumns are the columns of a CSV script in their default order
+var csvColumns = []string{"delay", "topic", "payload", "qos", "retain"}
+
+// LoadCSV reads a CSV script: one message per row with the columns delay, topic,
+// payload and optionally qos and retain. A header row may name the columns in any
+// order, and "offset" instead of "delay" times rows from the start of the script
+// rather than from the previous row. Times are durations ("1.5s") or milliseconds.
+// Empty qos and retain cells take the defaults; the encoding applies to payloads.
+func LoadCSV(path string, defaults Stream, encode Encoder) ([]CSVRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	index := map[string]int{}
+	for i, name := range csvColumns {
+		index[name] = i
+	}
+	offsets := false
+
+	var (
+		rows  []CSVRow
+		at    time.Duration
+		first = true
+	)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		header := first && isCSVHeader(record)
+		first = false
+		if header {
+			index = map[string]int{}
+			for i, name := range record {
+				index[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			_, offsets = index["offset"]
+			if _, ok := index["delay"]; ok == offsets {
+				return nil, fmt.Errorf("%s:%d: the header needs either a delay or an offset column", path, line)
+			}
+			if _, ok := index["topic"]; !ok {
+				return nil, fmt.Errorf("%s:%d: the header needs a topic column", path, line)
+			}
+			continue
+		}
+
+		cell := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := CSVRow{Line: line, Topic: cell("topic"), QoS: defaults.QoS, Retain: defaults.Retain}
+		if row.Topic == "" {
+			return nil, fmt.Errorf("%s:%d: missing topic", path, line)
+		}
+
+		timing := "delay"
+		if offsets {
+			timing = "offset"
+		}
+		d, err := parseCSVDuration(cell(timing))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid %s: %w", path, line, timing, err)
+		}
+		if offsets {
+			if d < at {
+				return nil, fmt.Errorf("%s:%d: offset %v is before the previous row", path, line, d)
+			}
+			at = d
+		} else {
+			at += d
+		}
+		row.At = at
+
+		// The payload cell is taken as is, keeping whitespace
+		if i, ok := index["payload"]; ok && i < len(record) {
+			row.Payload = []byte(record[i])
+		}
+		if encode != nil {
+			if row.Payload, err = encode(row.Payload); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+		if s := cell("qos"); s != "" {
+			qos, err := strconv.Atoi(s)
+			if err != nil || qos < 0 || qos > 2 {
+				return nil, fmt.Errorf("%s:%d: invalid qos %q", path, line, s)
+			}
+			row.QoS = byte(qos)
+		}
+		if s := cell("retain"); s != "" {
+			if row.Retain, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid retain %q", path, line, s)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s has no rows", path)
+	}
+	return rows, nil
+}
+
+// isCSVHeader reports whether a first row names columns rather than holding a message
+func isCSVHeader(record []string) bool {
+	_, err := parseCSVDuration(strings.TrimSpace(record[0]))
+	return err != nil
+}
+
+// parseCSVDuration parses a Go duration or a number of milliseconds; empty is 0
+func parseCSVDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		if ms < 0 {
+			return 0, fmt.Errorf("%q is negative", s)
+		}
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q is not a duration or a number of milliseconds", s)
+	}
+	return d, nil
+}
+
+// runCSV publishes the rows of a CSV script at their times, scaled by the speed
+// factor (0 publishes without delays). It returns the number of messages published.
+func runCSV(ctx context.Context, client mqtt.Client, rows []CSVRow, speed float64) int {
+	published := 0
+	start := time.Now()
+	for _, row := range rows {
+		if speed > 0 {
+			at := start.Add(time.Duration(float64(row.At) / speed))
+			select {
+			case <-ctx.Done():
+				return published
+			case <-time.After(time.Until(at)):
+			}
+		} else if ctx.Err() != nil {
+			return published
+		}
+
+		token := client.Publish(row.Topic, row.QoS, row.Retain, row.Payload)
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Line %d: failed to publish to %s: %v", row.Line, row.Topic, token.Error())
+			continue
+		}
+		published++
+		fmt.Printf("Sent message %d to %s: %s\n", published, row.Topic, formatPayload(row.Payload))
+	}
+	return published
+}
@@ -0,0 +1,156 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Payload encodings, applied to the text a template renders
+const (
+	EncodingText     = "text"     // Published as is
+	EncodingHex      = "hex"      // Hex digits, whitespace ignored, e.g. "01 ff {{randInt 0 255 | printf \"%02x\"}}"
+	EncodingBase64   = "base64"   // Standard base64
+	EncodingProtobuf = "protobuf" // Protobuf JSON of the -proto-message type, published in binary wire format
+)
+
+// Encoder turns the rendered text of a payload into the published bytes
+type Encoder func([]byte) ([]byte, error)
+
+// ProtoOptions names the message type used by the protobuf encoding
+type ProtoOptions struct {
+	Descriptor string // FileDescriptorSet, e.g. from protoc --include_imports --descriptor_set_out
+	Message    string // Fully qualified message name, e.g. "telemetry.v1.Reading"
+}
+
+// NewEncoder returns the encoder for an encoding name; text needs none
+func NewEncoder(encoding string, proto ProtoOptions) (Encoder, error) {
+	switch encoding {
+	case "", EncodingText:
+		return nil, nil
+	case EncodingHex:
+		return decodeHex, nil
+	case EncodingBase64:
+		return func(text []byte) ([]byte, error) {
+			return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(text)))
+		}, nil
+	case EncodingProtobuf:
+		return newProtoEncoder(proto)
+	default:
+		return nil, fmt.Errorf("unknown encoding %q (expected %s, %s, %s or %s)",
+			encoding, EncodingText, EncodingHex, EncodingBase64, EncodingProtobuf)
+	}
+}
+
+func decodeHex(text []byte) ([]byte, error) {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, string(text))
+	return hex.DecodeString(strings.TrimPrefix(digits, "0x"))
+}
+
+// newProtoEncoder converts protobuf JSON into the wire format of the named message,
+// resolved from a descriptor set so no generated code is needed
+func newProtoEncoder(opts ProtoOptions) (Encoder, error) {
+	if opts.Descriptor == "" || opts.Message == "" {
+		return nil, fmt.Errorf("the protobuf encoding needs -proto-descriptor and -proto-message")
+	}
+
+	data, err := os.ReadFile(opts.Descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", opts.Descriptor, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s (generate it with --include_imports): %w", opts.Descriptor, err)
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(opts.Message))
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found in %s", opts.Message, opts.Descriptor)
+	}
+	messageType, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", opts.Message)
+	}
+
+	return func(text []byte) ([]byte, error) {
+		message := dynamicpb.NewMessage(messageType)
+		if err := protojson.Unmarshal(text, message); err != nil {
+			return nil, fmt.Errorf("payload is not a valid %s: %w", opts.Message, err)
+		}
+		return proto.Marshal(message)
+	}, nil
+}
+
+// encodedPayload renders a payload and encodes the result
+type encodedPayload struct {
+	payload Payload
+	encode  Encoder
+}
+
+// encodePayload applies an encoder, if any, to the output of a payload
+func encodePayload(payload Payload, encode Encoder) Payload {
+	if encode == nil {
+		return payload
+	}
+	return encodedPayload{payload: payload, encode: encode}
+}
+
+func (p encodedPayload) Render(data TemplateData) ([]byte, error) {
+	text, err := p.payload.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	return p.encode(text)
+}
+
+// rawPayload publishes the same bytes, e.g. a binary frame read from a file, every time
+type rawPayload []byte
+
+func LoadRawPayload(path string) (Payload, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return rawPayload(data), nil
+}
+
+func (p rawPayload) Render(TemplateData) ([]byte, error) {
+	return p, nil
+}
+
+// maxPrintedPayload is the number of payload bytes shown per sent message
+const maxPrintedPayload = 256
+
+// formatPayload shows text payloads as they are and others as hex, shortening
+// long ones
+func formatPayload(data []byte) string {
+	if len(data) > maxPrintedPayload {
+		return fmt.Sprintf("%s... (%d bytes)", formatPayload(data[:maxPrintedPayload]), len(data))
+	}
+	if utf8.Valid(data) && !bytes.ContainsFunc(data, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r'
+	}) {
+		return string(data)
+	}
+	return "0x" + hex.EncodeToString(data)
+}
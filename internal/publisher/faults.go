@@ -0,0 +1,165 @@
+package publisher
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Faults replacing a message's payload, to exercise the monitor's error handling
+// and sanitization
+const (
+	FaultMalformedJSON = "malformed-json" // The payload cut off in the middle
+	FaultOversized     = "oversized"      // A JSON payload padded to -fault-size bytes
+	FaultInvalidUTF8   = "invalid-utf8"   // Invalid UTF-8 sequences mixed into the payload
+	FaultControlChars  = "control-chars"  // Terminal escape sequences and control characters
+)
+
+var faultKinds = []string{FaultMalformedJSON, FaultOversized, FaultInvalidUTF8, FaultControlChars}
+
+// FaultOptions configures fault injection
+type FaultOptions struct {
+	Kinds []string // Payload faults to choose from ("all" for every kind), none to disable
+	Rate  float64  // Fraction of messages replaced by a fault
+	Size  int      // Size of oversized payloads in bytes
+}
+
+// Validate checks the fault settings
+func (o FaultOptions) Validate() error {
+	for _, kind := range o.Kinds {
+		if kind != "all" && !slices.Contains(faultKinds, kind) {
+			return fmt.Errorf("unknown fault %q (expected all, %s)", kind, strings.Join(faultKinds, ", "))
+		}
+	}
+	if o.Rate < 0 || o.Rate > 1 {
+		return fmt.Errorf("-fault-rate must be between 0 and 1")
+	}
+	if o.Size < 1 {
+		return fmt.Errorf("-fault-size must be positive")
+	}
+	return nil
+}
+
+// faultPayload replaces some of the payloads it renders with faults
+type faultPayload struct {
+	payload Payload
+	opts    FaultOptions
+}
+
+// injectFaults wraps a payload when faults are enabled
+func injectFaults(payload Payload, opts FaultOptions) Payload {
+	if len(opts.Kinds) == 0 || opts.Rate == 0 {
+		return payload
+	}
+	if slices.Contains(opts.Kinds, "all") {
+		opts.Kinds = faultKinds
+	}
+	return faultPayload{payload: payload, opts: opts}
+}
+
+func (p faultPayload) Render(data TemplateData) ([]byte, error) {
+	payload, err := p.payload.Render(data)
+	if err != nil || rand.Float64() >= p.opts.Rate {
+		return payload, err
+	}
+
+	switch p.opts.Kinds[rand.Intn(len(p.opts.Kinds))] {
+	case FaultMalformedJSON:
+		if len(payload) < 2 {
+			return []byte(`{"value":`), nil
+		}
+		return payload[:1+rand.Intn(len(payload)-1)], nil
+	case FaultOversized:
+		prefix := fmt.Sprintf(`{"seq":%d,"padding":"`, data.Seq)
+		padding := max(p.opts.Size-len(prefix)-len(`"}`), 0)
+		return []byte(prefix + strings.Repeat("x", padding) + `"}`), nil
+	case FaultInvalidUTF8:
+		// A lone continuation byte, a truncated sequence and bytes never valid in UTF-8
+		at := rand.Intn(len(payload) + 1)
+		return bytes.Join([][]byte{payload[:at], {0x80, 0xe2, 0x82, 0xff, 0xfe}, payload[at:]}, nil), nil
+	default: // FaultControlChars
+		// Colors, cursor movement, a screen clear, a window title and a bell
+		at := rand.Intn(len(payload) + 1)
+		return bytes.Join([][]byte{payload[:at], []byte("\x1b[31mRED\x1b[0m\x1b[2J\x1b[H\x1b]0;pwned\x07\r\b\x00"), payload[at:]}, nil), nil
+	}
+}
+
+// errDropped is reported by connections closed by fault injection
+var errDropped = errors.New("connection dropped by fault injection")
+
+// connDropper opens the client's broker connections itself so they can be closed
+// without DISCONNECT, like a network failure. The broker then publishes the will
+// and the client reconnects on its own.
+type connDropper struct {
+	mu    sync.Mutex
+	conns []*droppableConn
+}
+
+// droppableConn replaces the error of a connection it closed, which the client
+// would otherwise take for its own close and not reconnect
+type droppableConn struct {
+	net.Conn
+	dropped atomic.Bool
+}
+
+func (c *droppableConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil && c.dropped.Load() {
+		err = errDropped
+	}
+	return n, err
+}
+
+func (c *droppableConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err != nil && c.dropped.Load() {
+		err = errDropped
+	}
+	return n, err
+}
+
+func (d *connDropper) open(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch uri.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", uri.Host)
+	case "ssl", "tls", "mqtts", "tcps":
+		conn, err = tls.DialWithDialer(dialer, "tcp", uri.Host, options.TLSConfig)
+	default:
+		return nil, fmt.Errorf("-fault-disconnect does not support %s:// brokers", uri.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	droppable := &droppableConn{Conn: conn}
+	d.mu.Lock()
+	d.conns = append(d.conns, droppable)
+	d.mu.Unlock()
+	return droppable, nil
+}
+
+// drop closes all connections opened so far
+func (d *connDropper) drop() {
+	d.mu.Lock()
+	conns := d.conns
+	d.conns = nil
+	d.mu.Unlock()
+	for _, conn := range conns {
+		conn.dropped.Store(true)
+		conn.Close()
+	}
+}
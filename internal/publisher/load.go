@@ -0,0 +1,164 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// loadReportInterval is how often progress is printed during a load test
+const loadReportInterval = time.Second
+
+// LoadOptions configures a load test
+type LoadOptions struct {
+	Rate     float64       // Messages per second over all clients
+	Clients  int           // Concurrent connections sharing the rate
+	Duration time.Duration // Length of the test, 0 to run until interrupted
+}
+
+// loadStats collects the outcome of publish calls from all clients
+type loadStats struct {
+	sent   atomic.Int64
+	errors atomic.Int64
+
+	mu        sync.Mutex
+	latencies []time.Duration // From Publish until the token completes (PUBACK/PUBCOMP for QoS 1/2)
+}
+
+func (s *loadStats) record(latency time.Duration, err error) {
+	if err != nil {
+		s.errors.Add(1)
+		return
+	}
+	s.sent.Add(1)
+	s.mu.Lock()
+	s.latencies = append(s.latencies, latency)
+	s.mu.Unlock()
+}
+
+// runLoad publishes at a fixed total rate from several connections and reports
+// throughput, errors and publish latency percentiles. Each client publishes the
+// stream's topic, with "+" levels replaced by the client's device name.
+func runLoad(ctx context.Context, opts *mqtt.ClientOptions, stream Stream, load LoadOptions) error {
+	if load.Clients < 1 {
+		return fmt.Errorf("-clients must be at least 1")
+	}
+	if load.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, load.Duration)
+		defer cancel()
+	}
+
+	fleet := expandFleet(stream, load.Clients)
+	clients := make([]mqtt.Client, load.Clients)
+	clientID := opts.ClientID
+	for i := range clients {
+		opts.SetClientID(fmt.Sprintf("%s-%d", clientID, i+1))
+		clients[i] = mqtt.NewClient(opts)
+		if token := clients[i].Connect(); token.Wait() && token.Error() != nil {
+			return fmt.Errorf("failed to connect client %d: %w", i+1, token.Error())
+		}
+		defer clients[i].Disconnect(250)
+	}
+
+	fmt.Printf("Load test: %g msg/s from %d clients, QoS %d", load.Rate, load.Clients, stream.QoS)
+	if load.Duration > 0 {
+		fmt.Printf(" for %v", load.Duration)
+	}
+	fmt.Println()
+
+	var (
+		stats   loadStats
+		wg      sync.WaitGroup
+		pending sync.WaitGroup
+	)
+	interval := time.Duration(float64(time.Second) * float64(load.Clients) / load.Rate)
+	start := time.Now()
+	for i, client := range clients {
+		s := fleet[min(i, len(fleet)-1)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Stagger the clients across one interval
+			next := start.Add(interval * time.Duration(i) / time.Duration(load.Clients))
+			for seq := 1; stream.Count == 0 || seq <= stream.Count; seq++ {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Until(next)):
+				}
+				next = next.Add(interval)
+
+				data, err := s.Payload.Render(TemplateData{Seq: seq, Topic: s.Topic, Device: s.Device, Time: time.Now()})
+				if err != nil {
+					stats.record(0, err)
+					continue
+				}
+				published := time.Now()
+				token := client.Publish(s.Topic, s.QoS, s.Retain, data)
+				pending.Add(1)
+				go func() {
+					defer pending.Done()
+					token.Wait()
+					stats.record(time.Since(published), token.Error())
+				}()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(loadReportInterval)
+	defer ticker.Stop()
+	var lastSent int64
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-ticker.C:
+			sent := stats.sent.Load()
+			fmt.Printf("%6s  %8.0f msg/s  %d sent  %d errors\n",
+				time.Since(start).Truncate(time.Second), float64(sent-lastSent)/loadReportInterval.Seconds(), sent, stats.errors.Load())
+			lastSent = sent
+		}
+	}
+	elapsed := time.Since(start)
+	pending.Wait()
+
+	fmt.Print(stats.report(elapsed))
+	return nil
+}
+
+// report summarizes the test
+func (s *loadStats) report(elapsed time.Duration) string {
+	s.mu.Lock()
+	latencies := slices.Clone(s.latencies)
+	s.mu.Unlock()
+	slices.Sort(latencies)
+
+	var b strings.Builder
+	sent := s.sent.Load()
+	fmt.Fprintf(&b, "\nSent %d messages in %v (%.1f msg/s), %d errors\n",
+		sent, elapsed.Round(time.Millisecond), float64(sent)/elapsed.Seconds(), s.errors.Load())
+	if len(latencies) > 0 {
+		fmt.Fprintf(&b, "Publish latency: p50 %v  p90 %v  p99 %v  max %v\n",
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1])
+	}
+	return b.String()
+}
+
+// percentile returns the p-th percentile of sorted durations (nearest rank)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(float64(len(sorted))*p/100+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)].Round(time.Microsecond)
+}
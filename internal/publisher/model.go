@@ -0,0 +1,214 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Value models of simulated sensor fields
+const (
+	ModelRandomWalk = "random_walk" // Drifts by up to step per message from start
+	ModelSine       = "sine"        // Oscillates around mean with amplitude over period
+	ModelStep       = "step"        // Holds each of values for every, then switches to the next
+	ModelConstant   = "constant"    // Always value
+)
+
+// FieldConfig is one [stream.fields.<name>] entry of a scenario
+type FieldConfig struct {
+	Model      string    `toml:"model"`       // random_walk, sine, step or constant
+	Start      float64   `toml:"start"`       // Initial value of a random walk
+	Step       float64   `toml:"step"`        // Largest change per message of a random walk
+	Mean       float64   `toml:"mean"`        // Center of a sine
+	Amplitude  float64   `toml:"amplitude"`   // Deviation of a sine from its mean
+	Period     string    `toml:"period"`      // Duration of one sine cycle
+	Values     []float64 `toml:"values"`      // Levels of a step model, repeated
+	Every      string    `toml:"every"`       // How long a step model holds each level
+	Value      float64   `toml:"value"`       // Value of a constant
+	Noise      float64   `toml:"noise"`       // Standard deviation of gaussian noise added to every value
+	Min        *float64  `toml:"min"`         // Lower bound of the value
+	Max        *float64  `toml:"max"`         // Upper bound of the value
+	Decimals   *int      `toml:"decimals"`    // Digits after the decimal point (default: 2)
+	StuckAfter string    `toml:"stuck_after"` // Simulate a stuck sensor: freeze the value this long after the start
+	StuckFor   string    `toml:"stuck_for"`   // How long the value stays frozen (default: until the end)
+}
+
+// FieldModel generates the values of one simulated field
+type FieldModel struct {
+	Kind       string
+	Start      float64
+	Step       float64
+	Mean       float64
+	Amplitude  float64
+	Period     time.Duration
+	Values     []float64
+	Every      time.Duration
+	Noise      float64
+	Min, Max   float64 // ±Inf when unbounded
+	Decimals   int
+	StuckAfter time.Duration // 0 for a healthy sensor
+	StuckFor   time.Duration // 0 to stay stuck
+}
+
+// NewFieldModel validates a scenario field and converts its durations
+func NewFieldModel(config FieldConfig) (FieldModel, error) {
+	model := FieldModel{
+		Kind:      config.Model,
+		Start:     config.Start,
+		Step:      config.Step,
+		Mean:      config.Mean,
+		Amplitude: config.Amplitude,
+		Values:    config.Values,
+		Noise:     config.Noise,
+		Min:       math.Inf(-1),
+		Max:       math.Inf(1),
+		Decimals:  2,
+	}
+	if config.Min != nil {
+		model.Min = *config.Min
+	}
+	if config.Max != nil {
+		model.Max = *config.Max
+	}
+	if model.Min > model.Max {
+		return model, fmt.Errorf("min is greater than max")
+	}
+	if config.Decimals != nil {
+		if *config.Decimals < 0 {
+			return model, fmt.Errorf("decimals must not be negative")
+		}
+		model.Decimals = *config.Decimals
+	}
+	if config.Noise < 0 {
+		return model, fmt.Errorf("noise must not be negative")
+	}
+
+	var err error
+	switch config.Model {
+	case ModelRandomWalk:
+		if config.Step < 0 {
+			return model, fmt.Errorf("step must not be negative")
+		}
+	case ModelSine:
+		if model.Period, err = parsePositiveDuration("period", config.Period); err != nil {
+			return model, err
+		}
+	case ModelStep:
+		if len(config.Values) == 0 {
+			return model, fmt.Errorf("the step model needs values")
+		}
+		if model.Every, err = parsePositiveDuration("every", config.Every); err != nil {
+			return model, err
+		}
+	case ModelConstant:
+		model.Start = config.Value
+	case "":
+		return model, fmt.Errorf("model is required")
+	default:
+		return model, fmt.Errorf("unknown model %q (expected %s, %s, %s or %s)",
+			config.Model, ModelRandomWalk, ModelSine, ModelStep, ModelConstant)
+	}
+
+	if config.StuckAfter != "" {
+		if model.StuckAfter, err = parsePositiveDuration("stuck_after", config.StuckAfter); err != nil {
+			return model, err
+		}
+	}
+	if config.StuckFor != "" {
+		if config.StuckAfter == "" {
+			return model, fmt.Errorf("stuck_for needs stuck_after")
+		}
+		if model.StuckFor, err = parsePositiveDuration("stuck_for", config.StuckFor); err != nil {
+			return model, err
+		}
+	}
+	return model, nil
+}
+
+func parsePositiveDuration(name, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return d, nil
+}
+
+// fieldGenerator produces the values of one field for one device
+type fieldGenerator struct {
+	model  FieldModel
+	walk   float64
+	stuck  bool
+	frozen float64
+}
+
+// Next returns the value at the given time since the stream started
+func (g *fieldGenerator) Next(elapsed time.Duration) float64 {
+	m := g.model
+	if m.StuckAfter > 0 && elapsed >= m.StuckAfter && (m.StuckFor == 0 || elapsed < m.StuckAfter+m.StuckFor) {
+		if !g.stuck {
+			g.stuck, g.frozen = true, g.next(elapsed)
+		}
+		return g.frozen
+	}
+	g.stuck = false
+	return g.next(elapsed)
+}
+
+func (g *fieldGenerator) next(elapsed time.Duration) float64 {
+	m := g.model
+	var v float64
+	switch m.Kind {
+	case ModelRandomWalk:
+		g.walk = min(max(g.walk+(rand.Float64()*2-1)*m.Step, m.Min), m.Max)
+		v = g.walk
+	case ModelSine:
+		v = m.Mean + m.Amplitude*math.Sin(2*math.Pi*elapsed.Seconds()/m.Period.Seconds())
+	case ModelStep:
+		v = m.Values[int(elapsed/m.Every)%len(m.Values)]
+	default:
+		v = m.Start
+	}
+	if m.Noise > 0 {
+		v += rand.NormFloat64() * m.Noise
+	}
+	v = min(max(v, m.Min), m.Max)
+	scale := math.Pow10(m.Decimals)
+	return math.Round(v*scale) / scale
+}
+
+// fieldValues generates the simulated fields of one device's messages
+type fieldValues map[string]*fieldGenerator
+
+func newFieldValues(models map[string]FieldModel) fieldValues {
+	values := make(fieldValues, len(models))
+	for name, model := range models {
+		values[name] = &fieldGenerator{model: model, walk: model.Start}
+	}
+	return values
+}
+
+// Next returns the values of all fields for the next message, nil without fields
+func (f fieldValues) Next(elapsed time.Duration) map[string]float64 {
+	if len(f) == 0 {
+		return nil
+	}
+	values := make(map[string]float64, len(f))
+	for name, g := range f {
+		values[name] = g.Next(elapsed)
+	}
+	return values
+}
+
+// fieldsPayload publishes the simulated fields of a stream without a template as
+// a JSON object with a timestamp, unless a field is named timestamp
+type fieldsPayload struct{}
+
+func (fieldsPayload) Render(data TemplateData) ([]byte, error) {
+	object := map[string]any{"timestamp": data.Time}
+	for name, value := range data.Fields {
+		object[name] = value
+	}
+	return json.Marshal(object) // Keys are sorted
+}
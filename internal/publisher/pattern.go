@@ -0,0 +1,76 @@
+package publisher
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Traffic patterns, shaping the gaps between the messages of a stream
+const (
+	PatternSteady  = "steady"  // One message every interval
+	PatternBurst   = "burst"   // Burst messages back to back every interval
+	PatternPoisson = "poisson" // Random arrivals averaging one per interval
+)
+
+// Pattern shapes when a stream publishes
+type Pattern struct {
+	Kind   string        // steady, burst or poisson
+	Burst  int           // Messages per burst for the burst pattern
+	Jitter time.Duration // Random offset of up to ± Jitter added to each gap
+}
+
+// Validate checks the pattern settings
+func (p Pattern) Validate() error {
+	switch p.Kind {
+	case "", PatternSteady, PatternPoisson:
+	case PatternBurst:
+		if p.Burst < 1 {
+			return fmt.Errorf("the burst pattern needs a burst size of at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown pattern %q (expected %s, %s or %s)", p.Kind, PatternSteady, PatternBurst, PatternPoisson)
+	}
+	if p.Jitter < 0 {
+		return fmt.Errorf("jitter must not be negative")
+	}
+	return nil
+}
+
+// Delay returns the gap after message seq (counting from 1) of a stream
+// publishing at the given interval
+func (p Pattern) Delay(interval time.Duration, seq int) time.Duration {
+	var delay time.Duration
+	switch p.Kind {
+	case PatternBurst:
+		if seq%p.Burst != 0 {
+			return 0 // Within a burst
+		}
+		delay = interval
+	case PatternPoisson:
+		delay = time.Duration(rand.ExpFloat64() * float64(interval))
+	default:
+		delay = interval
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(2*int64(p.Jitter)+1)) - p.Jitter
+	}
+	return max(delay, 0)
+}
+
+// String describes the pattern for the startup message
+func (p Pattern) String() string {
+	var s string
+	switch p.Kind {
+	case PatternBurst:
+		s = fmt.Sprintf("bursts of %d", p.Burst)
+	case PatternPoisson:
+		s = "Poisson arrivals"
+	default:
+		s = "steady"
+	}
+	if p.Jitter > 0 {
+		s += fmt.Sprintf(", ±%v jitter", p.Jitter)
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultTemplate produces the sensor reading published when no template is given
+const defaultTemplate = `{"temperature":{{randFloat 20 35}},"humidity":{{randFloat 30 70}},"timestamp":{{json .Time}},"sensor_id":"sensor_{{randInt 0 9 | printf "%02d"}}"}`
+
+// TemplateData is the dot of a payload template
+type TemplateData struct {
+	Seq    int                // Number of the message in its stream, starting at 1
+	Topic  string             // Topic the message is published to
+	Device string             // Fleet member the topic was generated for, if any
+	Time   time.Time          // Time the message is generated
+	Fields map[string]float64 // Values of the stream's simulated fields, e.g. {{.Fields.temperature}}
+}
+
+// Payload generates the payload of each message of a stream
+type Payload interface {
+	Render(data TemplateData) ([]byte, error)
+}
+
+// PayloadTemplate generates payloads from a Go template, so arbitrary shapes can
+// be produced without recompiling, e.g.
+//
+//	{"id":{{json uuid}},"seq":{{.Seq}},"temp":{{randFloat 18 25 | printf "%.1f"}},"mode":{{choice "eco" "boost" | json}}}
+type PayloadTemplate struct {
+	tmpl *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	// randInt returns a random integer in [min, max]
+	"randInt": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rand.Intn(max-min+1)
+	},
+	// randFloat returns a random number in [min, max)
+	"randFloat": func(min, max float64) float64 {
+		return min + rand.Float64()*(max-min)
+	},
+	// choice picks one of its arguments at random
+	"choice": func(items ...any) (any, error) {
+		if len(items) == 0 {
+			return nil, fmt.Errorf("choice needs at least one item")
+		}
+		return items[rand.Intn(len(items))], nil
+	},
+	// cycle picks its arguments in turn, e.g. {{cycle .Seq "on" "off"}}
+	"cycle": func(seq int, items ...any) (any, error) {
+		if len(items) == 0 {
+			return nil, fmt.Errorf("cycle needs at least one item")
+		}
+		return items[(seq-1+len(items))%len(items)], nil
+	},
+	"uuid": func() string {
+		return uuid.NewString()
+	},
+	"add": func(a, b int) int { return a + b },
+	"mul": func(a, b int) int { return a * b },
+	"unixMilli": func(t time.Time) int64 {
+		return t.UnixMilli()
+	},
+	// rfc3339 formats a time with nanoseconds, e.g. {{rfc3339 .Time}}
+	"rfc3339": func(t time.Time) string {
+		return t.Format(time.RFC3339Nano)
+	},
+	// json encodes a value, quoting and escaping strings
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func NewPayloadTemplate(text string) (*PayloadTemplate, error) {
+	tmpl, err := template.New("payload").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload template: %w", err)
+	}
+	return &PayloadTemplate{tmpl: tmpl}, nil
+}
+
+// LoadPayloadTemplate reads a template from a file
+func LoadPayloadTemplate(path string) (*PayloadTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewPayloadTemplate(string(bytes.TrimRight(data, "\r\n")))
+}
+
+// Render generates the payload of one message
+func (p *PayloadTemplate) Render(data TemplateData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,158 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// ProbeOptions configures the round-trip latency mode
+type ProbeOptions struct {
+	Topic    string        // Topic probes are published to
+	Mirror   string        // Topic probes come back on, e.g. through a bridge (default: Topic)
+	Interval time.Duration // Time between probes
+	Count    int           // Number of probes, 0 to run until interrupted
+	Timeout  time.Duration // A probe not received within this time is lost
+	QoS      byte
+}
+
+// probePayload identifies a probe when it comes back
+type probePayload struct {
+	Probe  string `json:"probe"` // Run identifier, so probes of other runs are ignored
+	Seq    int    `json:"seq"`
+	SentAt int64  `json:"sent_at"` // Unix nanoseconds
+}
+
+// runProbe publishes probes, receives them through a subscription and reports the
+// end-to-end latency through the broker. It fails when probes were lost, so it can
+// serve as a health check.
+func runProbe(ctx context.Context, client mqtt.Client, opts ProbeOptions) error {
+	if opts.Mirror == "" {
+		opts.Mirror = opts.Topic
+	}
+	if strings.ContainsAny(opts.Topic, "+#") {
+		return fmt.Errorf("probe topic must not contain wildcards")
+	}
+	run := fmt.Sprintf("%x", time.Now().UnixNano())
+
+	var (
+		mu        sync.Mutex
+		pending   = make(map[int]time.Time)
+		latencies []time.Duration
+	)
+	received := make(chan struct{}, 1)
+	handler := func(_ mqtt.Client, msg mqtt.Message) {
+		now := time.Now()
+		var probe probePayload
+		if err := json.Unmarshal(msg.Payload(), &probe); err != nil || probe.Probe != run {
+			return
+		}
+		mu.Lock()
+		sentAt, ok := pending[probe.Seq]
+		delete(pending, probe.Seq)
+		mu.Unlock()
+		if !ok {
+			return // Duplicate or already counted as lost
+		}
+		latency := now.Sub(sentAt)
+		fmt.Printf("Probe %d: %v\n", probe.Seq, latency.Round(time.Microsecond))
+		mu.Lock()
+		latencies = append(latencies, latency)
+		mu.Unlock()
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	}
+
+	if token := client.Subscribe(opts.Mirror, opts.QoS, handler); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", opts.Mirror, token.Error())
+	}
+	defer client.Unsubscribe(opts.Mirror)
+
+	fmt.Printf("Probing %s", opts.Topic)
+	if opts.Mirror != opts.Topic {
+		fmt.Printf(" via %s", opts.Mirror)
+	}
+	fmt.Printf(" every %v\n", opts.Interval)
+
+	lost := 0
+	expire := func(now time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		for seq, sentAt := range pending {
+			if now.Sub(sentAt) > opts.Timeout {
+				fmt.Printf("Probe %d: lost\n", seq)
+				delete(pending, seq)
+				lost++
+			}
+		}
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	sent := 0
+probing:
+	for opts.Count == 0 || sent < opts.Count {
+		sent++
+		sentAt := time.Now()
+		data, _ := json.Marshal(probePayload{Probe: run, Seq: sent, SentAt: sentAt.UnixNano()})
+		mu.Lock()
+		pending[sent] = sentAt
+		mu.Unlock()
+		if token := client.Publish(opts.Topic, opts.QoS, false, data); token.Wait() && token.Error() != nil {
+			fmt.Printf("Probe %d: publish failed: %v\n", sent, token.Error())
+		}
+
+		expire(time.Now())
+		if sent == opts.Count {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break probing
+		case <-ticker.C:
+		}
+	}
+
+	// Wait for the outstanding probes
+	deadline := time.NewTimer(opts.Timeout)
+	defer deadline.Stop()
+waiting:
+	for {
+		mu.Lock()
+		outstanding := len(pending)
+		mu.Unlock()
+		if outstanding == 0 {
+			break
+		}
+		select {
+		case <-received:
+		case <-deadline.C:
+			break waiting
+		case <-ctx.Done():
+			break waiting
+		}
+	}
+	mu.Lock()
+	lost += len(pending)
+	slices.Sort(latencies)
+	mu.Unlock()
+
+	fmt.Printf("\n%d probes sent, %d received, %d lost\n", sent, len(latencies), lost)
+	if len(latencies) > 0 {
+		fmt.Printf("Round trip: min %v  p50 %v  p90 %v  p99 %v  max %v\n",
+			latencies[0].Round(time.Microsecond), percentile(latencies, 50), percentile(latencies, 90),
+			percentile(latencies, 99), latencies[len(latencies)-1].Round(time.Microsecond))
+	}
+	if lost > 0 {
+		return fmt.Errorf("%d of %d probes lost", lost, sent)
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+// Package publisher generates MQTT test traffic for trying out and load testing
+// the monitor. It is the publish command of mqtt-monitor and the standalone
+// test-publisher.
+package publisher
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/cli"
+)
+
+// Run publishes test traffic as configured by the command line args. name is
+// the command name shown in the usage message.
+func Run(name string, args []string) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	var connection cli.ConnectionFlags
+	connection.Conn.Server = "tcp://localhost:1883"
+	connection.Register(flags, "MQTT broker URL")
+	topic := flags.String("topic", "sensors/test/data", "MQTT topic to publish to")
+	interval := flags.Duration("interval", 2*time.Second, "Publishing interval")
+	var pattern Pattern
+	flags.StringVar(&pattern.Kind, "pattern", PatternSteady, "Traffic pattern: steady, burst (-burst messages back to back every -interval) or poisson (random arrivals averaging one per -interval)")
+	flags.IntVar(&pattern.Burst, "burst", 10, "Messages per burst for -pattern burst")
+	flags.DurationVar(&pattern.Jitter, "jitter", 0, "Random offset of up to ± this duration added to each gap between messages")
+	count := flags.Int("count", 0, "Number of messages to send (0 for infinite)")
+	qos := flags.Uint("qos", 0, "QoS level of published messages (0, 1 or 2)")
+	retain := flags.Bool("retain", false, "Set the retain flag on published messages")
+	clientID := flags.String("client-id", "mqtt-test-publisher", "MQTT client ID")
+	cleanSession := flags.Bool("clean-session", true, "Start a clean session; with false the broker keeps the session of -client-id across connections")
+	willTopic := flags.String("will-topic", "", "Topic of the last will message the broker publishes when the connection is lost")
+	willPayload := flags.String("will-payload", "offline", "Payload of the last will message")
+	willQoS := flags.Uint("will-qos", 0, "QoS level of the last will message")
+	willRetain := flags.Bool("will-retain", false, "Set the retain flag on the last will message")
+	noDisconnect := flags.Bool("no-disconnect", false, "Drop the connection without DISCONNECT on exit, so the broker publishes the last will")
+	templateText := flags.String("template", "", "Go template for the payload (default: a random sensor reading)")
+	templateFile := flags.String("template-file", "", "File containing the payload template")
+	payloadFile := flags.String("payload-file", "", "Publish the bytes of this file, e.g. a binary frame, as every payload")
+	encoding := flags.String("encoding", EncodingText, "How the template output becomes the payload: text, hex, base64 or protobuf")
+	var protoOpts ProtoOptions
+	flags.StringVar(&protoOpts.Descriptor, "proto-descriptor", "", "FileDescriptorSet for -encoding protobuf (protoc --include_imports --descriptor_set_out)")
+	flags.StringVar(&protoOpts.Message, "proto-message", "", "Fully qualified message type for -encoding protobuf, e.g. telemetry.v1.Reading")
+	var topics stringList
+	flags.Var(&topics, "topics", "Publish to several topics concurrently: topic[:interval[:count]], comma separated or repeated, e.g. sensors/+/data:500ms:∞")
+	devices := flags.Int("devices", 10, "Number of devices substituted for \"+\" levels in -topics and scenario topics")
+	scenarioFile := flags.String("scenario", "", "TOML file with [[stream]] entries to publish concurrently")
+	csvFile := flags.String("csv", "", "Publish the rows of a CSV file (delay or offset, topic, payload, qos, retain) in order")
+	replayFile := flags.String("replay", "", "Publish the messages of a monitor session log (jsonl or binary) with their original timing")
+	var replay ReplayOptions
+	flags.Float64Var(&replay.Speed, "speed", 1, "Playback speed factor for -replay and -csv (0 publishes without delays)")
+	flags.StringVar(&replay.TopicPrefix, "topic-prefix", "", "Prefix added to every topic published by -replay")
+	flags.StringVar(&replay.Source, "source", "", "Only replay messages recorded from this connection")
+	var load LoadOptions
+	flags.Float64Var(&load.Rate, "rate", 0, "Load test: total messages per second, reporting throughput and latency (-count is per client)")
+	flags.IntVar(&load.Clients, "clients", 1, "Load test: number of concurrent connections")
+	flags.DurationVar(&load.Duration, "duration", 0, "Load test: length of the test (0 runs until interrupted)")
+	var faults FaultOptions
+	flags.Var((*stringList)(&faults.Kinds), "faults", "Replace some payloads by faults: malformed-json, oversized, invalid-utf8, control-chars or all")
+	flags.Float64Var(&faults.Rate, "fault-rate", 0.1, "Fraction of messages replaced by a fault with -faults")
+	flags.IntVar(&faults.Size, "fault-size", 1<<20, "Size in bytes of oversized fault payloads")
+	faultDisconnect := flags.Duration("fault-disconnect", 0, "Drop the broker connection without DISCONNECT this often and let the client reconnect")
+	sparkplug := flags.Bool("sparkplug", false, "Simulate a Sparkplug B edge node with -devices devices publishing DDATA every -interval")
+	var sparkplugOpts SparkplugOptions
+	flags.StringVar(&sparkplugOpts.Group, "sparkplug-group", "test", "Sparkplug group ID")
+	flags.StringVar(&sparkplugOpts.Node, "sparkplug-node", "edge01", "Sparkplug edge node ID")
+	probe := flags.Bool("probe", false, "Measure round-trip latency through the broker by publishing probes every -interval and subscribing to them")
+	var probeOpts ProbeOptions
+	flags.StringVar(&probeOpts.Topic, "probe-topic", "", "Topic for -probe (default: mqtt-test-publisher/probe/<client-id>)")
+	flags.StringVar(&probeOpts.Mirror, "mirror-topic", "", "Receive -probe messages on this topic instead, e.g. where a bridge mirrors the probe topic")
+	flags.DurationVar(&probeOpts.Timeout, "probe-timeout", 5*time.Second, "Count a probe as lost when it is not received within this time")
+	flags.Parse(args)
+
+	// Only one way of publishing at a time
+	var modes []string
+	for _, mode := range []struct {
+		flag string
+		set  bool
+	}{
+		{"-topics", len(topics) > 0},
+		{"-scenario", *scenarioFile != ""},
+		{"-csv", *csvFile != ""},
+		{"-replay", *replayFile != ""},
+		{"-rate", load.Rate > 0},
+		{"-probe", *probe},
+		{"-sparkplug", *sparkplug},
+	} {
+		if mode.set {
+			modes = append(modes, mode.flag)
+		}
+	}
+	if n := len(modes); n > 1 {
+		return fmt.Errorf("%s and %s cannot be combined", strings.Join(modes[:n-1], ", "), modes[n-1])
+	}
+	if load.Rate < 0 {
+		return errors.New("-rate must not be negative")
+	}
+	if err := pattern.Validate(); err != nil {
+		return err
+	}
+	if load.Rate > 0 && (pattern.Kind != PatternSteady || pattern.Jitter > 0) {
+		return errors.New("-pattern and -jitter do not apply to -rate")
+	}
+	if err := faults.Validate(); err != nil {
+		return err
+	}
+	if *sparkplug && *willTopic != "" {
+		return errors.New("-sparkplug sets NDEATH as the last will; -will-topic does not apply")
+	}
+	if len(faults.Kinds) > 0 && (*csvFile != "" || *replayFile != "" || *probe || *sparkplug) {
+		return errors.New("-faults does not apply to -csv, -replay, -probe or -sparkplug")
+	}
+	if replay.Speed < 0 {
+		return errors.New("-speed must not be negative")
+	}
+	if *qos > 2 || *willQoS > 2 {
+		return errors.New("QoS must be 0, 1 or 2")
+	}
+
+	// CSV payloads are encoded as they are read
+	payloadEncoding := *encoding
+	if *csvFile != "" {
+		payloadEncoding = EncodingText
+	}
+	payload, err := loadPayload(*templateText, *templateFile, *payloadFile, payloadEncoding, protoOpts)
+	if err != nil {
+		return err
+	}
+
+	defaults := Stream{Topic: *topic, Interval: *interval, Pattern: pattern, Count: *count, QoS: byte(*qos), Retain: *retain, Payload: payload}
+	streams, err := buildStreams(defaults, topics, *scenarioFile, *devices, protoOpts)
+	if err != nil {
+		return err
+	}
+	var csvRows []CSVRow
+	if *csvFile != "" {
+		encode, err := NewEncoder(*encoding, protoOpts)
+		if err != nil {
+			return err
+		}
+		if csvRows, err = LoadCSV(*csvFile, defaults, encode); err != nil {
+			return err
+		}
+	}
+	defaults.Payload = injectFaults(defaults.Payload, faults)
+	for i := range streams {
+		streams[i].Payload = injectFaults(streams[i].Payload, faults)
+	}
+
+	conn, err := connection.Connection()
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := conn.GetTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(conn.Server)
+	opts.SetUsername(conn.User)
+	opts.SetPassword(conn.Password)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	opts.SetClientID(*clientID)
+	opts.SetCleanSession(*cleanSession)
+	if *willTopic != "" {
+		opts.SetWill(*willTopic, *willPayload, byte(*willQoS), *willRetain)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *faultDisconnect > 0 {
+		var dropper connDropper
+		opts.SetCustomOpenConnectionFn(dropper.open)
+		opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			fmt.Printf("Connection lost: %v\n", err)
+		})
+		opts.SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+			fmt.Println("Reconnecting")
+		})
+		go func() {
+			ticker := time.NewTicker(*faultDisconnect)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					fmt.Println("Dropping the connection (fault injection)")
+					dropper.drop()
+				}
+			}
+		}()
+	}
+
+	// Set up after fault injection so the node's reconnect handler, which renews
+	// the will, is the one registered
+	var node *sparkplugNode
+	if *sparkplug {
+		sparkplugOpts.Devices, sparkplugOpts.Interval, sparkplugOpts.Count = *devices, *interval, *count
+		if node, err = newSparkplugNode(sparkplugOpts); err != nil {
+			return err
+		}
+		node.Configure(opts)
+	}
+
+	if load.Rate > 0 {
+		return runLoad(ctx, opts, defaults, load)
+	}
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to connect: %w", token.Error())
+	}
+	if *noDisconnect {
+		// Exiting closes the socket without DISCONNECT, which the broker treats as
+		// a lost connection
+		defer fmt.Println("Dropping the connection without DISCONNECT")
+	} else {
+		defer client.Disconnect(250)
+	}
+
+	if node != nil {
+		fmt.Printf("Simulating Sparkplug B edge node %s/%s with %d devices on %s\n", sparkplugOpts.Group, sparkplugOpts.Node, len(node.devices), conn.Server)
+		node.Run(ctx, client, !*noDisconnect)
+		return nil
+	}
+
+	if *probe {
+		if probeOpts.Topic == "" {
+			probeOpts.Topic = "mqtt-test-publisher/probe/" + *clientID
+		}
+		probeOpts.Interval, probeOpts.Count, probeOpts.QoS = *interval, *count, byte(*qos)
+		return runProbe(ctx, client, probeOpts)
+	}
+
+	if csvRows != nil {
+		fmt.Printf("Publishing %d rows of %s to %s\n", len(csvRows), *csvFile, conn.Server)
+		fmt.Printf("Published %d messages\n", runCSV(ctx, client, csvRows, replay.Speed))
+		return nil
+	}
+
+	if *replayFile != "" {
+		if replay.Speed > 0 {
+			fmt.Printf("Replaying %s to %s at %gx\n", *replayFile, conn.Server, replay.Speed)
+		} else {
+			fmt.Printf("Replaying %s to %s without delays\n", *replayFile, conn.Server)
+		}
+		published, err := runReplay(ctx, client, *replayFile, replay)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Published %d messages\n", published)
+		return nil
+	}
+
+	if len(streams) == 1 {
+		fmt.Printf("Publishing to %s on topic %s every %v (%v)\n", conn.Server, streams[0].Topic, streams[0].Interval, streams[0].Pattern)
+	} else {
+		fmt.Printf("Publishing to %s on %d topics\n", conn.Server, len(streams))
+	}
+	fmt.Println("Press Ctrl+C to stop")
+
+	var (
+		sent atomic.Int64
+		wg   sync.WaitGroup
+	)
+	for _, stream := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream.Run(ctx, client, &sent)
+		}()
+	}
+	wg.Wait()
+
+	fmt.Printf("Published %d messages\n", sent.Load())
+	return nil
+}
+
+// buildStreams returns the streams of the scenario file or -topics, or a single
+// stream from -topic
+func buildStreams(defaults Stream, topics []string, scenarioFile string, devices int, proto ProtoOptions) ([]Stream, error) {
+	if scenarioFile != "" {
+		if len(topics) > 0 {
+			return nil, fmt.Errorf("-scenario and -topics are mutually exclusive")
+		}
+		return LoadScenario(scenarioFile, defaults, devices, proto)
+	}
+	if len(topics) == 0 {
+		return []Stream{defaults}, nil
+	}
+
+	var streams []Stream
+	for _, spec := range topics {
+		stream, err := parseStreamSpec(spec, defaults)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, expandFleet(stream, devices)...)
+	}
+	return streams, nil
+}
+
+// stringList collects a flag given several times or as a comma separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// loadPayload returns the raw payload file, or the template given inline or in a
+// file (or the default one) with the encoding applied
+func loadPayload(text, templateFile, payloadFile, encoding string, proto ProtoOptions) (Payload, error) {
+	given := 0
+	for _, v := range []string{text, templateFile, payloadFile} {
+		if v != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return nil, fmt.Errorf("-template, -template-file and -payload-file are mutually exclusive")
+	}
+	if payloadFile != "" {
+		if encoding != EncodingText {
+			return nil, fmt.Errorf("-encoding does not apply to -payload-file")
+		}
+		return LoadRawPayload(payloadFile)
+	}
+
+	encode, err := NewEncoder(encoding, proto)
+	if err != nil {
+		return nil, err
+	}
+	if encode != nil && text == "" && templateFile == "" {
+		return nil, fmt.Errorf("-encoding %s needs -template or -template-file", encoding)
+	}
+
+	var payload *PayloadTemplate
+	switch {
+	case templateFile != "":
+		payload, err = LoadPayloadTemplate(templateFile)
+	case text != "":
+		payload, err = NewPayloadTemplate(text)
+	default:
+		payload, err = NewPayloadTemplate(defaultTemplate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return encodePayload(payload, encode), nil
+}
@@ -0,0 +1,67 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+)
+
+// ReplayOptions controls how a recorded session is published
+type ReplayOptions struct {
+	Speed       float64 // Playback speed factor (2 = twice as fast, 0 = no delays)
+	TopicPrefix string  // Prepended to every recorded topic
+	Source      string  // Only replay messages recorded from this connection
+}
+
+// runReplay publishes the messages of a structured session log written by the
+// monitor, keeping their original relative timing scaled by the speed factor.
+// It returns the number of messages published.
+func runReplay(ctx context.Context, client mqtt.Client, path string, opts ReplayOptions) (int, error) {
+	records, err := sessionlog.Read(path)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	var previous time.Time
+	for _, record := range records {
+		if record.Type != sessionlog.TypeMessage || (opts.Source != "" && record.Source != opts.Source) {
+			continue
+		}
+
+		if !previous.IsZero() && opts.Speed > 0 {
+			delay := time.Duration(float64(record.Timestamp.Sub(previous)) / opts.Speed)
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					return published, nil
+				case <-time.After(delay):
+				}
+			}
+		} else if ctx.Err() != nil {
+			return published, nil
+		}
+		previous = record.Timestamp
+
+		payload := record.RawPayload
+		if payload == nil {
+			payload = []byte(record.Payload)
+		}
+
+		topic := opts.TopicPrefix + record.Topic
+		token := client.Publish(topic, record.QoS, record.Retained, payload)
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Failed to publish to %s: %v", topic, token.Error())
+			continue
+		}
+		published++
+		fmt.Printf("Sent message %d to %s: %s\n", published, topic, formatPayload(payload))
+	}
+
+	return published, nil
+}
@@ -0,0 +1,133 @@
+package publisher
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Scenario describes a set of concurrent streams in a TOML file
+type Scenario struct {
+	Streams []StreamConfig `toml:"stream"`
+}
+
+// StreamConfig is one [[stream]] entry of a scenario
+type StreamConfig struct {
+	Topic        string `toml:"topic"`         // Topic to publish to; each "+" level is replaced by a device name
+	Devices      int    `toml:"devices"`       // Number of devices substituted for "+" (default: -devices)
+	Interval     string `toml:"interval"`      // Time between messages (default: -interval)
+	Pattern      string `toml:"pattern"`       // Traffic pattern: steady, burst or poisson (default: -pattern)
+	Burst        int    `toml:"burst"`         // Messages per burst for the burst pattern (default: -burst)
+	Jitter       string `toml:"jitter"`        // Random offset of up to ± this duration per gap (default: -jitter)
+	Count        int    `toml:"count"`         // Messages per device, 0 for infinite (default: -count)
+	QoS          *int   `toml:"qos"`           // QoS level (default: -qos)
+	Retain       *bool  `toml:"retain"`        // Set the retain flag (default: -retain)
+	Template     string `toml:"template"`      // Payload template (default: a random sensor reading)
+	TemplateFile string `toml:"template_file"` // File containing the payload template, relative to the scenario
+	PayloadFile  string `toml:"payload_file"`  // File whose bytes are published as is, relative to the scenario
+	Encoding     string `toml:"encoding"`      // How the template output becomes the payload (default: "text")
+	ProtoMessage string `toml:"proto_message"` // Message type for the protobuf encoding (default: -proto-message)
+
+	Fields map[string]FieldConfig `toml:"fields"` // Simulated sensor values, available to the template as .Fields.<name>
+}
+
+// LoadScenario reads a scenario file and builds its streams. Settings an entry
+// leaves out are taken from defaults and the -devices and -proto-* flags.
+func LoadScenario(path string, defaults Stream, devices int, proto ProtoOptions) ([]Stream, error) {
+	var scenario Scenario
+	if _, err := toml.DecodeFile(path, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	if len(scenario.Streams) == 0 {
+		return nil, fmt.Errorf("scenario %s has no [[stream]] entries", path)
+	}
+
+	var (
+		streams []Stream
+		err     error
+	)
+	for i, entry := range scenario.Streams {
+		stream := defaults
+		stream.Topic = entry.Topic
+		if stream.Topic == "" {
+			return nil, fmt.Errorf("stream %d: topic is required", i+1)
+		}
+		if entry.Interval != "" {
+			interval, err := time.ParseDuration(entry.Interval)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("stream %s: invalid interval %q", entry.Topic, entry.Interval)
+			}
+			stream.Interval = interval
+		}
+		if entry.Pattern != "" {
+			stream.Pattern.Kind = entry.Pattern
+		}
+		if entry.Burst != 0 {
+			stream.Pattern.Burst = entry.Burst
+		}
+		if entry.Jitter != "" {
+			if stream.Pattern.Jitter, err = time.ParseDuration(entry.Jitter); err != nil {
+				return nil, fmt.Errorf("stream %s: invalid jitter %q", entry.Topic, entry.Jitter)
+			}
+		}
+		if err := stream.Pattern.Validate(); err != nil {
+			return nil, fmt.Errorf("stream %s: %w", entry.Topic, err)
+		}
+		if entry.Count < 0 {
+			return nil, fmt.Errorf("stream %s: invalid count %d", entry.Topic, entry.Count)
+		}
+		if entry.Count > 0 {
+			stream.Count = entry.Count
+		}
+		if entry.QoS != nil {
+			if *entry.QoS < 0 || *entry.QoS > 2 {
+				return nil, fmt.Errorf("stream %s: invalid qos %d", entry.Topic, *entry.QoS)
+			}
+			stream.QoS = byte(*entry.QoS)
+		}
+		if entry.Retain != nil {
+			stream.Retain = *entry.Retain
+		}
+
+		if entry.Template != "" || entry.TemplateFile != "" || entry.PayloadFile != "" {
+			if entry.ProtoMessage != "" {
+				proto.Message = entry.ProtoMessage
+			}
+			stream.Payload, err = loadPayload(entry.Template, relativeTo(path, entry.TemplateFile),
+				relativeTo(path, entry.PayloadFile), cmp.Or(entry.Encoding, EncodingText), proto)
+			if err != nil {
+				return nil, fmt.Errorf("stream %s: %w", entry.Topic, err)
+			}
+		} else if entry.Encoding != "" {
+			return nil, fmt.Errorf("stream %s: encoding needs template or template_file", entry.Topic)
+		} else if len(entry.Fields) > 0 {
+			stream.Payload = fieldsPayload{}
+		}
+		if len(entry.Fields) > 0 {
+			stream.Fields = make(map[string]FieldModel, len(entry.Fields))
+			for name, config := range entry.Fields {
+				if stream.Fields[name], err = NewFieldModel(config); err != nil {
+					return nil, fmt.Errorf("stream %s: field %s: %w", entry.Topic, name, err)
+				}
+			}
+		}
+
+		n := devices
+		if entry.Devices > 0 {
+			n = entry.Devices
+		}
+		streams = append(streams, expandFleet(stream, n)...)
+	}
+	return streams, nil
+}
+
+// relativeTo resolves a file named in a scenario relative to the scenario's directory
+func relativeTo(scenario, file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(filepath.Dir(scenario), file)
+}
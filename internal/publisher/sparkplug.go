@@ -0,0 +1,327 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// sparkplugNamespace is the first topic level of Sparkplug B messages
+const sparkplugNamespace = "spBv1.0"
+
+// rebirthMetric is the node control metric a host application sets to request births
+const rebirthMetric = "Node Control/Rebirth"
+
+// Sparkplug B metric data types used by the simulator
+const (
+	sparkplugInt64   = 4
+	sparkplugDouble  = 10
+	sparkplugBoolean = 11
+)
+
+// SparkplugOptions configures the Sparkplug B edge node simulator
+type SparkplugOptions struct {
+	Group    string        // Group ID
+	Node     string        // Edge node ID
+	Devices  int           // Devices attached to the node
+	Interval time.Duration // Time between DDATA messages of each device
+	Count    int           // DDATA messages per device, 0 to run until interrupted
+}
+
+// sparkplugMetric is a metric of a Sparkplug B payload
+type sparkplugMetric struct {
+	Name  string
+	Value any // float64, bool or int64
+}
+
+// sparkplugDevice simulates the metrics of one device
+type sparkplugDevice struct {
+	id          string
+	temperature fieldGenerator
+	pressure    fieldGenerator
+	running     bool
+	cycles      int64
+}
+
+func newSparkplugDevice(id string) *sparkplugDevice {
+	return &sparkplugDevice{
+		id: id,
+		temperature: fieldGenerator{
+			model: FieldModel{Kind: ModelRandomWalk, Step: 0.3, Min: 10, Max: 40, Decimals: 2},
+			walk:  18 + rand.Float64()*6,
+		},
+		pressure: fieldGenerator{
+			model: FieldModel{Kind: ModelSine, Mean: 1013, Amplitude: 5, Period: 5 * time.Minute, Noise: 0.2, Min: math.Inf(-1), Max: math.Inf(1), Decimals: 2},
+		},
+		running: true,
+	}
+}
+
+// metrics advances the simulation and returns the device's metrics
+func (d *sparkplugDevice) metrics(elapsed time.Duration) []sparkplugMetric {
+	if rand.Float64() < 0.05 {
+		d.running = !d.running
+	}
+	if d.running {
+		d.cycles++
+	}
+	return []sparkplugMetric{
+		{Name: "Temperature", Value: d.temperature.Next(elapsed)},
+		{Name: "Pressure", Value: d.pressure.Next(elapsed)},
+		{Name: "Running", Value: d.running},
+		{Name: "Cycle Count", Value: d.cycles},
+	}
+}
+
+// sparkplugNode simulates a Sparkplug B edge node: NDEATH as the will, NBIRTH and
+// DBIRTH on every connection and on rebirth requests, periodic DDATA, and DDEATH
+// and NDEATH on exit
+type sparkplugNode struct {
+	opts    SparkplugOptions
+	start   time.Time
+	devices []*sparkplugDevice
+
+	mu    sync.Mutex // Guards the sequence numbers and device state
+	bdSeq int64      // Birth/death sequence, incremented for every connection
+	seq   uint64     // Message sequence, 0-255, reset by NBIRTH
+}
+
+func newSparkplugNode(opts SparkplugOptions) (*sparkplugNode, error) {
+	for _, id := range []string{opts.Group, opts.Node} {
+		if id == "" || strings.ContainsAny(id, "/+#") {
+			return nil, fmt.Errorf("invalid Sparkplug ID %q: must be non-empty without /, + or #", id)
+		}
+	}
+	if opts.Interval <= 0 {
+		return nil, fmt.Errorf("-interval must be positive")
+	}
+
+	n := &sparkplugNode{opts: opts, start: time.Now()}
+	width := len(fmt.Sprint(opts.Devices))
+	for i := 1; i <= opts.Devices; i++ {
+		n.devices = append(n.devices, newSparkplugDevice(fmt.Sprintf("device%0*d", width, i)))
+	}
+	return n, nil
+}
+
+func (n *sparkplugNode) topic(messageType, device string) string {
+	topic := strings.Join([]string{sparkplugNamespace, n.opts.Group, messageType, n.opts.Node}, "/")
+	if device != "" {
+		topic += "/" + device
+	}
+	return topic
+}
+
+// Configure registers NDEATH as the will and the handlers publishing births on
+// every (re)connection
+func (n *sparkplugNode) Configure(opts *mqtt.ClientOptions) {
+	opts.SetBinaryWill(n.topic("NDEATH", ""), n.death(), 1, false)
+	opts.SetOnConnectHandler(n.onConnect)
+	opts.SetReconnectingHandler(func(_ mqtt.Client, opts *mqtt.ClientOptions) {
+		// A new connection gets a new bdSeq, and the will has to match its NBIRTH
+		n.mu.Lock()
+		n.bdSeq++
+		fmt.Printf("Reconnecting with bdSeq %d\n", n.bdSeq)
+		n.mu.Unlock()
+		opts.SetBinaryWill(n.topic("NDEATH", ""), n.death(), 1, false)
+	})
+}
+
+// death returns the NDEATH payload for the current connection
+func (n *sparkplugNode) death() []byte {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return encodeSparkplugPayload(time.Now(), nil, []sparkplugMetric{{Name: "bdSeq", Value: n.bdSeq}})
+}
+
+func (n *sparkplugNode) onConnect(client mqtt.Client) {
+	cmd := n.topic("NCMD", "")
+	token := client.Subscribe(cmd, 1, func(client mqtt.Client, msg mqtt.Message) {
+		if isRebirthRequest(msg.Payload()) {
+			fmt.Println("Rebirth requested")
+			go n.publishBirths(client) // Not blocking the client's message handling
+		}
+	})
+	if token.Wait() && token.Error() != nil {
+		fmt.Printf("Failed to subscribe to %s: %v\n", cmd, token.Error())
+	}
+	n.publishBirths(client)
+}
+
+// publishBirths publishes NBIRTH and the DBIRTH of every device
+func (n *sparkplugNode) publishBirths(client mqtt.Client) {
+	n.mu.Lock()
+	n.seq = 0
+	nodeMetrics := []sparkplugMetric{{Name: "bdSeq", Value: n.bdSeq}, {Name: rebirthMetric, Value: false}}
+	n.mu.Unlock()
+	n.publish(client, "NBIRTH", "", nodeMetrics)
+
+	for _, device := range n.devices {
+		n.mu.Lock()
+		metrics := device.metrics(time.Since(n.start))
+		n.mu.Unlock()
+		n.publish(client, "DBIRTH", device.id, metrics)
+	}
+}
+
+// publish sends a message with the next sequence number
+func (n *sparkplugNode) publish(client mqtt.Client, messageType, device string, metrics []sparkplugMetric) {
+	n.mu.Lock()
+	seq := n.seq
+	n.seq = (n.seq + 1) % 256
+	n.mu.Unlock()
+
+	topic := n.topic(messageType, device)
+	token := client.Publish(topic, 0, false, encodeSparkplugPayload(time.Now(), &seq, metrics))
+	if token.Wait() && token.Error() != nil {
+		fmt.Printf("Failed to publish to %s: %v\n", topic, token.Error())
+		return
+	}
+	if len(metrics) == 0 {
+		fmt.Printf("Sent %s seq %d to %s\n", messageType, seq, topic)
+		return
+	}
+	fmt.Printf("Sent %s seq %d to %s: %s\n", messageType, seq, topic, formatMetrics(metrics))
+}
+
+// Run publishes DDATA until the count is reached or ctx is cancelled. With
+// explicitDeath it then publishes DDEATH and NDEATH, as an edge node going
+// offline on purpose does; without, the broker publishes the will.
+func (n *sparkplugNode) Run(ctx context.Context, client mqtt.Client, explicitDeath bool) {
+	ticker := time.NewTicker(n.opts.Interval)
+	defer ticker.Stop()
+
+publishing:
+	for round := 1; n.opts.Count == 0 || round <= n.opts.Count; round++ {
+		select {
+		case <-ctx.Done():
+			break publishing
+		case <-ticker.C:
+		}
+		for _, device := range n.devices {
+			n.mu.Lock()
+			metrics := device.metrics(time.Since(n.start))
+			n.mu.Unlock()
+			n.publish(client, "DDATA", device.id, metrics)
+		}
+	}
+
+	if !explicitDeath {
+		return
+	}
+	for _, device := range n.devices {
+		n.publish(client, "DDEATH", device.id, nil)
+	}
+	topic := n.topic("NDEATH", "")
+	if token := client.Publish(topic, 1, false, n.death()); token.Wait() && token.Error() != nil {
+		fmt.Printf("Failed to publish to %s: %v\n", topic, token.Error())
+		return
+	}
+	fmt.Printf("Sent NDEATH to %s\n", topic)
+}
+
+func formatMetrics(metrics []sparkplugMetric) string {
+	parts := make([]string, len(metrics))
+	for i, m := range metrics {
+		parts[i] = fmt.Sprintf("%s=%v", m.Name, m.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// encodeSparkplugPayload encodes an org.eclipse.tahu.protobuf.Payload; NDEATH
+// has no sequence number
+func encodeSparkplugPayload(timestamp time.Time, seq *uint64, metrics []sparkplugMetric) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(timestamp.UnixMilli()))
+	for _, m := range metrics {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeSparkplugMetric(timestamp, m))
+	}
+	if seq != nil {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, *seq)
+	}
+	return b
+}
+
+func encodeSparkplugMetric(timestamp time.Time, m sparkplugMetric) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, m.Name)
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(timestamp.UnixMilli()))
+	switch v := m.Value.(type) {
+	case int64:
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, sparkplugInt64)
+		b = protowire.AppendTag(b, 11, protowire.VarintType) // long_value
+		b = protowire.AppendVarint(b, uint64(v))
+	case float64:
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, sparkplugDouble)
+		b = protowire.AppendTag(b, 13, protowire.Fixed64Type) // double_value
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case bool:
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, sparkplugBoolean)
+		b = protowire.AppendTag(b, 14, protowire.VarintType) // boolean_value
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	}
+	return b
+}
+
+// isRebirthRequest reports whether an NCMD payload sets Node Control/Rebirth
+func isRebirthRequest(payload []byte) bool {
+	rebirth := false
+	forEachField(payload, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if num != 2 || typ != protowire.BytesType {
+			return
+		}
+		var (
+			name string
+			set  bool
+		)
+		forEachField(value, func(num protowire.Number, typ protowire.Type, value []byte) {
+			switch {
+			case num == 1 && typ == protowire.BytesType:
+				name = string(value)
+			case num == 14 && typ == protowire.VarintType:
+				v, _ := protowire.ConsumeVarint(value)
+				set = v != 0
+			}
+		})
+		rebirth = rebirth || (name == rebirthMetric && set)
+	})
+	return rebirth
+}
+
+// forEachField calls fn with the number, type and value of each field of an
+// encoded message; length-delimited values are passed without their length.
+// Decoding stops at the first malformed field.
+func forEachField(b []byte, fn func(protowire.Number, protowire.Type, []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return
+		}
+		value := b[:n]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		fn(num, typ, value)
+		b = b[n:]
+	}
+}
@@ -0,0 +1,135 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Stream publishes messages to one topic at its own interval
+type Stream struct {
+	Topic    string
+	Device   string // Fleet member substituted for "+" in the topic, if any
+	Interval time.Duration
+	Pattern  Pattern // Shape of the gaps between messages
+	Count    int     // 0 for infinite
+	QoS      byte
+	Retain   bool
+	Payload  Payload
+	Fields   map[string]FieldModel // Simulated sensor fields, each device with its own values
+}
+
+// parseStreamSpec parses "topic[:interval[:count]]", e.g. "sensors/+/data:500ms:∞".
+// Missing parts are taken from defaults; a count of "∞", "inf" or 0 is infinite.
+func parseStreamSpec(spec string, defaults Stream) (Stream, error) {
+	stream := defaults
+	parts := strings.Split(spec, ":")
+
+	// Topics may contain colons, so the optional parts are recognized from the end
+	if n := len(parts); n >= 3 {
+		if count, ok := parseCount(parts[n-1]); ok {
+			if interval, err := time.ParseDuration(parts[n-2]); err == nil {
+				stream.Interval, stream.Count = interval, count
+				parts = parts[:n-2]
+			}
+		}
+	}
+	if n := len(parts); n >= 2 {
+		if interval, err := time.ParseDuration(parts[n-1]); err == nil {
+			stream.Interval = interval
+			parts = parts[:n-1]
+		}
+	}
+
+	stream.Topic = strings.Join(parts, ":")
+	if stream.Topic == "" {
+		return stream, fmt.Errorf("invalid topic spec %q: missing topic", spec)
+	}
+	if stream.Interval <= 0 {
+		return stream, fmt.Errorf("invalid topic spec %q: interval must be positive", spec)
+	}
+	return stream, nil
+}
+
+func parseCount(s string) (int, bool) {
+	switch strings.ToLower(s) {
+	case "∞", "inf":
+		return 0, true
+	}
+	count, err := strconv.Atoi(s)
+	return count, err == nil && count >= 0
+}
+
+// expandFleet turns a stream whose topic has "+" levels into one stream per
+// device, with the device name in place of each "+"
+func expandFleet(stream Stream, devices int) []Stream {
+	if !strings.Contains(stream.Topic, "+") || devices < 1 {
+		return []Stream{stream}
+	}
+
+	width := len(strconv.Itoa(devices))
+	streams := make([]Stream, 0, devices)
+	for i := 1; i <= devices; i++ {
+		device := fmt.Sprintf("device%0*d", width, i)
+		s := stream
+		s.Device = device
+		s.Topic = strings.ReplaceAll(stream.Topic, "+", device)
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+// Run publishes the stream's messages until its count is reached or ctx is cancelled
+func (s Stream) Run(ctx context.Context, client mqtt.Client, sent *atomic.Int64) {
+	// Gaps are measured from the scheduled send time, so a slow publish does not
+	// stretch the pattern; time lost to a stalled broker is not caught up
+	start := time.Now()
+	next := start
+	fields := newFieldValues(s.Fields)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for seq := 1; ; seq++ {
+		now := time.Now()
+		data, err := s.Payload.Render(TemplateData{Seq: seq, Topic: s.Topic, Device: s.Device, Time: now, Fields: fields.Next(now.Sub(start))})
+		if err != nil {
+			log.Printf("Failed to render payload for %s: %v", s.Topic, err)
+			return
+		}
+
+		token := client.Publish(s.Topic, s.QoS, s.Retain, data)
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Failed to publish to %s: %v", s.Topic, token.Error())
+		} else {
+			n := sent.Add(1)
+			fmt.Printf("Sent message %d to %s: %s\n", n, s.Topic, formatPayload(data))
+		}
+
+		if s.Count > 0 && seq >= s.Count {
+			return
+		}
+		delay := s.Pattern.Delay(s.Interval, seq)
+		if delay == 0 {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		next = next.Add(delay)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		timer.Reset(time.Until(next))
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+	}
+}
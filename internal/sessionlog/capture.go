@@ -0,0 +1,173 @@
+package sessionlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Binary capture format (log_format = "binary"), preserving payload bytes exactly.
+//
+// The file starts with CaptureMagic followed by records. Every record is
+//
+//	uint32 body length
+//	int64  timestamp (unix nanoseconds)
+//	uint8  record type (captureTypeMessage or captureTypeEvent)
+//	uint8  QoS
+//	uint8  flags (bit 0: retained)
+//	uint16 source length, source bytes
+//	uint16 topic length, topic bytes
+//	uint32 payload length, payload bytes (event text for event records)
+//
+// All integers are big endian.
+const CaptureMagic = "MQMCAP1\n"
+
+const (
+	captureTypeMessage byte = 1
+	captureTypeEvent   byte = 2
+
+	captureFlagRetained byte = 1 << 0
+)
+
+// EncodeCapture serializes a record into the binary capture format
+func EncodeCapture(record Record) ([]byte, error) {
+	if len(record.Source) > 0xFFFF || len(record.Topic) > 0xFFFF {
+		return nil, fmt.Errorf("source or topic too long for capture record")
+	}
+
+	recordType, payload := captureTypeMessage, record.RawPayload
+	if record.Type == TypeEvent {
+		recordType, payload = captureTypeEvent, []byte(record.Event)
+	}
+
+	var flags byte
+	if record.Retained {
+		flags |= captureFlagRetained
+	}
+
+	bodyLen := 8 + 3 + 2 + len(record.Source) + 2 + len(record.Topic) + 4 + len(payload)
+	buf := make([]byte, 0, 4+bodyLen)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(bodyLen))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(record.Timestamp.UnixNano()))
+	buf = append(buf, recordType, record.QoS, flags)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(record.Source)))
+	buf = append(buf, record.Source...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(record.Topic)))
+	buf = append(buf, record.Topic...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+
+	return buf, nil
+}
+
+// isCapture reports whether the buffered reader is positioned at a binary capture header
+func isCapture(r *bufio.Reader) bool {
+	header, err := r.Peek(len(CaptureMagic))
+	return err == nil && string(header) == CaptureMagic
+}
+
+// scanCapture decodes binary capture records from r and calls fn for each one
+func scanCapture(r *bufio.Reader, fn func(Record) error) error {
+	if _, err := r.Discard(len(CaptureMagic)); err != nil {
+		return err
+	}
+
+	var lenBuf [4]byte
+	for index := 1; ; index++ {
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("record %d: %w", index, err)
+		}
+
+		bodyLen := binary.BigEndian.Uint32(lenBuf[:])
+		if bodyLen > MaxRecordSize {
+			return fmt.Errorf("record %d: length %d exceeds limit", index, bodyLen)
+		}
+
+		body := make([]byte, bodyLen)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("record %d: truncated: %w", index, err)
+		}
+
+		record, err := decodeCaptureBody(body)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", index, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+func decodeCaptureBody(body []byte) (Record, error) {
+	var record Record
+	r := bytes.NewReader(body)
+
+	var header struct {
+		Timestamp int64
+		Type      byte
+		QoS       byte
+		Flags     byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return record, fmt.Errorf("invalid header: %w", err)
+	}
+
+	source, err := readCaptureField(r, 2)
+	if err != nil {
+		return record, fmt.Errorf("invalid source: %w", err)
+	}
+	topic, err := readCaptureField(r, 2)
+	if err != nil {
+		return record, fmt.Errorf("invalid topic: %w", err)
+	}
+	payload, err := readCaptureField(r, 4)
+	if err != nil {
+		return record, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	record.Timestamp = time.Unix(0, header.Timestamp)
+	record.Source = string(source)
+	switch header.Type {
+	case captureTypeEvent:
+		record.Type = TypeEvent
+		record.Event = string(payload)
+	case captureTypeMessage:
+		record.Type = TypeMessage
+		record.Topic = string(topic)
+		record.RawPayload = payload
+		record.QoS = header.QoS
+		record.Retained = header.Flags&captureFlagRetained != 0
+	default:
+		return record, fmt.Errorf("unknown record type %d", header.Type)
+	}
+
+	return record, nil
+}
+
+// readCaptureField reads a length-prefixed byte field with a 2 or 4 byte length
+func readCaptureField(r *bytes.Reader, lenSize int) ([]byte, error) {
+	var n uint32
+	if lenSize == 2 {
+		var n16 uint16
+		if err := binary.Read(r, binary.BigEndian, &n16); err != nil {
+			return nil, err
+		}
+		n = uint32(n16)
+	} else if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+
+	if int64(n) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	field := make([]byte, n)
+	_, err := io.ReadFull(r, field)
+	return field, err
+}
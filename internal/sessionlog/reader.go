@@ -0,0 +1,70 @@
+package sessionlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+// MaxRecordSize bounds a single jsonl line or capture record when reading session logs
+const MaxRecordSize = 16 * 1024 * 1024
+
+// Read loads all records from a structured (jsonl or binary) session log
+func Read(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session log: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	err = Scan(file, func(record Record) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return records, nil
+}
+
+// Scan decodes jsonl or binary capture session log records from r and
+// calls fn for each one
+func Scan(r io.Reader, fn func(Record) error) error {
+	reader := bufio.NewReader(r)
+	if isCapture(reader) {
+		return scanCapture(reader, func(record Record) error {
+			if record.Type == TypeMessage {
+				record.Payload = mqtt.SanitizePayload(record.RawPayload)
+			}
+			return fn(record)
+		})
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxRecordSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("line %d is not a structured session log record (log_format = \"jsonl\" or \"binary\" is required): %w", line, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
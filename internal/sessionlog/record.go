@@ -0,0 +1,26 @@
+// Package sessionlog reads and encodes the structured session log formats written
+// by the monitor: JSON lines (log_format = "jsonl") and the binary capture format
+// (log_format = "binary").
+package sessionlog
+
+import "time"
+
+// Record types
+const (
+	TypeMessage = "message"
+	TypeEvent   = "event"
+)
+
+// Record is a single line of a structured (jsonl) session log
+type Record struct {
+	Type         string    `json:"type"`
+	Timestamp    time.Time `json:"timestamp"`
+	Source       string    `json:"source,omitempty"`
+	Topic        string    `json:"topic,omitempty"`
+	DisplayTopic string    `json:"display_topic,omitempty"`
+	Payload      string    `json:"payload,omitempty"`
+	RawPayload   []byte    `json:"raw_payload,omitempty"` // base64 encoded by encoding/json
+	QoS          byte      `json:"qos"`
+	Retained     bool      `json:"retained"`
+	Event        string    `json:"event,omitempty"`
+}
@@ -0,0 +1,436 @@
+// Package alerts evaluates threshold and absence rules against the messages of
+// a monitor and sends rate-limited notifications to Slack, Matrix, Telegram and
+// email when a rule starts or stops firing.
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+const (
+	defaultAlertRateLimit = 5 * time.Minute
+	defaultAlertSeverity  = "warning"
+	defaultAlertTemplate  = `[{{ .Severity | upper }}] {{ .Rule }} {{ .State }}: {{ .Message }}{{ if .Suppressed }} ({{ .Suppressed }} more suppressed){{ end }}`
+	alertQueueSize        = 100
+	alertCheckInterval    = time.Second
+	alertNotifyTimeout    = 10 * time.Second
+)
+
+// Alert states
+const (
+	Firing   = "firing"
+	Resolved = "resolved"
+)
+
+// Config holds the alert rules and the notifiers alerts are sent to
+type Config struct {
+	Rules     []Rule           `toml:"rule"`
+	RateLimit string           `toml:"rate_limit"` // Minimum time between notifications for the same rule and topic (default: "5m")
+	Template  string           `toml:"template"`   // Go text/template for notification text (default: "[SEVERITY] rule state: message")
+	Slack     []SlackConfig    `toml:"slack"`
+	Matrix    []MatrixConfig   `toml:"matrix"`
+	Telegram  []TelegramConfig `toml:"telegram"`
+	Email     []EmailConfig    `toml:"email"`
+}
+
+// Rule fires on a numeric threshold or on missing messages
+type Rule struct {
+	Name     string   `toml:"name"`     // Unique rule name
+	Topic    string   `toml:"topic"`    // MQTT topic filter, wildcards allowed
+	Field    string   `toml:"field"`    // Threshold rules: JSON payload field, nested as "a.b"
+	Above    *float64 `toml:"above"`    // Fire when the field is greater than this
+	Below    *float64 `toml:"below"`    // Fire when the field is less than this
+	Absent   string   `toml:"absent"`   // Absence rules: fire when no message matched for this long, e.g. "5m"
+	Severity string   `toml:"severity"` // Free-form severity (default: "warning")
+}
+
+// Alert is a rule changing state, as passed to notification templates
+type Alert struct {
+	Rule       string
+	Severity   string
+	State      string // Firing or Resolved
+	Topic      string // Matching topic, or the rule's filter for absence rules
+	Source     string // Connection of the triggering message, if any
+	Value      string // Field value of threshold rules
+	Message    string
+	Time       time.Time
+	Suppressed int // State changes held back by the rate limit since the last notification
+}
+
+// Notifier delivers alert notifications. text is the alert rendered with the notifier's template.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert, text string) error
+}
+
+// flusher is implemented by notifiers that hold alerts back, to send them on shutdown
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// alertTarget is a notifier with the template that formats its messages
+type alertTarget struct {
+	notifier Notifier
+	template *template.Template
+}
+
+// alertKey identifies a state tracked per rule and topic
+type alertKey struct {
+	rule  string
+	topic string
+}
+
+// alertState is the firing state of one rule and topic and what was last notified
+type alertState struct {
+	firing     bool
+	notified   bool // Whether the last notification sent was a firing one
+	lastSent   time.Time
+	suppressed int
+	alert      Alert
+}
+
+// Manager evaluates the rules against the message feed and notifies the
+// configured targets about state changes
+type Manager struct {
+	rules     []Rule
+	absent    map[string]time.Duration // Rule name to absence timeout
+	rateLimit time.Duration
+	targets   []alertTarget
+	notify    func(error) // Reports alerts in the UI status feed
+
+	states   map[alertKey]*alertState
+	lastSeen map[string]time.Time // Absence rule name to its last matching message
+	queue    chan Alert
+	logger   zerolog.Logger
+}
+
+// alertTemplateFuncs are available in notification templates
+var alertTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func parseAlertTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	tmpl, err := template.New(name).Funcs(alertTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// validateRule checks that a rule is either a threshold or an absence rule
+func validateRule(rule Rule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("alert rule on %q requires a name", rule.Topic)
+	}
+	if err := mqtt.ValidateTopicFilter(rule.Topic); err != nil {
+		return fmt.Errorf("alert rule %q: %w", rule.Name, err)
+	}
+
+	threshold := rule.Above != nil || rule.Below != nil
+	switch {
+	case threshold && rule.Absent != "":
+		return fmt.Errorf("alert rule %q: use either above/below or absent, not both", rule.Name)
+	case threshold && rule.Field == "":
+		return fmt.Errorf("alert rule %q: threshold requires a field", rule.Name)
+	case threshold:
+		if rule.Above != nil && rule.Below != nil && *rule.Below > *rule.Above {
+			// below > above means "inside the range", which always holds for one side
+			return fmt.Errorf("alert rule %q: below must not be greater than above", rule.Name)
+		}
+	case rule.Absent != "":
+		if d, err := time.ParseDuration(rule.Absent); err != nil || d <= 0 {
+			return fmt.Errorf("alert rule %q: invalid absent duration %q", rule.Name, rule.Absent)
+		}
+	default:
+		return fmt.Errorf("alert rule %q: requires above, below or absent", rule.Name)
+	}
+	return nil
+}
+
+// Validate checks the rules, templates and notifier settings
+func Validate(c Config) error {
+	_, err := NewManager(c, func(error) {}, zerolog.Nop())
+	return err
+}
+
+// NewManager validates the rules and sets up the notifiers
+func NewManager(config Config, notify func(error), logger zerolog.Logger) (*Manager, error) {
+	m := &Manager{
+		rules:     slices.Clone(config.Rules),
+		absent:    make(map[string]time.Duration),
+		rateLimit: defaultAlertRateLimit,
+		notify:    notify,
+		states:    make(map[alertKey]*alertState),
+		lastSeen:  make(map[string]time.Time),
+		queue:     make(chan Alert, alertQueueSize),
+		logger:    logger,
+	}
+
+	if config.RateLimit != "" {
+		d, err := time.ParseDuration(config.RateLimit)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid alert rate_limit %q", config.RateLimit)
+		}
+		m.rateLimit = d
+	}
+
+	names := make(map[string]bool)
+	for i, rule := range config.Rules {
+		if err := validateRule(rule); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate alert rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Severity == "" {
+			m.rules[i].Severity = defaultAlertSeverity
+		}
+		if rule.Absent != "" {
+			m.absent[rule.Name], _ = time.ParseDuration(rule.Absent)
+		}
+	}
+
+	defaultTemplate, err := parseAlertTemplate("alert", config.Template, defaultAlertTemplate)
+	if err != nil {
+		return nil, err
+	}
+	notifiers, err := newChatNotifiers(config, defaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	m.targets = append(m.targets, notifiers...)
+
+	emails, err := newEmailNotifiers(config, defaultTemplate, logger)
+	if err != nil {
+		return nil, err
+	}
+	m.targets = append(m.targets, emails...)
+
+	return m, nil
+}
+
+// Run evaluates messages until ctx is cancelled or messages is closed
+func (m *Manager) Run(ctx context.Context, messages <-chan monitor.Message) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.deliver(ctx)
+	}()
+	defer func() {
+		close(m.queue)
+		<-done
+	}()
+
+	start := time.Now()
+	for name := range m.absent {
+		m.lastSeen[name] = start
+	}
+
+	ticker := time.NewTicker(alertCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkAbsence(now)
+			m.retryHeld(now)
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			m.evaluate(msg)
+		}
+	}
+}
+
+// evaluate applies every matching rule to msg
+func (m *Manager) evaluate(msg monitor.Message) {
+	var values map[string]any
+	decoded := false
+	for _, rule := range m.rules {
+		if !mqtt.TopicMatches(rule.Topic, msg.Topic) {
+			continue
+		}
+
+		if rule.Absent != "" {
+			m.lastSeen[rule.Name] = msg.Timestamp
+			m.setState(alertKey{rule.Name, rule.Topic}, false, Alert{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Topic:    rule.Topic,
+				Source:   msg.Source,
+				Message:  fmt.Sprintf("message received on %s", msg.Topic),
+				Time:     msg.Timestamp,
+			})
+			continue
+		}
+
+		if !decoded {
+			decoded = true
+			var document any
+			if err := json.Unmarshal(msg.RawPayload, &document); err == nil {
+				values = make(map[string]any)
+				monitor.FlattenJSON("", document, values)
+			}
+		}
+		value, ok := values[rule.Field].(float64)
+		if !ok {
+			continue
+		}
+
+		var message string
+		firing := false
+		switch {
+		case rule.Above != nil && value > *rule.Above:
+			firing, message = true, fmt.Sprintf("%s on %s is %g, above %g", rule.Field, msg.Topic, value, *rule.Above)
+		case rule.Below != nil && value < *rule.Below:
+			firing, message = true, fmt.Sprintf("%s on %s is %g, below %g", rule.Field, msg.Topic, value, *rule.Below)
+		default:
+			message = fmt.Sprintf("%s on %s is back to %g", rule.Field, msg.Topic, value)
+		}
+		m.setState(alertKey{rule.Name, msg.Topic}, firing, Alert{
+			Rule:     rule.Name,
+			Severity: rule.Severity,
+			Topic:    msg.Topic,
+			Source:   msg.Source,
+			Value:    strconv.FormatFloat(value, 'g', -1, 64),
+			Message:  message,
+			Time:     msg.Timestamp,
+		})
+	}
+}
+
+// checkAbsence fires absence rules whose topics have been silent for too long
+func (m *Manager) checkAbsence(now time.Time) {
+	for _, rule := range m.rules {
+		timeout, ok := m.absent[rule.Name]
+		if !ok || now.Sub(m.lastSeen[rule.Name]) <= timeout {
+			continue
+		}
+		m.setState(alertKey{rule.Name, rule.Topic}, true, Alert{
+			Rule:     rule.Name,
+			Severity: rule.Severity,
+			Topic:    rule.Topic,
+			Message:  fmt.Sprintf("no message on %s for %s", rule.Topic, now.Sub(m.lastSeen[rule.Name]).Round(time.Second)),
+			Time:     now,
+		})
+	}
+}
+
+// setState records the outcome of a rule for a topic and notifies on a change
+func (m *Manager) setState(key alertKey, firing bool, alert Alert) {
+	state, ok := m.states[key]
+	if !ok {
+		if !firing {
+			return // Nothing to resolve
+		}
+		state = &alertState{}
+		m.states[key] = state
+	}
+	if state.firing == firing {
+		return
+	}
+
+	state.firing = firing
+	state.alert = alert
+	if !m.send(state, alert.Time) {
+		state.suppressed++
+	}
+}
+
+// retryHeld sends notifications that the rate limit held back once it allows them
+func (m *Manager) retryHeld(now time.Time) {
+	for key, state := range m.states {
+		if state.notified != state.firing {
+			m.send(state, now)
+		}
+		if !state.firing && !state.notified {
+			delete(m.states, key)
+		}
+	}
+}
+
+// send queues a notification for the current state unless it was already sent
+// or the rate limit holds it back. Resolutions of notified alerts always pass.
+func (m *Manager) send(state *alertState, now time.Time) bool {
+	if state.notified == state.firing {
+		return true
+	}
+	if state.firing && !state.lastSent.IsZero() && now.Sub(state.lastSent) < m.rateLimit {
+		return false
+	}
+
+	alert := state.alert
+	alert.State = Resolved
+	if state.firing {
+		alert.State = Firing
+	}
+	alert.Suppressed = state.suppressed
+
+	state.notified = state.firing
+	state.lastSent = now
+	state.suppressed = 0
+
+	if state.firing {
+		m.notify(monitor.Noticef(monitor.SeverityWarning, "alert %s %s: %s", alert.Rule, alert.State, alert.Message))
+	} else {
+		m.notify(monitor.Noticef(monitor.SeverityInfo, "alert %s %s: %s", alert.Rule, alert.State, alert.Message))
+	}
+	select {
+	case m.queue <- alert:
+	default:
+		m.logger.Warn().Str("rule", alert.Rule).Msg("Alert queue full, dropping notification")
+	}
+	return true
+}
+
+// deliver sends queued alerts to every target until the queue is closed
+func (m *Manager) deliver(ctx context.Context) {
+	for alert := range m.queue {
+		for _, target := range m.targets {
+			var text bytes.Buffer
+			if err := target.template.Execute(&text, alert); err != nil {
+				m.logger.Error().Err(err).Str("notifier", target.notifier.Name()).Msg("Failed to render alert template")
+				continue
+			}
+
+			// Shutdown gets its own grace period so pending alerts still go out
+			notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), alertNotifyTimeout)
+			err := target.notifier.Notify(notifyCtx, alert, text.String())
+			cancel()
+			if err != nil {
+				m.logger.Warn().Err(err).Str("notifier", target.notifier.Name()).Str("rule", alert.Rule).Msg("Failed to send alert")
+			}
+		}
+	}
+
+	for _, target := range m.targets {
+		if f, ok := target.notifier.(flusher); ok {
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), alertNotifyTimeout)
+			if err := f.Flush(flushCtx); err != nil {
+				m.logger.Warn().Err(err).Str("notifier", target.notifier.Name()).Msg("Failed to send pending alerts")
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Email transport security modes
+const (
+	EmailSTARTTLS = "starttls"
+	EmailTLS      = "tls"
+	EmailNone     = "none"
+)
+
+const (
+	defaultEmailSubject       = `[{{ .Severity | upper }}] {{ .Rule }} {{ .State }}`
+	defaultEmailDigestSubject = `MQTT Monitor: {{ len . }} alert notification{{ if gt (len .) 1 }}s{{ end }}`
+)
+
+// EmailConfig sends alerts by email through an SMTP server
+type EmailConfig struct {
+	Host               string   `toml:"host"`                 // SMTP server host name
+	Port               int      `toml:"port"`                 // SMTP port (default: 465 with tls = "tls", else 587)
+	Username           string   `toml:"username"`             // SMTP user, empty for no authentication
+	Password           string   `toml:"password"`             // SMTP password (default: SMTP_PASSWORD environment variable)
+	TLS                string   `toml:"tls"`                  // "starttls" (default), "tls" (implicit TLS) or "none"
+	InsecureSkipVerify bool     `toml:"insecure_skip_verify"` // Do not verify the server certificate
+	From               string   `toml:"from"`                 // Sender address
+	To                 []string `toml:"to"`                   // Recipient addresses
+	Subject            string   `toml:"subject"`              // Subject template for a single alert
+	DigestSubject      string   `toml:"digest_subject"`       // Subject template for a digest, executed on the list of alerts
+	Template           string   `toml:"template"`             // Overrides the alert template for the body
+	Digest             string   `toml:"digest"`               // Collect alerts for this long and send them in one email, e.g. "15m" (default: send each alert)
+}
+
+// EmailNotifier sends alerts by SMTP, either one email per alert or as a periodic digest
+type EmailNotifier struct {
+	name          string
+	config        EmailConfig
+	addr          string
+	subject       *template.Template
+	digestSubject *template.Template
+	digest        time.Duration
+	logger        zerolog.Logger
+
+	mu      sync.Mutex
+	pending []pendingEmail
+	timer   *time.Timer
+}
+
+// pendingEmail is an alert waiting for the next digest
+type pendingEmail struct {
+	alert Alert
+	text  string
+}
+
+// newEmailNotifiers creates the email targets of config
+func newEmailNotifiers(config Config, defaultTemplate *template.Template, logger zerolog.Logger) ([]alertTarget, error) {
+	var targets []alertTarget
+	for i, c := range config.Email {
+		notifier, err := NewEmailNotifier(fmt.Sprintf("email[%d]", i), c, logger)
+		if err != nil {
+			return nil, err
+		}
+		target, err := newAlertTarget(notifier, c.Template, defaultTemplate)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func NewEmailNotifier(name string, config EmailConfig, logger zerolog.Logger) (*EmailNotifier, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("email notifier requires host")
+	}
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("invalid email from address %q: %w", config.From, err)
+	}
+	if len(config.To) == 0 {
+		return nil, fmt.Errorf("email notifier requires at least one to address")
+	}
+	for _, to := range config.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return nil, fmt.Errorf("invalid email to address %q: %w", to, err)
+		}
+	}
+
+	switch config.TLS {
+	case "":
+		config.TLS = EmailSTARTTLS
+	case EmailSTARTTLS, EmailTLS, EmailNone:
+	default:
+		return nil, fmt.Errorf("invalid email tls mode %q: must be starttls, tls or none", config.TLS)
+	}
+	if config.Port == 0 {
+		config.Port = 587
+		if config.TLS == EmailTLS {
+			config.Port = 465
+		}
+	}
+	if config.Password == "" {
+		config.Password = os.Getenv("SMTP_PASSWORD")
+	}
+
+	n := &EmailNotifier{
+		name:   name,
+		config: config,
+		addr:   net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		logger: logger,
+	}
+
+	var err error
+	if n.subject, err = parseAlertTemplate(name+" subject", config.Subject, defaultEmailSubject); err != nil {
+		return nil, err
+	}
+	if n.digestSubject, err = parseAlertTemplate(name+" digest_subject", config.DigestSubject, defaultEmailDigestSubject); err != nil {
+		return nil, err
+	}
+	if config.Digest != "" {
+		if n.digest, err = time.ParseDuration(config.Digest); err != nil || n.digest <= 0 {
+			return nil, fmt.Errorf("invalid email digest interval %q", config.Digest)
+		}
+	}
+
+	return n, nil
+}
+
+func (n *EmailNotifier) Name() string { return n.name }
+
+// Notify sends the alert right away, or queues it for the next digest
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert, text string) error {
+	if n.digest == 0 {
+		var subject bytes.Buffer
+		if err := n.subject.Execute(&subject, alert); err != nil {
+			return err
+		}
+		return n.send(ctx, subject.String(), text)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pending = append(n.pending, pendingEmail{alert: alert, text: text})
+	if n.timer == nil {
+		n.timer = time.AfterFunc(n.digest, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), alertNotifyTimeout)
+			defer cancel()
+			if err := n.Flush(ctx); err != nil {
+				n.logger.Warn().Err(err).Str("notifier", n.name).Msg("Failed to send alert digest")
+			}
+		})
+	}
+	return nil
+}
+
+// Flush sends the queued alerts as one digest email
+func (n *EmailNotifier) Flush(ctx context.Context) error {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = nil
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+	n.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	alerts := make([]Alert, len(pending))
+	var body strings.Builder
+	for i, p := range pending {
+		alerts[i] = p.alert
+		fmt.Fprintf(&body, "%s  %s\n", p.alert.Time.Format(time.DateTime), p.text)
+	}
+	var subject bytes.Buffer
+	if err := n.digestSubject.Execute(&subject, alerts); err != nil {
+		return err
+	}
+	return n.send(ctx, subject.String(), body.String())
+}
+
+// send delivers one plain text email
+func (n *EmailNotifier) send(ctx context.Context, subject, body string) error {
+	message, err := n.compose(subject, body)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: n.config.Host, InsecureSkipVerify: n.config.InsecureSkipVerify}
+	if n.config.TLS == EmailTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if n.config.TLS == EmailSTARTTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if n.config.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection except to localhost
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(n.config.From)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range n.config.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("recipient %s: %w", addr.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose builds the RFC 5322 message with a quoted-printable UTF-8 body
+func (n *EmailNotifier) compose(subject, body string) ([]byte, error) {
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	header("From", n.config.From)
+	header("To", strings.Join(n.config.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,223 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const defaultTelegramAPI = "https://api.telegram.org"
+
+// SlackConfig sends alerts to a Slack incoming webhook
+type SlackConfig struct {
+	WebhookURL string `toml:"webhook_url"` // Incoming webhook URL (default: SLACK_WEBHOOK_URL environment variable)
+	Template   string `toml:"template"`    // Overrides the alert template
+}
+
+// MatrixConfig sends alerts to a Matrix room
+type MatrixConfig struct {
+	Homeserver  string `toml:"homeserver"`   // Homeserver base URL, e.g. "https://matrix.org"
+	RoomID      string `toml:"room_id"`      // Room ID, e.g. "!abc:matrix.org"
+	AccessToken string `toml:"access_token"` // Bot account access token (default: MATRIX_ACCESS_TOKEN environment variable)
+	Template    string `toml:"template"`     // Overrides the alert template
+}
+
+// TelegramConfig sends alerts through a Telegram bot
+type TelegramConfig struct {
+	BotToken string `toml:"bot_token"` // Bot token from @BotFather (default: TELEGRAM_BOT_TOKEN environment variable)
+	ChatID   string `toml:"chat_id"`   // Chat, group or channel ID
+	APIURL   string `toml:"api_url"`   // Bot API base URL (default: "https://api.telegram.org")
+	Template string `toml:"template"`  // Overrides the alert template
+}
+
+// newChatNotifiers creates the Slack, Matrix and Telegram targets of config
+func newChatNotifiers(config Config, defaultTemplate *template.Template) ([]alertTarget, error) {
+	var targets []alertTarget
+	add := func(notifier Notifier, text string) error {
+		target, err := newAlertTarget(notifier, text, defaultTemplate)
+		if err == nil {
+			targets = append(targets, target)
+		}
+		return err
+	}
+
+	for i, c := range config.Slack {
+		if c.WebhookURL == "" {
+			c.WebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+		}
+		if err := validateNotifierURL("slack webhook_url", c.WebhookURL); err != nil {
+			return nil, err
+		}
+		notifier := &SlackNotifier{name: fmt.Sprintf("slack[%d]", i), webhookURL: c.WebhookURL, client: notifierHTTPClient()}
+		if err := add(notifier, c.Template); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range config.Matrix {
+		if c.AccessToken == "" {
+			c.AccessToken = os.Getenv("MATRIX_ACCESS_TOKEN")
+		}
+		if err := validateNotifierURL("matrix homeserver", c.Homeserver); err != nil {
+			return nil, err
+		}
+		if c.RoomID == "" || c.AccessToken == "" {
+			return nil, fmt.Errorf("matrix notifier requires room_id and access_token")
+		}
+		notifier := &MatrixNotifier{
+			name:        fmt.Sprintf("matrix[%d]", i),
+			sendURL:     strings.TrimSuffix(c.Homeserver, "/") + "/_matrix/client/v3/rooms/" + url.PathEscape(c.RoomID) + "/send/m.room.message/",
+			accessToken: c.AccessToken,
+			client:      notifierHTTPClient(),
+		}
+		if err := add(notifier, c.Template); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range config.Telegram {
+		if c.BotToken == "" {
+			c.BotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
+		}
+		if c.APIURL == "" {
+			c.APIURL = defaultTelegramAPI
+		}
+		if err := validateNotifierURL("telegram api_url", c.APIURL); err != nil {
+			return nil, err
+		}
+		if c.BotToken == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("telegram notifier requires bot_token and chat_id")
+		}
+		notifier := &TelegramNotifier{
+			name:    fmt.Sprintf("telegram[%d]", i),
+			sendURL: strings.TrimSuffix(c.APIURL, "/") + "/bot" + c.BotToken + "/sendMessage",
+			chatID:  c.ChatID,
+			client:  notifierHTTPClient(),
+		}
+		if err := add(notifier, c.Template); err != nil {
+			return nil, err
+		}
+	}
+
+	return targets, nil
+}
+
+// newAlertTarget pairs notifier with its own template, or the default one when text is empty
+func newAlertTarget(notifier Notifier, text string, defaultTemplate *template.Template) (alertTarget, error) {
+	tmpl := defaultTemplate
+	if text != "" {
+		var err error
+		if tmpl, err = parseAlertTemplate(notifier.Name(), text, ""); err != nil {
+			return alertTarget{}, err
+		}
+	}
+	return alertTarget{notifier: notifier, template: tmpl}, nil
+}
+
+func validateNotifierURL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s %q", name, value)
+	}
+	return nil
+}
+
+func notifierHTTPClient() *http.Client {
+	return &http.Client{Timeout: alertNotifyTimeout}
+}
+
+// postJSON sends body as JSON and turns a non-2xx response into an error
+func postJSON(ctx context.Context, client *http.Client, method, target string, header http.Header, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may carry a secret (webhook path, bot token), keep it out of logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// SlackNotifier posts alerts to a Slack incoming webhook
+type SlackNotifier struct {
+	name       string
+	webhookURL string
+	client     *http.Client
+}
+
+func (n *SlackNotifier) Name() string { return n.name }
+
+func (n *SlackNotifier) Notify(ctx context.Context, _ Alert, text string) error {
+	return postJSON(ctx, n.client, http.MethodPost, n.webhookURL, nil, map[string]string{"text": text})
+}
+
+// MatrixNotifier sends alerts as m.text messages to a Matrix room
+type MatrixNotifier struct {
+	name        string
+	sendURL     string // Without the transaction ID
+	accessToken string
+	client      *http.Client
+	txn         atomic.Uint64
+}
+
+func (n *MatrixNotifier) Name() string { return n.name }
+
+func (n *MatrixNotifier) Notify(ctx context.Context, _ Alert, text string) error {
+	// Transaction IDs make retried requests idempotent; they must be unique per access token
+	txnID := fmt.Sprintf("mqtt-monitor-%d-%d", time.Now().UnixNano(), n.txn.Add(1))
+	header := http.Header{"Authorization": {"Bearer " + n.accessToken}}
+	return postJSON(ctx, n.client, http.MethodPut, n.sendURL+txnID, header, map[string]string{
+		"msgtype": "m.text",
+		"body":    text,
+	})
+}
+
+// TelegramNotifier sends alerts through the Telegram Bot API
+type TelegramNotifier struct {
+	name    string
+	sendURL string
+	chatID  string
+	client  *http.Client
+}
+
+func (n *TelegramNotifier) Name() string { return n.name }
+
+func (n *TelegramNotifier) Notify(ctx context.Context, _ Alert, text string) error {
+	return postJSON(ctx, n.client, http.MethodPost, n.sendURL, nil, map[string]any{
+		"chat_id":                  n.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+}
@@ -0,0 +1,354 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+// Client is a monitored broker connection. Received messages, connection events
+// and errors are sent to the channels given to NewClient without ever blocking.
+// The channels are never closed: the MQTT client, the decode workers and other
+// components may still send on them while a shutdown is under way.
+type Client struct {
+	config     ConnectionConfig
+	client     *mqtt.Client
+	messagesCh chan Message
+	eventsCh   chan ConnectionEvent
+	errorsCh   chan error
+	name       string
+	ctx        context.Context
+	topicDepth atomic.Int32
+	logger     zerolog.Logger
+	color      string
+
+	statusMu sync.RWMutex
+	status   ConnectionStatus
+	received atomic.Uint64
+	drops    dropCounters
+
+	subscribed atomic.Bool // The topics were subscribed on an earlier connect
+	decodePool *DecodePool // Decodes received messages; nil to decode on the receive path
+
+	onConnected   []func()
+	offlineTopic  string
+	offlineStatus []byte
+	offlineQoS    byte
+}
+
+// ConnectionStatus is a point-in-time view of a connection's health
+type ConnectionStatus struct {
+	Name      string            `json:"name"`
+	Server    string            `json:"server"`
+	Topics    []string          `json:"topics"`
+	Connected bool              `json:"connected"`
+	LastEvent string            `json:"last_event"`
+	Since     time.Time         `json:"since"`
+	Messages  uint64            `json:"messages"`
+	Dropped   uint64            `json:"dropped,omitempty"` // Messages lost because the monitor fell behind
+	Drops     map[string]uint64 `json:"drops"`             // Messages and events lost by drop point, e.g. DropDecodeQueue
+}
+
+// NewClient returns a client sending to the given channels. Until SetContext is
+// called, it uses context.Background.
+func NewClient(config ConnectionConfig, messagesCh chan Message, eventsCh chan ConnectionEvent, errorsCh chan error, topicDepth int) *Client {
+	logger := log.With().
+		Str("component", "mqtt-client").
+		Str("connection", config.Name).
+		Logger()
+
+	mqttConfig := config.ToMQTTConfig()
+	client := mqtt.NewClient(mqttConfig, logger)
+
+	c := &Client{
+		config:     config,
+		client:     client,
+		messagesCh: messagesCh,
+		eventsCh:   eventsCh,
+		errorsCh:   errorsCh,
+		name:       config.Name,
+		ctx:        context.Background(),
+		logger:     logger,
+		status: ConnectionStatus{
+			Name:      config.Name,
+			Server:    config.Server,
+			Topics:    config.Topics,
+			LastEvent: "not connected",
+			Since:     time.Now(),
+		},
+	}
+	c.topicDepth.Store(int32(topicDepth))
+	return c
+}
+
+// Config returns the configuration the client was created with, with its current topics
+func (c *Client) Config() ConnectionConfig {
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+	config := c.config
+	config.Topics = slices.Clone(c.config.Topics)
+	return config
+}
+
+// SetTopicDepth changes the number of topic levels shown for messages received from now on
+func (c *Client) SetTopicDepth(depth int) {
+	c.topicDepth.Store(int32(depth))
+}
+
+// SetTopics replaces the subscribed topics without reconnecting: new topics are
+// subscribed and dropped ones unsubscribed. When not connected the topics are
+// used by the next connect.
+func (c *Client) SetTopics(topics []string) error {
+	c.statusMu.Lock()
+	current := c.config.Topics
+	c.config.Topics = slices.Clone(topics)
+	c.status.Topics = c.config.Topics
+	c.statusMu.Unlock()
+
+	var added, removed []string
+	for _, topic := range topics {
+		if !slices.Contains(current, topic) {
+			added = append(added, topic)
+		}
+	}
+	for _, topic := range current {
+		if !slices.Contains(topics, topic) {
+			removed = append(removed, topic)
+		}
+	}
+
+	if len(removed) > 0 {
+		if err := c.client.Unsubscribe(removed...); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 && c.client.IsConnected() {
+		return c.client.Subscribe(added...)
+	}
+	return nil
+}
+
+// Name returns the connection name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Status returns the current connection status
+func (c *Client) Status() ConnectionStatus {
+	c.statusMu.RLock()
+	status := c.status
+	c.statusMu.RUnlock()
+
+	status.Messages = c.received.Load()
+	status.Dropped = c.drops.messages()
+	status.Drops = c.drops.counts()
+	return status
+}
+
+// OnConnected registers fn to run after every successful connect and subscribe.
+// It must be called before Connect.
+func (c *Client) OnConnected(fn func()) {
+	c.onConnected = append(c.onConnected, fn)
+}
+
+// SetOfflineStatus makes payload the retained message on topic whenever this client
+// goes away: published by the broker as last will, or by Disconnect on a clean shutdown.
+// It must be called before Connect.
+func (c *Client) SetOfflineStatus(topic string, payload []byte, qos byte) {
+	c.offlineTopic, c.offlineStatus, c.offlineQoS = topic, payload, qos
+	c.client.SetWill(topic, payload, qos, true)
+}
+
+// SubscribeHandler subscribes to topic outside the monitored feed; its messages go to handler only
+func (c *Client) SubscribeHandler(topic string, qos byte, handler func(mqtt.Message)) error {
+	return c.client.SubscribeHandler(topic, qos, handler)
+}
+
+// Publish sends a message through this connection
+func (c *Client) Publish(topic string, payload []byte, qos byte, retained bool) error {
+	return c.client.Publish(topic, payload, qos, retained)
+}
+
+func (c *Client) setStatus(connected bool, event string) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.status.Connected = connected
+	c.status.LastEvent = event
+	c.status.Since = time.Now()
+}
+
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// SetDecodePool makes pool decode the messages of this client instead of the
+// MQTT client's receive path. It must be called before Connect.
+func (c *Client) SetDecodePool(pool *DecodePool) {
+	c.decodePool = pool
+}
+
+// Add a method to set the color
+func (c *Client) SetColor(color string) {
+	c.color = color
+}
+
+// Color returns the color assigned with SetColor
+func (c *Client) Color() string {
+	return c.color
+}
+
+func (c *Client) Connect() error {
+	// Set up message handler
+	c.client.SetMessageHandler(c.Receive)
+
+	// Set up connection handler
+	c.client.SetConnectionHandler(func(connected bool, err error) {
+		event := ConnectionEvent{Connection: c.name, Time: time.Now()}
+		if connected {
+			if c.subscribed.Load() && !enabled(c.config.ResubscribeOnReconnect) {
+				c.logger.Info().Msg("Reconnected, keeping the subscriptions of the session")
+				event.State = StateConnected
+			} else {
+				// Subscribe to topics after successful connection
+				c.logger.Info().Msg("Connected successfully, subscribing to topics...")
+				if subscribeErr := c.subscribeToTopics(); subscribeErr != nil {
+					event.State, event.Err = StateFatal, fmt.Errorf("subscription error: %w", subscribeErr)
+				} else {
+					c.subscribed.Store(true)
+					event.State = StateSubscribed
+				}
+			}
+			for _, fn := range c.onConnected {
+				go fn()
+			}
+		} else if errors.Is(err, mqtt.ErrReconnecting) {
+			event.State = StateReconnecting
+		} else {
+			event.State, event.Err = StateLost, err
+		}
+		c.setStatus(connected, event.String())
+
+		select {
+		case c.eventsCh <- event:
+		case <-c.ctx.Done():
+			return
+		default:
+			// Channel is full, drop the event to prevent blocking
+			c.drops.eventsChannel.Add(1)
+		}
+	})
+
+	// Set QoS level
+	c.client.SetQoS(c.config.QoS)
+
+	// Connect to broker
+	if err := c.client.Connect(); err != nil {
+		c.setStatus(false, fmt.Sprintf("%s: connect failed: %v", c.name, err))
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return nil
+}
+
+// Receive handles msg as if the broker had delivered it on this connection. It
+// lets the bench command drive the pipeline without a broker.
+func (c *Client) Receive(msg mqtt.Message) {
+	c.received.Add(1)
+	if c.decodePool == nil {
+		c.deliver(c.newMessage(msg))
+	} else if !c.decodePool.submit(c, msg) {
+		// Decoding is behind, drop the message to keep receiving
+		c.drops.decodeQueue.Add(1)
+		c.logger.Warn().Msg("Decode queue full, dropping message")
+	}
+}
+
+// newMessage creates the Message of a message received by this client
+func (c *Client) newMessage(msg mqtt.Message) Message {
+	return NewMessage(msg, c.name, int(c.topicDepth.Load()), c.color)
+}
+
+// deliver sends message to the messages channel without blocking
+func (c *Client) deliver(message Message) {
+	select {
+	case c.messagesCh <- message:
+	case <-c.ctx.Done():
+	default:
+		// Channel is full, drop the message to prevent blocking
+		c.drops.messagesChannel.Add(1)
+		c.logger.Warn().Msg("Message channel full, dropping message")
+	}
+}
+
+// safeErrorSend safely sends error to error channel without blocking
+func (m *Client) safeErrorSend(err error) {
+	select {
+	case m.errorsCh <- err:
+		// Error sent successfully
+	case <-m.ctx.Done():
+		// Context cancelled, stop trying
+		return
+	default:
+		// Error channel is full, ignore to prevent blocking
+		m.drops.errorsChannel.Add(1)
+	}
+}
+
+func (m *Client) Disconnect() {
+	defer func() {
+		if r := recover(); r != nil {
+			m.safeErrorSend(fmt.Errorf("[%s] disconnect panic: %v", m.name, r))
+		}
+	}()
+
+	if m.client == nil {
+		return
+	}
+	connected := m.client.IsConnected()
+	if connected && m.offlineTopic != "" {
+		m.client.Publish(m.offlineTopic, m.offlineStatus, m.offlineQoS, true)
+	}
+	m.client.Disconnect() // Also stops reconnect attempts of a lost connection
+	if connected {
+		m.setStatus(false, fmt.Sprintf("%s: disconnected", m.name))
+	}
+}
+
+// subscribeToTopics subscribes to all configured topics
+func (c *Client) subscribeToTopics() error {
+	c.statusMu.RLock()
+	topics := c.config.Topics
+	c.statusMu.RUnlock()
+
+	if len(topics) == 0 {
+		c.logger.Warn().Msg("No topics configured for subscription")
+		return nil
+	}
+
+	c.logger.Info().
+		Strs("topics", topics).
+		Uint8("qos", c.config.QoS).
+		Msg("Subscribing to topics")
+
+	// Subscribe to all configured topics
+	if err := c.client.Subscribe(topics...); err != nil {
+		c.logger.Error().Err(err).Msg("Failed to subscribe to topics")
+		return err
+	}
+
+	c.logger.Info().
+		Strs("topics", topics).
+		Msg("Successfully subscribed to all topics")
+
+	return nil
+}
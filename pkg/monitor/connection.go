@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+// ConnectionConfig describes one broker connection and the topics it subscribes to
+type ConnectionConfig struct {
+	Name                    string   `toml:"name"`
+	Server                  string   `toml:"server"`
+	User                    string   `toml:"user,omitempty"`
+	Password                string   `toml:"password,omitempty"`
+	PasswordKeyring         string   `toml:"password_keyring,omitempty"`   // OS keyring entry "service/account" holding the password
+	PasswordCommand         string   `toml:"password_command,omitempty"`   // Command printing the password, run on every connection attempt
+	PasswordVault           string   `toml:"password_vault,omitempty"`     // Vault secret "path#field" holding the password (default field: "password"), read on every connection attempt
+	PasswordEncrypted       string   `toml:"password_encrypted,omitempty"` // Password encrypted with a master passphrase by "mqtt-monitor encrypt"
+	TLSCertFile             string   `toml:"tls_cert_file,omitempty"`
+	TLSKeyFile              string   `toml:"tls_key_file,omitempty"`
+	TLSKeyPassphraseCommand string   `toml:"tls_key_passphrase_command,omitempty"` // Command printing the passphrase of an encrypted tls_key_file
+	TLSKeyPassphraseVault   string   `toml:"tls_key_passphrase_vault,omitempty"`   // Vault secret "path#field" holding the passphrase (default field: "passphrase")
+	TLSCAFile               string   `toml:"tls_ca_file,omitempty"`
+	TLSInsecureSkipVerify   bool     `toml:"tls_insecure_skip_verify,omitempty"`
+	Topics                  []string `toml:"topics"` // Array of topics
+	ClientIDBase            string   `toml:"client_id_base"`
+	QoS                     byte     `toml:"qos,omitempty"` // QoS level (0, 1, or 2)
+
+	// Client behavior for brokers that misbehave with the defaults
+	AutoReconnect          *bool `toml:"auto_reconnect,omitempty"`           // Reconnect after a lost connection and retry the first connection (default: true)
+	ResubscribeOnReconnect *bool `toml:"resubscribe_on_reconnect,omitempty"` // Subscribe again after reconnecting (default: true)
+	OrderedDelivery        *bool `toml:"ordered_delivery,omitempty"`         // Hand messages on one at a time in arrival order (default: true)
+	CleanSession           *bool `toml:"clean_session,omitempty"`            // Start without a broker session; false resumes the session of client_id_base, used as the client ID as it is (default: true)
+}
+
+// enabled returns the value of an optional setting that defaults to true
+func enabled(setting *bool) bool {
+	return setting == nil || *setting
+}
+
+// ToMQTTConfig converts ConnectionConfig to mqtt.Config
+func (c *ConnectionConfig) ToMQTTConfig() mqtt.Config {
+	return mqtt.Config{
+		BrokerURL:             c.Server,
+		ClientID:              c.clientID(),
+		Username:              c.User,
+		Password:              c.Password,
+		CleanSession:          enabled(c.CleanSession),
+		ConnectRetryInterval:  5 * time.Second,
+		MaxReconnectInterval:  60 * time.Second,
+		TLSCertFile:           c.TLSCertFile,
+		TLSKeyFile:            c.TLSKeyFile,
+		TLSCAFile:             c.TLSCAFile,
+		TLSInsecureSkipVerify: c.TLSInsecureSkipVerify,
+		PasswordFunc:          secretFunc(c.PasswordCommand, c.PasswordVault, "password"),
+		TLSKeyPassphraseFunc:  secretFunc(c.TLSKeyPassphraseCommand, c.TLSKeyPassphraseVault, "passphrase"),
+		DisableAutoReconnect:  !enabled(c.AutoReconnect),
+		DisableResubscribe:    !enabled(c.ResubscribeOnReconnect),
+		DisableOrderMatters:   !enabled(c.OrderedDelivery),
+	}
+}
+
+// clientID returns the client ID of a connection attempt: unique per start with a
+// clean session, and client_id_base itself for resuming a persistent session
+func (c *ConnectionConfig) clientID() string {
+	if !enabled(c.CleanSession) {
+		return c.ClientIDBase
+	}
+	return c.GetUniqueClientID()
+}
+
+func (c *ConnectionConfig) GetUniqueClientID() string {
+	return fmt.Sprintf("%s-%d", c.ClientIDBase, time.Now().Unix())
+}
+
+func (c *ConnectionConfig) GetTLSConfig() (*tls.Config, error) {
+	if !c.needsTLS() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+
+	// Load client certificate if provided
+	if c.TLSCertFile != "" && c.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Load CA certificate if provided
+	if c.TLSCAFile != "" {
+		caCertPool, err := LoadCertPool(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	return tlsConfig, nil
+}
+
+// LoadCertPool reads a PEM file of CA certificates
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	caCert, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse CA certificate")
+	}
+	return caCertPool, nil
+}
+
+func (c *ConnectionConfig) needsTLS() bool {
+	return strings.HasPrefix(c.Server, "ssl://") ||
+		strings.HasPrefix(c.Server, "tls://") ||
+		strings.HasPrefix(c.Server, "mqtts://") ||
+		c.TLSCertFile != "" ||
+		c.TLSCAFile != "" ||
+		c.TLSInsecureSkipVerify
+}
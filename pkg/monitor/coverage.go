@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	"slices"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+// CoverageExamples is the number of example topics listed per filter
+const CoverageExamples = 3
+
+// FilterCoverage is what a subscription filter of a connection matched among the
+// topics seen on the connection
+type FilterCoverage struct {
+	Filter    string   `json:"filter"`
+	Topics    int      `json:"topics"`               // Topics seen matching the filter
+	Examples  []string `json:"examples,omitempty"`   // The first of them in topic order
+	CoveredBy string   `json:"covered_by,omitempty"` // An earlier or broader filter of the connection matching every topic this one does
+}
+
+// ConnectionCoverage compares the subscription filters of a connection with the
+// topics seen on it
+type ConnectionCoverage struct {
+	Connection string           `json:"connection"`
+	Topics     int              `json:"topics"` // Topics seen on the connection
+	Filters    []FilterCoverage `json:"filters"`
+	// Topics seen that match none of the filters, e.g. under a mount point the
+	// broker adds, or from filters replaced by a config reload
+	Unmatched         int      `json:"unmatched"`
+	UnmatchedExamples []string `json:"unmatched_examples,omitempty"`
+}
+
+// Coverage compares the subscription filters of every connection with the topics
+// seen on it so far, in connection order. Topics are those of the last values, so
+// up to MaxLastValues topics are taken into account.
+func (s *State) Coverage() []ConnectionCoverage {
+	seen := s.last.topicsBySource()
+	s.clientsMu.RLock()
+	clients := s.clients
+	s.clientsMu.RUnlock()
+
+	coverage := make([]ConnectionCoverage, 0, len(clients))
+	for _, client := range clients {
+		coverage = append(coverage, filterCoverage(client.Name(), client.Config().Topics, seen[client.Name()]))
+	}
+	return coverage
+}
+
+// filterCoverage matches the topics seen on a connection, in topic order, against
+// its subscription filters
+func filterCoverage(connection string, filters, topics []string) ConnectionCoverage {
+	coverage := ConnectionCoverage{Connection: connection, Topics: len(topics)}
+	matched := make([]bool, len(topics))
+	for i, filter := range filters {
+		fc := FilterCoverage{Filter: filter}
+		shared := mqtt.SharedFilter(filter)
+		for j, other := range filters {
+			otherShared := mqtt.SharedFilter(other)
+			// Of two equal filters, the later one is the redundant one
+			if j != i && mqtt.FilterCovers(otherShared, shared) && (j < i || !mqtt.FilterCovers(shared, otherShared)) {
+				fc.CoveredBy = other
+				break
+			}
+		}
+		for k, topic := range topics {
+			if !mqtt.TopicMatches(shared, topic) {
+				continue
+			}
+			matched[k] = true
+			fc.Topics++
+			if len(fc.Examples) < CoverageExamples {
+				fc.Examples = append(fc.Examples, topic)
+			}
+		}
+		coverage.Filters = append(coverage.Filters, fc)
+	}
+
+	for k, topic := range topics {
+		if matched[k] {
+			continue
+		}
+		coverage.Unmatched++
+		if len(coverage.UnmatchedExamples) < CoverageExamples {
+			coverage.UnmatchedExamples = append(coverage.UnmatchedExamples, topic)
+		}
+	}
+	return coverage
+}
+
+// topicsBySource returns the topics with a last value by connection, each sorted
+func (l *lastValues) topicsBySource() map[string][]string {
+	topics := make(map[string][]string)
+	l.mu.RLock()
+	for key := range l.values {
+		topics[key.source] = append(topics[key.source], key.topic)
+	}
+	l.mu.RUnlock()
+
+	for _, list := range topics {
+		slices.Sort(list)
+	}
+	return topics
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+const (
+	// DefaultDecodeWorkers is the number of workers of a DecodePool
+	DefaultDecodeWorkers = 4
+	// DefaultDecodeQueue is the number of received messages each worker holds
+	// before further ones are dropped
+	DefaultDecodeQueue = 256
+)
+
+// Decoder transforms a received message, e.g. to decode a binary payload into
+// text or to evaluate rules on it. Decoders run on the workers of a DecodePool.
+type Decoder func(*Message)
+
+// DecodePool turns received MQTT messages into Messages on a fixed number of
+// workers, between the MQTT client's receive path and the channel of the
+// Client, so slow decoders delay neither the broker connection nor the UI.
+// Messages of a topic always go to the same worker, which keeps their order.
+type DecodePool struct {
+	queues   []chan decodeJob
+	decoders []Decoder
+	seed     maphash.Seed
+}
+
+type decodeJob struct {
+	client *Client
+	msg    mqtt.Message
+}
+
+// NewDecodePool returns a pool of workers, each holding up to queue messages,
+// that run decoders in order on every message. Run starts the workers.
+func NewDecodePool(workers, queue int, decoders ...Decoder) *DecodePool {
+	if workers <= 0 {
+		workers = DefaultDecodeWorkers
+	}
+	if queue <= 0 {
+		queue = DefaultDecodeQueue
+	}
+
+	p := &DecodePool{
+		queues:   make([]chan decodeJob, workers),
+		decoders: decoders,
+		seed:     maphash.MakeSeed(),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan decodeJob, queue)
+	}
+	return p
+}
+
+// Run decodes messages until ctx is done and returns once every worker has
+// stopped, so no decoded message is delivered after it returns
+func (p *DecodePool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, queue := range p.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-queue:
+					if message, ok := p.decode(job.client, job.msg); ok {
+						job.client.deliver(message)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Queued returns the number of messages waiting for a worker
+func (p *DecodePool) Queued() int {
+	queued := 0
+	for _, queue := range p.queues {
+		queued += len(queue)
+	}
+	return queued
+}
+
+// submit queues msg of client for its topic's worker without blocking. It
+// reports false when the worker is too far behind to take it.
+func (p *DecodePool) submit(client *Client, msg mqtt.Message) bool {
+	queue := p.queues[maphash.String(p.seed, msg.Topic)%uint64(len(p.queues))]
+	select {
+	case queue <- decodeJob{client: client, msg: msg}:
+		return true
+	default:
+		return false
+	}
+}
+
+// decode creates the Message of msg and applies the decoders. It reports false
+// when a decoder panicked, counting the message as dropped.
+func (p *DecodePool) decode(client *Client, msg mqtt.Message) (message Message, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			client.drops.decoderFailure.Add(1)
+			client.logger.Warn().Str("topic", msg.Topic).Msgf("Decoder failed, dropping message: %v", r)
+			ok = false
+		}
+	}()
+
+	message = client.newMessage(msg)
+	for _, decoder := range p.decoders {
+		decoder(&message)
+	}
+	return message, true
+}
@@ -0,0 +1,39 @@
+package monitor
+
+import "sync/atomic"
+
+// Drop points of the pipeline, the names of the counters of ConnectionStatus.Drops
+// and State.Drops
+const (
+	DropDecodeQueue     = "decode_queue"     // Received messages the decode workers had no room for
+	DropMessagesChannel = "messages_channel" // Decoded messages the message handler had no room for
+	DropEventsChannel   = "events_channel"   // Connection events the handler had no room for
+	DropErrorsChannel   = "errors_channel"   // Errors and status messages the handler had no room for
+	DropDecoderFailure  = "decoder_failure"  // Messages a decoder panicked on
+	DropSubscriber      = "subscriber"       // Messages and events API and sink subscribers missed
+)
+
+// dropCounters counts what a client lost at each of its drop points
+type dropCounters struct {
+	decodeQueue     atomic.Uint64
+	messagesChannel atomic.Uint64
+	eventsChannel   atomic.Uint64
+	errorsChannel   atomic.Uint64
+	decoderFailure  atomic.Uint64
+}
+
+// counts returns the counters by drop point
+func (d *dropCounters) counts() map[string]uint64 {
+	return map[string]uint64{
+		DropDecodeQueue:     d.decodeQueue.Load(),
+		DropMessagesChannel: d.messagesChannel.Load(),
+		DropEventsChannel:   d.eventsChannel.Load(),
+		DropErrorsChannel:   d.errorsChannel.Load(),
+		DropDecoderFailure:  d.decoderFailure.Load(),
+	}
+}
+
+// messages returns the number of messages lost, leaving out errors and events
+func (d *dropCounters) messages() uint64 {
+	return d.decodeQueue.Load() + d.messagesChannel.Load() + d.decoderFailure.Load()
+}
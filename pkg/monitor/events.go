@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Severity ranks the events sent on the errors channel, so views can color and
+// filter them
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota // Status changes such as a connection coming up
+	SeverityWarning                 // Degraded but recovering, e.g. reconnecting
+	SeverityError                   // Failures; also errors without a severity
+)
+
+// severityNames are the names of the severities, as used in configs and by String
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < SeverityInfo || s > SeverityError {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity name: "info", "warning" or "error"
+func ParseSeverity(name string) (Severity, error) {
+	for i, severityName := range severityNames {
+		if strings.EqualFold(name, severityName) {
+			return Severity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q (expected info, warning or error)", name)
+}
+
+// SeverityOf returns the severity of an error or status message sent on an errors
+// channel: that of the first error in its chain with a Severity method, or else
+// SeverityError
+func SeverityOf(err error) Severity {
+	var event interface{ Severity() Severity }
+	if errors.As(err, &event) {
+		return event.Severity()
+	}
+	return SeverityError
+}
+
+// notice is a status message for the errors pane that is not a failure, such as
+// a reloaded config
+type notice struct {
+	err      error
+	severity Severity
+}
+
+// Noticef formats a status message of severity like fmt.Errorf, e.g. for Monitor.Notify
+func Noticef(severity Severity, format string, args ...any) error {
+	return &notice{fmt.Errorf(format, args...), severity}
+}
+
+func (n *notice) Error() string      { return n.err.Error() }
+func (n *notice) Unwrap() error      { return n.err }
+func (n *notice) Severity() Severity { return n.severity }
+
+// ConnectionState is the state a ConnectionEvent reports
+type ConnectionState int
+
+const (
+	StateConnected    ConnectionState = iota // Reconnected, keeping the subscriptions of the session
+	StateSubscribed                          // Connected and subscribed to the topics
+	StateReconnecting                        // Trying to connect again after losing the connection
+	StateLost                                // Disconnected, with the cause in Err if there is one
+	StateFatal                               // Failed in a way reconnecting does not fix, e.g. a rejected subscription
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateSubscribed:
+		return "subscribed"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateLost:
+		return "lost"
+	case StateFatal:
+		return "fatal"
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// ConnectionEvent reports a change of the state of a connection. Clients send
+// them on the events channel given to NewClient.
+type ConnectionEvent struct {
+	Connection string
+	State      ConnectionState
+	Err        error // Cause of StateLost, nil for a clean disconnect, and of StateFatal
+	Time       time.Time
+}
+
+// String describes the event as the status view and session log show it
+func (e ConnectionEvent) String() string {
+	switch e.State {
+	case StateConnected:
+		return e.Connection + ": reconnected without resubscribing"
+	case StateSubscribed:
+		return e.Connection + ": connected and subscribed successfully"
+	case StateReconnecting:
+		return e.Connection + ": reconnecting"
+	case StateLost:
+		if e.Err == nil {
+			return e.Connection + ": disconnected"
+		}
+		return fmt.Sprintf("%s: connection error: %v", e.Connection, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Connection, e.Err)
+}
+
+// Severity returns how serious the event is: info for a connection coming up,
+// warning while reconnecting and error for a lost or failed connection
+func (e ConnectionEvent) Severity() Severity {
+	switch e.State {
+	case StateConnected, StateSubscribed:
+		return SeverityInfo
+	case StateReconnecting:
+		return SeverityWarning
+	}
+	return SeverityError
+}
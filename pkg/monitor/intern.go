@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"bytes"
+	"hash/maphash"
+	"sync"
+)
+
+const (
+	// DefaultInternedPayloads is the number of distinct payloads a PayloadInterner remembers
+	DefaultInternedPayloads = 4096
+	// MaxInternedPayloadSize is the largest payload worth interning; bigger ones
+	// are rarely repeated verbatim
+	MaxInternedPayloadSize = 4096
+)
+
+// PayloadInterner makes messages with identical payloads share one copy of the
+// payload bytes and text, so the message buffers of a broker repeating the same
+// heartbeats hold each payload once. Its Intern method is a Decoder.
+type PayloadInterner struct {
+	mu         sync.Mutex
+	seed       maphash.Seed
+	payloads   map[uint64]internedPayload // By hash of the raw payload
+	maxEntries int
+}
+
+type internedPayload struct {
+	raw  []byte
+	text string
+}
+
+// NewPayloadInterner returns an interner remembering up to maxEntries payloads
+func NewPayloadInterner(maxEntries int) *PayloadInterner {
+	if maxEntries <= 0 {
+		maxEntries = DefaultInternedPayloads
+	}
+	return &PayloadInterner{
+		seed:       maphash.MakeSeed(),
+		payloads:   make(map[uint64]internedPayload),
+		maxEntries: maxEntries,
+	}
+}
+
+// Intern replaces the payload of msg with the shared copy of an earlier message
+// with the same raw payload, or remembers it for later ones
+func (p *PayloadInterner) Intern(msg *Message) {
+	if len(msg.RawPayload) == 0 || len(msg.RawPayload) > MaxInternedPayloadSize {
+		return
+	}
+	hash := maphash.Bytes(p.seed, msg.RawPayload)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	shared, ok := p.payloads[hash]
+	if !ok {
+		if len(p.payloads) >= p.maxEntries {
+			// Forget half the payloads, whichever the map yields first: Go's map
+			// order is unspecified, so this is neither LRU nor FIFO. A payload
+			// still in use is remembered again on its next message.
+			count := 0
+			for k := range p.payloads {
+				delete(p.payloads, k)
+				count++
+				if count >= p.maxEntries/2 {
+					break
+				}
+			}
+		}
+		p.payloads[hash] = internedPayload{raw: msg.RawPayload, text: msg.Payload}
+		return
+	}
+	if !bytes.Equal(shared.raw, msg.RawPayload) {
+		return // Hash collision
+	}
+	msg.RawPayload = shared.raw
+	// An earlier decoder may have changed the text
+	if msg.Payload == shared.text {
+		msg.Payload = shared.text
+	}
+}
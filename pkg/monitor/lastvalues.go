@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+// MaxLastValues caps the topics whose last message is kept, so a topic explosion
+// cannot exhaust memory; messages of further topics are not kept
+const MaxLastValues = MaxTrackedTopics
+
+// lastValueKey identifies a topic of a connection
+type lastValueKey struct {
+	source string
+	topic  string
+}
+
+// lastValues keeps the newest message of every topic of every connection, like
+// the retained messages of a broker, so the current state of a topic can be
+// looked up after its messages left the recent message buffer
+type lastValues struct {
+	mu        sync.RWMutex
+	values    map[lastValueKey]Message
+	maxTopics int
+	spool     atomic.Pointer[PayloadSpool]
+}
+
+func newLastValues(maxTopics int) *lastValues {
+	return &lastValues{values: make(map[lastValueKey]Message), maxTopics: maxTopics}
+}
+
+// record replaces the last message of the topic and connection of msg
+func (l *lastValues) record(msg Message) {
+	if spool := l.spool.Load(); spool != nil {
+		msg = spool.Store(msg)
+	}
+	key := lastValueKey{source: msg.Source, topic: msg.Topic}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.values[key]; !ok && len(l.values) >= l.maxTopics {
+		return
+	}
+	l.values[key] = msg
+}
+
+// match returns the last messages of the topics matching the topic filter, all
+// of them for an empty filter, ordered by topic and connection
+func (l *lastValues) match(filter string) []Message {
+	var matched []Message
+	l.mu.RLock()
+	for key, msg := range l.values {
+		if filter == "" || mqtt.TopicMatches(filter, key.topic) {
+			matched = append(matched, msg)
+		}
+	}
+	l.mu.RUnlock()
+
+	slices.SortFunc(matched, func(a, b Message) int {
+		return cmp.Or(strings.Compare(a.Topic, b.Topic), strings.Compare(a.Source, b.Source))
+	})
+	return matched
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+// Message is a received MQTT message as it flows through the monitor
+type Message struct {
+	Topic        string
+	DisplayTopic string
+	Payload      string
+	RawPayload   []byte          // Unmodified payload bytes as received; shared between messages with the same payload, so never modified
+	Spooled      *SpooledPayload // Payload of a message stored without RawPayload, and possibly only a preview in Payload, see PayloadSpool
+	Source       string
+	Timestamp    time.Time
+	QoS          byte
+	Retained     bool
+	Color        string
+	Epoch        uint64 // Replay seek the message was emitted for, so those of an earlier seek can be dropped; zero for live messages
+}
+
+// Size approximates the memory held by the message: its payloads, topics and
+// names. A payload shared with other messages counts for each of them, a spooled
+// one only with its preview.
+func (m Message) Size() int {
+	return len(m.Topic) + len(m.DisplayTopic) + len(m.Payload) + len(m.RawPayload) + len(m.Source) + len(m.Color)
+}
+
+// Unspooled returns the message with the full payload of a spooled message read
+// back, or the message itself when it is not spooled
+func (m Message) Unspooled() (Message, error) {
+	if m.Spooled == nil {
+		return m, nil
+	}
+	raw, text, err := m.Spooled.Load()
+	if err != nil {
+		return m, err
+	}
+	if text != "" {
+		m.Payload = text
+	}
+	m.RawPayload, m.Spooled = raw, nil
+	return m, nil
+}
+
+// NewMessage creates a new Message from mqtt.Message
+func NewMessage(mqttMsg mqtt.Message, source string, topicDepth int, color string) Message {
+	displayTopic := mqtt.TruncateTopic(mqttMsg.Topic, topicDepth)
+	payload := mqtt.SanitizePayload(mqttMsg.Payload)
+
+	return Message{
+		Topic:        mqttMsg.Topic,
+		DisplayTopic: displayTopic,
+		Payload:      payload,
+		RawPayload:   mqttMsg.Payload,
+		Source:       source,
+		Timestamp:    mqttMsg.Timestamp,
+		QoS:          mqttMsg.QoS,
+		Retained:     mqttMsg.Retained,
+		Color:        color,
+	}
+}
+
+// FlattenJSON collects leaf values of a decoded JSON document keyed by dotted path
+func FlattenJSON(prefix string, value any, out map[string]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			FlattenJSON(name, child, out)
+		}
+	default:
+		if prefix != "" {
+			out[prefix] = v
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package monitor is the capture engine of mqtt-monitor: broker connections,
+// the received message type and the state (recent messages, statistics and
+// live subscriptions) that every output reads from. It has no user interface,
+// so other tools can embed it:
+//
+//	m := monitor.New(monitor.Options{Connections: connections})
+//	messages, cancel := m.State().Subscribe(1000)
+//	defer cancel()
+//	go m.Run(ctx)
+//	for msg := range messages {
+//		fmt.Println(msg.Topic, msg.Payload)
+//	}
+package monitor
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTopicDepth is the number of trailing topic levels kept in Message.DisplayTopic
+	DefaultTopicDepth = 3
+	// DefaultBufferSize is the number of recent messages kept for State.Messages
+	DefaultBufferSize = 10000
+
+	disconnectTimeout = 2 * time.Second
+)
+
+// Options configures a Monitor
+type Options struct {
+	Connections   []ConnectionConfig
+	TopicDepth    int       // Default: DefaultTopicDepth
+	BufferSize    int       // Default: DefaultBufferSize
+	DecodeWorkers int       // Workers decoding received messages, default: DefaultDecodeWorkers
+	Decoders      []Decoder // Applied in order to every received message, on the decode workers, after payload interning
+	Colors        []string  // Assigned cyclically to the connections, see Client.Color
+	Offline       bool      // Run does not connect the clients; messages are handed to Client.Receive, as benchmarks do
+}
+
+// Handler is called by Run, on its goroutine and in order, for everything the
+// monitor records: to show it, write it to a log or count it
+type Handler interface {
+	HandleMessage(msg Message)
+	HandleConnectionEvent(event ConnectionEvent)
+	HandleError(err error) // Errors and status messages, see SeverityOf
+}
+
+// Queues is a point-in-time view of how far the pipeline is behind
+type Queues struct {
+	Decode       int // Received messages waiting for a decode worker
+	Messages     int // Decoded messages waiting for Run
+	MessagesSize int
+	Events       int
+	EventsSize   int
+	Errors       int
+	ErrorsSize   int
+}
+
+// Monitor connects to the configured brokers and records everything they deliver in its State
+type Monitor struct {
+	state    *State
+	decoder  *DecodePool
+	messages chan Message
+	events   chan ConnectionEvent
+	errors   chan error
+	probes   chan chan struct{}
+	handlers []Handler
+	colors   []string
+	offline  bool
+
+	mu        sync.Mutex // Guards clients, nextColor and ctx
+	clients   []*Client
+	nextColor int
+	ctx       context.Context // Of Run, for the clients created while it runs
+}
+
+func New(opts Options) *Monitor {
+	if opts.TopicDepth <= 0 {
+		opts.TopicDepth = DefaultTopicDepth
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+
+	m := &Monitor{
+		decoder:  NewDecodePool(opts.DecodeWorkers, DefaultDecodeQueue, append([]Decoder{NewPayloadInterner(DefaultInternedPayloads).Intern}, opts.Decoders...)...),
+		messages: make(chan Message, 1000),
+		events:   make(chan ConnectionEvent, 100),
+		errors:   make(chan error, 100),
+		probes:   make(chan chan struct{}),
+		colors:   opts.Colors,
+		offline:  opts.Offline,
+	}
+	for _, conn := range opts.Connections {
+		m.clients = append(m.clients, m.NewClient(conn, opts.TopicDepth, m.NextColor()))
+	}
+	m.state = NewState(m.clients, opts.BufferSize)
+	return m
+}
+
+// State returns the state the monitor records into
+func (m *Monitor) State() *State {
+	return m.state
+}
+
+// Clients returns the broker connections, e.g. to register OnConnected hooks before Run
+func (m *Monitor) Clients() []*Client {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clients
+}
+
+// NewClient returns a client for conn that feeds this monitor, e.g. for a
+// connection added at runtime. It is neither monitored nor connected until it is
+// passed to SetClients and Connect.
+func (m *Monitor) NewClient(conn ConnectionConfig, topicDepth int, color string) *Client {
+	client := NewClient(conn, m.messages, m.events, m.errors, topicDepth)
+	client.SetDecodePool(m.decoder)
+	client.SetColor(color)
+
+	m.mu.Lock()
+	if m.ctx != nil {
+		client.SetContext(m.ctx)
+	}
+	m.mu.Unlock()
+	return client
+}
+
+// NextColor returns the next of Options.Colors, continuing the cyclic assignment
+// of the configured connections; empty without colors
+func (m *Monitor) NextColor() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.colors) == 0 {
+		return ""
+	}
+	color := m.colors[m.nextColor%len(m.colors)]
+	m.nextColor++
+	return color
+}
+
+// SetClients replaces the monitored connections, e.g. after a configuration
+// reload. Clients that are no longer monitored must be disconnected by the caller.
+func (m *Monitor) SetClients(clients []*Client) {
+	m.mu.Lock()
+	m.clients = slices.Clone(clients)
+	m.mu.Unlock()
+	m.state.SetClients(clients)
+}
+
+// Connect connects clients in the background. Failures are recorded as
+// connection events; the clients keep retrying.
+func (m *Monitor) Connect(clients ...*Client) {
+	for _, client := range clients {
+		go func(c *Client) {
+			if err := c.Connect(); err != nil {
+				select {
+				case m.events <- ConnectionEvent{Connection: c.Name(), State: StateLost, Err: err, Time: time.Now()}:
+				default:
+					c.drops.eventsChannel.Add(1)
+				}
+			}
+		}(client)
+	}
+}
+
+// AddHandler makes Run call h for everything it records. It must be called before Run.
+func (m *Monitor) AddHandler(h Handler) {
+	m.handlers = append(m.handlers, h)
+}
+
+// Notify records err, an error or status message such as a notice of a
+// component, as if a connection had reported it. It never blocks: when Run is
+// behind, err is dropped.
+func (m *Monitor) Notify(err error) {
+	if err == nil {
+		return
+	}
+	select {
+	case m.errors <- err:
+	default:
+	}
+}
+
+// Feed returns the channels Run reads from, for sources of messages and events
+// other than broker connections, such as a replayed session log
+func (m *Monitor) Feed() (chan<- Message, chan<- error) {
+	return m.messages, m.errors
+}
+
+// Queues returns the current levels of the pipeline's queues
+func (m *Monitor) Queues() Queues {
+	return Queues{
+		Decode:       m.decoder.Queued(),
+		Messages:     len(m.messages),
+		MessagesSize: cap(m.messages),
+		Events:       len(m.events),
+		EventsSize:   cap(m.events),
+		Errors:       len(m.errors),
+		ErrorsSize:   cap(m.errors),
+	}
+}
+
+// Alive reports whether Run answers a probe before ctx is done, i.e. whether the
+// message loop is making progress
+func (m *Monitor) Alive(ctx context.Context) bool {
+	reply := make(chan struct{})
+	select {
+	case m.probes <- reply:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case <-reply:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run connects every client and records messages and events until ctx is
+// cancelled, then disconnects and waits for the decode workers to stop.
+// Connection failures are recorded as events; clients keep retrying in the
+// background.
+func (m *Monitor) Run(ctx context.Context) {
+	decoded := make(chan struct{})
+	go func() {
+		defer close(decoded)
+		m.decoder.Run(ctx)
+	}()
+
+	m.mu.Lock()
+	m.ctx = ctx
+	clients := m.clients
+	m.mu.Unlock()
+	for _, client := range clients {
+		client.SetContext(ctx)
+	}
+	if !m.offline {
+		m.Connect(clients...)
+	}
+
+	defer func() {
+		m.Disconnect(m.Clients()...)
+		<-decoded
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-m.messages:
+			m.state.RecordMessage(msg)
+			for _, h := range m.handlers {
+				h.HandleMessage(msg)
+			}
+			if err := m.state.CheckSequence(msg); err != nil {
+				m.recordError(err)
+			}
+		case event := <-m.events:
+			m.state.RecordConnectionEvent(event)
+			for _, h := range m.handlers {
+				h.HandleConnectionEvent(event)
+			}
+		case err := <-m.errors:
+			if err != nil {
+				m.recordError(err)
+			}
+		case reply := <-m.probes:
+			close(reply)
+		}
+	}
+}
+
+// recordError records err and passes it to the handlers
+func (m *Monitor) recordError(err error) {
+	m.state.RecordEvent(err)
+	for _, h := range m.handlers {
+		h.HandleError(err)
+	}
+}
+
+// Disconnect closes the connections of clients, giving up after disconnectTimeout
+func (m *Monitor) Disconnect(clients ...*Client) {
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			c.Disconnect()
+		}(client)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(disconnectTimeout):
+	}
+}
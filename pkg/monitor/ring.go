@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MessageRing is a fixed-capacity, thread-safe buffer of the most recent messages.
+// Once full, each new message overwrites the oldest one. With a byte limit set,
+// the oldest messages are also dropped while the stored ones exceed it. With a
+// spool set, large payloads are stored in the spool.
+type MessageRing struct {
+	mu       sync.RWMutex
+	items    []Message
+	start    int // Index of the oldest message
+	count    int
+	bytes    int64 // Size of the stored messages
+	maxBytes int64 // 0 for no limit
+	spool    atomic.Pointer[PayloadSpool]
+}
+
+func NewMessageRing(capacity int) *MessageRing {
+	return &MessageRing{items: make([]Message, capacity)}
+}
+
+// Add stores a message, evicting the oldest when the ring is full. It returns how
+// many messages were dropped to stay within the byte limit.
+func (r *MessageRing) Add(msg Message) (trimmed int) {
+	if spool := r.spool.Load(); spool != nil {
+		msg = spool.Store(msg)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.items) == 0 {
+		return 0
+	}
+
+	if r.count == len(r.items) {
+		r.evictOldest()
+	}
+	r.items[(r.start+r.count)%len(r.items)] = msg
+	r.count++
+	r.bytes += int64(msg.Size())
+	return r.trim()
+}
+
+// SetMaxBytes limits the total size of the stored messages, 0 for no limit, and
+// returns how many messages were dropped to meet it
+func (r *MessageRing) SetMaxBytes(limit int64) (trimmed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maxBytes = limit
+	return r.trim()
+}
+
+// SetSpool makes the ring store the messages spool returns, nil to keep every
+// payload in memory. Messages already stored are not affected.
+func (r *MessageRing) SetSpool(spool *PayloadSpool) {
+	r.spool.Store(spool)
+}
+
+// Bytes returns the total size of the stored messages
+func (r *MessageRing) Bytes() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bytes
+}
+
+// trim drops the oldest messages while the stored ones exceed the byte limit. The
+// newest message is kept even when it exceeds the limit alone.
+func (r *MessageRing) trim() (trimmed int) {
+	for r.maxBytes > 0 && r.bytes > r.maxBytes && r.count > 1 {
+		r.evictOldest()
+		trimmed++
+	}
+	return trimmed
+}
+
+// evictOldest drops the oldest message, releasing its payload
+func (r *MessageRing) evictOldest() {
+	r.bytes -= int64(r.items[r.start].Size())
+	r.items[r.start] = Message{}
+	r.start = (r.start + 1) % len(r.items)
+	r.count--
+}
+
+// Len returns the number of stored messages
+func (r *MessageRing) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.count
+}
+
+// Each calls fn for every stored message from oldest to newest until fn returns false
+func (r *MessageRing) Each(fn func(Message) bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := 0; i < r.count; i++ {
+		if !fn(r.items[(r.start+i)%len(r.items)]) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the stored messages, oldest first
+func (r *MessageRing) Snapshot() []Message {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Message, r.count)
+	for i := range out {
+		out[i] = r.items[(r.start+i)%len(r.items)]
+	}
+	return out
+}
+
+// Clear removes all messages
+func (r *MessageRing) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clear(r.items)
+	r.start, r.count, r.bytes = 0, 0, 0
+}
+
+// Last returns a copy of the newest n stored messages, oldest first
+func (r *MessageRing) Last(n int) []Message {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n = min(n, r.count)
+	out := make([]Message, n)
+	for i := range out {
+		out[i] = r.items[(r.start+r.count-n+i)%len(r.items)]
+	}
+	return out
+}
@@ -0,0 +1,157 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// secretTimeout bounds a single secret command or Vault request
+const secretTimeout = 30 * time.Second
+
+// secretFunc returns a function fetching a secret from command or, if command is
+// empty, from the Vault reference vault, or nil when neither is set
+func secretFunc(command, vault, defaultField string) func() (string, error) {
+	switch {
+	case command != "":
+		return func() (string, error) { return commandSecret(command) }
+	case vault != "":
+		return func() (string, error) { return VaultSecret(vault, defaultField) }
+	}
+	return nil
+}
+
+// commandSecret runs command through the shell and returns its output without
+// the trailing newline
+func commandSecret(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("secret command %q: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("secret command %q: %w", command, err)
+	}
+	secret := strings.TrimRight(string(out), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secret command %q printed nothing", command)
+	}
+	return secret, nil
+}
+
+// ParseVaultRef splits a Vault reference "path#field" into the secret path and
+// field, defaultField when the reference has none
+func ParseVaultRef(ref, defaultField string) (path, field string, err error) {
+	path, field, _ = strings.Cut(ref, "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", "", fmt.Errorf("invalid Vault secret %q (expected \"path#field\", e.g. \"secret/data/mqtt#password\")", ref)
+	}
+	if field == "" {
+		field = defaultField
+	}
+	return path, field, nil
+}
+
+// VaultSecret reads a field of a Vault secret over the HTTP API. The server and
+// token come from VAULT_ADDR and VAULT_TOKEN (or ~/.vault-token), as for the
+// vault CLI; VAULT_NAMESPACE and VAULT_CACERT are honored. Both KV version 1
+// and 2 secrets are supported, for version 2 the path includes "data/".
+func VaultSecret(ref, defaultField string) (string, error) {
+	path, field, err := ParseVaultRef(ref, defaultField)
+	if err != nil {
+		return "", err
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("vault %s: VAULT_ADDR is not set", path)
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return "", fmt.Errorf("vault %s: %w", path, err)
+	}
+
+	client := &http.Client{Timeout: secretTimeout}
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return "", fmt.Errorf("vault %s: %w", path, err)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault %s: %w", path, err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data   map[string]any `json:"data"`
+		Errors []string       `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("vault %s: invalid response: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(body.Errors) > 0 {
+			return "", fmt.Errorf("vault %s: %s: %s", path, resp.Status, strings.Join(body.Errors, "; "))
+		}
+		return "", fmt.Errorf("vault %s: %s", path, resp.Status)
+	}
+
+	data := body.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested // KV version 2
+		}
+	}
+	value, ok := data[field].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("vault %s: no string field %q", path, field)
+	}
+	return value, nil
+}
+
+// vaultToken returns VAULT_TOKEN or the token stored by "vault login"
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("VAULT_TOKEN is not set")
+	}
+	token, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", fmt.Errorf("VAULT_TOKEN is not set and ~/.vault-token cannot be read")
+	}
+	return strings.TrimSpace(string(token)), nil
+}
@@ -0,0 +1,257 @@
+package monitor
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+// SequenceRule names the payload field counting the messages of the topics
+// matching a filter, so lost messages show up as gaps in the count
+type SequenceRule struct {
+	Topic string `toml:"topic"` // MQTT topic filter, wildcards allowed
+	Field string `toml:"field"` // JSONPath of the counter in JSON payloads, e.g. "$.seq" or "$.meta.counters[0]"
+}
+
+// Validate checks the topic filter and the path of the rule
+func (r SequenceRule) Validate() error {
+	if err := mqtt.ValidateTopicFilter(r.Topic); err != nil {
+		return fmt.Errorf("sequence on %q: %w", r.Topic, err)
+	}
+	if _, err := parseJSONPath(r.Field); err != nil {
+		return fmt.Errorf("sequence on %q: %w", r.Topic, err)
+	}
+	return nil
+}
+
+// SequenceStats counts the messages of a topic of a connection by their sequence
+// numbers
+type SequenceStats struct {
+	Source     string    `json:"source"`
+	Topic      string    `json:"topic"`
+	Last       uint64    `json:"last"`       // Sequence number of the newest message
+	Messages   uint64    `json:"messages"`   // Messages with a sequence number
+	Lost       uint64    `json:"lost"`       // Sequence numbers skipped by gaps
+	Gaps       uint64    `json:"gaps"`       // Times the sequence skipped numbers
+	Resets     uint64    `json:"resets"`     // Times the sequence went back, e.g. on a device restart
+	Duplicates uint64    `json:"duplicates"` // Messages repeating the last number, e.g. redelivered with QoS 1
+	LastIssue  time.Time `json:"last_issue,omitzero"`
+}
+
+// SequenceIssue is a gap or a reset in the sequence numbers of a topic, reported
+// as a warning on the errors channel
+type SequenceIssue struct {
+	Source   string
+	Topic    string
+	Previous uint64 // Sequence number of the message before
+	Current  uint64
+}
+
+func (e *SequenceIssue) Error() string {
+	if e.Current < e.Previous {
+		return fmt.Sprintf("sequence reset on %s (%s): %d after %d", e.Topic, e.Source, e.Current, e.Previous)
+	}
+	return fmt.Sprintf("sequence gap on %s (%s): %d after %d, %d lost", e.Topic, e.Source, e.Current, e.Previous, e.Current-e.Previous-1)
+}
+
+// Severity makes sequence issues warnings
+func (e *SequenceIssue) Severity() Severity {
+	return SeverityWarning
+}
+
+// sequenceKey identifies the sequence of a topic of a connection
+type sequenceKey struct {
+	source string
+	topic  string
+}
+
+// compiledSequenceRule is a SequenceRule with its path parsed
+type compiledSequenceRule struct {
+	topic string
+	path  jsonPath
+}
+
+// sequences tracks the sequence numbers of the topics matching the rules, up to
+// MaxTrackedTopics topics
+type sequences struct {
+	mu    sync.Mutex
+	rules []compiledSequenceRule
+	stats map[sequenceKey]*SequenceStats
+}
+
+// setRules replaces the rules; topics keep their counts
+func (s *sequences) setRules(rules []SequenceRule) error {
+	compiled := make([]compiledSequenceRule, 0, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		path, _ := parseJSONPath(rule.Field)
+		compiled = append(compiled, compiledSequenceRule{topic: rule.Topic, path: path})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = compiled
+	if s.stats == nil {
+		s.stats = make(map[sequenceKey]*SequenceStats)
+	}
+	return nil
+}
+
+// check counts the sequence number of msg when a rule matches its topic, and
+// returns the gap or reset it makes, if any
+func (s *sequences) check(msg Message) *SequenceIssue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.rules, func(rule compiledSequenceRule) bool { return mqtt.TopicMatches(rule.topic, msg.Topic) })
+	if i < 0 {
+		return nil
+	}
+	current, ok := sequenceNumber(msg.RawPayload, s.rules[i].path)
+	if !ok {
+		return nil
+	}
+
+	key := sequenceKey{source: msg.Source, topic: msg.Topic}
+	stats, ok := s.stats[key]
+	if !ok {
+		if len(s.stats) >= MaxTrackedTopics {
+			return nil
+		}
+		s.stats[key] = &SequenceStats{Source: msg.Source, Topic: msg.Topic, Last: current, Messages: 1}
+		return nil
+	}
+
+	previous := stats.Last
+	stats.Last = current
+	stats.Messages++
+	switch {
+	case current == previous+1:
+		return nil
+	case current == previous:
+		stats.Duplicates++
+		return nil
+	case current > previous:
+		stats.Gaps++
+		stats.Lost += current - previous - 1
+	default:
+		stats.Resets++
+	}
+	stats.LastIssue = msg.Timestamp
+	return &SequenceIssue{Source: msg.Source, Topic: msg.Topic, Previous: previous, Current: current}
+}
+
+// snapshot returns the counts of every topic, those with the most lost messages
+// first, then by topic and connection
+func (s *sequences) snapshot() []SequenceStats {
+	s.mu.Lock()
+	stats := make([]SequenceStats, 0, len(s.stats))
+	for _, st := range s.stats {
+		stats = append(stats, *st)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(stats, func(a, b SequenceStats) int {
+		return cmp.Or(cmp.Compare(b.Lost, a.Lost), cmp.Compare(b.Resets, a.Resets),
+			strings.Compare(a.Topic, b.Topic), strings.Compare(a.Source, b.Source))
+	})
+	return stats
+}
+
+// sequenceNumber returns the non-negative integer at path in a JSON payload, also
+// when it is a string of digits
+func sequenceNumber(payload []byte, path jsonPath) (uint64, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return 0, false
+	}
+
+	value, ok := path.lookup(document)
+	if !ok {
+		return 0, false
+	}
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = v.String()
+	case string:
+		text = v
+	default:
+		return 0, false
+	}
+	n, err := strconv.ParseUint(text, 10, 64)
+	return n, err == nil
+}
+
+// jsonPath is a parsed JSONPath of object member names (string) and array
+// indexes (int)
+type jsonPath []any
+
+// parseJSONPath parses a JSONPath made of names and indexes, such as
+// "$.meta.seq" or "$.counters[0]"; the leading "$." may be left out
+func parseJSONPath(path string) (jsonPath, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if rest == "" {
+		return nil, fmt.Errorf("field %q: a JSONPath to the counter is required, e.g. \"$.seq\"", path)
+	}
+
+	var parsed jsonPath
+	for i, segment := range strings.Split(rest, ".") {
+		name, indexes, indexed := strings.Cut(segment, "[")
+		switch {
+		case name != "":
+			parsed = append(parsed, name)
+		case i > 0 || !indexed: // Only "$[0]" indexes the document itself
+			return nil, fmt.Errorf("field %q: empty name", path)
+		}
+		if !indexed {
+			continue
+		}
+		if !strings.HasSuffix(indexes, "]") {
+			return nil, fmt.Errorf("field %q: unterminated array index in %q", path, segment)
+		}
+		for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("field %q: invalid array index in %q", path, segment)
+			}
+			parsed = append(parsed, n)
+		}
+	}
+	return parsed, nil
+}
+
+// lookup returns the value at the path in a decoded JSON document
+func (p jsonPath) lookup(document any) (any, bool) {
+	value := document
+	for _, step := range p {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[step]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := value.([]any)
+			if !ok || step >= len(array) {
+				return nil, false
+			}
+			value = array[step]
+		}
+	}
+	return value, true
+}
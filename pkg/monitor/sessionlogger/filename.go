@@ -0,0 +1,87 @@
+package sessionlogger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultFilenameTemplate reproduces the historical session log names
+const DefaultFilenameTemplate = "mqtt_monitor_{date}_{time}"
+
+// filenamePlaceholders lists the placeholders understood by session log filename templates
+var filenamePlaceholders = []string{
+	"{hostname}", "{connection}", "{date}", "{time}",
+	"{year}", "{month}", "{day}", "{hour}", "{minute}", "{second}", "{seq}",
+}
+
+// filenameVars are the values substituted into a filename template
+type filenameVars struct {
+	Hostname   string
+	Connection string
+	Time       time.Time
+	Sequence   int
+}
+
+// expandFilenameTemplate substitutes placeholders in tmpl; the extension is added by the caller
+func expandFilenameTemplate(tmpl string, vars filenameVars) string {
+	t := vars.Time
+	replacer := strings.NewReplacer(
+		"{hostname}", sanitizeFilenamePart(vars.Hostname),
+		"{connection}", sanitizeFilenamePart(vars.Connection),
+		"{date}", t.Format("20060102"),
+		"{time}", t.Format("150405"),
+		"{year}", t.Format("2006"),
+		"{month}", t.Format("01"),
+		"{day}", t.Format("02"),
+		"{hour}", t.Format("15"),
+		"{minute}", t.Format("04"),
+		"{second}", t.Format("05"),
+		"{seq}", fmt.Sprintf("%04d", vars.Sequence),
+	)
+	return replacer.Replace(tmpl)
+}
+
+// filenameTemplateGlob turns a template into a glob matching every name it can produce
+func filenameTemplateGlob(tmpl string) string {
+	pairs := make([]string, 0, 2*len(filenamePlaceholders))
+	for _, placeholder := range filenamePlaceholders {
+		pairs = append(pairs, placeholder, "*")
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+// ValidateFilenameTemplate rejects templates that would escape the output directory
+func ValidateFilenameTemplate(tmpl string) error {
+	if strings.ContainsAny(tmpl, `/\`) {
+		return fmt.Errorf("session_log_filename must not contain path separators")
+	}
+	if strings.TrimSpace(filenameTemplateGlob(tmpl)) == "" {
+		return fmt.Errorf("session_log_filename must not be empty")
+	}
+	if _, err := filepath.Match(filenameTemplateGlob(tmpl), ""); err != nil {
+		return fmt.Errorf("invalid session_log_filename: %w", err)
+	}
+	return nil
+}
+
+func sanitizeFilenamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ' ', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// hostname returns the local host name or "unknown"
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "unknown"
+	}
+	return name
+}
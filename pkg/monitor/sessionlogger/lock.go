@@ -0,0 +1,108 @@
+package sessionlogger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Instances writing session logs to the same output directory lock a slot there:
+// the first one .mqtt-monitor.lock, the next ones .mqtt-monitor.2.lock and so on.
+// Instances after the first add their number to their file names, and every
+// instance locks its active files, so no instance appends to or removes the file
+// another one writes.
+const (
+	instanceLockName = ".mqtt-monitor"
+	maxInstances     = 64 // Slots tried before giving up
+)
+
+// outputDirLock is the slot of this instance in an output directory
+type outputDirLock struct {
+	file     *os.File
+	instance int   // 1 for the first instance, which keeps the plain file names
+	others   []int // Process IDs of the instances holding the slots before ours
+}
+
+// lockOutputDir locks the first free instance slot of dir. The lock is held until
+// Close, or until the process exits.
+func lockOutputDir(dir string) (*outputDirLock, error) {
+	lock := &outputDirLock{}
+	for instance := 1; instance <= maxInstances; instance++ {
+		path := filepath.Join(dir, instanceLockFile(instance))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		locked, err := tryLock(file, true)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if !locked {
+			if pid, err := readLockPID(file); err == nil {
+				lock.others = append(lock.others, pid)
+			}
+			file.Close()
+			continue
+		}
+
+		// The process ID tells users and other instances who holds the slot
+		if err := file.Truncate(0); err == nil {
+			file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+		}
+		lock.file = file
+		lock.instance = instance
+		return lock, nil
+	}
+	return nil, fmt.Errorf("all %d instance slots of %s are locked", maxInstances, dir)
+}
+
+// instanceLockFile returns the name of the lockfile of an instance slot
+func instanceLockFile(instance int) string {
+	if instance == 1 {
+		return instanceLockName + ".lock"
+	}
+	return fmt.Sprintf("%s.%d.lock", instanceLockName, instance)
+}
+
+// readLockPID returns the process ID written to a lockfile
+func readLockPID(file *os.File) (int, error) {
+	data := make([]byte, 32)
+	n, err := file.ReadAt(data, 0)
+	if n == 0 {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data[:n])))
+}
+
+// filenameSuffix returns what instances after the first add to the file name
+// template, e.g. "_instance2"
+func (l *outputDirLock) filenameSuffix() string {
+	if l.instance <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("_instance%d", l.instance)
+}
+
+// Close releases the slot; the lockfile stays for the next instance
+func (l *outputDirLock) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// sessionLogInUse reports whether a session log is locked as the active file of
+// a session logger, of this or another instance
+func sessionLogInUse(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	locked, err := tryLock(file, false)
+	return err == nil && !locked
+}
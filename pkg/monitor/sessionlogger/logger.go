@@ -0,0 +1,662 @@
+// Package sessionlogger records the messages and events of a monitor to files
+// in the output directory: text, jsonl or binary capture session logs with
+// rotation, retention, topic filters and sharding, checksum manifests and
+// statistics summaries. Instances sharing an output directory lock a slot each
+// and keep off each other's files.
+package sessionlogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+	"github.com/rawrobot/tui-mqtt-monitor/pkg/monitor"
+)
+
+// Supported session log formats
+const (
+	FormatText   = "text"
+	FormatJSONL  = "jsonl"
+	FormatBinary = "binary"
+)
+
+// Session log rotation modes
+const (
+	RotationDuration = "duration"  // Rotate after session_log_max_duration
+	RotationDaily    = "daily"     // Rotate at local midnight
+	RotationDailyUTC = "daily_utc" // Rotate at UTC midnight
+)
+
+// NewMessageRecord converts a received message into its structured record, with
+// the full payload of a spooled message. When the spool no longer has it, the
+// record has the preview.
+func NewMessageRecord(msg monitor.Message) sessionlog.Record {
+	if unspooled, err := msg.Unspooled(); err == nil {
+		msg = unspooled
+	}
+	return sessionlog.Record{
+		Type:         sessionlog.TypeMessage,
+		Timestamp:    msg.Timestamp,
+		Source:       msg.Source,
+		Topic:        msg.Topic,
+		DisplayTopic: msg.DisplayTopic,
+		Payload:      msg.Payload,
+		RawPayload:   msg.RawPayload,
+		QoS:          msg.QoS,
+		Retained:     msg.Retained,
+	}
+}
+
+// Config holds the parsed session logging settings
+type Config struct {
+	OutputDir    string
+	Format       string
+	MaxDuration  time.Duration
+	Rotation     string // RotationDuration (default), RotationDaily or RotationDailyUTC
+	MaxSize      int64  // Rotate when the current file exceeds this many bytes (0 disables)
+	Retention    RetentionPolicy
+	Topics       TopicFilterSet // Only messages on matching topics are logged
+	Filename     string         // Filename template, see DefaultFilenameTemplate
+	Connection   string         // Value of the {connection} filename placeholder
+	Append       bool           // Resume the most recent log if it has not reached its limits
+	Checksums    bool           // Write a sidecar manifest with SHA-256 and record count when a file is closed
+	ShardByTopic bool           // Write a separate file per first topic level
+	Summary      bool           // Write a statistics summary next to each finished log
+	Instance     int            // Instance slot in OutputDir, see lock.go; 0 to lock a free one
+}
+
+type Logger struct {
+	outputDir   string
+	format      string
+	file        *os.File
+	path        string
+	fileSize    int64
+	maxDuration time.Duration
+	rotation    string
+	maxSize     int64
+	retention   RetentionPolicy
+	topics      TopicFilterSet
+	added       TopicFilterSet // Filters added at runtime, kept when the configured ones are replaced
+	filename    string
+	connection  string
+	hostname    string
+	sequence    int
+	checksums   bool
+	summary     bool
+	stats       *logStats // Statistics of the active file
+	startTime   time.Time
+	currentTime time.Time
+	logger      zerolog.Logger
+	mu          sync.Mutex
+	closed      bool
+	paused      atomic.Bool
+	ticker      *time.Ticker
+	dirLock     *outputDirLock // Instance slot in outputDir, nil for shards and without locking
+
+	// Receives a copy of every written line, e.g. for the tail socket
+	tap func([]byte)
+
+	// Topic sharding, see shards.go
+	config Config
+	shards map[string]*Logger
+	ctx    context.Context
+}
+
+func New(config Config, logger zerolog.Logger) (*Logger, error) {
+	format := config.Format
+	switch format {
+	case "":
+		format = FormatText
+	case FormatText, FormatJSONL, FormatBinary:
+	default:
+		return nil, fmt.Errorf("unsupported session log format: %s", format)
+	}
+
+	if config.Filename == "" {
+		config.Filename = DefaultFilenameTemplate
+	}
+
+	// Shards share the slot of their router
+	var dirLock *outputDirLock
+	if config.Instance == 0 {
+		var err error
+		dirLock, err = lockOutputDir(config.OutputDir)
+		if err != nil {
+			logger.Warn().Err(err).Str("dir", config.OutputDir).Msg("Failed to lock output directory; other instances writing to it go unnoticed")
+			config.Instance = 1
+		} else {
+			config.Instance = dirLock.instance
+			config.Filename += dirLock.filenameSuffix()
+		}
+	}
+
+	sl := &Logger{
+		outputDir:   config.OutputDir,
+		format:      format,
+		maxDuration: config.MaxDuration,
+		rotation:    config.Rotation,
+		maxSize:     config.MaxSize,
+		retention:   config.Retention,
+		topics:      config.Topics,
+		filename:    config.Filename,
+		connection:  config.Connection,
+		hostname:    hostname(),
+		checksums:   config.Checksums,
+		summary:     config.Summary,
+		stats:       newLogStats(),
+		logger:      logger,
+		currentTime: time.Now(),
+		ticker:      time.NewTicker(time.Second),
+		dirLock:     dirLock,
+		config:      config,
+	}
+
+	if config.ShardByTopic {
+		sl.shards = make(map[string]*Logger)
+		return sl, nil
+	}
+
+	if config.Append && sl.resumeLatest() {
+		return sl, nil
+	}
+
+	if err := sl.rotateFile(); err != nil {
+		dirLock.Close()
+		return nil, err
+	}
+
+	return sl, nil
+}
+
+// Instance returns the instance slot of the logger in its output directory, 1 for
+// the first instance, and the process IDs of the instances before it
+func (sl *Logger) Instance() (instance int, others []int) {
+	if sl.dirLock == nil {
+		return sl.config.Instance, nil
+	}
+	return sl.dirLock.instance, sl.dirLock.others
+}
+
+// resumeLatest reopens the newest session log for appending when it is not yet due for
+// rotation (by age, day or size). It reports whether a file was resumed.
+func (sl *Logger) resumeLatest() bool {
+	files, err := listSessionLogs(sl.outputDir, filenameTemplateGlob(sl.filename))
+	if err != nil {
+		return false
+	}
+
+	// Only files written in the current format can be continued
+	for i := len(files) - 1; i >= 0; i-- {
+		latest := files[i]
+		if filepath.Ext(latest.path) != sl.extension() {
+			continue
+		}
+
+		startTime := sessionLogStartTime(latest.path, latest.modTime)
+		if sl.rotationDue(startTime, latest.size) {
+			return false
+		}
+
+		file, err := os.OpenFile(latest.path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			sl.logger.Warn().Err(err).Str("file", latest.path).Msg("Failed to reopen session log")
+			return false
+		}
+		if locked, err := tryLock(file, true); err == nil && !locked {
+			file.Close()
+			sl.logger.Info().Str("file", latest.path).Msg("Latest session log is written by another instance")
+			return false
+		}
+
+		sl.file = file
+		sl.path = latest.path
+		sl.fileSize = latest.size
+		sl.startTime = startTime
+		sl.logger.Info().Str("file", latest.path).Msg("Resumed session log file")
+
+		sl.cleanupOldLogs(latest.path)
+		return true
+	}
+
+	return false
+}
+
+func (sl *Logger) Start(ctx context.Context) {
+	sl.mu.Lock()
+	sl.ctx = ctx
+	sl.mu.Unlock()
+
+	go sl.timeKeeper(ctx)
+}
+
+func (sl *Logger) timeKeeper(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-sl.ticker.C:
+			sl.mu.Lock()
+			sl.currentTime = t
+			sl.mu.Unlock()
+		}
+	}
+}
+
+func (sl *Logger) rotateFile() error {
+	sl.closeFile()
+
+	sl.startTime = sl.currentTime
+	sl.sequence++
+	file, path, err := sl.createUniqueFile(sl.generateFilename())
+	if err != nil {
+		return fmt.Errorf("failed to create session log file: %w", err)
+	}
+	// Keeps other instances from resuming or removing the file; where flock is
+	// not supported, the file is not protected
+	tryLock(file, true)
+
+	sl.file = file
+	sl.path = path
+	sl.fileSize = 0
+	if sl.format == FormatBinary {
+		n, err := file.WriteString(sessionlog.CaptureMagic)
+		if err != nil {
+			return fmt.Errorf("failed to write capture header: %w", err)
+		}
+		sl.fileSize = int64(n)
+	}
+	sl.logger.Info().Str("file", path).Msg("Created new session log file")
+
+	sl.cleanupOldLogs(path)
+
+	return nil
+}
+
+// Rotate closes the current file and starts a new one immediately.
+// It returns the path of the new file.
+func (sl *Logger) Rotate() (string, error) {
+	if sl.shards != nil {
+		return sl.rotateShards()
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.closed {
+		return "", fmt.Errorf("session logger has been closed")
+	}
+
+	if err := sl.rotateFile(); err != nil {
+		return "", err
+	}
+	return sl.path, nil
+}
+
+// cleanupOldLogs enforces the retention policy, keeping the active file
+func (sl *Logger) cleanupOldLogs(active string) {
+	removed, err := applyRetention(sl.outputDir, filenameTemplateGlob(sl.filename), sl.retention, active, sl.currentTime)
+	if err != nil {
+		sl.logger.Error().Err(err).Msg("Failed to apply session log retention")
+	}
+	for _, path := range removed {
+		sl.logger.Info().Str("file", path).Msg("Removed old session log file")
+	}
+}
+
+func (sl *Logger) generateFilename() string {
+	return expandFilenameTemplate(sl.filename, filenameVars{
+		Hostname:   sl.hostname,
+		Connection: sl.connection,
+		Time:       sl.startTime,
+		Sequence:   sl.sequence,
+	})
+}
+
+func (sl *Logger) extension() string {
+	switch sl.format {
+	case FormatJSONL:
+		return ".jsonl"
+	case FormatBinary:
+		return ".mqcap"
+	}
+	return ".log"
+}
+
+// createUniqueFile creates base+extension in the output directory without overwriting
+// an existing file; on collision a numeric suffix is appended
+func (sl *Logger) createUniqueFile(base string) (*os.File, string, error) {
+	for attempt := 0; ; attempt++ {
+		name := base
+		if attempt > 0 {
+			name = fmt.Sprintf("%s_%d", base, attempt)
+		}
+		path := filepath.Join(sl.outputDir, name+sl.extension())
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return file, path, nil
+		}
+		if !os.IsExist(err) || attempt >= 1000 {
+			return nil, "", err
+		}
+	}
+}
+
+// Log writes a free-form text line to the session log
+func (sl *Logger) Log(message string) error {
+	if sl.shards != nil {
+		return sl.eachShard(func(shard *Logger) error { return shard.Log(message) })
+	}
+
+	record := sessionlog.Record{
+		Type:      sessionlog.TypeEvent,
+		Timestamp: time.Now(),
+		Event:     message,
+	}
+	if sl.structured() {
+		return sl.writeRecord(record)
+	}
+	return sl.writeText(message, record)
+}
+
+// writeText writes a timestamped text line; record describes it for statistics
+func (sl *Logger) writeText(message string, record sessionlog.Record) error {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if err := sl.prepareWrite(); err != nil {
+		return err
+	}
+
+	line := fmt.Sprintf("[%s] %s\n", sl.currentTime.Format("2006-01-02 15:04:05.000"), message)
+	n, err := sl.file.WriteString(line)
+	sl.fileSize += int64(n)
+	sl.stats.add(record, n)
+	if sl.tap != nil {
+		sl.tap([]byte(line))
+	}
+	return err
+}
+
+// LogMessage writes a received message to the session log in the configured format.
+// Messages excluded by the logging topic filters are skipped.
+func (sl *Logger) LogMessage(msg monitor.Message) error {
+	sl.mu.Lock()
+	topics := sl.topics
+	sl.mu.Unlock()
+	if sl.paused.Load() || !topics.Match(msg.Topic) {
+		return nil
+	}
+
+	if sl.shards != nil {
+		shard, err := sl.shardFor(msg.Topic)
+		if err != nil {
+			return err
+		}
+		return shard.LogMessage(msg)
+	}
+
+	record := NewMessageRecord(msg)
+	if sl.structured() {
+		return sl.writeRecord(record)
+	}
+
+	// The text format keeps the full topic and delivery flags; only the payload is sanitized
+	retained := ""
+	if msg.Retained {
+		retained = " retained"
+	}
+	return sl.writeText(fmt.Sprintf("[%s] %s (qos=%d%s): %s", msg.Source, msg.Topic, msg.QoS, retained, msg.Payload), record)
+}
+
+// LogEvent writes a connection event to the session log
+func (sl *Logger) LogEvent(event string) error {
+	if sl.shards != nil {
+		return sl.eachShard(func(shard *Logger) error { return shard.LogEvent(event) })
+	}
+
+	record := sessionlog.Record{
+		Type:      sessionlog.TypeEvent,
+		Timestamp: time.Now(),
+		Event:     event,
+	}
+	if sl.structured() {
+		return sl.writeRecord(record)
+	}
+	return sl.writeText(fmt.Sprintf("Connection event: %s", event), record)
+}
+
+// structured reports whether records are written as jsonl or binary capture
+func (sl *Logger) structured() bool {
+	return sl.format == FormatJSONL || sl.format == FormatBinary
+}
+
+func (sl *Logger) writeRecord(record sessionlog.Record) error {
+	data, err := sl.encodeRecord(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode session log record: %w", err)
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if err := sl.prepareWrite(); err != nil {
+		return err
+	}
+
+	n, err := sl.file.Write(data)
+	sl.fileSize += int64(n)
+	sl.stats.add(record, n)
+	sl.tapRecord(record, data)
+	return err
+}
+
+// SetPaused stops or resumes writing messages; connection events are still logged
+func (sl *Logger) SetPaused(paused bool) {
+	sl.paused.Store(paused)
+}
+
+// Paused reports whether message logging is paused
+func (sl *Logger) Paused() bool {
+	return sl.paused.Load()
+}
+
+// AddTopicFilter adds an include or exclude topic filter at runtime
+func (sl *Logger) AddTopicFilter(filter string, exclude bool) error {
+	if err := mqtt.ValidateTopicFilter(filter); err != nil {
+		return err
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	// Copy so readers holding the previous set are unaffected
+	topics := TopicFilterSet{
+		Include: slices.Clone(sl.topics.Include),
+		Exclude: slices.Clone(sl.topics.Exclude),
+	}
+	added := TopicFilterSet{
+		Include: slices.Clone(sl.added.Include),
+		Exclude: slices.Clone(sl.added.Exclude),
+	}
+	if exclude {
+		topics.Exclude = appendMissing(topics.Exclude, filter)
+		added.Exclude = appendMissing(added.Exclude, filter)
+	} else {
+		topics.Include = appendMissing(topics.Include, filter)
+		added.Include = appendMissing(added.Include, filter)
+	}
+	sl.topics, sl.added = topics, added
+	return nil
+}
+
+// AddedTopicFilters returns the filters added with AddTopicFilter
+func (sl *Logger) AddedTopicFilters() TopicFilterSet {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.added
+}
+
+// appendMissing appends the values not yet in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// SetTopicFilters replaces the configured logging topic filters, e.g. after a
+// configuration reload. Filters added at runtime stay in effect.
+func (sl *Logger) SetTopicFilters(topics TopicFilterSet) error {
+	for _, filter := range slices.Concat(topics.Include, topics.Exclude) {
+		if err := mqtt.ValidateTopicFilter(filter); err != nil {
+			return err
+		}
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.topics = TopicFilterSet{
+		Include: appendMissing(slices.Clone(topics.Include), sl.added.Include...),
+		Exclude: appendMissing(slices.Clone(topics.Exclude), sl.added.Exclude...),
+	}
+	return nil
+}
+
+// TopicFilters returns the active logging topic filters
+func (sl *Logger) TopicFilters() TopicFilterSet {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.topics
+}
+
+// SetTap registers a function receiving a copy of every line written to the log.
+// Binary capture records are passed on as jsonl so the stream stays readable.
+func (sl *Logger) SetTap(tap func([]byte)) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.tap = tap
+	for _, shard := range sl.shards {
+		shard.SetTap(tap)
+	}
+}
+
+// tapRecord passes an encoded record to the tap; caller must hold sl.mu
+func (sl *Logger) tapRecord(record sessionlog.Record, data []byte) {
+	if sl.tap == nil {
+		return
+	}
+	if sl.format == FormatBinary {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		data = append(encoded, '\n')
+	}
+	sl.tap(data)
+}
+
+func (sl *Logger) encodeRecord(record sessionlog.Record) ([]byte, error) {
+	if sl.format == FormatBinary {
+		return sessionlog.EncodeCapture(record)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// prepareWrite checks the logger state and rotates the file if needed; caller must hold sl.mu
+func (sl *Logger) prepareWrite() error {
+	if sl.closed {
+		return fmt.Errorf("session logger has been closed")
+	}
+
+	if sl.rotationDue(sl.startTime, sl.fileSize) {
+		if err := sl.rotateFile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotationDue reports whether a file started at start with size bytes must be rotated
+func (sl *Logger) rotationDue(start time.Time, size int64) bool {
+	if sl.maxSize > 0 && size >= sl.maxSize {
+		return true
+	}
+
+	switch sl.rotation {
+	case RotationDaily:
+		return !sameDay(start.Local(), sl.currentTime.Local())
+	case RotationDailyUTC:
+		return !sameDay(start.UTC(), sl.currentTime.UTC())
+	default:
+		return sl.currentTime.Sub(start) > sl.maxDuration
+	}
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func (sl *Logger) Close() error {
+	if sl.shards != nil {
+		return sl.closeShards()
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.closed {
+		return nil
+	}
+
+	sl.closed = true
+	sl.ticker.Stop()
+	sl.dirLock.Close()
+
+	return sl.closeFile()
+}
+
+// closeFile closes the active file and writes its manifest if enabled; caller must hold sl.mu
+func (sl *Logger) closeFile() error {
+	if sl.file == nil {
+		return nil
+	}
+
+	err := sl.file.Close()
+	sl.file = nil
+
+	if sl.checksums {
+		if _, manifestErr := writeManifest(sl.path, sl.format); manifestErr != nil {
+			sl.logger.Error().Err(manifestErr).Str("file", sl.path).Msg("Failed to write session log manifest")
+		}
+	}
+	if sl.summary {
+		if summaryErr := sl.stats.writeSummary(sl.path); summaryErr != nil {
+			sl.logger.Error().Err(summaryErr).Str("file", sl.path).Msg("Failed to write session log summary")
+		}
+	}
+	sl.stats = newLogStats()
+
+	return err
+}
@@ -0,0 +1,128 @@
+package sessionlogger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+)
+
+// manifestSuffix is appended to a session log path to name its sidecar manifest
+const manifestSuffix = ".manifest.json"
+
+// Manifest records the checksum and record count of a finished session log
+type Manifest struct {
+	File      string    `json:"file"`
+	SHA256    string    `json:"sha256"`
+	Bytes     int64     `json:"bytes"`
+	Records   int       `json:"records"`
+	Format    string    `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// writeManifest hashes a closed session log and writes its sidecar manifest
+func writeManifest(path, format string) (*Manifest, error) {
+	manifest, err := buildManifest(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+manifestSuffix, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func buildManifest(path, format string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	records, err := countLogRecords(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manifest{
+		File:      filepath.Base(path),
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		Bytes:     size,
+		Records:   records,
+		Format:    format,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// countLogRecords counts messages and events in a session log
+func countLogRecords(path, format string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	if format == FormatText {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), sessionlog.MaxRecordSize)
+		for scanner.Scan() {
+			count++
+		}
+		return count, scanner.Err()
+	}
+
+	err = sessionlog.Scan(file, func(sessionlog.Record) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// VerifyManifest recomputes the checksum and record count of a session log
+// and compares them with its manifest
+func VerifyManifest(path string) error {
+	data, err := os.ReadFile(path + manifestSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var expected Manifest
+	if err := json.Unmarshal(data, &expected); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	actual, err := buildManifest(path, expected.Format)
+	if err != nil {
+		return err
+	}
+
+	if actual.SHA256 != expected.SHA256 || actual.Bytes != expected.Bytes {
+		return fmt.Errorf("checksum mismatch: expected %s (%d bytes), got %s (%d bytes)",
+			expected.SHA256, expected.Bytes, actual.SHA256, actual.Bytes)
+	}
+	if actual.Records != expected.Records {
+		return fmt.Errorf("record count mismatch: expected %d, got %d", expected.Records, actual.Records)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package sessionlogger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy limits how many session logs are kept in the output directory.
+// Zero values disable the corresponding limit.
+type RetentionPolicy struct {
+	MaxAge       time.Duration
+	MaxFiles     int
+	MaxTotalSize int64
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.MaxAge > 0 || p.MaxFiles > 0 || p.MaxTotalSize > 0
+}
+
+type sessionLogFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// isSessionLogName reports whether a file name looks like a session log produced
+// from the filename template glob
+func isSessionLogName(name, glob string) bool {
+	ext := filepath.Ext(name)
+	if ext != ".log" && ext != ".jsonl" && ext != ".mqcap" {
+		return false
+	}
+	// Names may carry a collision suffix such as "_1"
+	base := strings.TrimSuffix(name, ext)
+	matched, _ := filepath.Match(glob, base)
+	if !matched {
+		matched, _ = filepath.Match(glob+"_*", base)
+	}
+	return matched
+}
+
+// listSessionLogs returns the session logs in dir matching glob, oldest first
+func listSessionLogs(dir, glob string) ([]sessionLogFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []sessionLogFile
+	for _, entry := range entries {
+		if entry.IsDir() || !isSessionLogName(entry.Name(), glob) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, sessionLogFile{
+			path:    filepath.Join(dir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	return files, nil
+}
+
+// applyRetention deletes the oldest session logs in dir matching glob until the policy
+// is satisfied. The file named by keep (the active log) is never removed, nor are
+// the active logs of other loggers and instances.
+// It returns the deleted paths.
+func applyRetention(dir, glob string, policy RetentionPolicy, keep string, now time.Time) ([]string, error) {
+	if !policy.enabled() {
+		return nil, nil
+	}
+
+	files, err := listSessionLogs(dir, glob)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalSize int64
+	for _, f := range files {
+		totalSize += f.size
+	}
+
+	var removed []string
+	remaining := len(files)
+	for _, f := range files {
+		if f.path == keep {
+			continue
+		}
+
+		expired := policy.MaxAge > 0 && now.Sub(f.modTime) > policy.MaxAge
+		tooMany := policy.MaxFiles > 0 && remaining > policy.MaxFiles
+		tooLarge := policy.MaxTotalSize > 0 && totalSize > policy.MaxTotalSize
+		if !expired && !tooMany && !tooLarge || sessionLogInUse(f.path) {
+			continue
+		}
+
+		if err := os.Remove(f.path); err != nil {
+			return removed, err
+		}
+		os.Remove(f.path + manifestSuffix)
+		os.Remove(f.path + summarySuffix)
+		removed = append(removed, f.path)
+		remaining--
+		totalSize -= f.size
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,99 @@
+package sessionlogger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Topic-prefix sharding: with session_log_shard_by_topic enabled the Logger
+// returned by New does not own a file. It routes every message to a
+// child logger per first topic level, created on demand, whose filenames are
+// prefixed with the shard name (e.g. site1_mqtt_monitor_20240115_143025.log).
+
+// shardName returns the shard for a topic: its first level, made filename-safe
+func shardName(topic string) string {
+	first, _, _ := strings.Cut(topic, "/")
+	if first == "" {
+		return "_root"
+	}
+	return sanitizeFilenamePart(first)
+}
+
+// shardFor returns the child logger for topic, creating it if needed
+func (sl *Logger) shardFor(topic string) (*Logger, error) {
+	name := shardName(topic)
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.closed {
+		return nil, fmt.Errorf("session logger has been closed")
+	}
+
+	if shard, ok := sl.shards[name]; ok {
+		return shard, nil
+	}
+
+	config := sl.config
+	config.ShardByTopic = false
+	config.Filename = name + "_" + config.Filename
+	config.Topics = TopicFilterSet{} // The router has already filtered
+
+	shard, err := New(config, sl.logger.With().Str("shard", name).Logger())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session log shard %s: %w", name, err)
+	}
+	if sl.ctx != nil {
+		shard.Start(sl.ctx)
+	}
+	shard.tap = sl.tap
+
+	sl.shards[name] = shard
+	return shard, nil
+}
+
+// eachShard calls fn for every open shard and returns the first error
+func (sl *Logger) eachShard(fn func(*Logger) error) error {
+	sl.mu.Lock()
+	shards := make([]*Logger, 0, len(sl.shards))
+	for _, shard := range sl.shards {
+		shards = append(shards, shard)
+	}
+	sl.mu.Unlock()
+
+	var firstErr error
+	for _, shard := range shards {
+		if err := fn(shard); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// rotateShards rotates every open shard and returns the new paths
+func (sl *Logger) rotateShards() (string, error) {
+	var paths []string
+	err := sl.eachShard(func(shard *Logger) error {
+		path, err := shard.Rotate()
+		if err == nil {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	return strings.Join(paths, ", "), err
+}
+
+// closeShards closes every open shard
+func (sl *Logger) closeShards() error {
+	sl.mu.Lock()
+	if sl.closed {
+		sl.mu.Unlock()
+		return nil
+	}
+	sl.closed = true
+	sl.ticker.Stop()
+	sl.mu.Unlock()
+
+	defer sl.dirLock.Close()
+	return sl.eachShard((*Logger).Close)
+}
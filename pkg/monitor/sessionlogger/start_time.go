@@ -0,0 +1,42 @@
+package sessionlogger
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+)
+
+// sessionLogStartTime returns the timestamp of the first record in a session log,
+// falling back to fallback when it cannot be determined
+func sessionLogStartTime(path string, fallback time.Time) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return fallback
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(path, ".log") {
+		// Text logs start with "[2006-01-02 15:04:05.000] "
+		line, err := bufio.NewReader(file).ReadString('\n')
+		if err != nil || len(line) < 25 || line[0] != '[' {
+			return fallback
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04:05.000", line[1:24], time.Local)
+		if err != nil {
+			return fallback
+		}
+		return start
+	}
+
+	start := fallback
+	errStop := errors.New("stop")
+	sessionlog.Scan(file, func(record sessionlog.Record) error {
+		start = record.Timestamp
+		return errStop
+	})
+	return start
+}
@@ -0,0 +1,88 @@
+package sessionlogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/sessionlog"
+)
+
+// summarySuffix is appended to a session log path to name its statistics summary
+const summarySuffix = ".summary.json"
+
+// logStats accumulates statistics for the active session log file.
+// Access is guarded by the owning Logger's mutex.
+type logStats struct {
+	Messages     int            `json:"messages"`
+	Events       int            `json:"events"`
+	Errors       int            `json:"errors"`
+	Bytes        int64          `json:"bytes"`
+	PayloadBytes int64          `json:"payload_bytes"`
+	First        time.Time      `json:"first,omitzero"`
+	Last         time.Time      `json:"last,omitzero"`
+	Topics       map[string]int `json:"topics"`
+	Connections  map[string]int `json:"connections"`
+}
+
+// logSummary is the document written next to a finished session log
+type logSummary struct {
+	File string `json:"file"`
+	*logStats
+}
+
+func newLogStats() *logStats {
+	return &logStats{
+		Topics:      make(map[string]int),
+		Connections: make(map[string]int),
+	}
+}
+
+// add counts a record that occupied n bytes in the log
+func (s *logStats) add(record sessionlog.Record, n int) {
+	s.Bytes += int64(n)
+
+	if s.First.IsZero() || record.Timestamp.Before(s.First) {
+		s.First = record.Timestamp
+	}
+	if record.Timestamp.After(s.Last) {
+		s.Last = record.Timestamp
+	}
+
+	if record.Type == sessionlog.TypeEvent {
+		s.Events++
+		if IsErrorEvent(record.Event) {
+			s.Errors++
+		}
+		return
+	}
+
+	s.Messages++
+	s.PayloadBytes += int64(len(record.RawPayload))
+	s.Topics[record.Topic]++
+	s.Connections[record.Source]++
+}
+
+// IsErrorEvent classifies connection events that indicate a problem
+func IsErrorEvent(event string) bool {
+	lower := strings.ToLower(event)
+	return strings.Contains(lower, "error") ||
+		strings.Contains(lower, "fail") ||
+		strings.Contains(lower, "lost") ||
+		strings.Contains(lower, "disconnected")
+}
+
+// writeSummary writes the statistics as a sidecar file of the session log at path
+func (s *logStats) writeSummary(path string) error {
+	data, err := json.MarshalIndent(logSummary{File: filepath.Base(path), logStats: s}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+summarySuffix, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
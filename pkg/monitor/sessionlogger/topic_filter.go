@@ -0,0 +1,30 @@
+package sessionlogger
+
+import "github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+
+// TopicFilterSet selects topics by include and exclude MQTT topic filters.
+// An empty include list matches every topic; excludes always win.
+type TopicFilterSet struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// Match reports whether topic passes the filter set
+func (f TopicFilterSet) Match(topic string) bool {
+	for _, filter := range f.Exclude {
+		if mqtt.TopicMatches(filter, topic) {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	for _, filter := range f.Include {
+		if mqtt.TopicMatches(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
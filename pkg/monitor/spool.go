@@ -0,0 +1,210 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SpoolPreviewSize is the number of payload bytes a spooled message keeps in memory
+	SpoolPreviewSize = 1024
+	// SpoolSegmentSize is the size beyond which a spool continues in a new file
+	SpoolSegmentSize = 64 << 20
+	// SpoolSegments is the number of files a spool keeps; the payloads in the
+	// oldest one are dropped when another one is needed
+	SpoolSegments = 4
+)
+
+// ErrSpoolExpired is returned for a spooled payload whose file was dropped to
+// bound the disk space of the spool, or removed by Close
+var ErrSpoolExpired = errors.New("spooled payload no longer available")
+
+// PayloadSpool keeps the full payloads of large messages in temporary files, so
+// the message buffers hold a preview of them instead of megabytes per message.
+// Message rings with a spool store the messages it returns from Store.
+type PayloadSpool struct {
+	mu        sync.Mutex
+	dir       string
+	threshold atomic.Int64    // Payloads above this many bytes are spooled, 0 for none
+	segments  []*spoolSegment // Oldest first
+	closed    bool
+
+	// The last spooled payload, so storing the same message in several rings, as
+	// the TUI and the monitor's buffer do, writes it once. It stays in memory
+	// until the next one is spooled.
+	lastData *byte
+	lastLen  int
+	last     *SpooledPayload
+}
+
+// spoolSegment is one file of a spool
+type spoolSegment struct {
+	file    *os.File
+	size    int64
+	expired atomic.Bool
+}
+
+// SpooledPayload references the full payload of a message in a PayloadSpool
+type SpooledPayload struct {
+	segment  *spoolSegment
+	offset   int64
+	Size     int // Raw payload bytes
+	textSize int // Bytes of the payload text after the raw bytes, 0 when the message keeps all of it
+}
+
+// NewPayloadSpool returns a spool writing payloads above threshold bytes to
+// files in dir, or the default directory for temporary files when dir is empty.
+// Files are created when the first payload is spooled.
+func NewPayloadSpool(dir string, threshold int64) *PayloadSpool {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	s := &PayloadSpool{dir: dir}
+	s.SetThreshold(threshold)
+	return s
+}
+
+// SetThreshold changes the payload size above which payloads are spooled, 0 to
+// stop spooling. Messages already spooled stay readable.
+func (s *PayloadSpool) SetThreshold(threshold int64) {
+	// A threshold below the preview would spool payloads without saving memory
+	if threshold > 0 && threshold < SpoolPreviewSize {
+		threshold = SpoolPreviewSize
+	}
+	s.threshold.Store(threshold)
+}
+
+// Store returns msg without its raw payload, and with a preview of a payload text
+// longer than SpoolPreviewSize, but a reference to them in the spool when the raw
+// payload is above the threshold, or msg itself. When writing fails, msg keeps
+// its payload in memory.
+func (s *PayloadSpool) Store(msg Message) Message {
+	threshold := s.threshold.Load()
+	if threshold == 0 || int64(len(msg.RawPayload)) <= threshold || msg.Spooled != nil {
+		return msg
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spooled := s.last
+	if &msg.RawPayload[0] != s.lastData || len(msg.RawPayload) != s.lastLen {
+		var err error
+		if spooled, err = s.write(msg.RawPayload, msg.Payload); err != nil {
+			log.Warn().Err(err).Str("topic", msg.Topic).Msg("Keeping payload in memory")
+			return msg
+		}
+		s.lastData, s.lastLen, s.last = &msg.RawPayload[0], len(msg.RawPayload), spooled
+	}
+
+	if spooled.textSize > 0 {
+		msg.Payload = payloadPreview(msg.Payload)
+	}
+	msg.RawPayload = nil
+	msg.Spooled = spooled
+	return msg
+}
+
+// write appends raw and, when it is too long to keep, text to the current segment
+func (s *PayloadSpool) write(raw []byte, text string) (*SpooledPayload, error) {
+	if s.closed {
+		return nil, ErrSpoolExpired
+	}
+	spooled := &SpooledPayload{Size: len(raw)}
+	if len(text) > SpoolPreviewSize {
+		spooled.textSize = len(text)
+	}
+
+	segment, err := s.currentSegment()
+	if err != nil {
+		return nil, err
+	}
+	spooled.segment, spooled.offset = segment, segment.size
+	if _, err := segment.file.WriteAt(raw, segment.size); err != nil {
+		return nil, fmt.Errorf("failed to write payload spool: %w", err)
+	}
+	segment.size += int64(len(raw))
+	if spooled.textSize > 0 {
+		if _, err := segment.file.WriteAt([]byte(text), segment.size); err != nil {
+			return nil, fmt.Errorf("failed to write payload spool: %w", err)
+		}
+		segment.size += int64(len(text))
+	}
+	return spooled, nil
+}
+
+// currentSegment returns the segment to write to, starting a new one, and
+// dropping the oldest, when the current one is full
+func (s *PayloadSpool) currentSegment() (*spoolSegment, error) {
+	if n := len(s.segments); n > 0 && s.segments[n-1].size < SpoolSegmentSize {
+		return s.segments[n-1], nil
+	}
+
+	file, err := os.CreateTemp(s.dir, "mqtt-monitor-spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payload spool: %w", err)
+	}
+	if len(s.segments) == SpoolSegments {
+		s.segments[0].remove()
+		s.segments = s.segments[1:]
+	}
+	segment := &spoolSegment{file: file}
+	s.segments = append(s.segments, segment)
+	return segment, nil
+}
+
+// Close removes the spool files. Spooled payloads can no longer be read, and
+// messages are no longer spooled.
+func (s *PayloadSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, segment := range s.segments {
+		errs = append(errs, segment.remove())
+	}
+	s.segments = nil
+	s.closed = true
+	s.lastData, s.last = nil, nil
+	return errors.Join(errs...)
+}
+
+// remove expires the payloads of the segment and deletes its file
+func (seg *spoolSegment) remove() error {
+	seg.expired.Store(true)
+	return errors.Join(seg.file.Close(), os.Remove(seg.file.Name()))
+}
+
+// Load reads the raw payload back from the spool, and the payload text when the
+// message only kept a preview of it, or else returns an empty text
+func (p *SpooledPayload) Load() (raw []byte, text string, err error) {
+	if p.segment.expired.Load() {
+		return nil, "", ErrSpoolExpired
+	}
+	buf := make([]byte, p.Size+p.textSize)
+	if _, err := p.segment.file.ReadAt(buf, p.offset); err != nil {
+		if p.segment.expired.Load() {
+			return nil, "", ErrSpoolExpired
+		}
+		return nil, "", fmt.Errorf("failed to read payload spool: %w", err)
+	}
+	return buf[:p.Size], string(buf[p.Size:]), nil
+}
+
+// payloadPreview returns the start of a payload text, cut at a character boundary
+func payloadPreview(text string) string {
+	if len(text) <= SpoolPreviewSize {
+		return text
+	}
+	cut := SpoolPreviewSize
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
@@ -0,0 +1,396 @@
+package monitor
+
+import (
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rawrobot/tui-mqtt-monitor/internal/mqtt"
+)
+
+const (
+	// MaxTrackedTopics caps the per-topic statistics so a topic explosion cannot exhaust memory
+	MaxTrackedTopics = 10000
+	rateWindow       = 60 // Seconds of history used for the message rate
+)
+
+// TopicStats holds the counters for a single topic
+type TopicStats struct {
+	Topic    string    `json:"topic"`
+	Messages uint64    `json:"messages"`
+	Bytes    uint64    `json:"bytes"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Stats is a snapshot of the monitor's counters
+type Stats struct {
+	StartTime      time.Time         `json:"start_time"`
+	Uptime         string            `json:"uptime"`
+	Messages       uint64            `json:"messages"`
+	Errors         uint64            `json:"errors"`
+	Bytes          uint64            `json:"bytes"`
+	RatePerSecond  float64           `json:"rate_per_second"` // Averaged over the last minute
+	Topics         int               `json:"topics"`
+	UntrackedTopic uint64            `json:"untracked_messages,omitempty"`
+	Sources        map[string]uint64 `json:"sources"`
+	TopTopics      []TopicStats      `json:"top_topics"`
+}
+
+// MessageQuery selects messages from the recent message buffer
+type MessageQuery struct {
+	Topic  string    // MQTT topic filter, wildcards allowed
+	Source string    // Connection name
+	Text   string    // Case-insensitive payload substring
+	Since  time.Time // Only messages received at or after this time
+	Limit  int       // Maximum number of (newest) messages to return
+}
+
+// Match reports whether msg passes the topic, source, text and since filters
+func (q MessageQuery) Match(msg Message) bool {
+	if q.Topic != "" && !mqtt.TopicMatches(q.Topic, msg.Topic) {
+		return false
+	}
+	if q.Source != "" && msg.Source != q.Source {
+		return false
+	}
+	if !q.Since.IsZero() && msg.Timestamp.Before(q.Since) {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(msg.Payload), strings.ToLower(q.Text)) {
+		return false
+	}
+	return true
+}
+
+// State collects what a running monitor has seen so it can be
+// inspected from outside the UI
+type State struct {
+	recent    *MessageRing
+	last      *lastValues
+	sequences sequences
+
+	clientsMu sync.RWMutex
+	clients   []*Client
+
+	mu        sync.Mutex
+	startTime time.Time
+	messages  uint64
+	errors    uint64
+	bytes     uint64
+	untracked uint64
+	topics    map[string]*TopicStats
+	sources   map[string]uint64
+	buckets   [rateWindow]uint64
+	bucketAt  [rateWindow]int64
+
+	dropCounters map[string]func() uint64 // Drop points added by AddDropCounter, protected by mu
+
+	messageSubs broadcaster[Message]
+	eventSubs   broadcaster[Event]
+}
+
+// Event is a connection status change or error shown in the status view
+type Event struct {
+	Timestamp time.Time
+	Message   string
+	Severity  Severity
+}
+
+// broadcaster fans values out to subscriber channels without ever blocking the sender
+type broadcaster[T any] struct {
+	mu          sync.RWMutex
+	subscribers map[chan T]struct{}
+	dropped     atomic.Uint64
+}
+
+func (b *broadcaster[T]) subscribe(buffer int) (<-chan T, func()) {
+	ch := make(chan T, buffer)
+
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan T]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (b *broadcaster[T]) publish(value T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- value:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+func NewState(clients []*Client, capacity int) *State {
+	return &State{
+		recent:    NewMessageRing(capacity),
+		last:      newLastValues(MaxLastValues),
+		clients:   clients,
+		startTime: time.Now(),
+		topics:    make(map[string]*TopicStats),
+		sources:   make(map[string]uint64),
+	}
+}
+
+// SetMemoryLimit caps the total size of the recent message buffer in bytes, 0 for
+// no limit besides its capacity
+func (s *State) SetMemoryLimit(limit int64) {
+	s.recent.SetMaxBytes(limit)
+}
+
+// SetPayloadSpool makes the recent message buffer and the last values keep large
+// payloads in spool, nil to keep them in memory. Subscribers still receive the
+// full messages.
+func (s *State) SetPayloadSpool(spool *PayloadSpool) {
+	s.recent.SetSpool(spool)
+	s.last.spool.Store(spool)
+}
+
+// SetSequenceRules makes CheckSequence count the sequence numbers of the topics
+// matching rules, replacing the rules of an earlier call. Topics already counted
+// keep their counts.
+func (s *State) SetSequenceRules(rules []SequenceRule) error {
+	return s.sequences.setRules(rules)
+}
+
+// CheckSequence counts the sequence number of msg when a sequence rule matches
+// its topic, and returns a *SequenceIssue, a warning, when it skips numbers or
+// goes back
+func (s *State) CheckSequence(msg Message) error {
+	if issue := s.sequences.check(msg); issue != nil {
+		return issue
+	}
+	return nil
+}
+
+// Sequences returns the sequence counts of the topics matching the sequence
+// rules, those with the most lost messages first. Up to MaxTrackedTopics topics
+// are counted.
+func (s *State) Sequences() []SequenceStats {
+	return s.sequences.snapshot()
+}
+
+// Subscribe returns a channel receiving every new message and a function that
+// ends the subscription. Messages are dropped for subscribers that fall behind
+// by more than buffer messages, so a slow consumer never stalls the monitor.
+func (s *State) Subscribe(buffer int) (<-chan Message, func()) {
+	return s.messageSubs.subscribe(buffer)
+}
+
+// SubscribeEvents is like Subscribe for connection events and errors
+func (s *State) SubscribeEvents(buffer int) (<-chan Event, func()) {
+	return s.eventSubs.subscribe(buffer)
+}
+
+// Dropped returns how many messages and events subscribers missed because they fell behind
+func (s *State) Dropped() uint64 {
+	return s.messageSubs.dropped.Load() + s.eventSubs.dropped.Load()
+}
+
+// AddDropCounter adds a drop point outside the monitor, such as the queue of a
+// view, to Drops. A counter added again under the same name replaces the first.
+func (s *State) AddDropCounter(name string, count func() uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropCounters == nil {
+		s.dropCounters = make(map[string]func() uint64)
+	}
+	s.dropCounters[name] = count
+}
+
+// Drops returns the messages and events lost at each drop point: those of the
+// connections summed up, DropSubscriber and the counters of AddDropCounter
+func (s *State) Drops() map[string]uint64 {
+	drops := map[string]uint64{DropSubscriber: s.Dropped()}
+	for _, status := range s.Connections() {
+		for name, count := range status.Drops {
+			drops[name] += count
+		}
+	}
+
+	s.mu.Lock()
+	counters := maps.Clone(s.dropCounters)
+	s.mu.Unlock()
+	for name, count := range counters {
+		drops[name] += count()
+	}
+	return drops
+}
+
+// RecordMessage adds a message to the recent buffer, the last values and the
+// counters and forwards it to subscribers
+func (s *State) RecordMessage(msg Message) {
+	s.recent.Add(msg)
+	s.last.record(msg)
+	s.messageSubs.publish(msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := uint64(len(msg.RawPayload))
+	s.messages++
+	s.bytes += size
+	s.sources[msg.Source]++
+
+	now := time.Now().Unix()
+	slot := now % rateWindow
+	if s.bucketAt[slot] != now {
+		s.bucketAt[slot] = now
+		s.buckets[slot] = 0
+	}
+	s.buckets[slot]++
+
+	ts, ok := s.topics[msg.Topic]
+	if !ok {
+		if len(s.topics) >= MaxTrackedTopics {
+			s.untracked++
+			return
+		}
+		ts = &TopicStats{Topic: msg.Topic}
+		s.topics[msg.Topic] = ts
+	}
+	ts.Messages++
+	ts.Bytes += size
+	ts.LastSeen = msg.Timestamp
+}
+
+// RecordEvent forwards an error or status event to event subscribers, counting
+// it as an error when it has error severity, as notices and warnings have not
+func (s *State) RecordEvent(event error) {
+	if SeverityOf(event) == SeverityError {
+		s.mu.Lock()
+		s.errors++
+		s.mu.Unlock()
+	}
+
+	s.eventSubs.publish(Event{Timestamp: time.Now(), Message: event.Error(), Severity: SeverityOf(event)})
+}
+
+// RecordConnectionEvent counts a lost or failed connection as an error and
+// forwards the event to event subscribers
+func (s *State) RecordConnectionEvent(event ConnectionEvent) {
+	if event.Severity() == SeverityError {
+		s.mu.Lock()
+		s.errors++
+		s.mu.Unlock()
+	}
+
+	s.eventSubs.publish(Event{Timestamp: event.Time, Message: event.String(), Severity: event.Severity()})
+}
+
+// SetClients replaces the monitored connections, e.g. after a configuration reload
+func (s *State) SetClients(clients []*Client) {
+	s.clientsMu.Lock()
+	s.clients = clients
+	s.clientsMu.Unlock()
+}
+
+// ConnectionCount returns the number of configured connections
+func (s *State) ConnectionCount() int {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return len(s.clients)
+}
+
+// Connections returns the status of every configured connection
+func (s *State) Connections() []ConnectionStatus {
+	s.clientsMu.RLock()
+	clients := s.clients
+	s.clientsMu.RUnlock()
+
+	statuses := make([]ConnectionStatus, 0, len(clients))
+	for _, client := range clients {
+		statuses = append(statuses, client.Status())
+	}
+	return statuses
+}
+
+// Stats returns a snapshot of the counters with the topN busiest topics
+func (s *State) Stats(topN int) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{
+		StartTime:      s.startTime,
+		Uptime:         time.Since(s.startTime).Round(time.Second).String(),
+		Messages:       s.messages,
+		Errors:         s.errors,
+		Bytes:          s.bytes,
+		Topics:         len(s.topics),
+		UntrackedTopic: s.untracked,
+		Sources:        make(map[string]uint64, len(s.sources)),
+	}
+	for source, count := range s.sources {
+		stats.Sources[source] = count
+	}
+
+	// Average over complete seconds only, so the rate does not dip at the start of each second
+	now := time.Now().Unix()
+	window := min(int64(rateWindow), max(now-s.startTime.Unix(), 1))
+	var recent uint64
+	for i := range s.buckets {
+		if age := now - s.bucketAt[i]; age > 0 && age <= window {
+			recent += s.buckets[i]
+		}
+	}
+	stats.RatePerSecond = float64(recent) / float64(window)
+
+	stats.TopTopics = make([]TopicStats, 0, len(s.topics))
+	for _, ts := range s.topics {
+		stats.TopTopics = append(stats.TopTopics, *ts)
+	}
+	sort.Slice(stats.TopTopics, func(i, j int) bool {
+		if stats.TopTopics[i].Messages != stats.TopTopics[j].Messages {
+			return stats.TopTopics[i].Messages > stats.TopTopics[j].Messages
+		}
+		return stats.TopTopics[i].Topic < stats.TopTopics[j].Topic
+	})
+	if topN >= 0 && len(stats.TopTopics) > topN {
+		stats.TopTopics = stats.TopTopics[:topN]
+	}
+
+	return stats
+}
+
+// LastValues returns the newest message of every topic and connection matching
+// the topic filter, or of all of them for an empty filter, ordered by topic. Up
+// to MaxLastValues topics are kept, whether or not their messages are still in
+// the recent buffer.
+func (s *State) LastValues(filter string) []Message {
+	return s.last.match(filter)
+}
+
+// Messages returns the newest buffered messages matching q, oldest first
+func (s *State) Messages(q MessageQuery) []Message {
+	var matched []Message
+	s.recent.Each(func(msg Message) bool {
+		if q.Match(msg) {
+			matched = append(matched, msg)
+		}
+		return true
+	})
+
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[len(matched)-q.Limit:]
+	}
+	return matched
+}